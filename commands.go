@@ -0,0 +1,733 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/validation"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// setupCommands registers the Pockestrator subcommands on the root command
+func (p *PocketstratorApp) setupCommands() {
+	commands := []*cobra.Command{
+		p.newDiscoverCommand(),
+		p.newApplyCommand(),
+		p.newServicesCommand(),
+		p.newValidateCommand(),
+		p.newVersionsCommand(),
+	}
+
+	for _, command := range commands {
+		// Only serve applies the app migrations, which the commands need as much as the API
+		command.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+			return p.app.RunAllMigrations()
+		}
+		p.app.RootCmd.AddCommand(command)
+	}
+
+	p.app.RootCmd.AddCommand(newRemoteCommand())
+}
+
+// cliContext returns a context recording the operations it is passed to as performed by
+// the local user running the command
+func cliContext() context.Context {
+	name := "cli"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	return pkg.WithActor(context.Background(), pkg.Actor{Name: name, Source: "cli"})
+}
+
+// newDiscoverCommand creates the command that finds and adopts existing PocketBase deployments
+func (p *PocketstratorApp) newDiscoverCommand() *cobra.Command {
+	var importServices bool
+	var assumeYes bool
+
+	command := &cobra.Command{
+		Use:          "discover",
+		Short:        "Find PocketBase instances deployed outside Pockestrator and optionally import them",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cliContext()
+
+			discovered, err := p.orchestrator.DiscoverServices(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(discovered) == 0 {
+				fmt.Println("No pocketbase services found")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROJECT\tPORT\tVERSION\tSITE\tSYSTEMD\tSTATE")
+			for _, svc := range discovered {
+				state := "importable"
+				if svc.Managed {
+					state = "managed"
+				} else if !svc.Importable {
+					state = "error: " + strings.Join(svc.Errors, "; ")
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
+					svc.ProjectName, svc.Port, svc.PocketBaseVersion, svc.CaddySite, svc.SystemdStatus, state)
+			}
+			w.Flush()
+
+			if !importServices {
+				return nil
+			}
+
+			reader := bufio.NewReader(os.Stdin)
+			var selected []string
+			for _, svc := range discovered {
+				if !svc.Importable {
+					continue
+				}
+
+				for _, warning := range svc.Warnings {
+					fmt.Printf("⚠️  %s: %s\n", svc.ProjectName, warning)
+				}
+
+				if !assumeYes {
+					fmt.Printf("Import %s (port %d)? [y/N] ", svc.ProjectName, svc.Port)
+					answer, _ := reader.ReadString('\n')
+					answer = strings.ToLower(strings.TrimSpace(answer))
+					if answer != "y" && answer != "yes" {
+						continue
+					}
+				}
+
+				selected = append(selected, svc.ProjectName)
+			}
+
+			if len(selected) == 0 {
+				fmt.Println("Nothing to import")
+				return nil
+			}
+
+			results, err := p.orchestrator.ImportServices(ctx, selected, "cli")
+			if err != nil {
+				return err
+			}
+
+			for _, result := range results {
+				fmt.Printf("%s: %s (%s)\n", result.ProjectName, result.Status, result.Message)
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&importServices, "import", false, "import the discovered services as records")
+	command.Flags().BoolVarP(&assumeYes, "yes", "y", false, "import every importable service without prompting")
+
+	return command
+}
+
+// newApplyCommand creates the command that brings the services in line with a manifest
+func (p *PocketstratorApp) newApplyCommand() *cobra.Command {
+	var file string
+	var prune bool
+	var planOnly bool
+	var timeout time.Duration
+
+	command := &cobra.Command{
+		Use:          "apply",
+		Short:        "Create, update and optionally delete services to match a YAML or JSON manifest",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if file == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read manifest: %w", err)
+			}
+
+			manifest, err := pkg.ParseManifest(data)
+			if err != nil {
+				return err
+			}
+
+			ctx := cliContext()
+			result, err := p.orchestrator.ApplyManifest(ctx, manifest, pkg.ApplyOptions{
+				Prune:     prune,
+				DryRun:    planOnly,
+				CreatedBy: "cli",
+			})
+			if err != nil {
+				return err
+			}
+
+			// The deploys run in this process, so they have to finish before the command exits
+			if !planOnly {
+				p.waitForApply(ctx, result, timeout)
+			}
+
+			printApplyResult(result)
+
+			if result.Failed > 0 {
+				return fmt.Errorf("%d of %d actions failed", result.Failed, len(result.Actions))
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVarP(&file, "file", "f", "", "manifest file, or - to read standard input")
+	command.Flags().BoolVar(&prune, "prune", false, "delete services that are not in the manifest")
+	command.Flags().BoolVar(&planOnly, "plan", false, "only print what would change")
+	command.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "how long to wait for each deploy")
+	command.MarkFlagRequired("file")
+
+	return command
+}
+
+// newServicesCommand creates the command group that manages services in-process
+func (p *PocketstratorApp) newServicesCommand() *cobra.Command {
+	var asJSON bool
+
+	command := &cobra.Command{
+		Use:   "services",
+		Short: "List, create, delete and control services",
+	}
+	command.PersistentFlags().BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+
+	command.AddCommand(
+		p.newServicesListCommand(&asJSON),
+		p.newServicesCreateCommand(&asJSON),
+		p.newServicesUpdateCommand(&asJSON),
+		p.newServicesDeleteCommand(&asJSON),
+		p.newServicesLogsCommand(&asJSON),
+		p.newServicesStatusCommand(&asJSON),
+	)
+	for _, action := range []string{"start", "stop", "restart"} {
+		command.AddCommand(p.newServicesControlCommand(action, &asJSON))
+	}
+
+	return command
+}
+
+func (p *PocketstratorApp) newServicesListCommand(asJSON *bool) *cobra.Command {
+	return &cobra.Command{
+		Use:          "list",
+		Short:        "List the managed services",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			services, err := p.orchestrator.ListServices(context.Background())
+			if err != nil {
+				return err
+			}
+
+			if *asJSON {
+				return printJSON(map[string]any{"services": services, "total": len(services)})
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tPROJECT\tPORT\tVERSION\tDOMAIN\tSTATUS")
+			for _, svc := range services {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n",
+					svc.ID, svc.ProjectName, svc.Port, svc.PocketBaseVersion, svc.Domain, svc.Status)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func (p *PocketstratorApp) newServicesCreateCommand(asJSON *bool) *cobra.Command {
+	var req pkg.ServiceRequest
+	var timeout time.Duration
+
+	command := &cobra.Command{
+		Use:          "create <project-name>",
+		Short:        "Create and deploy a service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cliContext()
+			req.ProjectName = args[0]
+			req.CreatedBy = "cli"
+
+			response, err := p.orchestrator.CreateService(ctx, &req)
+			if err != nil {
+				return err
+			}
+			if response.Status == "error" {
+				if *asJSON {
+					printJSON(response)
+				} else {
+					printValidationErrors(response.Errors)
+				}
+				return fmt.Errorf("%s", strings.ToLower(response.Message))
+			}
+
+			// The deploy runs in this process, so it has to finish before the command exits
+			serviceRecord, err := p.waitForDeployment(ctx, response.ID, timeout)
+			if err != nil {
+				return err
+			}
+
+			if *asJSON {
+				if err := printJSON(serviceRecord); err != nil {
+					return err
+				}
+			} else {
+				fmt.Printf("%s: %s on port %d (%s.%s)\n",
+					serviceRecord.ProjectName, serviceRecord.Status, serviceRecord.Port, serviceRecord.ProjectName, serviceRecord.Domain)
+			}
+
+			if serviceRecord.Status == "error" {
+				return fmt.Errorf("deployment of %s failed, see the logs for details", serviceRecord.ProjectName)
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().IntVar(&req.Port, "port", 0, "port to listen on, allocated when omitted")
+	command.Flags().StringVar(&req.PocketBaseVersion, "version", "", "PocketBase version, the latest when omitted")
+	command.Flags().StringVar(&req.Domain, "domain", "", "domain the service is served under")
+	command.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "how long to wait for the deploy")
+
+	return command
+}
+
+func (p *PocketstratorApp) newServicesUpdateCommand(asJSON *bool) *cobra.Command {
+	var req pkg.ServiceUpdateRequest
+	var timeout time.Duration
+
+	command := &cobra.Command{
+		Use:          "update <service>",
+		Short:        "Change the port, domain, version or serve flags of a service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cliContext()
+
+			serviceRecord, err := p.orchestrator.FindService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			// An empty --flag= clears the serve flags
+			if cmd.Flags().Changed("flag") {
+				req.ServeFlags = slices.DeleteFunc(req.ServeFlags, func(flag string) bool { return flag == "" })
+			}
+
+			response, err := p.orchestrator.UpdateService(ctx, serviceRecord.ID, &req)
+			if err != nil {
+				return err
+			}
+			if response.Status == "error" || response.Data.Status != "deploying" {
+				if !*asJSON {
+					printValidationErrors(response.Errors)
+				}
+				return printResponse(response, *asJSON)
+			}
+
+			// The update runs in this process, so it has to finish before the command exits
+			serviceRecord, err = p.waitForDeployment(ctx, serviceRecord.ID, timeout)
+			if err != nil {
+				return err
+			}
+
+			return printUpdateOutcome(&req, serviceRecord, *asJSON)
+		},
+	}
+
+	command.Flags().IntVar(&req.Port, "port", 0, "new port")
+	command.Flags().StringVar(&req.PocketBaseVersion, "version", "", "PocketBase version to switch to")
+	command.Flags().StringVar(&req.Domain, "domain", "", "new domain")
+	command.Flags().StringArrayVar(&req.ServeFlags, "flag", nil, "extra \"pocketbase serve\" argument, repeatable; --flag= clears them")
+	command.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "how long to wait for the update")
+
+	return command
+}
+
+func (p *PocketstratorApp) newServicesDeleteCommand(asJSON *bool) *cobra.Command {
+	var assumeYes bool
+
+	command := &cobra.Command{
+		Use:          "delete <service>",
+		Short:        "Delete a service with its unit, Caddy site and files",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cliContext()
+
+			serviceRecord, err := p.orchestrator.FindService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if !assumeYes {
+				fmt.Printf("Delete %s and all of its data? [y/N] ", serviceRecord.ProjectName)
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				answer = strings.ToLower(strings.TrimSpace(answer))
+				if answer != "y" && answer != "yes" {
+					return fmt.Errorf("aborted")
+				}
+			}
+
+			response, err := p.orchestrator.DeleteService(ctx, serviceRecord.ID)
+			if err != nil {
+				return err
+			}
+
+			return printResponse(response, *asJSON)
+		},
+	}
+
+	command.Flags().BoolVarP(&assumeYes, "yes", "y", false, "delete without prompting")
+
+	return command
+}
+
+func (p *PocketstratorApp) newServicesControlCommand(action string, asJSON *bool) *cobra.Command {
+	return &cobra.Command{
+		Use:          action + " <service>",
+		Short:        fmt.Sprintf("%s a service", strings.ToUpper(action[:1])+action[1:]),
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cliContext()
+
+			serviceRecord, err := p.orchestrator.FindService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			response, err := p.orchestrator.ControlService(ctx, serviceRecord.ID, action)
+			if err != nil {
+				return err
+			}
+
+			return printResponse(response, *asJSON)
+		},
+	}
+}
+
+func (p *PocketstratorApp) newServicesLogsCommand(asJSON *bool) *cobra.Command {
+	var lines int
+
+	command := &cobra.Command{
+		Use:          "logs <service>",
+		Short:        "Print the journal of a service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			serviceRecord, err := p.orchestrator.FindService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			logs, err := p.orchestrator.GetServiceLogs(ctx, serviceRecord.ID, lines)
+			if err != nil {
+				return err
+			}
+
+			if *asJSON {
+				return printJSON(logs)
+			}
+
+			for _, line := range logs.Logs {
+				fmt.Println(line)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().IntVarP(&lines, "lines", "n", 100, "number of lines to print")
+
+	return command
+}
+
+func (p *PocketstratorApp) newServicesStatusCommand(asJSON *bool) *cobra.Command {
+	return &cobra.Command{
+		Use:          "status <service>",
+		Short:        "Check the health of a service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			serviceRecord, err := p.orchestrator.FindService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			status, err := p.orchestrator.GetServiceStatus(ctx, serviceRecord.ID)
+			if err != nil {
+				return err
+			}
+
+			if *asJSON {
+				return printJSON(status)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Service\t%s (%s)\n", serviceRecord.ProjectName, serviceRecord.ID)
+			fmt.Fprintf(w, "Running\t%t\n", status.IsRunning)
+			fmt.Fprintf(w, "Systemd\t%s\n", status.SystemdStatus)
+			fmt.Fprintf(w, "Caddy\t%s\n", status.CaddyStatus)
+			fmt.Fprintf(w, "Config match\t%t\n", status.ConfigMatch)
+			if status.Verdict != "" {
+				fmt.Fprintf(w, "Verdict\t%s\n", status.Verdict)
+			}
+			if status.ErrorMessage != "" {
+				fmt.Fprintf(w, "Error\t%s\n", status.ErrorMessage)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// newValidateCommand creates the command group that runs validations
+func (p *PocketstratorApp) newValidateCommand() *cobra.Command {
+	var asJSON bool
+
+	command := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the host",
+	}
+	command.PersistentFlags().BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+
+	command.AddCommand(&cobra.Command{
+		Use:          "system",
+		Short:        "Check that systemd, Caddy and the configured directories are usable",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result := p.orchestrator.ValidateSystemRequirements()
+
+			if asJSON {
+				if err := printJSON(result); err != nil {
+					return err
+				}
+			} else if len(result.Errors) == 0 && len(result.Warnings) == 0 {
+				fmt.Println("System requirements met")
+			} else {
+				printValidationErrors(result.Errors)
+				for _, warning := range result.Warnings {
+					fmt.Printf("⚠️  %s: %s (%s)\n", warning.Field, warning.Message, warning.Code)
+				}
+			}
+
+			if !result.IsValid {
+				return fmt.Errorf("system requirements not met")
+			}
+			return nil
+		},
+	})
+
+	return command
+}
+
+// newVersionsCommand creates the command that compares the PocketBase versions services run
+func (p *PocketstratorApp) newVersionsCommand() *cobra.Command {
+	var asJSON bool
+
+	command := &cobra.Command{
+		Use:          "versions",
+		Short:        "Show the latest PocketBase release and the version each service runs",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := p.orchestrator.GetVersions(context.Background())
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				return printJSON(report)
+			}
+
+			fmt.Printf("Latest PocketBase release: %s\n\n", report.Latest)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROJECT\tRECORDED\tINSTALLED\tNOTE")
+			for _, svc := range report.Services {
+				installed := svc.Installed
+				note := ""
+				switch {
+				case svc.Error != "":
+					installed = "-"
+					note = svc.Error
+				case svc.Installed != svc.Recorded:
+					note = "differs from record"
+				case svc.Installed != report.Latest:
+					note = "update available"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", svc.ProjectName, svc.Recorded, installed, note)
+			}
+			return w.Flush()
+		},
+	}
+
+	command.Flags().BoolVar(&asJSON, "json", false, "print JSON instead of a table")
+
+	return command
+}
+
+// waitForDeployment polls a service until it leaves the deploying status
+func (p *PocketstratorApp) waitForDeployment(ctx context.Context, id string, timeout time.Duration) (*database.ServiceRecord, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		response, err := p.orchestrator.GetService(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if response.Data.Status != "deploying" {
+			return response.Data, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is still deploying after %s", response.Data.ProjectName, timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// waitForApply waits for the deploys a manifest apply started and records how each one
+// ended, counting the failures in result.Failed
+func (p *PocketstratorApp) waitForApply(ctx context.Context, result *pkg.ApplyResult, timeout time.Duration) {
+	for _, action := range result.Actions {
+		if action.Status != "deploying" {
+			continue
+		}
+
+		serviceRecord, err := p.waitForDeployment(ctx, action.ServiceID, timeout)
+		switch {
+		case err != nil:
+			action.Status, action.Error = "error", err.Error()
+		case serviceRecord.Status == "error":
+			action.Status, action.Error = "error", "deployment failed, see the logs for details"
+		case applyRolledBack(action, serviceRecord):
+			action.Status, action.Error = "error", "failed its health check and was rolled back"
+		default:
+			action.Status = serviceRecord.Status
+			continue
+		}
+		result.Failed++
+	}
+}
+
+// applyRolledBack reports whether an update action's version, port or domain change was
+// rolled back
+func applyRolledBack(action *pkg.PlanAction, serviceRecord *database.ServiceRecord) bool {
+	for _, change := range action.Changes {
+		switch change.Field {
+		case "version":
+			if change.To != serviceRecord.PocketBaseVersion {
+				return true
+			}
+		case "port":
+			if change.To != serviceRecord.Port {
+				return true
+			}
+		case "domain":
+			if change.To != serviceRecord.Domain {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printResponse prints a service operation response as JSON or its message
+func printResponse(response *pkg.ServiceResponse, asJSON bool) error {
+	if asJSON {
+		if err := printJSON(response); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println(response.Message)
+	}
+
+	if response.Status == "error" {
+		return fmt.Errorf("%s", strings.ToLower(response.Message))
+	}
+	return nil
+}
+
+// printUpdateOutcome prints a service after an update finished, and fails when the update
+// was rolled back or left the service in error
+func printUpdateOutcome(req *pkg.ServiceUpdateRequest, serviceRecord *database.ServiceRecord, asJSON bool) error {
+	if asJSON {
+		if err := printJSON(serviceRecord); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%s: %s on port %d (%s.%s), PocketBase %s\n", serviceRecord.ProjectName, serviceRecord.Status,
+			serviceRecord.Port, serviceRecord.ProjectName, serviceRecord.Domain, serviceRecord.PocketBaseVersion)
+	}
+
+	rolledBack := (req.Port != 0 && req.Port != serviceRecord.Port) ||
+		(req.Domain != "" && req.Domain != serviceRecord.Domain) ||
+		(req.PocketBaseVersion != "" && req.PocketBaseVersion != serviceRecord.PocketBaseVersion)
+
+	switch {
+	case serviceRecord.Status == "error":
+		return fmt.Errorf("update of %s failed, see the logs for details", serviceRecord.ProjectName)
+	case rolledBack:
+		return fmt.Errorf("update of %s failed its health check and was rolled back", serviceRecord.ProjectName)
+	}
+	return nil
+}
+
+// printApplyResult prints the actions of a manifest apply or plan as a table
+func printApplyResult(result *pkg.ApplyResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tSERVICE\tCHANGES\tSTATUS")
+	for _, action := range result.Actions {
+		changes := make([]string, len(action.Changes))
+		for i, change := range action.Changes {
+			changes[i] = change.Field
+		}
+
+		status := action.Status
+		if result.DryRun {
+			status = "planned"
+		}
+		if action.Error != "" {
+			status = "error: " + action.Error
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", action.Action, action.Name, strings.Join(changes, ","), status)
+	}
+	w.Flush()
+}
+
+// printValidationErrors prints validation errors one per line
+func printValidationErrors(errs []validation.ValidationError) {
+	for _, e := range errs {
+		fmt.Printf("❌ %s: %s (%s)\n", e.Field, e.Message, e.Code)
+	}
+}
+
+// printJSON writes v to standard output as indented JSON
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
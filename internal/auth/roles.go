@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// UsersCollection is the auth collection Pockestrator users and their roles are stored in
+const UsersCollection = "users"
+
+// Role is the level of access a Pockestrator user has
+type Role string
+
+const (
+	// RoleViewer can read services, their status, logs and backups
+	RoleViewer Role = "viewer"
+	// RoleOperator can also deploy, update, control and share services and manage backups
+	RoleOperator Role = "operator"
+	// RoleAdmin can also delete services and backups and clean up the host
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists every role from least to most privileged
+var Roles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+// Permission is an action a route requires
+type Permission string
+
+const (
+	// PermRead allows reading services, health, logs, backups and system information
+	PermRead Permission = "read"
+	// PermControl allows starting, stopping and restarting services
+	PermControl Permission = "control"
+	// PermDeploy allows creating, updating and cloning services and applying manifests
+	PermDeploy Permission = "deploy"
+	// PermBackup allows creating and downloading backups and editing backup policies
+	PermBackup Permission = "backup"
+	// PermRestore allows restoring a service from a backup
+	PermRestore Permission = "restore"
+	// PermDelete allows deleting services and backups
+	PermDelete Permission = "delete"
+	// PermManage allows discovering unmanaged services and cleaning up orphaned resources
+	PermManage Permission = "manage"
+	// PermShare allows sharing a service with collaborators. Only owners and admins have it.
+	PermShare Permission = "share"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:   {PermRead},
+	RoleOperator: {PermRead, PermControl, PermDeploy, PermBackup, PermRestore, PermShare},
+	RoleAdmin:    {PermRead, PermControl, PermDeploy, PermBackup, PermRestore, PermShare, PermDelete, PermManage},
+}
+
+// CollaboratorPermissions are the permissions a service owner can share with collaborators.
+// Collaborators can always read the service.
+var CollaboratorPermissions = []Permission{PermControl, PermDeploy, PermBackup, PermRestore}
+
+// Grant is a user's access to a single service
+type Grant struct {
+	Owner       bool         `json:"owner"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// Allows reports whether the grant includes the permission. Owners have every permission.
+func (g *Grant) Allows(perm Permission) bool {
+	if g == nil {
+		return false
+	}
+	return g.Owner || perm == PermRead || slices.Contains(g.Permissions, perm)
+}
+
+// GrantFunc looks up the service a request targets and the caller's grant on it; a nil grant
+// means no access
+type GrantFunc func(e *core.RequestEvent) (string, *Grant, error)
+
+// ParseRole returns the role named s, or false if there is none
+func ParseRole(s string) (Role, bool) {
+	role := Role(s)
+	_, ok := rolePermissions[role]
+	return role, ok
+}
+
+// Can reports whether the role grants the permission. Unknown roles grant nothing.
+func (r Role) Can(perm Permission) bool {
+	return slices.Contains(rolePermissions[r], perm)
+}
+
+// CanOnService reports whether an authenticated record may use the permission on a service
+// it holds the grant for. The role caps what a grant allows, and admins need no grant.
+func CanOnService(record *core.Record, perm Permission, grant *Grant) bool {
+	role := RoleOf(record)
+	if !role.Can(perm) {
+		return false
+	}
+	return role == RoleAdmin || grant.Allows(perm)
+}
+
+// RoleOf returns the role of an authenticated record. Superusers are admins, users get the
+// role stored on their record, and records of any other auth collection have no role.
+func RoleOf(record *core.Record) Role {
+	if record == nil {
+		return ""
+	}
+	if record.IsSuperuser() {
+		return RoleAdmin
+	}
+	if record.Collection().Name != UsersCollection {
+		return ""
+	}
+
+	role, ok := ParseRole(record.GetString("role"))
+	if !ok {
+		return ""
+	}
+	return role
+}
+
+// Require returns a middleware rejecting requests whose auth record lacks the permission.
+// API tokens must be scoped to it, and tokens limited to some services can only read.
+func Require(perm Permission) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id: "pockestratorRequire_" + string(perm),
+		Func: func(e *core.RequestEvent) error {
+			if e.Auth == nil {
+				return e.UnauthorizedError("The request requires valid record authorization token.", nil)
+			}
+
+			if !RoleOf(e.Auth).Can(perm) {
+				return e.ForbiddenError("Your role does not allow the "+string(perm)+" permission.", nil)
+			}
+			if err := checkTokenScope(e, perm); err != nil {
+				return err
+			}
+			if scope := TokenScopeOf(e); scope != nil && len(scope.Services) > 0 && perm != PermRead {
+				return e.ForbiddenError("This API token is limited to specific services.", nil)
+			}
+
+			return e.Next()
+		},
+	}
+}
+
+// RequireService is like Require for routes targeting a single service: unless the caller
+// is an admin, grants must also return a grant on the service that allows the permission.
+// API tokens must be scoped to the permission and the service.
+func RequireService(perm Permission, grants GrantFunc) *hook.Handler[*core.RequestEvent] {
+	return &hook.Handler[*core.RequestEvent]{
+		Id: "pockestratorRequireService_" + string(perm),
+		Func: func(e *core.RequestEvent) error {
+			if e.Auth == nil {
+				return e.UnauthorizedError("The request requires valid record authorization token.", nil)
+			}
+
+			role := RoleOf(e.Auth)
+			if !role.Can(perm) {
+				return e.ForbiddenError("Your role does not allow the "+string(perm)+" permission.", nil)
+			}
+			if err := checkTokenScope(e, perm); err != nil {
+				return err
+			}
+			scope := TokenScopeOf(e)
+			if role == RoleAdmin && (scope == nil || len(scope.Services) == 0) {
+				return e.Next()
+			}
+
+			serviceID, grant, err := grants(e)
+			if err != nil {
+				return err
+			}
+			if !scope.AllowsService(serviceID) {
+				return e.ForbiddenError("This API token is not scoped to this service.", nil)
+			}
+			if role != RoleAdmin && !grant.Allows(perm) {
+				return e.ForbiddenError("You do not have the "+string(perm)+" permission on this service.", nil)
+			}
+
+			return e.Next()
+		},
+	}
+}
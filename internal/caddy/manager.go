@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -46,18 +47,27 @@ func NewManager(caddyfilePath string) *Manager {
 	}
 }
 
-// AddService adds a new service configuration to Caddyfile
-func (m *Manager) AddService(config *ServiceConfig) error {
-	// Parse template
+// RenderSite returns the site block generated for a configuration
+func RenderSite(config *ServiceConfig) (string, error) {
 	tmpl, err := template.New("caddy").Parse(ConfigTemplate)
 	if err != nil {
-		return fmt.Errorf("failed to parse Caddy template: %w", err)
+		return "", fmt.Errorf("failed to parse Caddy template: %w", err)
 	}
 
-	// Generate config string
 	var configStr strings.Builder
 	if err := tmpl.Execute(&configStr, config); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return configStr.String(), nil
+}
+
+// AddService adds a new service configuration to Caddyfile
+func (m *Manager) AddService(config *ServiceConfig) error {
+	// Generate config string
+	configStr, err := RenderSite(config)
+	if err != nil {
+		return err
 	}
 
 	// Check if Caddyfile exists
@@ -81,7 +91,7 @@ func (m *Manager) AddService(config *ServiceConfig) error {
 	}
 	defer file.Close()
 
-	if _, err := file.WriteString(configStr.String()); err != nil {
+	if _, err := file.WriteString(configStr); err != nil {
 		return fmt.Errorf("failed to write to Caddyfile: %w", err)
 	}
 
@@ -274,3 +284,145 @@ func (m *Manager) RestoreConfig(backupPath string) error {
 
 	return nil
 }
+
+// SiteBlock is a top-level site block read from the Caddyfile
+type SiteBlock struct {
+	Address string
+	Body    string
+	Start   int // offset of the address line
+	End     int // offset just past the closing brace
+}
+
+// upstreamPattern matches reverse_proxy directives pointing at a local port
+var upstreamPattern = regexp.MustCompile(`reverse_proxy\s+(?:https?://)?(?:127\.0\.0\.1|localhost):(\d+)\b`)
+
+// ParseSiteBlocks splits the Caddyfile into its top-level site blocks, honouring nested braces
+func (m *Manager) ParseSiteBlocks() ([]SiteBlock, error) {
+	content, err := os.ReadFile(m.caddyfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Caddyfile: %w", err)
+	}
+
+	var blocks []SiteBlock
+	depth := 0
+	start := 0
+	blockStart := 0
+	address := ""
+
+	text := string(content)
+	for i, ch := range text {
+		switch ch {
+		case '{':
+			if depth == 0 {
+				// The address is the last non-empty line before the opening brace
+				header := strings.TrimRight(text[start:i], " \t\r\n")
+				blockStart = start
+				if idx := strings.LastIndex(header, "\n"); idx >= 0 {
+					blockStart = start + idx + 1
+					header = header[idx+1:]
+				}
+				address = strings.TrimSpace(header)
+				start = i + 1
+			}
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				if address != "" {
+					blocks = append(blocks, SiteBlock{Address: address, Body: text[start:i], Start: blockStart, End: i + 1})
+				}
+				start = i + 1
+			}
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced braces in Caddyfile")
+			}
+		}
+	}
+
+	return blocks, nil
+}
+
+// UpstreamPort returns the local port a site block proxies to, or 0 if it has none
+func (b SiteBlock) UpstreamPort() int {
+	match := upstreamPattern.FindStringSubmatch(b.Body)
+	if match == nil {
+		return 0
+	}
+
+	port, _ := strconv.Atoi(match[1])
+	return port
+}
+
+// RemoveSite removes the site block with the given address from the Caddyfile, saving the
+// previous contents with BackupConfig first
+func (m *Manager) RemoveSite(address string) error {
+	blocks, err := m.ParseSiteBlocks()
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(m.caddyfilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read Caddyfile: %w", err)
+	}
+
+	for _, block := range blocks {
+		if block.Address != address {
+			continue
+		}
+
+		if _, err := m.BackupConfig(); err != nil {
+			return err
+		}
+
+		newContent := append([]byte{}, content[:block.Start]...)
+		newContent = append(newContent, content[block.End:]...)
+
+		if err := os.WriteFile(m.caddyfilePath, newContent, 0644); err != nil {
+			return fmt.Errorf("failed to write Caddyfile: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("site %s not found in Caddyfile", address)
+}
+
+// GetSiteBlock returns the text of the site block with the given address, as it appears in
+// the Caddyfile
+func (m *Manager) GetSiteBlock(address string) (string, error) {
+	blocks, err := m.ParseSiteBlocks()
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(m.caddyfilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Caddyfile: %w", err)
+	}
+
+	for _, block := range blocks {
+		if block.Address == address {
+			return string(content[block.Start:block.End]), nil
+		}
+	}
+
+	return "", fmt.Errorf("site %s not found in Caddyfile", address)
+}
+
+// FindSiteByPort returns the site address whose reverse_proxy points at the given local port
+func (m *Manager) FindSiteByPort(port int) (string, error) {
+	blocks, err := m.ParseSiteBlocks()
+	if err != nil {
+		return "", err
+	}
+
+	for _, block := range blocks {
+		for _, match := range upstreamPattern.FindAllStringSubmatch(block.Body, -1) {
+			if match[1] == fmt.Sprintf("%d", port) {
+				return block.Address, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no site block proxies to port %d", port)
+}
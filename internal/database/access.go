@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CollaboratorRecord is a user a service is shared with
+type CollaboratorRecord struct {
+	ID          string    `json:"id" db:"id"`
+	ServiceID   string    `json:"service" db:"service"`
+	UserID      string    `json:"user" db:"user"`
+	Email       string    `json:"email,omitempty" db:"-"`
+	Permissions []string  `json:"permissions" db:"permissions"`
+	CreatedAt   time.Time `json:"created" db:"created"`
+	UpdatedAt   time.Time `json:"updated" db:"updated"`
+}
+
+// UserExists reports whether a record with the ID exists in the users collection
+func (m *Manager) UserExists(ctx context.Context, id string) (bool, error) {
+	if _, err := m.app.FindRecordById("users", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return true, nil
+}
+
+// SetServiceOwner changes the user a service belongs to
+func (m *Manager) SetServiceOwner(ctx context.Context, serviceID, userID string) error {
+	record, err := m.app.FindRecordById("services", serviceID)
+	if err != nil {
+		return fmt.Errorf("failed to find service record: %w", err)
+	}
+
+	record.Set("owner", userID)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to update service owner: %w", err)
+	}
+
+	return nil
+}
+
+// GetCollaborator returns a user's collaborator entry on a service, or nil when it has none
+func (m *Manager) GetCollaborator(ctx context.Context, serviceID, userID string) (*CollaboratorRecord, error) {
+	record, err := m.app.FindFirstRecordByFilter("service_collaborators", "service = {:service} && user = {:user}", map[string]any{
+		"service": serviceID,
+		"user":    userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find collaborator: %w", err)
+	}
+
+	return recordToCollaborator(record), nil
+}
+
+// ListCollaborators returns the users a service is shared with, oldest first
+func (m *Manager) ListCollaborators(ctx context.Context, serviceID string) ([]*CollaboratorRecord, error) {
+	records, err := m.app.FindRecordsByFilter("service_collaborators", "service = {:service}", "created,@rowid", 0, 0, map[string]any{
+		"service": serviceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collaborators: %w", err)
+	}
+
+	if errs := m.app.ExpandRecords(records, []string{"user"}, nil); len(errs) > 0 {
+		return nil, fmt.Errorf("failed to expand collaborators: %v", errs)
+	}
+
+	collaborators := make([]*CollaboratorRecord, len(records))
+	for i, record := range records {
+		collaborators[i] = recordToCollaborator(record)
+		if user := record.ExpandedOne("user"); user != nil {
+			collaborators[i].Email = user.Email()
+		}
+	}
+
+	return collaborators, nil
+}
+
+// SaveCollaborator shares a service with a user, replacing the permissions of an existing entry
+func (m *Manager) SaveCollaborator(ctx context.Context, collaborator *CollaboratorRecord) error {
+	record, err := m.app.FindFirstRecordByFilter("service_collaborators", "service = {:service} && user = {:user}", map[string]any{
+		"service": collaborator.ServiceID,
+		"user":    collaborator.UserID,
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to find collaborator: %w", err)
+		}
+
+		collection, err := m.app.FindCollectionByNameOrId("service_collaborators")
+		if err != nil {
+			return fmt.Errorf("failed to find service_collaborators collection: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("service", collaborator.ServiceID)
+		record.Set("user", collaborator.UserID)
+	}
+
+	record.Set("permissions", collaborator.Permissions)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save collaborator: %w", err)
+	}
+
+	*collaborator = *recordToCollaborator(record)
+
+	return nil
+}
+
+// DeleteCollaborator stops sharing a service with a user
+func (m *Manager) DeleteCollaborator(ctx context.Context, serviceID, userID string) error {
+	record, err := m.app.FindFirstRecordByFilter("service_collaborators", "service = {:service} && user = {:user}", map[string]any{
+		"service": serviceID,
+		"user":    userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find collaborator: %w", err)
+	}
+
+	if err := m.app.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete collaborator: %w", err)
+	}
+
+	return nil
+}
+
+// ListServicesForUser returns the services a user owns or collaborates on
+func (m *Manager) ListServicesForUser(ctx context.Context, userID string) ([]*ServiceRecord, error) {
+	records, err := m.app.FindRecordsByFilter("services", "owner = {:user} || service_collaborators_via_service.user ?= {:user}", "", 0, 0, map[string]any{
+		"user": userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	services := make([]*ServiceRecord, len(records))
+	for i, record := range records {
+		services[i] = m.recordToService(record)
+	}
+
+	return services, nil
+}
+
+// recordToCollaborator converts a PocketBase record to a CollaboratorRecord
+func recordToCollaborator(record *core.Record) *CollaboratorRecord {
+	return &CollaboratorRecord{
+		ID:          record.Id,
+		ServiceID:   record.GetString("service"),
+		UserID:      record.GetString("user"),
+		Permissions: record.GetStringSlice("permissions"),
+		CreatedAt:   record.GetDateTime("created").Time(),
+		UpdatedAt:   record.GetDateTime("updated").Time(),
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// AuditRecord is an entry of the append-only audit log
+type AuditRecord struct {
+	ID          string         `json:"id" db:"id"`
+	Actor       string         `json:"actor" db:"actor"`       // email, or "system" for the orchestrator itself
+	ActorID     string         `json:"actor_id" db:"actor_id"` // auth record ID, empty for the CLI and system
+	Source      string         `json:"source" db:"source"`     // api, records, cli, manifest or system
+	Action      string         `json:"action" db:"action"`
+	ServiceID   string         `json:"service_id" db:"service_id"`
+	ServiceName string         `json:"service_name" db:"service_name"`
+	Params      map[string]any `json:"params,omitempty" db:"params"`
+	Outcome     string         `json:"outcome" db:"outcome"` // success, failure or rejected
+	Error       string         `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time      `json:"created" db:"created"`
+}
+
+// AuditFilter selects audit log entries; empty fields match everything
+type AuditFilter struct {
+	Actor   string
+	Action  string
+	Service string // service ID or project name
+	Outcome string
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+// CreateAuditEntry appends an entry to the audit log
+func (m *Manager) CreateAuditEntry(ctx context.Context, entry *AuditRecord) error {
+	collection, err := m.app.FindCollectionByNameOrId("audit_log")
+	if err != nil {
+		return fmt.Errorf("failed to find audit_log collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("actor", entry.Actor)
+	record.Set("actor_id", entry.ActorID)
+	record.Set("source", entry.Source)
+	record.Set("action", entry.Action)
+	record.Set("service_id", entry.ServiceID)
+	record.Set("service_name", entry.ServiceName)
+	record.Set("params", entry.Params)
+	record.Set("outcome", entry.Outcome)
+	record.Set("error", entry.Error)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save audit entry: %w", err)
+	}
+
+	entry.ID = record.Id
+	entry.CreatedAt = record.GetDateTime("created").Time()
+
+	return nil
+}
+
+// ListAuditEntries returns the audit log entries matching the filter, newest first
+func (m *Manager) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]*AuditRecord, error) {
+	var conditions []string
+	params := map[string]any{}
+
+	if filter.Actor != "" {
+		conditions = append(conditions, "(actor = {:actor} || actor_id = {:actor})")
+		params["actor"] = filter.Actor
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = {:action}")
+		params["action"] = filter.Action
+	}
+	if filter.Service != "" {
+		conditions = append(conditions, "(service_id = {:service} || service_name = {:service})")
+		params["service"] = filter.Service
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome = {:outcome}")
+		params["outcome"] = filter.Outcome
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created >= {:from}")
+		params["from"] = dateTimeParam(filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created <= {:to}")
+		params["to"] = dateTimeParam(filter.To)
+	}
+
+	records, err := m.app.FindRecordsByFilter("audit_log", strings.Join(conditions, " && "), "-created", filter.Limit, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+
+	entries := make([]*AuditRecord, len(records))
+	for i, record := range records {
+		var entryParams map[string]any
+		record.UnmarshalJSONField("params", &entryParams)
+
+		entries[i] = &AuditRecord{
+			ID:          record.Id,
+			Actor:       record.GetString("actor"),
+			ActorID:     record.GetString("actor_id"),
+			Source:      record.GetString("source"),
+			Action:      record.GetString("action"),
+			ServiceID:   record.GetString("service_id"),
+			ServiceName: record.GetString("service_name"),
+			Params:      entryParams,
+			Outcome:     record.GetString("outcome"),
+			Error:       record.GetString("error"),
+			CreatedAt:   record.GetDateTime("created").Time(),
+		}
+	}
+
+	return entries, nil
+}
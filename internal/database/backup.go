@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// BackupPolicyRecord represents a service's scheduled backup policy
+type BackupPolicyRecord struct {
+	ID        string `json:"id" db:"id"`
+	ServiceID string `json:"service" db:"service"`
+	Schedule  string `json:"schedule" db:"schedule"` // cron expression, evaluated in UTC
+	// RetentionCount keeps only the newest backups, RetentionDays drops older ones; zero disables either limit
+	RetentionCount int        `json:"retention_count" db:"retention_count"`
+	RetentionDays  int        `json:"retention_days" db:"retention_days"`
+	Enabled        bool       `json:"enabled" db:"enabled"`
+	LastRun        *time.Time `json:"last_run,omitempty" db:"last_run"`
+	CreatedAt      time.Time  `json:"created" db:"created"`
+	UpdatedAt      time.Time  `json:"updated" db:"updated"`
+}
+
+// BackupRecord represents a pb_data archive of a service
+type BackupRecord struct {
+	ID        string    `json:"id" db:"id"`
+	ServiceID string    `json:"service" db:"service"`
+	Filename  string    `json:"filename" db:"filename"`
+	Storage   string    `json:"storage" db:"storage"` // local, s3
+	Path      string    `json:"-" db:"path"`          // key of the archive within its storage backend
+	Size      int64     `json:"size" db:"size"`
+	Checksum  string    `json:"checksum" db:"checksum"`
+	Trigger   string    `json:"trigger" db:"trigger"` // scheduled, manual
+	CreatedAt time.Time `json:"created" db:"created"`
+}
+
+// GetBackupPolicy returns a service's backup policy, or nil when it has none
+func (m *Manager) GetBackupPolicy(ctx context.Context, serviceID string) (*BackupPolicyRecord, error) {
+	record, err := m.app.FindFirstRecordByFilter("backup_policies", "service = {:service}", map[string]any{
+		"service": serviceID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find backup policy: %w", err)
+	}
+
+	return recordToBackupPolicy(record), nil
+}
+
+// ListBackupPolicies returns every backup policy
+func (m *Manager) ListBackupPolicies(ctx context.Context) ([]*BackupPolicyRecord, error) {
+	records, err := m.app.FindAllRecords("backup_policies")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup policies: %w", err)
+	}
+
+	policies := make([]*BackupPolicyRecord, len(records))
+	for i, record := range records {
+		policies[i] = recordToBackupPolicy(record)
+	}
+
+	return policies, nil
+}
+
+// SaveBackupPolicy creates or replaces a service's backup policy
+func (m *Manager) SaveBackupPolicy(ctx context.Context, policy *BackupPolicyRecord) error {
+	record, err := m.app.FindFirstRecordByFilter("backup_policies", "service = {:service}", map[string]any{
+		"service": policy.ServiceID,
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to find backup policy: %w", err)
+		}
+
+		collection, err := m.app.FindCollectionByNameOrId("backup_policies")
+		if err != nil {
+			return fmt.Errorf("failed to find backup_policies collection: %w", err)
+		}
+		record = core.NewRecord(collection)
+		record.Set("service", policy.ServiceID)
+	}
+
+	record.Set("schedule", policy.Schedule)
+	record.Set("retention_count", policy.RetentionCount)
+	record.Set("retention_days", policy.RetentionDays)
+	record.Set("enabled", policy.Enabled)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save backup policy: %w", err)
+	}
+
+	*policy = *recordToBackupPolicy(record)
+
+	return nil
+}
+
+// MarkBackupPolicyRun records when a policy last ran
+func (m *Manager) MarkBackupPolicyRun(ctx context.Context, id string, ranAt time.Time) error {
+	record, err := m.app.FindRecordById("backup_policies", id)
+	if err != nil {
+		return fmt.Errorf("failed to find backup policy: %w", err)
+	}
+
+	record.Set("last_run", ranAt)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to update backup policy: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteBackupPolicy removes a service's backup policy
+func (m *Manager) DeleteBackupPolicy(ctx context.Context, serviceID string) error {
+	record, err := m.app.FindFirstRecordByFilter("backup_policies", "service = {:service}", map[string]any{
+		"service": serviceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find backup policy: %w", err)
+	}
+
+	if err := m.app.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete backup policy: %w", err)
+	}
+
+	return nil
+}
+
+// CreateBackup records a written backup archive
+func (m *Manager) CreateBackup(ctx context.Context, backup *BackupRecord) error {
+	collection, err := m.app.FindCollectionByNameOrId("backups")
+	if err != nil {
+		return fmt.Errorf("failed to find backups collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("service", backup.ServiceID)
+	record.Set("filename", backup.Filename)
+	record.Set("storage", backup.Storage)
+	record.Set("path", backup.Path)
+	record.Set("size", backup.Size)
+	record.Set("checksum", backup.Checksum)
+	record.Set("trigger", backup.Trigger)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save backup: %w", err)
+	}
+
+	backup.ID = record.Id
+	backup.CreatedAt = record.GetDateTime("created").Time()
+
+	return nil
+}
+
+// GetBackup retrieves a backup by ID
+func (m *Manager) GetBackup(ctx context.Context, id string) (*BackupRecord, error) {
+	record, err := m.app.FindRecordById("backups", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find backup: %w", err)
+	}
+
+	return recordToBackup(record), nil
+}
+
+// ListBackups returns a service's backups, newest first
+func (m *Manager) ListBackups(ctx context.Context, serviceID string) ([]*BackupRecord, error) {
+	records, err := m.app.FindRecordsByFilter("backups", "service = {:service}", "-created", 0, 0, map[string]any{
+		"service": serviceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	backups := make([]*BackupRecord, len(records))
+	for i, record := range records {
+		backups[i] = recordToBackup(record)
+	}
+
+	return backups, nil
+}
+
+// DeleteBackup removes a backup record
+func (m *Manager) DeleteBackup(ctx context.Context, id string) error {
+	record, err := m.app.FindRecordById("backups", id)
+	if err != nil {
+		return fmt.Errorf("failed to find backup: %w", err)
+	}
+
+	if err := m.app.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+
+	return nil
+}
+
+// recordToBackupPolicy converts a PocketBase record to a BackupPolicyRecord
+func recordToBackupPolicy(record *core.Record) *BackupPolicyRecord {
+	policy := &BackupPolicyRecord{
+		ID:             record.Id,
+		ServiceID:      record.GetString("service"),
+		Schedule:       record.GetString("schedule"),
+		RetentionCount: record.GetInt("retention_count"),
+		RetentionDays:  record.GetInt("retention_days"),
+		Enabled:        record.GetBool("enabled"),
+		CreatedAt:      record.GetDateTime("created").Time(),
+		UpdatedAt:      record.GetDateTime("updated").Time(),
+	}
+
+	if lastRun := record.GetDateTime("last_run"); !lastRun.IsZero() {
+		t := lastRun.Time()
+		policy.LastRun = &t
+	}
+
+	return policy
+}
+
+// recordToBackup converts a PocketBase record to a BackupRecord
+func recordToBackup(record *core.Record) *BackupRecord {
+	storage := record.GetString("storage")
+	if storage == "" {
+		storage = "local"
+	}
+
+	return &BackupRecord{
+		ID:        record.Id,
+		ServiceID: record.GetString("service"),
+		Filename:  record.GetString("filename"),
+		Storage:   storage,
+		Path:      record.GetString("path"),
+		Size:      int64(record.GetInt("size")),
+		Checksum:  record.GetString("checksum"),
+		Trigger:   record.GetString("trigger"),
+		CreatedAt: record.GetDateTime("created").Time(),
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CrashEventRecord represents a detected crash loop of a service
+type CrashEventRecord struct {
+	ID         string    `json:"id" db:"id"`
+	ServiceID  string    `json:"service" db:"service"`
+	Restarts   int       `json:"restarts" db:"restarts"`
+	NRestarts  int       `json:"n_restarts" db:"n_restarts"`
+	ExitStatus int       `json:"exit_status" db:"exit_status"`
+	Stopped    bool      `json:"stopped" db:"stopped"`
+	LogTail    string    `json:"log_tail,omitempty" db:"log_tail"`
+	CreatedAt  time.Time `json:"created" db:"created"`
+}
+
+// CreateCrashEvent persists a crash loop event
+func (m *Manager) CreateCrashEvent(ctx context.Context, event *CrashEventRecord) error {
+	collection, err := m.app.FindCollectionByNameOrId("crash_events")
+	if err != nil {
+		return fmt.Errorf("failed to find crash_events collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("service", event.ServiceID)
+	record.Set("restarts", event.Restarts)
+	record.Set("n_restarts", event.NRestarts)
+	record.Set("exit_status", event.ExitStatus)
+	record.Set("stopped", event.Stopped)
+	record.Set("log_tail", event.LogTail)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save crash event: %w", err)
+	}
+
+	event.ID = record.Id
+	event.CreatedAt = record.GetDateTime("created").Time()
+
+	return nil
+}
+
+// ListCrashEvents returns the most recent crash events of a service, newest first
+func (m *Manager) ListCrashEvents(ctx context.Context, serviceID string, limit int) ([]*CrashEventRecord, error) {
+	records, err := m.app.FindRecordsByFilter("crash_events", "service = {:service}", "-created", limit, 0, map[string]any{
+		"service": serviceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list crash events: %w", err)
+	}
+
+	events := make([]*CrashEventRecord, len(records))
+	for i, record := range records {
+		events[i] = &CrashEventRecord{
+			ID:         record.Id,
+			ServiceID:  record.GetString("service"),
+			Restarts:   record.GetInt("restarts"),
+			NRestarts:  record.GetInt("n_restarts"),
+			ExitStatus: record.GetInt("exit_status"),
+			Stopped:    record.GetBool("stopped"),
+			LogTail:    record.GetString("log_tail"),
+			CreatedAt:  record.GetDateTime("created").Time(),
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// HealthCheckRecord represents a single persisted health check
+type HealthCheckRecord struct {
+	ID             string    `json:"id" db:"id"`
+	ServiceID      string    `json:"service" db:"service"`
+	SystemdStatus  string    `json:"systemd_status" db:"systemd_status"`
+	HTTPOK         bool      `json:"http_ok" db:"http_ok"`
+	HTTPStatus     int       `json:"http_status" db:"http_status"`
+	LatencyMs      float64   `json:"latency_ms" db:"latency_ms"`
+	CaddyOK        bool      `json:"caddy_ok" db:"caddy_ok"`
+	CaddyStatus    string    `json:"caddy_status" db:"caddy_status"`
+	CaddyLatencyMs float64   `json:"caddy_latency_ms" db:"caddy_latency_ms"`
+	Verdict        string    `json:"verdict" db:"verdict"`
+	Healthy        bool      `json:"healthy" db:"healthy"`
+	Error          string    `json:"error,omitempty" db:"error"`
+	CreatedAt      time.Time `json:"created" db:"created"`
+}
+
+// CreateHealthCheck persists a health check result
+func (m *Manager) CreateHealthCheck(ctx context.Context, check *HealthCheckRecord) error {
+	collection, err := m.app.FindCollectionByNameOrId("health_checks")
+	if err != nil {
+		return fmt.Errorf("failed to find health_checks collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("service", check.ServiceID)
+	record.Set("systemd_status", check.SystemdStatus)
+	record.Set("http_ok", check.HTTPOK)
+	record.Set("http_status", check.HTTPStatus)
+	record.Set("latency_ms", check.LatencyMs)
+	record.Set("caddy_ok", check.CaddyOK)
+	record.Set("caddy_status", check.CaddyStatus)
+	record.Set("caddy_latency_ms", check.CaddyLatencyMs)
+	record.Set("verdict", check.Verdict)
+	record.Set("healthy", check.Healthy)
+	record.Set("error", check.Error)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save health check: %w", err)
+	}
+
+	check.ID = record.Id
+	check.CreatedAt = record.GetDateTime("created").Time()
+
+	return nil
+}
+
+// ListHealthChecks returns the health checks of a service between from and to, newest first.
+// Zero times leave the corresponding bound open.
+func (m *Manager) ListHealthChecks(ctx context.Context, serviceID string, from, to time.Time, limit int) ([]*HealthCheckRecord, error) {
+	filter := "service = {:service}"
+	params := map[string]any{"service": serviceID}
+
+	if !from.IsZero() {
+		filter += " && created >= {:from}"
+		params["from"] = dateTimeParam(from)
+	}
+	if !to.IsZero() {
+		filter += " && created <= {:to}"
+		params["to"] = dateTimeParam(to)
+	}
+
+	records, err := m.app.FindRecordsByFilter("health_checks", filter, "-created", limit, 0, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list health checks: %w", err)
+	}
+
+	checks := make([]*HealthCheckRecord, len(records))
+	for i, record := range records {
+		checks[i] = recordToHealthCheck(record)
+	}
+
+	return checks, nil
+}
+
+// DeleteHealthChecksBefore removes health checks older than the cutoff and returns how many were deleted
+func (m *Manager) DeleteHealthChecksBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	records, err := m.app.FindRecordsByFilter("health_checks", "created < {:cutoff}", "", 0, 0, map[string]any{
+		"cutoff": dateTimeParam(cutoff),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired health checks: %w", err)
+	}
+
+	for _, record := range records {
+		if err := m.app.Delete(record); err != nil {
+			return 0, fmt.Errorf("failed to delete health check: %w", err)
+		}
+	}
+
+	return len(records), nil
+}
+
+// RecordHealthCheckResult stores the outcome of a health check on the service record.
+// An empty status leaves the current status untouched.
+func (m *Manager) RecordHealthCheckResult(ctx context.Context, id, status string, checkedAt time.Time) error {
+	record, err := m.app.FindRecordById("services", id)
+	if err != nil {
+		return fmt.Errorf("failed to find service record: %w", err)
+	}
+
+	if status != "" {
+		record.Set("status", status)
+	}
+	record.Set("last_health_check", checkedAt)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to update health check result: %w", err)
+	}
+
+	return nil
+}
+
+// recordToHealthCheck converts a PocketBase record to a HealthCheckRecord
+func recordToHealthCheck(record *core.Record) *HealthCheckRecord {
+	return &HealthCheckRecord{
+		ID:             record.Id,
+		ServiceID:      record.GetString("service"),
+		SystemdStatus:  record.GetString("systemd_status"),
+		HTTPOK:         record.GetBool("http_ok"),
+		HTTPStatus:     record.GetInt("http_status"),
+		LatencyMs:      record.GetFloat("latency_ms"),
+		CaddyOK:        record.GetBool("caddy_ok"),
+		CaddyStatus:    record.GetString("caddy_status"),
+		CaddyLatencyMs: record.GetFloat("caddy_latency_ms"),
+		Verdict:        record.GetString("verdict"),
+		Healthy:        record.GetBool("healthy"),
+		Error:          record.GetString("error"),
+		CreatedAt:      record.GetDateTime("created").Time(),
+	}
+}
+
+// dateTimeParam formats a time the way PocketBase stores dates so filters compare correctly
+func dateTimeParam(t time.Time) string {
+	dt, _ := types.ParseDateTime(t)
+	return dt.String()
+}
@@ -3,36 +3,56 @@ package database
 import (
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/pocketbase/pocketbase"
+	ozzo "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pocketbase/pocketbase/core"
 )
 
 // ServiceRecord represents a service record in the database
 type ServiceRecord struct {
-	ID                string    `json:"id" db:"id"`
-	ProjectName       string    `json:"project_name" db:"project_name"`
-	Port              int       `json:"port" db:"port"`
-	PocketBaseVersion string    `json:"pocketbase_version" db:"pocketbase_version"`
-	Domain            string    `json:"domain" db:"domain"`
-	Status            string    `json:"status" db:"status"`
-	SystemdConfigHash string    `json:"systemd_config_hash" db:"systemd_config_hash"`
-	CaddyConfigHash   string    `json:"caddy_config_hash" db:"caddy_config_hash"`
-	LastHealthCheck   time.Time `json:"last_health_check" db:"last_health_check"`
-	CreatedBy         string    `json:"created_by" db:"created_by"`
-	CreatedAt         time.Time `json:"created" db:"created"`
-	UpdatedAt         time.Time `json:"updated" db:"updated"`
+	ID                string            `json:"id" db:"id"`
+	ProjectName       string            `json:"project_name" db:"project_name"`
+	Port              int               `json:"port" db:"port"`
+	PocketBaseVersion string            `json:"pocketbase_version" db:"pocketbase_version"`
+	Domain            string            `json:"domain" db:"domain"`
+	ServeFlags        []string          `json:"serve_flags,omitempty" db:"serve_flags"` // extra "pocketbase serve" arguments
+	Env               map[string]string `json:"env,omitempty" db:"env"`                 // environment variables of the unit
+	Limits            ServiceLimits     `json:"limits" db:"limits"`
+	Status            string            `json:"status" db:"status"`
+	SystemdConfigHash string            `json:"systemd_config_hash" db:"systemd_config_hash"`
+	CaddyConfigHash   string            `json:"caddy_config_hash" db:"caddy_config_hash"`
+	LastHealthCheck   time.Time         `json:"last_health_check" db:"last_health_check"`
+	CreatedBy         string            `json:"created_by" db:"created_by"`
+	Owner             string            `json:"owner,omitempty" db:"owner"` // users record ID
+	Team              string            `json:"team,omitempty" db:"team"`   // teams record ID
+	Description       string            `json:"description,omitempty" db:"description"`
+	CreatedAt         time.Time         `json:"created" db:"created"`
+	UpdatedAt         time.Time         `json:"updated" db:"updated"`
 }
 
+// ServiceLimits holds the systemd resource limits of a service; empty values keep the unit defaults
+type ServiceLimits struct {
+	MemoryMax    string `json:"memory_max,omitempty"`     // e.g. 512M
+	CPUQuota     string `json:"cpu_quota,omitempty"`      // e.g. 50%
+	MaxOpenFiles int    `json:"max_open_files,omitempty"` // LimitNOFILE
+}
+
+// ErrDuplicateProjectName is returned when a service with the same project name already exists
+var ErrDuplicateProjectName = errors.New("a service with this project name already exists")
+
+// ErrDuplicatePort is returned when a service already uses the same port
+var ErrDuplicatePort = errors.New("a service already uses this port")
+
 // Manager handles database operations
 type Manager struct {
-	app *pocketbase.PocketBase
+	app core.App
 }
 
 // NewManager creates a new database manager
-func NewManager(app *pocketbase.PocketBase) *Manager {
+func NewManager(app core.App) *Manager {
 	return &Manager{app: app}
 }
 
@@ -48,14 +68,20 @@ func (m *Manager) CreateService(ctx context.Context, service *ServiceRecord) err
 	record.Set("port", service.Port)
 	record.Set("pocketbase_version", service.PocketBaseVersion)
 	record.Set("domain", service.Domain)
+	record.Set("serve_flags", service.ServeFlags)
+	record.Set("env", service.Env)
+	record.Set("limits", service.Limits)
 	record.Set("status", service.Status)
 	record.Set("systemd_config_hash", service.SystemdConfigHash)
 	record.Set("caddy_config_hash", service.CaddyConfigHash)
 	record.Set("last_health_check", service.LastHealthCheck)
 	record.Set("created_by", service.CreatedBy)
+	record.Set("owner", service.Owner)
+	record.Set("team", service.Team)
+	record.Set("description", service.Description)
 
 	if err := m.app.Save(record); err != nil {
-		return fmt.Errorf("failed to create service record: %w", err)
+		return fmt.Errorf("failed to create service record: %w", uniqueViolation(err))
 	}
 
 	service.ID = record.Id
@@ -113,13 +139,17 @@ func (m *Manager) UpdateService(ctx context.Context, service *ServiceRecord) err
 	record.Set("port", service.Port)
 	record.Set("pocketbase_version", service.PocketBaseVersion)
 	record.Set("domain", service.Domain)
+	record.Set("serve_flags", service.ServeFlags)
+	record.Set("env", service.Env)
+	record.Set("limits", service.Limits)
+	record.Set("team", service.Team)
 	record.Set("status", service.Status)
 	record.Set("systemd_config_hash", service.SystemdConfigHash)
 	record.Set("caddy_config_hash", service.CaddyConfigHash)
 	record.Set("last_health_check", service.LastHealthCheck)
 
 	if err := m.app.Save(record); err != nil {
-		return fmt.Errorf("failed to update service record: %w", err)
+		return fmt.Errorf("failed to update service record: %w", uniqueViolation(err))
 	}
 
 	service.UpdatedAt = record.GetDateTime("updated").Time()
@@ -171,6 +201,65 @@ func (m *Manager) GetExistingServices(ctx context.Context) ([]string, error) {
 	return services, nil
 }
 
+// GetReservedPorts returns every reserved port mapped to its owner, including ports of existing services
+func (m *Manager) GetReservedPorts(ctx context.Context) (map[int]string, error) {
+	reserved := make(map[int]string)
+
+	services, err := m.app.FindRecordsByFilter("services", "", "", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service ports: %w", err)
+	}
+	for _, record := range services {
+		reserved[record.GetInt("port")] = record.GetString("project_name")
+	}
+
+	reservations, err := m.app.FindRecordsByFilter("port_reservations", "", "", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get port reservations: %w", err)
+	}
+	for _, record := range reservations {
+		reserved[record.GetInt("port")] = record.GetString("owner")
+	}
+
+	return reserved, nil
+}
+
+// ReservePort records a port reservation for the given owner
+func (m *Manager) ReservePort(ctx context.Context, port int, owner string) error {
+	collection, err := m.app.FindCollectionByNameOrId("port_reservations")
+	if err != nil {
+		return fmt.Errorf("failed to find port_reservations collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("port", port)
+	record.Set("owner", owner)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save port reservation: %w", err)
+	}
+
+	return nil
+}
+
+// ReleasePort removes the reservation for a port, if any
+func (m *Manager) ReleasePort(ctx context.Context, port int) error {
+	records, err := m.app.FindRecordsByFilter("port_reservations", "port = {:port}", "", 0, 0, map[string]any{
+		"port": port,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find port reservation: %w", err)
+	}
+
+	for _, record := range records {
+		if err := m.app.Delete(record); err != nil {
+			return fmt.Errorf("failed to delete port reservation: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // UpdateServiceStatus updates the status of a service
 func (m *Manager) UpdateServiceStatus(ctx context.Context, id, status string) error {
 	record, err := m.app.FindRecordById("services", id)
@@ -188,6 +277,21 @@ func (m *Manager) UpdateServiceStatus(ctx context.Context, id, status string) er
 	return nil
 }
 
+// OnServiceStatusChange calls fn after a service is created or its status changes, however
+// the record was saved. previous is empty for new services.
+func (m *Manager) OnServiceStatusChange(fn func(service *ServiceRecord, previous string)) {
+	m.app.OnRecordAfterCreateSuccess("services").BindFunc(func(e *core.RecordEvent) error {
+		fn(m.recordToService(e.Record), "")
+		return e.Next()
+	})
+	m.app.OnRecordAfterUpdateSuccess("services").BindFunc(func(e *core.RecordEvent) error {
+		if previous := e.Record.Original().GetString("status"); previous != e.Record.GetString("status") {
+			fn(m.recordToService(e.Record), previous)
+		}
+		return e.Next()
+	})
+}
+
 // UpdateConfigHashes updates the configuration hashes for a service
 func (m *Manager) UpdateConfigHashes(ctx context.Context, id, systemdHash, caddyHash string) error {
 	record, err := m.app.FindRecordById("services", id)
@@ -207,22 +311,54 @@ func (m *Manager) UpdateConfigHashes(ctx context.Context, id, systemdHash, caddy
 
 // recordToService converts a PocketBase record to a ServiceRecord
 func (m *Manager) recordToService(record *core.Record) *ServiceRecord {
+	var serveFlags []string
+	record.UnmarshalJSONField("serve_flags", &serveFlags)
+
+	var env map[string]string
+	record.UnmarshalJSONField("env", &env)
+
+	var limits ServiceLimits
+	record.UnmarshalJSONField("limits", &limits)
+
 	return &ServiceRecord{
 		ID:                record.Id,
 		ProjectName:       record.GetString("project_name"),
 		Port:              record.GetInt("port"),
 		PocketBaseVersion: record.GetString("pocketbase_version"),
 		Domain:            record.GetString("domain"),
+		ServeFlags:        serveFlags,
+		Env:               env,
+		Limits:            limits,
 		Status:            record.GetString("status"),
 		SystemdConfigHash: record.GetString("systemd_config_hash"),
 		CaddyConfigHash:   record.GetString("caddy_config_hash"),
 		LastHealthCheck:   record.GetDateTime("last_health_check").Time(),
 		CreatedBy:         record.GetString("created_by"),
+		Owner:             record.GetString("owner"),
+		Team:              record.GetString("team"),
+		Description:       record.GetString("description"),
 		CreatedAt:         record.GetDateTime("created").Time(),
 		UpdatedAt:         record.GetDateTime("updated").Time(),
 	}
 }
 
+// uniqueViolation maps unique index failures on the services collection to sentinel errors
+func uniqueViolation(err error) error {
+	var fieldErrors ozzo.Errors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	if _, ok := fieldErrors["project_name"]; ok {
+		return fmt.Errorf("%w: %v", ErrDuplicateProjectName, err)
+	}
+	if _, ok := fieldErrors["port"]; ok {
+		return fmt.Errorf("%w: %v", ErrDuplicatePort, err)
+	}
+
+	return err
+}
+
 // GenerateConfigHash generates a hash for configuration content
 func GenerateConfigHash(content string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(content)))
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TeamRecord is a group of users that services can belong to, with quotas on them. Empty
+// quotas are unlimited.
+type TeamRecord struct {
+	ID          string   `json:"id" db:"id"`
+	Name        string   `json:"name" db:"name"`
+	Members     []string `json:"members" db:"members"` // users record IDs
+	MaxServices int      `json:"max_services" db:"max_services"`
+	// MaxMemory caps the sum of the memory_max limits of the team's services, e.g. 4G
+	MaxMemory string `json:"max_memory,omitempty" db:"max_memory"`
+	// MaxBackupStorage caps the total size of the backups of the team's services, e.g. 20G
+	MaxBackupStorage string    `json:"max_backup_storage,omitempty" db:"max_backup_storage"`
+	CreatedAt        time.Time `json:"created" db:"created"`
+	UpdatedAt        time.Time `json:"updated" db:"updated"`
+}
+
+// HasMember reports whether a user belongs to the team
+func (t *TeamRecord) HasMember(userID string) bool {
+	return slices.Contains(t.Members, userID)
+}
+
+// GetTeam returns a team by ID
+func (m *Manager) GetTeam(ctx context.Context, id string) (*TeamRecord, error) {
+	record, err := m.app.FindRecordById("teams", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find team: %w", err)
+	}
+
+	return &TeamRecord{
+		ID:               record.Id,
+		Name:             record.GetString("name"),
+		Members:          record.GetStringSlice("members"),
+		MaxServices:      record.GetInt("max_services"),
+		MaxMemory:        record.GetString("max_memory"),
+		MaxBackupStorage: record.GetString("max_backup_storage"),
+		CreatedAt:        record.GetDateTime("created").Time(),
+		UpdatedAt:        record.GetDateTime("updated").Time(),
+	}, nil
+}
+
+// ListServicesForTeam returns the services that belong to a team
+func (m *Manager) ListServicesForTeam(ctx context.Context, teamID string) ([]*ServiceRecord, error) {
+	records, err := m.app.FindRecordsByFilter("services", "team = {:team}", "", 0, 0, map[string]any{
+		"team": teamID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	services := make([]*ServiceRecord, len(records))
+	for i, record := range records {
+		services[i] = m.recordToService(record)
+	}
+
+	return services, nil
+}
+
+// GetTeamBackupSize returns the total size of the backups of a team's services
+func (m *Manager) GetTeamBackupSize(ctx context.Context, teamID string) (int64, error) {
+	records, err := m.app.FindRecordsByFilter("backups", "service.team = {:team}", "", 0, 0, map[string]any{
+		"team": teamID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var total int64
+	for _, record := range records {
+		total += int64(record.GetInt("size"))
+	}
+
+	return total, nil
+}
+
+// GetServiceBackupSize returns the total size in bytes of a service's backups
+func (m *Manager) GetServiceBackupSize(ctx context.Context, serviceID string) (int64, error) {
+	records, err := m.app.FindRecordsByFilter("backups", "service = {:service}", "", 0, 0, map[string]any{
+		"service": serviceID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var total int64
+	for _, record := range records {
+		total += int64(record.GetInt("size"))
+	}
+
+	return total, nil
+}
+
+// SetServiceTeam moves a service to another team, or out of its team when teamID is empty
+func (m *Manager) SetServiceTeam(ctx context.Context, serviceID, teamID string) error {
+	record, err := m.app.FindRecordById("services", serviceID)
+	if err != nil {
+		return fmt.Errorf("failed to find service record: %w", err)
+	}
+
+	record.Set("team", teamID)
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to update service record: %w", err)
+	}
+
+	return nil
+}
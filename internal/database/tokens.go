@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// TokenRecord is an API token. Only a hash of the token itself is stored.
+type TokenRecord struct {
+	ID              string     `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	OwnerCollection string     `json:"owner_collection" db:"owner_collection"` // users or _superusers
+	OwnerID         string     `json:"owner_id" db:"owner_id"`
+	OwnerEmail      string     `json:"owner_email" db:"owner_email"`
+	Prefix          string     `json:"prefix" db:"prefix"` // start of the token, to recognize it
+	Hash            string     `json:"-" db:"token_hash"`
+	Permissions     []string   `json:"permissions" db:"permissions"`
+	Services        []string   `json:"services" db:"services"` // empty for every service
+	ExpiresAt       *time.Time `json:"expires,omitempty" db:"expires"`
+	LastUsedAt      *time.Time `json:"last_used,omitempty" db:"last_used"`
+	CreatedAt       time.Time  `json:"created" db:"created"`
+}
+
+// CreateAPIToken saves a new API token
+func (m *Manager) CreateAPIToken(ctx context.Context, token *TokenRecord) error {
+	collection, err := m.app.FindCollectionByNameOrId("api_tokens")
+	if err != nil {
+		return fmt.Errorf("failed to find api_tokens collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("name", token.Name)
+	record.Set("owner_collection", token.OwnerCollection)
+	record.Set("owner_id", token.OwnerID)
+	record.Set("owner_email", token.OwnerEmail)
+	record.Set("prefix", token.Prefix)
+	record.Set("token_hash", token.Hash)
+	record.Set("permissions", token.Permissions)
+	record.Set("services", token.Services)
+	if token.ExpiresAt != nil {
+		record.Set("expires", *token.ExpiresAt)
+	}
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save API token: %w", err)
+	}
+
+	token.ID = record.Id
+	token.CreatedAt = record.GetDateTime("created").Time()
+
+	return nil
+}
+
+// GetAPIToken returns an API token by ID
+func (m *Manager) GetAPIToken(ctx context.Context, id string) (*TokenRecord, error) {
+	record, err := m.app.FindRecordById("api_tokens", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find API token: %w", err)
+	}
+
+	return recordToToken(record), nil
+}
+
+// FindAPITokenByHash returns the API token with the hash, nil when there is none
+func (m *Manager) FindAPITokenByHash(ctx context.Context, hash string) (*TokenRecord, error) {
+	record, err := m.app.FindFirstRecordByData("api_tokens", "token_hash", hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find API token: %w", err)
+	}
+
+	return recordToToken(record), nil
+}
+
+// ListAPITokens returns the API tokens of an owner, or every token when ownerID is empty,
+// newest first
+func (m *Manager) ListAPITokens(ctx context.Context, ownerID string) ([]*TokenRecord, error) {
+	filter := ""
+	if ownerID != "" {
+		filter = "owner_id = {:owner}"
+	}
+
+	records, err := m.app.FindRecordsByFilter("api_tokens", filter, "-created", 0, 0, map[string]any{
+		"owner": ownerID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+
+	tokens := make([]*TokenRecord, len(records))
+	for i, record := range records {
+		tokens[i] = recordToToken(record)
+	}
+
+	return tokens, nil
+}
+
+// TouchAPIToken records when an API token was last used
+func (m *Manager) TouchAPIToken(ctx context.Context, id string, usedAt time.Time) error {
+	record, err := m.app.FindRecordById("api_tokens", id)
+	if err != nil {
+		return fmt.Errorf("failed to find API token: %w", err)
+	}
+
+	record.Set("last_used", usedAt)
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to update API token: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAPIToken removes an API token
+func (m *Manager) DeleteAPIToken(ctx context.Context, id string) error {
+	record, err := m.app.FindRecordById("api_tokens", id)
+	if err != nil {
+		return fmt.Errorf("failed to find API token: %w", err)
+	}
+
+	if err := m.app.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+
+	return nil
+}
+
+func recordToToken(record *core.Record) *TokenRecord {
+	token := &TokenRecord{
+		ID:              record.Id,
+		Name:            record.GetString("name"),
+		OwnerCollection: record.GetString("owner_collection"),
+		OwnerID:         record.GetString("owner_id"),
+		OwnerEmail:      record.GetString("owner_email"),
+		Prefix:          record.GetString("prefix"),
+		Hash:            record.GetString("token_hash"),
+		Permissions:     record.GetStringSlice("permissions"),
+		Services:        []string{},
+		CreatedAt:       record.GetDateTime("created").Time(),
+	}
+	record.UnmarshalJSONField("services", &token.Services)
+
+	if expires := record.GetDateTime("expires"); !expires.IsZero() {
+		t := expires.Time()
+		token.ExpiresAt = &t
+	}
+	if lastUsed := record.GetDateTime("last_used"); !lastUsed.IsZero() {
+		t := lastUsed.Time()
+		token.LastUsedAt = &t
+	}
+
+	return token
+}
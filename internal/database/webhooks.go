@@ -0,0 +1,280 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookRecord is a subscription of an HTTP endpoint to events. The secret signs the
+// payloads and is never returned after creation.
+type WebhookRecord struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	URL       string    `json:"url" db:"url"`
+	Events    []string  `json:"events" db:"events"`
+	Services  []string  `json:"services" db:"services"` // empty for every service
+	Secret    string    `json:"-" db:"secret"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created" db:"created"`
+	UpdatedAt time.Time `json:"updated" db:"updated"`
+}
+
+// WebhookDeliveryRecord is an event queued for, or sent to, a webhook
+type WebhookDeliveryRecord struct {
+	ID             string          `json:"id" db:"id"`
+	WebhookID      string          `json:"webhook" db:"webhook"`
+	EventID        string          `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	ServiceID      string          `json:"service_id" db:"service_id"`
+	ServiceName    string          `json:"service_name" db:"service_name"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttempt    *time.Time      `json:"next_attempt,omitempty" db:"next_attempt"`
+	ResponseStatus int             `json:"response_status,omitempty" db:"response_status"`
+	Error          string          `json:"error,omitempty" db:"error"`
+	DeliveredAt    *time.Time      `json:"delivered,omitempty" db:"delivered"`
+	CreatedAt      time.Time       `json:"created" db:"created"`
+	UpdatedAt      time.Time       `json:"updated" db:"updated"`
+}
+
+// CreateWebhook saves a new webhook
+func (m *Manager) CreateWebhook(ctx context.Context, webhook *WebhookRecord) error {
+	collection, err := m.app.FindCollectionByNameOrId("webhooks")
+	if err != nil {
+		return fmt.Errorf("failed to find webhooks collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("name", webhook.Name)
+	record.Set("url", webhook.URL)
+	record.Set("events", webhook.Events)
+	record.Set("services", webhook.Services)
+	record.Set("secret", webhook.Secret)
+	record.Set("enabled", webhook.Enabled)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save webhook: %w", err)
+	}
+
+	webhook.ID = record.Id
+	webhook.CreatedAt = record.GetDateTime("created").Time()
+	webhook.UpdatedAt = record.GetDateTime("updated").Time()
+
+	return nil
+}
+
+// GetWebhook returns a webhook by ID
+func (m *Manager) GetWebhook(ctx context.Context, id string) (*WebhookRecord, error) {
+	record, err := m.app.FindRecordById("webhooks", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook: %w", err)
+	}
+
+	return recordToWebhook(record), nil
+}
+
+// ListWebhooks returns the webhooks, only the enabled ones when enabledOnly is set, oldest first
+func (m *Manager) ListWebhooks(ctx context.Context, enabledOnly bool) ([]*WebhookRecord, error) {
+	filter := ""
+	if enabledOnly {
+		filter = "enabled = true"
+	}
+
+	records, err := m.app.FindRecordsByFilter("webhooks", filter, "created", 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	webhooks := make([]*WebhookRecord, len(records))
+	for i, record := range records {
+		webhooks[i] = recordToWebhook(record)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries
+func (m *Manager) DeleteWebhook(ctx context.Context, id string) error {
+	record, err := m.app.FindRecordById("webhooks", id)
+	if err != nil {
+		return fmt.Errorf("failed to find webhook: %w", err)
+	}
+
+	if err := m.app.Delete(record); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	return nil
+}
+
+// CreateWebhookDelivery queues a delivery
+func (m *Manager) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDeliveryRecord) error {
+	collection, err := m.app.FindCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		return fmt.Errorf("failed to find webhook_deliveries collection: %w", err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("webhook", delivery.WebhookID)
+	record.Set("event_id", delivery.EventID)
+	record.Set("event_type", delivery.EventType)
+	record.Set("service_id", delivery.ServiceID)
+	record.Set("service_name", delivery.ServiceName)
+	record.Set("payload", delivery.Payload)
+	setDelivery(record, delivery)
+
+	if err := m.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+
+	delivery.ID = record.Id
+	delivery.CreatedAt = record.GetDateTime("created").Time()
+	delivery.UpdatedAt = record.GetDateTime("updated").Time()
+
+	return nil
+}
+
+// UpdateWebhookDelivery saves the outcome of a delivery attempt. Only the outcome changes, so
+// the record is saved without validating its webhook relation, which may no longer resolve.
+func (m *Manager) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDeliveryRecord) error {
+	record, err := m.app.FindRecordById("webhook_deliveries", delivery.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find webhook delivery: %w", err)
+	}
+
+	setDelivery(record, delivery)
+	if err := m.app.SaveNoValidate(record); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	delivery.UpdatedAt = record.GetDateTime("updated").Time()
+
+	return nil
+}
+
+// ListDueWebhookDeliveries returns the pending deliveries whose next attempt is due at now,
+// the longest waiting first
+func (m *Manager) ListDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDeliveryRecord, error) {
+	records, err := m.app.FindRecordsByFilter("webhook_deliveries", "status = 'pending' && next_attempt <= {:now}", "next_attempt,created", limit, 0, map[string]any{
+		"now": dateTimeParam(now),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due webhook deliveries: %w", err)
+	}
+
+	return recordsToDeliveries(records), nil
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, optionally only those with a
+// status, newest first
+func (m *Manager) ListWebhookDeliveries(ctx context.Context, webhookID, status string, limit int) ([]*WebhookDeliveryRecord, error) {
+	filter := "webhook = {:webhook}"
+	if status != "" {
+		filter += " && status = {:status}"
+	}
+
+	records, err := m.app.FindRecordsByFilter("webhook_deliveries", filter, "-created", limit, 0, map[string]any{
+		"webhook": webhookID,
+		"status":  status,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	return recordsToDeliveries(records), nil
+}
+
+// DeleteWebhookDeliveriesBefore removes finished deliveries older than the cutoff and returns
+// how many were deleted. Pending deliveries are kept however old they are.
+func (m *Manager) DeleteWebhookDeliveriesBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	records, err := m.app.FindRecordsByFilter("webhook_deliveries", "status != 'pending' && created < {:cutoff}", "", 0, 0, map[string]any{
+		"cutoff": dateTimeParam(cutoff),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired webhook deliveries: %w", err)
+	}
+
+	for _, record := range records {
+		if err := m.app.Delete(record); err != nil {
+			return 0, fmt.Errorf("failed to delete webhook delivery: %w", err)
+		}
+	}
+
+	return len(records), nil
+}
+
+// setDelivery sets the fields of a delivery that change with each attempt
+func setDelivery(record *core.Record, delivery *WebhookDeliveryRecord) {
+	record.Set("status", delivery.Status)
+	record.Set("attempts", delivery.Attempts)
+	record.Set("response_status", delivery.ResponseStatus)
+	record.Set("error", delivery.Error)
+	record.Set("next_attempt", "")
+	if delivery.NextAttempt != nil {
+		record.Set("next_attempt", *delivery.NextAttempt)
+	}
+	record.Set("delivered", "")
+	if delivery.DeliveredAt != nil {
+		record.Set("delivered", *delivery.DeliveredAt)
+	}
+}
+
+func recordToWebhook(record *core.Record) *WebhookRecord {
+	webhook := &WebhookRecord{
+		ID:        record.Id,
+		Name:      record.GetString("name"),
+		URL:       record.GetString("url"),
+		Events:    record.GetStringSlice("events"),
+		Services:  []string{},
+		Secret:    record.GetString("secret"),
+		Enabled:   record.GetBool("enabled"),
+		CreatedAt: record.GetDateTime("created").Time(),
+		UpdatedAt: record.GetDateTime("updated").Time(),
+	}
+	record.UnmarshalJSONField("services", &webhook.Services)
+
+	return webhook
+}
+
+func recordsToDeliveries(records []*core.Record) []*WebhookDeliveryRecord {
+	deliveries := make([]*WebhookDeliveryRecord, len(records))
+	for i, record := range records {
+		deliveries[i] = &WebhookDeliveryRecord{
+			ID:             record.Id,
+			WebhookID:      record.GetString("webhook"),
+			EventID:        record.GetString("event_id"),
+			EventType:      record.GetString("event_type"),
+			ServiceID:      record.GetString("service_id"),
+			ServiceName:    record.GetString("service_name"),
+			Status:         record.GetString("status"),
+			Attempts:       record.GetInt("attempts"),
+			ResponseStatus: record.GetInt("response_status"),
+			Error:          record.GetString("error"),
+			CreatedAt:      record.GetDateTime("created").Time(),
+			UpdatedAt:      record.GetDateTime("updated").Time(),
+		}
+		record.UnmarshalJSONField("payload", &deliveries[i].Payload)
+		if next := record.GetDateTime("next_attempt"); !next.IsZero() {
+			t := next.Time()
+			deliveries[i].NextAttempt = &t
+		}
+		if delivered := record.GetDateTime("delivered"); !delivered.IsZero() {
+			t := delivered.Time()
+			deliveries[i].DeliveredAt = &t
+		}
+	}
+
+	return deliveries
+}
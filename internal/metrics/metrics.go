@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types
+const (
+	TypeGauge     = "gauge"
+	TypeCounter   = "counter"
+	TypeHistogram = "histogram"
+)
+
+// Label is a single metric label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a metric family
+type Sample struct {
+	// Suffix is appended to the family name, e.g. "_bucket" for histograms
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named group of samples sharing help text and type
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// NewFamily creates an empty metric family
+func NewFamily(name, typ, help string) *Family {
+	return &Family{Name: name, Type: typ, Help: help}
+}
+
+// Add appends a sample with the given label name/value pairs
+func (f *Family) Add(value float64, labels ...string) *Family {
+	f.Samples = append(f.Samples, Sample{Labels: pairs(labels), Value: value})
+	return f
+}
+
+// FilterLabel drops the samples whose label called name has a value keep rejects. Samples
+// without the label are kept.
+func FilterLabel(families []*Family, name string, keep func(value string) bool) []*Family {
+	filtered := make([]*Family, len(families))
+	for i, family := range families {
+		copied := *family
+		copied.Samples = nil
+		for _, sample := range family.Samples {
+			if sampleKept(sample, name, keep) {
+				copied.Samples = append(copied.Samples, sample)
+			}
+		}
+		filtered[i] = &copied
+	}
+	return filtered
+}
+
+func sampleKept(sample Sample, name string, keep func(value string) bool) bool {
+	for _, label := range sample.Labels {
+		if label.Name == name {
+			return keep(label.Value)
+		}
+	}
+	return true
+}
+
+// Write renders metric families in the Prometheus text exposition format.
+// Families without samples are skipped.
+func Write(w io.Writer, families []*Family) error {
+	bw := bufio.NewWriter(w)
+
+	for _, family := range families {
+		if len(family.Samples) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", family.Name, escapeHelp(family.Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", family.Name, family.Type)
+
+		for _, sample := range family.Samples {
+			bw.WriteString(family.Name)
+			bw.WriteString(sample.Suffix)
+			if len(sample.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, label := range sample.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", label.Name, escapeLabel(label.Value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(sample.Value))
+			bw.WriteByte('\n')
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Histogram is a histogram partitioned by the value of a single label
+type Histogram struct {
+	mu      sync.Mutex
+	label   string
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+// histogramSeries holds the observations for one label value
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates a histogram with the given upper bucket bounds, partitioned by label
+func NewHistogram(label string, buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return &Histogram{
+		label:   label,
+		buckets: sorted,
+		series:  make(map[string]*histogramSeries),
+	}
+}
+
+// Observe records a value for the given label value
+func (h *Histogram) Observe(labelValue string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[labelValue]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[labelValue] = series
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+// Counts returns the number of observations per label value
+func (h *Histogram) Counts() map[string]uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make(map[string]uint64, len(h.series))
+	for labelValue, series := range h.series {
+		counts[labelValue] = series.count
+	}
+	return counts
+}
+
+// Family renders the histogram as a metric family
+func (h *Histogram) Family(name, help string) *Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	family := NewFamily(name, TypeHistogram, help)
+
+	labelValues := make([]string, 0, len(h.series))
+	for labelValue := range h.series {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+
+	for _, labelValue := range labelValues {
+		series := h.series[labelValue]
+		for i, bound := range h.buckets {
+			family.Samples = append(family.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: []Label{{h.label, labelValue}, {"le", formatValue(bound)}},
+				Value:  float64(series.counts[i]),
+			})
+		}
+		family.Samples = append(family.Samples,
+			Sample{Suffix: "_bucket", Labels: []Label{{h.label, labelValue}, {"le", "+Inf"}}, Value: float64(series.count)},
+			Sample{Suffix: "_sum", Labels: []Label{{h.label, labelValue}}, Value: series.sum},
+			Sample{Suffix: "_count", Labels: []Label{{h.label, labelValue}}, Value: float64(series.count)},
+		)
+	}
+
+	return family
+}
+
+// pairs converts alternating name/value strings into labels
+func pairs(labels []string) []Label {
+	result := make([]Label, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		result = append(result, Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return result
+}
+
+// formatValue formats a sample value the way Prometheus expects
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes backslashes and newlines in help text
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// escapeLabel escapes backslashes, newlines and double quotes in label values
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
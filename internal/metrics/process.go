@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the kernel's USER_HZ, the unit of the CPU times in /proc/<pid>/stat
+const clockTicks = 100
+
+// ProcessStats holds the resource usage of a process read from /proc
+type ProcessStats struct {
+	PID        int     `json:"pid"`
+	RSSBytes   uint64  `json:"rss_bytes"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+	Threads    int     `json:"threads"`
+	OpenFDs    int     `json:"open_fds"`
+	// MaxOpenFiles is the soft RLIMIT_NOFILE, zero when unlimited
+	MaxOpenFiles uint64 `json:"max_open_files"`
+}
+
+// ReadProcessStats reads the resource usage of pid from the proc filesystem at procRoot
+func ReadProcessStats(procRoot string, pid int) (*ProcessStats, error) {
+	procDir := filepath.Join(procRoot, strconv.Itoa(pid))
+	stats := &ProcessStats{PID: pid}
+
+	status, err := os.ReadFile(filepath.Join(procDir, "status"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process status: %w", err)
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch key {
+		case "VmRSS":
+			// Reported in kB
+			kb, _ := strconv.ParseUint(fields[0], 10, 64)
+			stats.RSSBytes = kb * 1024
+		case "Threads":
+			stats.Threads, _ = strconv.Atoi(fields[0])
+		}
+	}
+
+	stat, err := os.ReadFile(filepath.Join(procDir, "stat"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process stat: %w", err)
+	}
+
+	// The command name may contain spaces, so fields are counted from the closing parenthesis.
+	// utime and stime are fields 14 and 15, i.e. the 12th and 13th after the name.
+	if end := strings.LastIndexByte(string(stat), ')'); end >= 0 {
+		fields := strings.Fields(string(stat)[end+1:])
+		if len(fields) > 12 {
+			utime, _ := strconv.ParseUint(fields[11], 10, 64)
+			stime, _ := strconv.ParseUint(fields[12], 10, 64)
+			stats.CPUSeconds = float64(utime+stime) / clockTicks
+		}
+	}
+
+	if fds, err := os.ReadDir(filepath.Join(procDir, "fd")); err == nil {
+		stats.OpenFDs = len(fds)
+	}
+
+	if limits, err := os.ReadFile(filepath.Join(procDir, "limits")); err == nil {
+		for _, line := range strings.Split(string(limits), "\n") {
+			if rest, ok := strings.CutPrefix(line, "Max open files"); ok {
+				// Columns are soft limit, hard limit and units
+				if fields := strings.Fields(rest); len(fields) > 0 {
+					stats.MaxOpenFiles, _ = strconv.ParseUint(fields[0], 10, 64)
+				}
+				break
+			}
+		}
+	}
+
+	return stats, nil
+}
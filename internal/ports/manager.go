@@ -0,0 +1,390 @@
+package ports
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultRanges is the port range used when none is configured
+var DefaultRanges = []Range{{Start: 8091, End: 65535}}
+
+// ErrNoPortsAvailable is returned when every port in the configured ranges is taken
+var ErrNoPortsAvailable = errors.New("no ports available in the configured ranges")
+
+// Range is an inclusive range of ports the allocator may hand out
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Conflict describes a process that is already listening on a port
+type Conflict struct {
+	Port    int    `json:"port"`
+	Address string `json:"address"`
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+
+	inode string
+}
+
+// Store persists port reservations
+type Store interface {
+	// GetReservedPorts returns every reserved port mapped to its owner
+	GetReservedPorts(ctx context.Context) (map[int]string, error)
+	// ReservePort records a reservation for the given owner
+	ReservePort(ctx context.Context, port int, owner string) error
+	// ReleasePort removes a reservation
+	ReleasePort(ctx context.Context, port int) error
+}
+
+// ParseRanges parses a comma separated list of ports and port ranges such as "8091-8999,9100"
+func ParseRanges(spec string) ([]Range, error) {
+	var ranges []Range
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			endStr = startStr
+		}
+
+		start, err := strconv.Atoi(strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q: %w", part, err)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(endStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q: %w", part, err)
+		}
+
+		if start < 1024 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port range %q: must be within 1024-65535 and start <= end", part)
+		}
+
+		ranges = append(ranges, Range{Start: start, End: end})
+	}
+
+	return ranges, nil
+}
+
+// ReservedError is returned when a requested port is reserved by another owner
+type ReservedError struct {
+	Port  int
+	Owner string
+}
+
+func (e *ReservedError) Error() string {
+	return fmt.Sprintf("port %d is reserved by %s", e.Port, e.Owner)
+}
+
+// ConflictError is returned when a requested port is already bound on the host
+type ConflictError struct {
+	Conflict *Conflict
+}
+
+func (e *ConflictError) Error() string {
+	if e.Conflict.Process != "" {
+		return fmt.Sprintf("port %d is in use by %s (pid %d)", e.Conflict.Port, e.Conflict.Process, e.Conflict.PID)
+	}
+	return fmt.Sprintf("port %d is in use on %s", e.Conflict.Port, e.Conflict.Address)
+}
+
+// Manager allocates ports from the configured ranges
+type Manager struct {
+	mu       sync.Mutex
+	ranges   []Range
+	store    Store
+	procRoot string
+}
+
+// NewManager creates a new port manager
+func NewManager(ranges []Range, store Store) *Manager {
+	if len(ranges) == 0 {
+		ranges = DefaultRanges
+	}
+
+	return &Manager{
+		ranges:   ranges,
+		store:    store,
+		procRoot: "/proc",
+	}
+}
+
+// SetProcRoot overrides the location of the proc filesystem
+func (m *Manager) SetProcRoot(procRoot string) {
+	m.procRoot = procRoot
+}
+
+// Ranges returns the configured port ranges
+func (m *Manager) Ranges() []Range {
+	return m.ranges
+}
+
+// Allocate reserves a port for owner. When preferred is non-zero that exact
+// port is reserved, otherwise the first free port in the configured ranges is used.
+// Reserving a port the owner already holds succeeds.
+func (m *Manager) Allocate(ctx context.Context, owner string, preferred int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reserved, err := m.store.GetReservedPorts(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load port reservations: %w", err)
+	}
+
+	listening, err := m.listeningPorts()
+	if err != nil {
+		return 0, err
+	}
+
+	if preferred != 0 {
+		if holder, ok := reserved[preferred]; ok {
+			if holder == owner {
+				return preferred, nil
+			}
+			return 0, &ReservedError{Port: preferred, Owner: holder}
+		}
+		if conflict, ok := listening[preferred]; ok {
+			m.resolveOwner(conflict)
+			return 0, &ConflictError{Conflict: conflict}
+		}
+		if err := m.store.ReservePort(ctx, preferred, owner); err != nil {
+			return 0, fmt.Errorf("failed to reserve port %d: %w", preferred, err)
+		}
+		return preferred, nil
+	}
+
+	for _, r := range m.ranges {
+		for port := r.Start; port <= r.End; port++ {
+			if _, ok := reserved[port]; ok {
+				continue
+			}
+			if _, ok := listening[port]; ok {
+				continue
+			}
+			if err := m.store.ReservePort(ctx, port, owner); err != nil {
+				return 0, fmt.Errorf("failed to reserve port %d: %w", port, err)
+			}
+			return port, nil
+		}
+	}
+
+	return 0, ErrNoPortsAvailable
+}
+
+// Adopt reserves a port an existing instance is already listening on, for an owner taking
+// that instance over. Unlike Allocate it does not probe the host, but a port reserved by
+// another owner is still refused.
+func (m *Manager) Adopt(ctx context.Context, owner string, port int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reserved, err := m.store.GetReservedPorts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load port reservations: %w", err)
+	}
+
+	if holder, ok := reserved[port]; ok {
+		if holder == owner {
+			return nil
+		}
+		return &ReservedError{Port: port, Owner: holder}
+	}
+	if err := m.store.ReservePort(ctx, port, owner); err != nil {
+		return fmt.Errorf("failed to reserve port %d: %w", port, err)
+	}
+
+	return nil
+}
+
+// Release frees a reserved port
+func (m *Manager) Release(ctx context.Context, port int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.store.ReleasePort(ctx, port)
+}
+
+// InRange reports whether port falls inside one of the configured ranges
+func (m *Manager) InRange(port int) bool {
+	for _, r := range m.ranges {
+		if port >= r.Start && port <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Probe reports which process, if any, is listening on port
+func (m *Manager) Probe(port int) (*Conflict, error) {
+	listening, err := m.listeningPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	conflict, ok := listening[port]
+	if !ok {
+		return nil, nil
+	}
+
+	m.resolveOwner(conflict)
+	return conflict, nil
+}
+
+// ProbePort reports which process, if any, is listening on port using /proc
+func ProbePort(port int) (*Conflict, error) {
+	return (&Manager{procRoot: "/proc"}).Probe(port)
+}
+
+// listeningPorts parses /proc/net/tcp and /proc/net/tcp6 for sockets in the LISTEN state
+func (m *Manager) listeningPorts() (map[int]*Conflict, error) {
+	listening := make(map[int]*Conflict)
+
+	found := false
+	for _, name := range []string{"tcp", "tcp6"} {
+		sockets, err := parseProcNet(filepath.Join(m.procRoot, "net", name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+
+		for _, socket := range sockets {
+			if _, ok := listening[socket.Port]; !ok {
+				listening[socket.Port] = socket
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("cannot read %s/net/tcp", m.procRoot)
+	}
+
+	return listening, nil
+}
+
+// parseProcNet reads a /proc/net/tcp style table and returns the listening sockets
+func parseProcNet(path string) ([]*Conflict, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sockets []*Conflict
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // skip header
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		// State 0A is TCP_LISTEN
+		if fields[3] != "0A" {
+			continue
+		}
+
+		address, port, err := decodeAddress(fields[1])
+		if err != nil {
+			continue
+		}
+
+		sockets = append(sockets, &Conflict{Port: port, Address: address, inode: fields[9]})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return sockets, nil
+}
+
+// decodeAddress converts a hex "ADDR:PORT" pair from /proc/net/tcp into a printable address and port
+func decodeAddress(hexAddr string) (string, int, error) {
+	hostHex, portHex, found := strings.Cut(hexAddr, ":")
+	if !found {
+		return "", 0, fmt.Errorf("invalid address %q", hexAddr)
+	}
+
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in %q: %w", hexAddr, err)
+	}
+
+	// Addresses are stored as little-endian 32-bit words
+	var ip []byte
+	for i := 0; i+8 <= len(hostHex); i += 8 {
+		word, err := strconv.ParseUint(hostHex[i:i+8], 16, 32)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid address in %q: %w", hexAddr, err)
+		}
+		ip = append(ip, byte(word), byte(word>>8), byte(word>>16), byte(word>>24))
+	}
+
+	var address string
+	if len(ip) == 4 {
+		address = fmt.Sprintf("%d.%d.%d.%d:%d", ip[0], ip[1], ip[2], ip[3], port)
+	} else {
+		parts := make([]string, 0, 8)
+		for i := 0; i+1 < len(ip); i += 2 {
+			parts = append(parts, strconv.FormatUint(uint64(ip[i])<<8|uint64(ip[i+1]), 16))
+		}
+		address = fmt.Sprintf("[%s]:%d", strings.Join(parts, ":"), port)
+	}
+
+	return address, int(port), nil
+}
+
+// resolveOwner fills in the PID and process name owning a conflicting socket
+func (m *Manager) resolveOwner(conflict *Conflict) {
+	if conflict.inode == "" || conflict.inode == "0" {
+		return
+	}
+
+	target := "socket:[" + conflict.inode + "]"
+	procs, err := os.ReadDir(m.procRoot)
+	if err != nil {
+		return
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join(m.procRoot, proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || link != target {
+				continue
+			}
+
+			conflict.PID = pid
+			if comm, err := os.ReadFile(filepath.Join(m.procRoot, proc.Name(), "comm")); err == nil {
+				conflict.Process = strings.TrimSpace(string(comm))
+			}
+			return
+		}
+	}
+}
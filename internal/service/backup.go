@@ -0,0 +1,224 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	_ "modernc.org/sqlite"
+)
+
+// snapshotDatabases are the SQLite databases copied into a data snapshot
+var snapshotDatabases = []string{"data.db", "auxiliary.db"}
+
+// Snapshot describes a written pb_data archive
+type Snapshot struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"` // hex encoded SHA-256 of the archive
+}
+
+// SnapshotDataDir archives a consistent copy of a project's pb_data into a zip at destPath.
+// The SQLite databases are copied with VACUUM INTO, so the service can keep running,
+// and the storage directory is added as is.
+func (m *Manager) SnapshotDataDir(ctx context.Context, projectName, destPath string) (*Snapshot, error) {
+	dataDir := filepath.Join(m.baseDir, projectName, "pb_data")
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, fmt.Errorf("failed to find pb_data: %w", err)
+	}
+
+	tempDir, err := os.MkdirTemp("", "pockestrator-snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var copied []string
+	for _, name := range snapshotDatabases {
+		src := filepath.Join(dataDir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+
+		if err := vacuumInto(ctx, src, filepath.Join(tempDir, name)); err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", name, err)
+		}
+		copied = append(copied, name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Write to a temporary name so a failed backup never looks complete
+	partialPath := destPath + ".partial"
+	archive, err := os.Create(partialPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(partialPath)
+	defer archive.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	writer := zip.NewWriter(io.MultiWriter(archive, hash, counter))
+
+	for _, name := range copied {
+		header := &zip.FileHeader{Name: name, Modified: time.Now()}
+		header.SetMode(0644)
+		if err := addFileToZip(writer, filepath.Join(tempDir, name), header); err != nil {
+			writer.Close()
+			return nil, fmt.Errorf("failed to archive %s: %w", name, err)
+		}
+	}
+
+	storageDir := filepath.Join(dataDir, "storage")
+	if _, err := os.Stat(storageDir); err == nil {
+		if err := addDirectoryToZip(writer, storageDir, "storage/"); err != nil {
+			writer.Close()
+			return nil, fmt.Errorf("failed to archive storage: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Rename(partialPath, destPath); err != nil {
+		return nil, fmt.Errorf("failed to move archive into place: %w", err)
+	}
+
+	return &Snapshot{
+		Path:     destPath,
+		Size:     counter.n,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// StageRestore extracts a backup archive next to a project's pb_data and checks the
+// integrity of its SQLite databases, leaving the live data untouched. It returns the
+// staging directory, which the caller swaps in with SwapDataDir or removes.
+func (m *Manager) StageRestore(ctx context.Context, projectName, archivePath string) (string, error) {
+	serviceDir := filepath.Join(m.baseDir, projectName)
+	stagingDir := filepath.Join(serviceDir, fmt.Sprintf("pb_data.restore-%s", time.Now().Format("20060102-150405")))
+
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	if err := m.extractZip(archivePath, stagingDir); err != nil {
+		os.RemoveAll(stagingDir)
+		return "", fmt.Errorf("failed to unpack backup: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(stagingDir, "data.db")); err != nil {
+		os.RemoveAll(stagingDir)
+		return "", fmt.Errorf("backup archive does not contain data.db")
+	}
+
+	for _, name := range snapshotDatabases {
+		path := filepath.Join(stagingDir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+
+		if err := CheckDatabaseIntegrity(ctx, path); err != nil {
+			os.RemoveAll(stagingDir)
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return stagingDir, nil
+}
+
+// SwapDataDir moves a project's current pb_data aside and the staged directory into its
+// place. It returns where the previous pb_data was moved, which is empty when there was none.
+func (m *Manager) SwapDataDir(projectName, stagingDir string) (string, error) {
+	dataDir := filepath.Join(m.baseDir, projectName, "pb_data")
+	asideDir := ""
+
+	if _, err := os.Stat(dataDir); err == nil {
+		asideDir = filepath.Join(m.baseDir, projectName, fmt.Sprintf("pb_data.pre-restore-%s", time.Now().Format("20060102-150405")))
+		if err := os.Rename(dataDir, asideDir); err != nil {
+			return "", fmt.Errorf("failed to move pb_data aside: %w", err)
+		}
+	}
+
+	if err := os.Rename(stagingDir, dataDir); err != nil {
+		if asideDir != "" {
+			os.Rename(asideDir, dataDir)
+		}
+		return "", fmt.Errorf("failed to move restored data into place: %w", err)
+	}
+
+	return asideDir, nil
+}
+
+// RevertDataDir replaces a project's pb_data with the directory SwapDataDir moved aside
+func (m *Manager) RevertDataDir(projectName, asideDir string) error {
+	dataDir := filepath.Join(m.baseDir, projectName, "pb_data")
+
+	if err := os.RemoveAll(dataDir); err != nil {
+		return fmt.Errorf("failed to remove restored data: %w", err)
+	}
+
+	if asideDir == "" {
+		return nil
+	}
+
+	if err := os.Rename(asideDir, dataDir); err != nil {
+		return fmt.Errorf("failed to move previous pb_data back: %w", err)
+	}
+
+	return nil
+}
+
+// CheckDatabaseIntegrity runs SQLite's integrity check on the database at path
+func CheckDatabaseIntegrity(ctx context.Context, path string) error {
+	db, err := dbx.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.NewQuery("PRAGMA integrity_check").WithContext(ctx).Row(&result); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	return nil
+}
+
+// vacuumInto writes a transactionally consistent copy of the SQLite database at src to dest
+func vacuumInto(ctx context.Context, src, dest string) error {
+	db, err := dbx.Open("sqlite", src+"?_pragma=busy_timeout(10000)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.NewQuery("VACUUM INTO {:dest}").Bind(dbx.Params{"dest": dest}).WithContext(ctx).Execute()
+	return err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
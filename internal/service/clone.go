@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// appDirs are the application directories of an instance that are copied when cloning it
+var appDirs = []string{"pb_hooks", "pb_migrations", "pb_public"}
+
+// CopyAppDirs copies a project's pb_hooks, pb_migrations and pb_public into another
+// project's directory and returns the directories that were copied
+func (m *Manager) CopyAppDirs(sourceProject, targetProject string) ([]string, error) {
+	targetDir := filepath.Join(m.baseDir, targetProject)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create service directory: %w", err)
+	}
+
+	var copied []string
+	for _, name := range appDirs {
+		src := filepath.Join(m.baseDir, sourceProject, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+
+		if err := copyTree(src, filepath.Join(targetDir, name)); err != nil {
+			return copied, fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+		copied = append(copied, name)
+	}
+
+	return copied, nil
+}
+
+// CloneDataDir writes a consistent snapshot of a project's pb_data into another project's
+// directory. The source can keep running; the target must not have a pb_data yet.
+func (m *Manager) CloneDataDir(ctx context.Context, sourceProject, targetProject string) error {
+	targetDataDir := filepath.Join(m.baseDir, targetProject, "pb_data")
+	if _, err := os.Stat(targetDataDir); err == nil {
+		return fmt.Errorf("%s already has a pb_data directory", targetProject)
+	}
+
+	tempDir, err := os.MkdirTemp("", "pockestrator-clone-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	snapshot, err := m.SnapshotDataDir(ctx, sourceProject, filepath.Join(tempDir, "pb_data.zip"))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(targetDataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create pb_data: %w", err)
+	}
+
+	if err := m.extractZip(snapshot.Path, targetDataDir); err != nil {
+		os.RemoveAll(targetDataDir)
+		return fmt.Errorf("failed to unpack snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// copyTree copies the directory src to dst, preserving file modes and symlinks
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+// copyFile copies a regular file, creating dst with the given mode
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
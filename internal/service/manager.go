@@ -3,17 +3,23 @@ package service
 import (
 	"archive/zip"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
 
+// Installer installs the PocketBase binary of a version into a service directory
+type Installer func(ctx context.Context, version, serviceDir string) error
+
 // Manager handles PocketBase service management
 type Manager struct {
 	baseDir     string
@@ -39,7 +45,11 @@ func (m *Manager) Deploy(ctx context.Context, config *DeploymentConfig) error {
 	}
 
 	// Download and extract PocketBase
-	if err := m.downloadPocketBase(ctx, config.PocketBaseVersion, serviceDir); err != nil {
+	install := config.Install
+	if install == nil {
+		install = m.downloadPocketBase
+	}
+	if err := install(ctx, config.PocketBaseVersion, serviceDir); err != nil {
 		return fmt.Errorf("failed to download PocketBase: %w", err)
 	}
 
@@ -113,6 +123,11 @@ func (m *Manager) extractZip(src, dest string) error {
 			continue
 		}
 
+		// Archives are not required to carry entries for every directory
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
 		fileReader, err := file.Open()
 		if err != nil {
 			return fmt.Errorf("failed to open file in zip: %w", err)
@@ -136,6 +151,214 @@ func (m *Manager) extractZip(src, dest string) error {
 	return nil
 }
 
+// ArchiveDirectory writes the contents of srcDir into a zip file at destPath
+func (m *Manager) ArchiveDirectory(srcDir, destPath string) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	archive, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer archive.Close()
+
+	writer := zip.NewWriter(archive)
+
+	if err := addDirectoryToZip(writer, srcDir, ""); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to archive %s: %w", srcDir, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	return nil
+}
+
+// addDirectoryToZip writes the contents of srcDir into the archive under prefix
+func addDirectoryToZip(writer *zip.Writer, srcDir, prefix string) error {
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = prefix + filepath.ToSlash(relPath)
+
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = writer.CreateHeader(header)
+			return err
+		}
+
+		return addFileToZip(writer, path, header)
+	})
+}
+
+// addFileToZip compresses the file at path into the archive using header
+func addFileToZip(writer *zip.Writer, path string, header *zip.FileHeader) error {
+	header.Method = zip.Deflate
+	entry, err := writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+// DataUsage is the disk usage of a project's pb_data directory in bytes
+type DataUsage struct {
+	DataDB       int64 `json:"data_db"`
+	DataWAL      int64 `json:"data_wal"`
+	AuxiliaryDB  int64 `json:"auxiliary_db"`
+	AuxiliaryWAL int64 `json:"auxiliary_wal"`
+	Storage      int64 `json:"storage"`
+	Other        int64 `json:"other"`
+	Total        int64 `json:"total"`
+}
+
+// DataDirUsage measures a project's pb_data directory, split into the SQLite
+// databases, their write-ahead logs and the uploaded file storage
+func (m *Manager) DataDirUsage(projectName string) (*DataUsage, error) {
+	dataDir := filepath.Join(m.baseDir, projectName, "pb_data")
+	usage := &DataUsage{}
+
+	err := filepath.WalkDir(dataDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		usage.Total += size
+
+		rel, _ := filepath.Rel(dataDir, path)
+		switch {
+		case rel == "data.db":
+			usage.DataDB += size
+		case rel == "data.db-wal", rel == "data.db-shm":
+			usage.DataWAL += size
+		case rel == "auxiliary.db":
+			usage.AuxiliaryDB += size
+		case rel == "auxiliary.db-wal", rel == "auxiliary.db-shm":
+			usage.AuxiliaryWAL += size
+		case strings.HasPrefix(rel, "storage"+string(filepath.Separator)):
+			usage.Storage += size
+		default:
+			usage.Other += size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure pb_data: %w", err)
+	}
+
+	return usage, nil
+}
+
+// TailErrorLog returns the last n lines of a project's errors.log
+func (m *Manager) TailErrorLog(projectName string, n int) ([]string, error) {
+	file, err := os.Open(filepath.Join(m.baseDir, projectName, "errors.log"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open error log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat error log: %w", err)
+	}
+
+	// The log is append-only and can grow large, so only read its tail
+	const maxTail = 64 * 1024
+	offset := info.Size() - maxTail
+	if offset < 0 {
+		offset = 0
+	}
+
+	data := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read error log: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if offset > 0 && len(lines) > 1 {
+		// Drop the partial first line
+		lines = lines[1:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return lines, nil
+}
+
+// ListServiceDirs returns the names of directories under the base directory that contain a PocketBase binary
+func (m *Manager) ListServiceDirs() ([]string, error) {
+	entries, err := os.ReadDir(m.baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base directory: %w", err)
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(m.baseDir, entry.Name(), "pocketbase")); err == nil {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	return dirs, nil
+}
+
+// RemoveServiceDir deletes a project's directory under the base directory
+func (m *Manager) RemoveServiceDir(projectName string) error {
+	if projectName == "" || strings.ContainsAny(projectName, `/\`) || projectName == "." || projectName == ".." {
+		return fmt.Errorf("invalid project name: %q", projectName)
+	}
+
+	if err := os.RemoveAll(filepath.Join(m.baseDir, projectName)); err != nil {
+		return fmt.Errorf("failed to remove service directory: %w", err)
+	}
+
+	return nil
+}
+
 // GetServiceStatus checks if a service is running
 func (m *Manager) GetServiceStatus(serviceName string) (*HealthStatus, error) {
 	status := &HealthStatus{
@@ -158,6 +381,87 @@ func (m *Manager) GetServiceStatus(serviceName string) (*HealthStatus, error) {
 	return status, nil
 }
 
+// ProbeHTTP requests the instance's /api/health endpoint directly on the loopback interface
+func (m *Manager) ProbeHTTP(ctx context.Context, port int) *ProbeResult {
+	url := fmt.Sprintf("http://127.0.0.1:%d/api/health", port)
+	return probe(ctx, http.DefaultClient, url, "")
+}
+
+// ProbeViaCaddy requests https://<host>/api/health through the local Caddy listener.
+// The connection is dialled to listenerURL's address while the Host header and TLS
+// server name are set to host, so the request exercises the real site block.
+func (m *Manager) ProbeViaCaddy(ctx context.Context, listenerURL, host string) *ProbeResult {
+	listener, err := neturl.Parse(listenerURL)
+	if err != nil || listener.Host == "" {
+		return &ProbeResult{URL: listenerURL, Error: fmt.Sprintf("invalid Caddy listener URL %q", listenerURL)}
+	}
+
+	dialAddr := listener.Host
+	if listener.Port() == "" {
+		port := "443"
+		if listener.Scheme == "http" {
+			port = "80"
+		}
+		dialAddr = net.JoinHostPort(listener.Hostname(), port)
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, dialAddr)
+		},
+		TLSClientConfig: &tls.Config{ServerName: host},
+	}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{
+		Transport: transport,
+		// A redirect (e.g. HTTP → HTTPS) is reported as the probe result rather than followed
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	url := fmt.Sprintf("%s://%s/api/health", listener.Scheme, host)
+	return probe(ctx, client, url, host)
+}
+
+// probe performs a GET request against url, optionally overriding the Host header
+func probe(ctx context.Context, client *http.Client, url, host string) *ProbeResult {
+	result := &ProbeResult{URL: url}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if host != "" {
+		req.Host = host
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		var opErr *net.OpError
+		result.Unreachable = errors.As(err, &opErr) && opErr.Op == "dial"
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	result.StatusCode = resp.StatusCode
+	result.OK = resp.StatusCode == http.StatusOK
+	if !result.OK {
+		result.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return result
+}
+
 // Stop stops a PocketBase service
 func (m *Manager) Stop(serviceName string) error {
 	cmd := exec.Command("sudo", "systemctl", "stop", serviceName+"-pocketbase.service")
@@ -210,35 +514,28 @@ func (m *Manager) GetLatestVersion(ctx context.Context) (string, error) {
 	return "0.28.4", nil
 }
 
-// GetNextPort finds the next available port starting from 8091
-func (m *Manager) GetNextPort(usedPorts []int) int {
-	basePort := 8091
+// binaryVersionTimeout bounds running a discovered binary to ask its version, which may
+// not be PocketBase at all
+const binaryVersionTimeout = 5 * time.Second
 
-	// Create map for O(1) lookups
-	portMap := make(map[int]bool)
-	for _, port := range usedPorts {
-		portMap[port] = true
-	}
+// GetBinaryVersion runs the PocketBase binary's version command and returns the reported version
+func (m *Manager) GetBinaryVersion(ctx context.Context, binaryPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, binaryVersionTimeout)
+	defer cancel()
 
-	// Find next available port
-	for port := basePort; port <= 65535; port++ {
-		if !portMap[port] {
-			return port
-		}
-	}
-
-	return basePort // fallback
-}
-
-// IsPortAvailable checks if a port is available on the system
-func (m *Manager) IsPortAvailable(port int) bool {
-	// Use netstat or similar to check port availability
-	cmd := exec.Command("netstat", "-tuln")
+	cmd := exec.CommandContext(ctx, binaryPath, "--version")
+	// Do not wait for children that keep the output open after the binary is killed
+	cmd.WaitDelay = time.Second
 	output, err := cmd.Output()
 	if err != nil {
-		return true // assume available if can't check
+		return "", fmt.Errorf("failed to run %s --version: %w", binaryPath, err)
+	}
+
+	// Output looks like "pocketbase version 0.28.4"
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty version output from %s", binaryPath)
 	}
 
-	portStr := ":" + strconv.Itoa(port)
-	return !strings.Contains(string(output), portStr)
+	return strings.TrimPrefix(fields[len(fields)-1], "v"), nil
 }
@@ -27,17 +27,50 @@ type DeploymentConfig struct {
 	SystemdDir      string `json:"systemd_dir"`
 	CaddyConfigPath string `json:"caddy_config_path"`
 	SuperuserEmail  string `json:"superuser_email"`
+	// Install installs the PocketBase binary; nil downloads the release from GitHub
+	Install Installer `json:"-"`
 }
 
 // HealthStatus represents the health status of a service
 type HealthStatus struct {
-	ServiceID     string    `json:"service_id"`
-	IsRunning     bool      `json:"is_running"`
-	SystemdStatus string    `json:"systemd_status"`
-	CaddyStatus   string    `json:"caddy_status"`
-	ConfigMatch   bool      `json:"config_match"`
-	LastChecked   time.Time `json:"last_checked"`
-	ErrorMessage  string    `json:"error_message,omitempty"`
+	ServiceID     string       `json:"service_id"`
+	IsRunning     bool         `json:"is_running"`
+	SystemdStatus string       `json:"systemd_status"`
+	CaddyStatus   string       `json:"caddy_status"` // ok, route_missing, unreachable, misconfigured
+	ConfigMatch   bool         `json:"config_match"`
+	DirectProbe   *ProbeResult `json:"direct_probe,omitempty"`
+	CaddyProbe    *ProbeResult `json:"caddy_probe,omitempty"`
+	Verdict       string       `json:"verdict,omitempty"`
+	LastChecked   time.Time    `json:"last_checked"`
+	ErrorMessage  string       `json:"error_message,omitempty"`
+}
+
+// Caddy probe statuses
+const (
+	CaddyStatusOK            = "ok"
+	CaddyStatusRouteMissing  = "route_missing"
+	CaddyStatusUnreachable   = "unreachable"
+	CaddyStatusMisconfigured = "misconfigured"
+)
+
+// Combined health verdicts
+const (
+	VerdictHealthy           = "healthy"
+	VerdictPocketBaseDown    = "pocketbase_down"
+	VerdictCaddyRouteMissing = "caddy_route_missing"
+	VerdictCaddyUnreachable  = "caddy_unreachable"
+	VerdictCaddyMisconfig    = "caddy_misconfigured"
+)
+
+// ProbeResult holds the outcome of an HTTP health probe
+type ProbeResult struct {
+	URL        string        `json:"url"`
+	OK         bool          `json:"ok"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	Error      string        `json:"error,omitempty"`
+	// Unreachable is set when no connection could be established at all
+	Unreachable bool `json:"unreachable,omitempty"`
 }
 
 // ValidationResult represents the result of configuration validation
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps archives in a directory on the local filesystem
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates a store rooted at dir. The directory is created on first upload.
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// Name implements Store
+func (s *LocalStore) Name() string {
+	return "local"
+}
+
+// Upload implements Store. The file is moved into place when it is on the same
+// filesystem and copied otherwise.
+func (s *LocalStore) Upload(ctx context.Context, key, localPath string) error {
+	destPath, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	if err := os.Rename(localPath, destPath); err == nil {
+		return nil
+	}
+
+	// Write to a temporary name so a failed copy never looks complete
+	partialPath := destPath + ".partial"
+	if err := copyFile(localPath, partialPath); err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to copy archive: %w", err)
+	}
+	if err := os.Rename(partialPath, destPath); err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to move archive into place: %w", err)
+	}
+
+	return os.Remove(localPath)
+}
+
+// Open implements Store
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	return file, nil
+}
+
+// List implements Store
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]*Object, error) {
+	objects := []*Object{}
+
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".partial") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, &Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	return objects, nil
+}
+
+// Delete implements Store
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return fmt.Errorf("failed to remove archive: %w", err)
+	}
+
+	return nil
+}
+
+// resolve maps a key to a path inside the store directory
+func (s *LocalStore) resolve(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid archive key %q", key)
+	}
+	return path, nil
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// S3Config holds the settings of an S3-compatible bucket
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // e.g. https://s3.eu-central-1.amazonaws.com or http://127.0.0.1:9000
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"-"`
+	SecretKey string `json:"-"`
+	// PathStyle addresses the bucket as endpoint/bucket instead of bucket.endpoint,
+	// which MinIO and most self-hosted implementations need
+	PathStyle bool `json:"path_style"`
+	// Prefix is prepended to every key, so one bucket can be shared
+	Prefix string `json:"prefix"`
+}
+
+// S3Store keeps archives in an S3-compatible bucket
+type S3Store struct {
+	config S3Config
+}
+
+// NewS3Store creates a store for the configured bucket
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("s3 access key and secret key are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Prefix != "" && !strings.HasSuffix(config.Prefix, "/") {
+		config.Prefix += "/"
+	}
+
+	return &S3Store{config: config}, nil
+}
+
+// Name implements Store
+func (s *S3Store) Name() string {
+	return "s3"
+}
+
+// Upload implements Store
+func (s *S3Store) Upload(ctx context.Context, key, localPath string) error {
+	fsys, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	file, err := filesystem.NewFileFromPath(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	if err := fsys.UploadFile(file, s.config.Prefix+key); err != nil {
+		return fmt.Errorf("failed to upload archive: %w", err)
+	}
+
+	return os.Remove(localPath)
+}
+
+// Open implements Store
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	fsys, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := fsys.GetReader(s.config.Prefix + key)
+	if err != nil {
+		fsys.Close()
+		if errors.Is(err, filesystem.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+
+	return &s3Reader{ReadCloser: reader, fsys: fsys}, nil
+}
+
+// List implements Store
+func (s *S3Store) List(ctx context.Context, prefix string) ([]*Object, error) {
+	fsys, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	listed, err := fsys.List(s.config.Prefix + prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	objects := make([]*Object, 0, len(listed))
+	for _, obj := range listed {
+		if obj.IsDir {
+			continue
+		}
+		objects = append(objects, &Object{
+			Key:     strings.TrimPrefix(obj.Key, s.config.Prefix),
+			Size:    obj.Size,
+			ModTime: obj.ModTime,
+		})
+	}
+
+	return objects, nil
+}
+
+// Delete implements Store
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	fsys, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	if err := fsys.Delete(s.config.Prefix + key); err != nil {
+		if errors.Is(err, filesystem.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return fmt.Errorf("failed to delete archive: %w", err)
+	}
+
+	return nil
+}
+
+// open creates a client bound to ctx. Clients are cheap and the filesystem
+// context is not safe to share between concurrent calls.
+func (s *S3Store) open(ctx context.Context) (*filesystem.System, error) {
+	fsys, err := filesystem.NewS3(
+		s.config.Bucket,
+		s.config.Region,
+		s.config.Endpoint,
+		s.config.AccessKey,
+		s.config.SecretKey,
+		s.config.PathStyle,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	fsys.SetContext(ctx)
+	return fsys, nil
+}
+
+// s3Reader closes the client along with the object reader
+type s3Reader struct {
+	io.ReadCloser
+	fsys *filesystem.System
+}
+
+func (r *s3Reader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.fsys.Close())
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when an archive does not exist in a store
+var ErrNotFound = errors.New("archive not found")
+
+// Object describes an archive held by a store
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Store holds backup archives under slash separated keys such as "my-app/my-app-20250801-030000-412.zip"
+type Store interface {
+	// Name identifies the backend ("local" or "s3") and is recorded with each backup
+	Name() string
+	// Upload stores the file at localPath under key. The local file is consumed and
+	// no longer exists once Upload succeeds.
+	Upload(ctx context.Context, key, localPath string) error
+	// Open returns a reader for the archive stored under key
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns the archives whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]*Object, error)
+	// Delete removes the archive stored under key
+	Delete(ctx context.Context, key string) error
+}
@@ -1,12 +1,18 @@
 package systemd
 
 import (
+	"bufio"
 	"fmt"
+	"math"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 // ServiceTemplate is the systemd service file template
@@ -17,13 +23,22 @@ Description = {{.ProjectName}} pocketbase
 Type           = simple
 User           = root
 Group          = root
-LimitNOFILE    = 4096
+LimitNOFILE    = {{if .LimitNOFILE}}{{.LimitNOFILE}}{{else}}4096{{end}}
+{{- if .MemoryMax}}
+MemoryMax      = {{.MemoryMax}}
+{{- end}}
+{{- if .CPUQuota}}
+CPUQuota       = {{.CPUQuota}}
+{{- end}}
 Restart        = always
 RestartSec     = 5s
 StandardOutput   = append:{{.ServiceDir}}/errors.log
 StandardError    = append:{{.ServiceDir}}/errors.log
 WorkingDirectory = {{.ServiceDir}}/
-ExecStart      = {{.ServiceDir}}/pocketbase serve --http="127.0.0.1:{{.Port}}"
+ExecStart      = {{.ServiceDir}}/pocketbase serve --http="127.0.0.1:{{.Port}}"{{range .QuotedServeFlags}} {{.}}{{end}}
+{{- range .EnvironmentLines}}
+Environment    = {{.}}
+{{- end}}
 
 [Install]
 WantedBy = multi-user.target
@@ -39,6 +54,75 @@ type ServiceConfig struct {
 	ProjectName string
 	ServiceDir  string
 	Port        int
+	// ServeFlags are extra arguments appended to "pocketbase serve"
+	ServeFlags []string
+	// Environment variables of the service
+	Environment map[string]string
+	// Resource limits, left at the unit defaults when empty
+	MemoryMax   string // e.g. 512M
+	CPUQuota    string // e.g. 50%
+	LimitNOFILE int
+}
+
+// unitEscaper escapes backslashes and quotes for the unit parser and % for specifier expansion
+var unitEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+
+// EnvironmentLines returns the quoted Environment= assignments of the unit, sorted by name
+func (c *ServiceConfig) EnvironmentLines() []string {
+	names := make([]string, 0, len(c.Environment))
+	for name := range c.Environment {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = `"` + name + "=" + unitEscaper.Replace(c.Environment[name]) + `"`
+	}
+
+	return lines
+}
+
+// QuotedServeFlags returns the serve flags quoted for ExecStart, so each one stays a single
+// argument whatever it contains
+func (c *ServiceConfig) QuotedServeFlags() []string {
+	quoted := make([]string, len(c.ServeFlags))
+	for i, flag := range c.ServeFlags {
+		quoted[i] = `"` + unitEscaper.Replace(flag) + `"`
+	}
+
+	return quoted
+}
+
+// instanceServeFlags are the serve flags tied to a single instance's directory or listeners,
+// which are not carried over when a unit's flags are reused for another service
+var instanceServeFlags = []string{"--http", "--https", "--dir", "--hooksDir", "--migrationsDir", "--publicDir"}
+
+// UnitInfo holds the settings recovered from an existing service file
+type UnitInfo struct {
+	ProjectName      string `json:"project_name"`
+	UnitFile         string `json:"unit_file"`
+	WorkingDirectory string `json:"working_directory"`
+	ExecStart        string `json:"exec_start"`
+	BinaryPath       string `json:"binary_path"`
+	ListenAddress    string `json:"listen_address"`
+	Port             int    `json:"port"`
+	// ServeFlags are the remaining serve flags, without the instance specific ones
+	ServeFlags []string `json:"serve_flags,omitempty"`
+}
+
+// UnitState holds the runtime properties of a unit reported by systemctl show
+type UnitState struct {
+	ActiveState    string `json:"active_state"`
+	SubState       string `json:"sub_state"`
+	NRestarts      int    `json:"n_restarts"`
+	ExecMainStatus int    `json:"exec_main_status"`
+	MainPID        int    `json:"main_pid"`
+	// ActiveEnterTimestamp is when the unit last entered the active state, zero if it never did
+	ActiveEnterTimestamp time.Time `json:"active_enter_timestamp"`
+	// Accounting values are zero when systemd does not track them for the unit
+	MemoryCurrent uint64 `json:"memory_current"`
+	CPUUsageNSec  uint64 `json:"cpu_usage_nsec"`
 }
 
 // NewManager creates a new systemd manager
@@ -48,12 +132,26 @@ func NewManager(systemdDir string) *Manager {
 	}
 }
 
+// RenderService returns the service file generated for a configuration
+func RenderService(config *ServiceConfig) (string, error) {
+	tmpl, err := template.New("service").Parse(ServiceTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse service template: %w", err)
+	}
+
+	var content strings.Builder
+	if err := tmpl.Execute(&content, config); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return content.String(), nil
+}
+
 // CreateService creates a systemd service file
 func (m *Manager) CreateService(config *ServiceConfig) error {
-	// Parse template
-	tmpl, err := template.New("service").Parse(ServiceTemplate)
+	content, err := RenderService(config)
 	if err != nil {
-		return fmt.Errorf("failed to parse service template: %w", err)
+		return err
 	}
 
 	// Create service file path
@@ -61,16 +159,9 @@ func (m *Manager) CreateService(config *ServiceConfig) error {
 	serviceFilePath := filepath.Join(m.systemdDir, serviceFileName)
 
 	// Create service file
-	file, err := os.Create(serviceFilePath)
-	if err != nil {
+	if err := os.WriteFile(serviceFilePath, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to create service file: %w", err)
 	}
-	defer file.Close()
-
-	// Execute template
-	if err := tmpl.Execute(file, config); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
-	}
 
 	// Set appropriate permissions
 	if err := os.Chmod(serviceFilePath, 0644); err != nil {
@@ -180,6 +271,77 @@ func (m *Manager) GetServiceLogs(serviceName string, lines int) (string, error)
 	return string(output), nil
 }
 
+// GetUnitState returns the runtime state, restart counter and resource accounting of a systemd service
+func (m *Manager) GetUnitState(serviceName string) (*UnitState, error) {
+	serviceFileName := fmt.Sprintf("%s-pocketbase.service", serviceName)
+
+	cmd := exec.Command("sudo", "systemctl", "show", serviceFileName,
+		"--property=ActiveState,SubState,NRestarts,ExecMainStatus,MainPID,MemoryCurrent,CPUUsageNSec,ActiveEnterTimestamp")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unit state: %w", err)
+	}
+
+	return ParseUnitState(string(output))
+}
+
+// ParseUnitState parses the KEY=VALUE output of systemctl show
+func ParseUnitState(output string) (*UnitState, error) {
+	state := &UnitState{}
+
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+
+		var err error
+		switch key {
+		case "ActiveState":
+			state.ActiveState = value
+		case "SubState":
+			state.SubState = value
+		case "NRestarts":
+			state.NRestarts, err = strconv.Atoi(value)
+		case "ExecMainStatus":
+			state.ExecMainStatus, err = strconv.Atoi(value)
+		case "MainPID":
+			state.MainPID, err = strconv.Atoi(value)
+		case "MemoryCurrent":
+			state.MemoryCurrent = parseAccounting(value)
+		case "CPUUsageNSec":
+			state.CPUUsageNSec = parseAccounting(value)
+		case "ActiveEnterTimestamp":
+			state.ActiveEnterTimestamp = parseTimestamp(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", key, value, err)
+		}
+	}
+
+	return state, nil
+}
+
+// parseAccounting parses a resource accounting property, which systemd reports as
+// "[not set]" or the maximum uint64 when accounting is disabled
+func parseAccounting(value string) uint64 {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || n == math.MaxUint64 {
+		return 0
+	}
+	return n
+}
+
+// parseTimestamp parses a systemd timestamp such as "Thu 2025-07-31 19:30:00 UTC",
+// which systemctl prints in the local time zone. Empty or unknown values yield the zero time.
+func parseTimestamp(value string) time.Time {
+	t, err := time.ParseInLocation("Mon 2006-01-02 15:04:05 MST", value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
 // RestartService restarts a systemd service
 func (m *Manager) RestartService(serviceName string) error {
 	serviceFileName := fmt.Sprintf("%s-pocketbase.service", serviceName)
@@ -222,3 +384,166 @@ func (m *Manager) ValidateServiceFile(serviceName string) error {
 
 	return nil
 }
+
+// ListServiceFiles returns the paths of all pocketbase service files in the systemd directory
+func (m *Manager) ListServiceFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(m.systemdDir, "*-pocketbase.service"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service files: %w", err)
+	}
+
+	return files, nil
+}
+
+// ParseServiceFile reads a pocketbase service file and recovers its directory and listen port
+func (m *Manager) ParseServiceFile(path string) (*UnitInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open service file: %w", err)
+	}
+	defer file.Close()
+
+	info := &UnitInfo{
+		ProjectName: strings.TrimSuffix(filepath.Base(path), "-pocketbase.service"),
+		UnitFile:    path,
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "WorkingDirectory":
+			info.WorkingDirectory = filepath.Clean(strings.TrimSpace(value))
+		case "ExecStart":
+			info.ExecStart = strings.TrimSpace(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read service file: %w", err)
+	}
+
+	if info.ExecStart == "" {
+		return nil, fmt.Errorf("service file %s has no ExecStart", path)
+	}
+
+	args := splitExecStart(info.ExecStart)
+	info.BinaryPath = strings.Trim(args[0], `"'`)
+
+	// Find the --http flag in either "--http=addr" or "--http addr" form
+	for i, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--http="); ok {
+			info.ListenAddress = strings.Trim(value, `"'`)
+			break
+		}
+		if arg == "--http" && i+1 < len(args) {
+			info.ListenAddress = strings.Trim(args[i+1], `"'`)
+			break
+		}
+	}
+
+	info.ServeFlags = parseServeFlags(args)
+
+	if info.ListenAddress == "" {
+		// PocketBase listens on 127.0.0.1:8090 when no --http flag is given
+		info.ListenAddress = "127.0.0.1:8090"
+	}
+
+	_, portStr, err := net.SplitHostPort(info.ListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %w", info.ListenAddress, err)
+	}
+
+	info.Port, err = strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in listen address %q: %w", info.ListenAddress, err)
+	}
+
+	if info.WorkingDirectory == "" {
+		info.WorkingDirectory = filepath.Dir(info.BinaryPath)
+	}
+
+	return info, nil
+}
+
+// splitExecStart splits an ExecStart command line into arguments like systemd does: quotes
+// group words, a backslash escapes the next character and %% is a literal %
+func splitExecStart(line string) []string {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, strings.ReplaceAll(arg.String(), "%%", "%"))
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, strings.ReplaceAll(arg.String(), "%%", "%"))
+	}
+
+	return args
+}
+
+// parseServeFlags returns the flags after "serve" in an ExecStart, skipping the instance specific ones
+func parseServeFlags(args []string) []string {
+	serveAt := -1
+	for i, arg := range args {
+		if arg == "serve" {
+			serveAt = i
+			break
+		}
+	}
+	if serveAt < 0 {
+		return nil
+	}
+
+	var flags []string
+	rest := args[serveAt+1:]
+	for i := 0; i < len(rest); i++ {
+		// Positional arguments are domains for automatic TLS, which belong to the instance
+		if !strings.HasPrefix(rest[i], "-") {
+			continue
+		}
+
+		name, _, hasValue := strings.Cut(rest[i], "=")
+		flag := rest[i : i+1]
+		if !hasValue && i+1 < len(rest) && !strings.HasPrefix(rest[i+1], "-") {
+			// "--flag value" form
+			flag = rest[i : i+2]
+			i++
+		}
+
+		if !slices.Contains(instanceServeFlags, name) {
+			flags = append(flags, flag...)
+		}
+	}
+
+	return flags
+}
@@ -9,6 +9,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/tigawanna/pockestrator/internal/ports"
 )
 
 // Validator handles validation of service configurations
@@ -119,11 +121,22 @@ func (v *Validator) ValidatePort(port int) ValidationResult {
 	}
 
 	// Check if port is available
-	if !v.IsPortAvailable(port) {
+	conflict, err := ports.ProbePort(port)
+	if err != nil {
+		// /proc is unavailable, fall back to trying to bind the port
+		if !v.IsPortAvailable(port) {
+			conflict = &ports.Conflict{Port: port}
+		}
+	}
+	if conflict != nil {
+		message := fmt.Sprintf("Port %d is already in use", port)
+		if conflict.Process != "" {
+			message = fmt.Sprintf("Port %d is already in use by %s (pid %d)", port, conflict.Process, conflict.PID)
+		}
 		result.IsValid = false
 		result.Errors = append(result.Errors, ValidationError{
 			Field:   "port",
-			Message: fmt.Sprintf("Port %d is already in use", port),
+			Message: message,
 			Code:    "PORT_IN_USE",
 		})
 	}
@@ -189,8 +202,12 @@ func (v *Validator) ValidateVersion(version string) ValidationResult {
 
 // IsPortAvailable checks if a port is available
 func (v *Validator) IsPortAvailable(port int) bool {
-	// Try to bind to the port
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if conflict, err := ports.ProbePort(port); err == nil {
+		return conflict == nil
+	}
+
+	// Try to bind to the port on the loopback interface services listen on
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
 	if err != nil {
 		return false
 	}
@@ -2,36 +2,52 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	ozzo "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/plugins/ghupdate"
 	"github.com/pocketbase/pocketbase/plugins/jsvm"
 	"github.com/pocketbase/pocketbase/plugins/migratecmd"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
 	"github.com/pocketbase/pocketbase/tools/hook"
 
+	"github.com/tigawanna/pockestrator/internal/auth"
 	"github.com/tigawanna/pockestrator/internal/caddy"
 	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/metrics"
+	"github.com/tigawanna/pockestrator/internal/ports"
 	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/internal/storage"
 	"github.com/tigawanna/pockestrator/internal/systemd"
 	"github.com/tigawanna/pockestrator/internal/validation"
+	_ "github.com/tigawanna/pockestrator/migrations"
 	"github.com/tigawanna/pockestrator/pkg"
 )
 
 //go:embed dashboard/dist/*
 var dashboardFiles embed.FS
 
+// eventKeepAlive is how often an idle event stream gets a comment, so proxies keep it open
+const eventKeepAlive = 30 * time.Second
+
 // PocketstratorApp represents the main application
 type PocketstratorApp struct {
 	app          *pocketbase.PocketBase
@@ -46,6 +62,26 @@ type Config struct {
 	CaddyConfig   string
 	DefaultDomain string
 	PublicDir     string
+	BackupDir     string
+	CaddyProbeURL string
+	PortRanges    []ports.Range
+
+	// BackupStorage selects where backups are written: local (BackupDir) or s3
+	BackupStorage string
+	S3            storage.S3Config
+
+	HealthCheckInterval  time.Duration
+	HealthCheckRetention time.Duration
+
+	CrashLoopWindow    time.Duration
+	CrashLoopThreshold int
+	RestartBudget      int
+
+	DeployHealthTimeout  time.Duration
+	RestoreHealthTimeout time.Duration
+	UpdateHealthTimeout  time.Duration
+
+	WebhookDeliveryRetention time.Duration
 }
 
 // DefaultConfig returns default configuration
@@ -56,6 +92,22 @@ func DefaultConfig() *Config {
 		CaddyConfig:   "/etc/caddy/Caddyfile",
 		DefaultDomain: "tigawanna.vip",
 		PublicDir:     defaultPublicDir(),
+		BackupDir:     "/var/backups/pockestrator",
+		CaddyProbeURL: "https://127.0.0.1:443",
+		PortRanges:    ports.DefaultRanges,
+		BackupStorage: "local",
+
+		HealthCheckInterval:  5 * time.Minute,
+		HealthCheckRetention: 7 * 24 * time.Hour,
+
+		CrashLoopWindow:    pkg.DefaultCrashLoopWindow,
+		CrashLoopThreshold: pkg.DefaultCrashLoopThreshold,
+
+		DeployHealthTimeout:  time.Minute,
+		RestoreHealthTimeout: time.Minute,
+		UpdateHealthTimeout:  time.Minute,
+
+		WebhookDeliveryRetention: 30 * 24 * time.Hour,
 	}
 }
 
@@ -63,12 +115,21 @@ func main() {
 	app := pocketbase.New()
 	config := DefaultConfig()
 
+	// Setup command line flags
+	setupFlags(app, config)
+
 	// Initialize managers
 	serviceManager := service.NewManager(config.BaseDir, config.SystemdDir, config.CaddyConfig)
 	systemdManager := systemd.NewManager(config.SystemdDir)
 	caddyManager := caddy.NewManager(config.CaddyConfig)
 	validator := validation.NewValidator(config.BaseDir, config.SystemdDir, config.CaddyConfig)
 	dbManager := database.NewManager(app)
+	portManager := ports.NewManager(config.PortRanges, dbManager)
+
+	backupStore, err := newBackupStore(config)
+	if err != nil {
+		log.Fatalf("invalid backup storage: %v", err)
+	}
 
 	// Initialize orchestrator
 	orchestratorConfig := &pkg.Config{
@@ -76,6 +137,17 @@ func main() {
 		SystemdDir:    config.SystemdDir,
 		CaddyConfig:   config.CaddyConfig,
 		DefaultDomain: config.DefaultDomain,
+		BackupDir:     config.BackupDir,
+		CaddyProbeURL: config.CaddyProbeURL,
+		BackupStore:   backupStore,
+
+		CrashLoopWindow:    config.CrashLoopWindow,
+		CrashLoopThreshold: config.CrashLoopThreshold,
+		RestartBudget:      config.RestartBudget,
+
+		DeployHealthTimeout:  config.DeployHealthTimeout,
+		RestoreHealthTimeout: config.RestoreHealthTimeout,
+		UpdateHealthTimeout:  config.UpdateHealthTimeout,
 	}
 
 	orchestrator := pkg.NewOrchestrator(
@@ -84,6 +156,7 @@ func main() {
 		caddyManager,
 		validator,
 		dbManager,
+		portManager,
 		orchestratorConfig,
 	)
 
@@ -93,15 +166,13 @@ func main() {
 		config:       config,
 	}
 
-	// Setup command line flags
-	setupFlags(app, config)
-
 	// Setup plugins
 	setupPlugins(app, config)
 
-	// Setup hooks and routes
+	// Setup hooks, routes and commands
 	pockApp.setupHooks()
 	pockApp.setupRoutes()
+	pockApp.setupCommands()
 
 	// Setup static file serving
 	setupStaticFiles(app, config.PublicDir)
@@ -111,6 +182,10 @@ func main() {
 	log.Printf("⚙️  SystemD directory: %s", config.SystemdDir)
 	log.Printf("🌐 Caddy config: %s", config.CaddyConfig)
 	log.Printf("🏠 Default domain: %s", config.DefaultDomain)
+	log.Printf("💾 Backup directory: %s", config.BackupDir)
+	if config.BackupStorage == "s3" {
+		log.Printf("☁️  Backup storage: s3 bucket %s at %s", config.S3.Bucket, config.S3.Endpoint)
+	}
 
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
@@ -167,7 +242,180 @@ func setupFlags(app *pocketbase.PocketBase, config *Config) {
 		"fallback the request to index.html on missing static path",
 	)
 
+	var portRanges string
+	app.RootCmd.PersistentFlags().StringVar(
+		&portRanges,
+		"portRanges",
+		"8091-65535",
+		"comma separated port ranges to allocate service ports from (e.g. 8091-8999,9100-9199)",
+	)
+
+	app.RootCmd.PersistentFlags().DurationVar(
+		&config.HealthCheckInterval,
+		"healthInterval",
+		config.HealthCheckInterval,
+		"how often to health check the managed services",
+	)
+
+	app.RootCmd.PersistentFlags().DurationVar(
+		&config.HealthCheckRetention,
+		"healthRetention",
+		config.HealthCheckRetention,
+		"how long to keep health check history (0 keeps it forever)",
+	)
+
+	app.RootCmd.PersistentFlags().DurationVar(
+		&config.WebhookDeliveryRetention,
+		"webhookRetention",
+		config.WebhookDeliveryRetention,
+		"how long to keep the log of sent and failed webhook deliveries (0 keeps it forever)",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.CaddyProbeURL,
+		"caddyProbeURL",
+		config.CaddyProbeURL,
+		"the local Caddy listener used to probe services through their public site block",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.BackupDir,
+		"backupDir",
+		config.BackupDir,
+		"the directory service backups are written to",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.BackupStorage,
+		"backupStorage",
+		config.BackupStorage,
+		"where backups are written: local (the backup directory) or s3",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.S3.Endpoint,
+		"s3Endpoint",
+		"",
+		"the S3-compatible endpoint for --backupStorage=s3 (e.g. https://s3.eu-central-1.amazonaws.com)",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.S3.Region,
+		"s3Region",
+		"us-east-1",
+		"the S3 region",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.S3.Bucket,
+		"s3Bucket",
+		"",
+		"the S3 bucket backups are uploaded to",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.S3.Prefix,
+		"s3Prefix",
+		"",
+		"a key prefix for backups in the bucket",
+	)
+
+	app.RootCmd.PersistentFlags().BoolVar(
+		&config.S3.PathStyle,
+		"s3PathStyle",
+		false,
+		"address the bucket as endpoint/bucket (needed by MinIO and most self-hosted stores)",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.S3.AccessKey,
+		"s3AccessKey",
+		os.Getenv("POCKESTRATOR_S3_ACCESS_KEY"),
+		"the S3 access key (defaults to $POCKESTRATOR_S3_ACCESS_KEY)",
+	)
+
+	app.RootCmd.PersistentFlags().StringVar(
+		&config.S3.SecretKey,
+		"s3SecretKey",
+		os.Getenv("POCKESTRATOR_S3_SECRET_KEY"),
+		"the S3 secret key (defaults to $POCKESTRATOR_S3_SECRET_KEY)",
+	)
+
+	app.RootCmd.PersistentFlags().DurationVar(
+		&config.CrashLoopWindow,
+		"crashLoopWindow",
+		config.CrashLoopWindow,
+		"sliding window over which service restarts are counted",
+	)
+
+	app.RootCmd.PersistentFlags().IntVar(
+		&config.CrashLoopThreshold,
+		"crashLoopThreshold",
+		config.CrashLoopThreshold,
+		"restarts within the window after which a service is marked crashlooping",
+	)
+
+	app.RootCmd.PersistentFlags().IntVar(
+		&config.RestartBudget,
+		"restartBudget",
+		config.RestartBudget,
+		"restarts within the window after which a crash looping service is stopped (0 never stops it)",
+	)
+
+	app.RootCmd.PersistentFlags().DurationVar(
+		&config.DeployHealthTimeout,
+		"deployHealthTimeout",
+		config.DeployHealthTimeout,
+		"how long a new service gets to pass its health check before the deploy is marked failed",
+	)
+
+	app.RootCmd.PersistentFlags().DurationVar(
+		&config.RestoreHealthTimeout,
+		"restoreHealthTimeout",
+		config.RestoreHealthTimeout,
+		"how long a restored service gets to pass its health check before the restore is reverted",
+	)
+
+	app.RootCmd.PersistentFlags().DurationVar(
+		&config.UpdateHealthTimeout,
+		"updateHealthTimeout",
+		config.UpdateHealthTimeout,
+		"how long an updated service gets to pass its health check before the update is rolled back",
+	)
+
 	app.RootCmd.ParseFlags(os.Args[1:])
+
+	ranges, err := ports.ParseRanges(portRanges)
+	if err != nil {
+		log.Fatalf("invalid --portRanges: %v", err)
+	}
+	config.PortRanges = ranges
+
+	if config.HealthCheckInterval <= 0 {
+		log.Fatalf("invalid --healthInterval: must be positive")
+	}
+
+	if config.CrashLoopWindow <= 0 || config.CrashLoopThreshold <= 0 || config.RestartBudget < 0 {
+		log.Fatalf("invalid crash loop settings: window and threshold must be positive, budget must not be negative")
+	}
+	if config.CrashLoopWindow < 2*config.HealthCheckInterval {
+		// Restarts are sampled on every health check, so the window needs at least two of them
+		log.Printf("⚠️ --crashLoopWindow %s is shorter than two health check intervals (%s); crash loops may go undetected",
+			config.CrashLoopWindow, config.HealthCheckInterval)
+	}
+}
+
+// newBackupStore creates the configured backup store. Local storage returns nil,
+// which keeps backups in the backup directory.
+func newBackupStore(config *Config) (storage.Store, error) {
+	switch config.BackupStorage {
+	case "local":
+		return nil, nil
+	case "s3":
+		return storage.NewS3Store(config.S3)
+	default:
+		return nil, fmt.Errorf("unknown --backupStorage %q, expected local or s3", config.BackupStorage)
+	}
 }
 
 // setupPlugins sets up PocketBase plugins
@@ -212,26 +460,39 @@ func setupStaticFiles(app *pocketbase.PocketBase, publicDir string) {
 
 // setupHooks sets up PocketBase event hooks
 func (p *PocketstratorApp) setupHooks() {
-	// Service creation hook
-	p.app.OnRecordCreate("services").BindFunc(func(e *core.RecordEvent) error {
+	// Service record hooks - records created, edited or deleted through the records API, such
+	// as from the admin UI, go through the same orchestrator flows as the custom routes.
+	// Only request hooks are used: the orchestrator's own saves must not be handled again.
+	p.app.OnRecordCreateRequest("services").BindFunc(func(e *core.RecordRequestEvent) error {
 		return p.handleServiceCreate(e)
 	})
 
-	// Service update hook
-	p.app.OnRecordUpdate("services").BindFunc(func(e *core.RecordEvent) error {
+	p.app.OnRecordUpdateRequest("services").BindFunc(func(e *core.RecordRequestEvent) error {
 		return p.handleServiceUpdate(e)
 	})
 
-	// Service deletion hook
-	p.app.OnRecordDelete("services").BindFunc(func(e *core.RecordEvent) error {
+	p.app.OnRecordDeleteRequest("services").BindFunc(func(e *core.RecordRequestEvent) error {
 		return p.handleServiceDelete(e)
 	})
 
-	// Health check job - runs every 5 minutes
+	// Teams are managed through the records API, and audited here
+	p.app.OnRecordCreateRequest("teams").BindFunc(p.auditTeamRequest(pkg.AuditCreateTeam))
+	p.app.OnRecordUpdateRequest("teams").BindFunc(p.auditTeamRequest(pkg.AuditUpdateTeam))
+	p.app.OnRecordDeleteRequest("teams").BindFunc(p.auditTeamRequest(pkg.AuditDeleteTeam))
+
+	// The audit log is append-only, for superusers and the app itself too
+	p.app.OnRecordUpdate("audit_log").BindFunc(func(e *core.RecordEvent) error {
+		return errors.New("audit log entries cannot be changed")
+	})
+	p.app.OnRecordDelete("audit_log").BindFunc(func(e *core.RecordEvent) error {
+		return errors.New("audit log entries cannot be deleted")
+	})
+
+	// Health check job - runs every HealthCheckInterval
 	p.app.OnServe().BindFunc(func(e *core.ServeEvent) error {
 		// Schedule periodic health checks
 		go func() {
-			ticker := time.NewTicker(5 * time.Minute)
+			ticker := time.NewTicker(p.config.HealthCheckInterval)
 			defer ticker.Stop()
 			for {
 				select {
@@ -243,6 +504,17 @@ func (p *PocketstratorApp) setupHooks() {
 		return e.Next()
 	})
 
+	// Backup job - checks the backup policies every minute
+	p.app.Cron().MustAdd("pockestrator_backups", "* * * * *", p.performScheduledBackups)
+
+	// Webhooks - deliveries are queued and sent for as long as the app serves, and the
+	// delivery log is pruned hourly
+	p.app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		go p.orchestrator.RunWebhooks(context.Background())
+		return e.Next()
+	})
+	p.app.Cron().MustAdd("pockestrator_webhook_deliveries", "0 * * * *", p.pruneWebhookDeliveries)
+
 	// App startup hook
 	p.app.OnServe().BindFunc(func(e *core.ServeEvent) error {
 		log.Println("✅ Pockestrator is ready!")
@@ -254,69 +526,448 @@ func (p *PocketstratorApp) setupHooks() {
 // setupRoutes sets up custom API routes
 func (p *PocketstratorApp) setupRoutes() {
 	p.app.OnServe().BindFunc(func(e *core.ServeEvent) error {
+		// Every route requires an auth token whose role grants the route's permission
+		// (see internal/auth). Superusers are admins. Routes for a single service also
+		// require the caller to own it or to be a collaborator with the permission.
+		// API tokens act for their owner, within the token's scope.
+		e.Router.Bind(auth.LoadAPIToken("/api/pockestrator/", p.apiTokenAuth))
+
 		// Service management endpoints
-		e.Router.POST("/api/pockestrator/services", p.handleCreateService)
-		e.Router.GET("/api/pockestrator/services", p.handleListServices)
-		e.Router.GET("/api/pockestrator/services/{id}", p.handleGetService)
-		e.Router.DELETE("/api/pockestrator/services/{id}", p.handleDeleteService)
-		e.Router.POST("/api/pockestrator/services/{id}/control", p.handleServiceControl)
-		e.Router.GET("/api/pockestrator/services/{id}/status", p.handleServiceStatus)
-		e.Router.GET("/api/pockestrator/services/{id}/logs", p.handleServiceLogs)
+		e.Router.POST("/api/pockestrator/services", p.handleCreateService).Bind(auth.Require(auth.PermDeploy))
+		e.Router.GET("/api/pockestrator/services", p.handleListServices).Bind(auth.Require(auth.PermRead))
+		e.Router.GET("/api/pockestrator/services/{id}", p.handleGetService).Bind(p.requireService(auth.PermRead))
+		e.Router.PATCH("/api/pockestrator/services/{id}", p.handleUpdateService).Bind(p.requireService(auth.PermDeploy))
+		e.Router.DELETE("/api/pockestrator/services/{id}", p.handleDeleteService).Bind(p.requireService(auth.PermDelete))
+		e.Router.POST("/api/pockestrator/services/{id}/control", p.handleServiceControl).Bind(p.requireService(auth.PermControl))
+		e.Router.POST("/api/pockestrator/services/{id}/clone", p.handleCloneService).Bind(p.requireService(auth.PermDeploy))
+		e.Router.GET("/api/pockestrator/services/{id}/status", p.handleServiceStatus).Bind(p.requireService(auth.PermRead))
+		e.Router.GET("/api/pockestrator/services/{id}/logs", p.handleServiceLogs).Bind(p.requireService(auth.PermRead))
+		e.Router.GET("/api/pockestrator/services/{id}/health/history", p.handleHealthHistory).Bind(p.requireService(auth.PermRead))
+		e.Router.GET("/api/pockestrator/services/{id}/crashes", p.handleCrashEvents).Bind(p.requireService(auth.PermRead))
+		e.Router.GET("/api/pockestrator/services/{id}/usage", p.handleServiceUsage).Bind(p.requireService(auth.PermRead))
+
+		// Collaborator endpoints
+		e.Router.GET("/api/pockestrator/services/{id}/collaborators", p.handleListCollaborators).Bind(p.requireService(auth.PermRead))
+		e.Router.PUT("/api/pockestrator/services/{id}/collaborators/{userId}", p.handleSetCollaborator).Bind(p.requireService(auth.PermShare))
+		e.Router.DELETE("/api/pockestrator/services/{id}/collaborators/{userId}", p.handleRemoveCollaborator).Bind(p.requireService(auth.PermShare))
+
+		// Backup endpoints
+		e.Router.GET("/api/pockestrator/services/{id}/backups", p.handleListBackups).Bind(p.requireService(auth.PermRead))
+		e.Router.POST("/api/pockestrator/services/{id}/backups", p.handleCreateBackup).Bind(p.requireService(auth.PermBackup))
+		e.Router.GET("/api/pockestrator/services/{id}/backup-policy", p.handleGetBackupPolicy).Bind(p.requireService(auth.PermRead))
+		e.Router.PUT("/api/pockestrator/services/{id}/backup-policy", p.handleSetBackupPolicy).Bind(p.requireService(auth.PermBackup))
+		e.Router.DELETE("/api/pockestrator/services/{id}/backup-policy", p.handleDeleteBackupPolicy).Bind(p.requireService(auth.PermBackup))
+		e.Router.GET("/api/pockestrator/backups/{backupId}/download", p.handleDownloadBackup).Bind(p.requireService(auth.PermBackup))
+		e.Router.DELETE("/api/pockestrator/backups/{backupId}", p.handleDeleteBackup).Bind(p.requireService(auth.PermDelete))
+		// Uploaded archives can be far larger than the default body limit
+		e.Router.POST("/api/pockestrator/services/{id}/restore", p.handleRestoreService).Bind(p.requireService(auth.PermRestore), apis.BodyLimit(0))
+
+		// API token endpoints, for signed-in users only
+		e.Router.GET("/api/pockestrator/tokens", p.handleListTokens).Bind(auth.Require(auth.PermRead), auth.RejectAPITokens())
+		e.Router.POST("/api/pockestrator/tokens", p.handleCreateToken).Bind(auth.Require(auth.PermRead), auth.RejectAPITokens())
+		e.Router.DELETE("/api/pockestrator/tokens/{tokenId}", p.handleRevokeToken).Bind(auth.Require(auth.PermRead), auth.RejectAPITokens())
+
+		// Team endpoints
+		e.Router.GET("/api/pockestrator/teams/{teamId}/usage", p.handleTeamUsage).Bind(auth.Require(auth.PermRead))
+
+		// Webhook endpoints
+		e.Router.GET("/api/pockestrator/webhooks", p.handleListWebhooks).Bind(auth.Require(auth.PermManage))
+		e.Router.POST("/api/pockestrator/webhooks", p.handleCreateWebhook).Bind(auth.Require(auth.PermManage))
+		e.Router.DELETE("/api/pockestrator/webhooks/{webhookId}", p.handleDeleteWebhook).Bind(auth.Require(auth.PermManage))
+		e.Router.GET("/api/pockestrator/webhooks/{webhookId}/deliveries", p.handleWebhookDeliveries).Bind(auth.Require(auth.PermManage))
+
+		// Audit log endpoint
+		e.Router.GET("/api/pockestrator/audit", p.handleAuditLog).Bind(auth.Require(auth.PermManage))
+
+		// Manifest endpoint
+		e.Router.POST("/api/pockestrator/apply", p.handleApplyManifest).Bind(auth.Require(auth.PermDeploy))
+
+		// Event stream endpoint
+		e.Router.GET("/api/pockestrator/events", p.handleEvents).Bind(auth.Require(auth.PermRead))
+
+		// Metrics endpoint
+		e.Router.GET("/api/pockestrator/metrics", p.handleMetrics).Bind(auth.Require(auth.PermRead))
 
 		// Validation endpoints
-		e.Router.POST("/api/pockestrator/validate/service", p.handleValidateService)
-		e.Router.GET("/api/pockestrator/validate/system", p.handleValidateSystem)
+		e.Router.POST("/api/pockestrator/validate/service", p.handleValidateService).Bind(auth.Require(auth.PermRead))
+		e.Router.GET("/api/pockestrator/validate/system", p.handleValidateSystem).Bind(auth.Require(auth.PermRead))
+
+		// Discovery endpoints
+		e.Router.GET("/api/pockestrator/discovery", p.handleDiscoverServices).Bind(auth.Require(auth.PermManage))
+		e.Router.POST("/api/pockestrator/discovery/import", p.handleImportServices).Bind(auth.Require(auth.PermManage))
+
+		// Orphaned resource endpoints
+		e.Router.GET("/api/pockestrator/orphans", p.handleScanOrphans).Bind(auth.Require(auth.PermManage))
+		e.Router.POST("/api/pockestrator/orphans/remove", p.handleRemoveOrphans).Bind(auth.Require(auth.PermManage))
+
+		// Port endpoints
+		e.Router.GET("/api/pockestrator/ports/{port}", p.handlePortStatus).Bind(auth.Require(auth.PermRead))
 
 		// System information endpoints
-		e.Router.GET("/api/pockestrator/system/info", p.handleSystemInfo)
-		e.Router.GET("/api/pockestrator/system/health", p.handleSystemHealth)
+		e.Router.GET("/api/pockestrator/system/info", p.handleSystemInfo).Bind(auth.Require(auth.PermRead))
+		e.Router.GET("/api/pockestrator/system/health", p.handleSystemHealth).Bind(auth.Require(auth.PermRead))
 
 		return e.Next()
 	})
 }
 
+// apiTokenAuth resolves an API token to its owner's auth record and the token's scope.
+// Tokens of deleted owners are rejected like unknown tokens.
+func (p *PocketstratorApp) apiTokenAuth(e *core.RequestEvent, token string) (*core.Record, *auth.TokenScope, error) {
+	record, err := p.orchestrator.AuthenticateAPIToken(context.Background(), token)
+	if err != nil {
+		return nil, nil, e.InternalServerError("Failed to check API token", err)
+	}
+	if record == nil {
+		return nil, nil, nil
+	}
+
+	owner, err := e.App.FindRecordById(record.OwnerCollection, record.OwnerID)
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	scope := &auth.TokenScope{TokenID: record.ID, Name: record.Name, Services: record.Services}
+	for _, perm := range record.Permissions {
+		scope.Permissions = append(scope.Permissions, auth.Permission(perm))
+	}
+
+	return owner, scope, nil
+}
+
+// requireService returns a middleware checking the caller's permission on the service a
+// route targets
+func (p *PocketstratorApp) requireService(perm auth.Permission) *hook.Handler[*core.RequestEvent] {
+	return auth.RequireService(perm, p.serviceGrant)
+}
+
+// serviceGrant looks up the caller's grant on the service in the {id} path parameter, or on
+// the service the backup in the {backupId} path parameter belongs to
+func (p *PocketstratorApp) serviceGrant(e *core.RequestEvent) (string, *auth.Grant, error) {
+	ctx := context.Background()
+
+	id := e.Request.PathValue("id")
+	if id == "" {
+		backup, err := p.orchestrator.GetBackup(ctx, e.Request.PathValue("backupId"))
+		if err != nil {
+			return "", nil, e.NotFoundError("Backup not found", err)
+		}
+		id = backup.ServiceID
+	}
+
+	grant, err := p.orchestrator.ServiceGrant(ctx, id, e.Auth.Id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, e.NotFoundError("Service not found", err)
+		}
+		return "", nil, e.InternalServerError("Failed to check service access", err)
+	}
+
+	return id, grant, nil
+}
+
+// auditTeamRequest returns a hook that records a records API change to a team in the audit log
+func (p *PocketstratorApp) auditTeamRequest(action string) func(e *core.RecordRequestEvent) error {
+	return func(e *core.RecordRequestEvent) error {
+		ctx := actorContext(e.RequestEvent, "records")
+		err := e.Next()
+
+		params := map[string]any{"team": e.Record.Id, "name": e.Record.GetString("name")}
+		if action != pkg.AuditDeleteTeam {
+			params["members"] = e.Record.GetStringSlice("members")
+			params["max_services"] = e.Record.GetInt("max_services")
+			params["max_memory"] = e.Record.GetString("max_memory")
+			params["max_backup_storage"] = e.Record.GetString("max_backup_storage")
+		}
+		p.orchestrator.RecordAudit(ctx, action, nil, params, err)
+
+		return err
+	}
+}
+
+// actorContext returns a context recording the operations it is passed to as performed by
+// the caller. Requests made with an API token are recorded as such.
+func actorContext(e *core.RequestEvent, source string) context.Context {
+	ctx := context.Background()
+	if e.Auth == nil {
+		return ctx
+	}
+	if auth.TokenScopeOf(e) != nil {
+		source = "token"
+	}
+	return pkg.WithActor(ctx, pkg.Actor{Name: e.Auth.Email(), ID: e.Auth.Id, Source: source})
+}
+
+// ownerFor returns the owner of a service the caller creates. Users own the services they
+// create, admins may create services for another user, and superusers are not users.
+func ownerFor(caller *core.Record, requested string) string {
+	if caller == nil || caller.Collection().Name != auth.UsersCollection {
+		return requested
+	}
+	if requested != "" && auth.RoleOf(caller) == auth.RoleAdmin {
+		return requested
+	}
+	return caller.Id
+}
+
 // Event Handlers
-func (p *PocketstratorApp) handleServiceCreate(e *core.RecordEvent) error {
-	log.Printf("📦 Creating service: %s", e.Record.GetString("project_name"))
-	e.Record.Set("status", "deploying")
-	return nil
+func (p *PocketstratorApp) handleServiceCreate(e *core.RecordRequestEvent) error {
+	ctx := actorContext(e.RequestEvent, "records")
+
+	req := &pkg.ServiceRequest{
+		ProjectName:       e.Record.GetString("project_name"),
+		PocketBaseVersion: e.Record.GetString("pocketbase_version"),
+		Port:              e.Record.GetInt("port"),
+		Domain:            e.Record.GetString("domain"),
+		Description:       e.Record.GetString("description"),
+		CreatedBy:         e.Record.GetString("created_by"),
+	}
+	for name, target := range map[string]any{"serve_flags": &req.ServeFlags, "env": &req.Env, "limits": &req.Limits} {
+		if err := e.Record.UnmarshalJSONField(name, target); err != nil {
+			return e.BadRequestError("Invalid service record", ozzo.Errors{name: ozzo.NewError("INVALID_JSON", err.Error())})
+		}
+	}
+	if user := e.Auth; user != nil {
+		req.CreatedBy = user.Email()
+	}
+	req.Owner = ownerFor(e.Auth, e.Record.GetString("owner"))
+	req.Team = e.Record.GetString("team")
+
+	log.Printf("📦 Creating service: %s", req.ProjectName)
+
+	// The orchestrator creates the record itself, so the records API's own save is skipped
+	response, err := p.orchestrator.CreateService(ctx, req)
+	if err != nil {
+		return e.InternalServerError("Failed to create service", err)
+	}
+	if response.Status == "error" {
+		return e.BadRequestError(response.Message, validationErrorData(response.Errors))
+	}
+
+	return respondWithServiceRecord(e, response.ID)
 }
 
-func (p *PocketstratorApp) handleServiceUpdate(e *core.RecordEvent) error {
+func (p *PocketstratorApp) handleServiceUpdate(e *core.RecordRequestEvent) error {
+	ctx := actorContext(e.RequestEvent, "records")
+	original := e.Record.Original()
+
+	var grant *auth.Grant
+	if e.Auth != nil && !e.Auth.IsSuperuser() {
+		var err error
+		if grant, err = p.orchestrator.ServiceGrant(ctx, e.Record.Id, e.Auth.Id); err != nil {
+			return e.InternalServerError("Failed to check service access", err)
+		}
+	}
+
+	if e.Record.GetString("project_name") != original.GetString("project_name") {
+		return e.BadRequestError("Validation failed", ozzo.Errors{
+			"project_name": ozzo.NewError("RENAME_NOT_SUPPORTED", "Services cannot be renamed, clone the service instead"),
+		})
+	}
+
+	// The collection rules let operators edit the services they can access, the exact
+	// permission depends on their grant
+	if !auth.CanOnService(e.Auth, auth.PermDeploy, grant) {
+		return e.ForbiddenError("You do not have the deploy permission on this service.", nil)
+	}
+	owner := e.Record.GetString("owner")
+	ownerChanged := owner != original.GetString("owner")
+	if ownerChanged && auth.RoleOf(e.Auth) != auth.RoleAdmin && (grant == nil || !grant.Owner) {
+		return e.ForbiddenError("Only the owner or an admin can transfer a service.", nil)
+	}
+	team := e.Record.GetString("team")
+	teamChanged := team != original.GetString("team")
+	if teamChanged && auth.RoleOf(e.Auth) != auth.RoleAdmin {
+		return e.ForbiddenError("Only an admin can move a service to another team.", nil)
+	}
+
+	req, changed, err := serviceUpdateFromRecord(original, e.Record)
+	if err != nil {
+		return e.BadRequestError("Invalid service record", err)
+	}
+	svc := &database.ServiceRecord{ID: e.Record.Id, ProjectName: e.Record.GetString("project_name")}
+
+	// A new owner must exist and belong to the team the service ends up in
+	if ownerChanged {
+		if err := p.orchestrator.ValidateServiceOwner(ctx, owner, team); err != nil {
+			return transferError(e, err)
+		}
+	}
+
+	// Edits that deploy nothing are saved by the records API, and audited here. A move
+	// between teams is checked against the new team's quotas first, and the team stays
+	// locked until the record is saved. Once it is, the transfer goes through the
+	// orchestrator, which checks the owner against the saved team and records it.
+	if !changed {
+		if teamChanged {
+			unlock, err := p.orchestrator.CheckServiceTeam(ctx, e.Record.Id, team)
+			if err != nil {
+				if errors.Is(err, pkg.ErrInvalidTeam) {
+					return e.BadRequestError("Validation failed", ozzo.Errors{"team": ozzo.NewError("INVALID_TEAM", err.Error())})
+				}
+				return e.InternalServerError("Failed to move service", err)
+			}
+			defer unlock()
+		}
+
+		err := e.Next()
+		if teamChanged {
+			p.orchestrator.RecordAudit(ctx, pkg.AuditMoveTeam, svc, map[string]any{"team": team}, err)
+		}
+		if ownerChanged && err == nil {
+			if err := p.orchestrator.SetServiceOwner(ctx, e.Record.Id, owner); err != nil {
+				log.Printf("⚠️ Failed to transfer %s: %v", svc.ProjectName, err)
+			}
+		}
+		if description := e.Record.GetString("description"); description != original.GetString("description") {
+			p.orchestrator.RecordAudit(ctx, pkg.AuditUpdate, svc, map[string]any{"description": description}, err)
+		}
+		return err
+	}
+
+	// Moves between teams are checked and saved with the rest of the update
+	if teamChanged {
+		req.Team = &team
+	}
+
 	log.Printf("🔄 Updating service: %s", e.Record.GetString("project_name"))
-	return nil
+
+	// The orchestrator records the change itself, so the records API's own save is skipped
+	response, err := p.orchestrator.UpdateService(ctx, e.Record.Id, req)
+	if err != nil {
+		return e.InternalServerError("Failed to update service", err)
+	}
+	if response.Status == "error" {
+		return e.BadRequestError(response.Message, validationErrorData(response.Errors))
+	}
+	if ownerChanged {
+		if err := p.orchestrator.SetServiceOwner(ctx, e.Record.Id, owner); err != nil {
+			return transferError(e, err)
+		}
+	}
+
+	return respondWithServiceRecord(e, e.Record.Id)
 }
 
-func (p *PocketstratorApp) handleServiceDelete(e *core.RecordEvent) error {
-	ctx := context.Background()
+// transferError answers a records API request whose owner transfer failed
+func transferError(e *core.RecordRequestEvent, err error) error {
+	if errors.Is(err, pkg.ErrInvalidOwner) {
+		return e.BadRequestError("Validation failed", ozzo.Errors{"owner": ozzo.NewError("INVALID_OWNER", err.Error())})
+	}
+	return e.InternalServerError("Failed to transfer service", err)
+}
+
+// respondWithServiceRecord answers a records API request with a service record as the
+// orchestrator stored it
+func respondWithServiceRecord(e *core.RecordRequestEvent, id string) error {
+	record, err := e.App.FindRecordById("services", id)
+	if err != nil {
+		return e.InternalServerError("Failed to load service record", err)
+	}
+	if err := apis.EnrichRecord(e.RequestEvent, record); err != nil {
+		return e.InternalServerError("Failed to enrich record", err)
+	}
+
+	return e.JSON(http.StatusOK, record)
+}
+
+// serviceUpdateFromRecord builds an update request from the deployed fields an edit of a
+// services record changes, and reports whether it changes any
+func serviceUpdateFromRecord(original, edited *core.Record) (*pkg.ServiceUpdateRequest, bool, error) {
+	req := &pkg.ServiceUpdateRequest{}
+	changed := false
+
+	if port := edited.GetInt("port"); port != original.GetInt("port") {
+		req.Port = port
+		changed = true
+	}
+	if version := edited.GetString("pocketbase_version"); version != original.GetString("pocketbase_version") {
+		req.PocketBaseVersion = version
+		changed = true
+	}
+	if domain := edited.GetString("domain"); domain != original.GetString("domain") {
+		req.Domain = domain
+		changed = true
+	}
+
+	var flags, originalFlags []string
+	var env, originalEnv map[string]string
+	var limits, originalLimits database.ServiceLimits
+	for _, field := range []struct {
+		name             string
+		edited, original any
+	}{
+		{"serve_flags", &flags, &originalFlags},
+		{"env", &env, &originalEnv},
+		{"limits", &limits, &originalLimits},
+	} {
+		if err := edited.UnmarshalJSONField(field.name, field.edited); err != nil {
+			return nil, false, ozzo.Errors{field.name: ozzo.NewError("INVALID_JSON", err.Error())}
+		}
+		original.UnmarshalJSONField(field.name, field.original)
+	}
+
+	// Cleared flags and variables are sent as empty, not nil, so that they are removed
+	if !slices.Equal(flags, originalFlags) {
+		req.ServeFlags = append([]string{}, flags...)
+		changed = true
+	}
+	if !maps.Equal(env, originalEnv) {
+		req.Env = maps.Clone(env)
+		if req.Env == nil {
+			req.Env = map[string]string{}
+		}
+		changed = true
+	}
+	if limits != originalLimits {
+		req.Limits = &limits
+		changed = true
+	}
+
+	return req, changed, nil
+}
+
+// validationErrorData converts validation errors into PocketBase's per-field error data
+func validationErrorData(errs []validation.ValidationError) ozzo.Errors {
+	data := ozzo.Errors{}
+	for _, ve := range errs {
+		if _, ok := data[ve.Field]; !ok {
+			data[ve.Field] = ozzo.NewError(ve.Code, ve.Message)
+		}
+	}
+	return data
+}
+
+func (p *PocketstratorApp) handleServiceDelete(e *core.RecordRequestEvent) error {
+	ctx := actorContext(e.RequestEvent, "records")
 	projectName := e.Record.GetString("project_name")
 
 	log.Printf("🗑️  Deleting service: %s", projectName)
 
-	// Use orchestrator to handle the deletion
-	_, err := p.orchestrator.DeleteService(ctx, e.Record.Id)
-	if err != nil {
+	// The orchestrator removes the unit, site and files before deleting the record itself
+	if _, err := p.orchestrator.DeleteService(ctx, e.Record.Id); err != nil {
 		log.Printf("❌ Failed to delete service %s: %v", projectName, err)
-		return fmt.Errorf("service deletion failed: %w", err)
+		return e.InternalServerError("Failed to delete service", err)
 	}
 
 	log.Printf("✅ Service %s deleted successfully", projectName)
-	return nil
+	return e.NoContent(http.StatusNoContent)
 }
 
 // API Handlers
 func (p *PocketstratorApp) handleCreateService(e *core.RequestEvent) error {
-	ctx := context.Background()
+	ctx := actorContext(e, "api")
 
 	var req pkg.ServiceRequest
 	if err := e.BindBody(&req); err != nil {
 		return e.BadRequestError("Invalid request body", err)
 	}
 
-	// Set the creator
-	if auth := e.Auth; auth != nil {
-		req.CreatedBy = auth.Email()
+	// Set the creator and owner
+	if user := e.Auth; user != nil {
+		req.CreatedBy = user.Email()
 	}
+	req.Owner = ownerFor(e.Auth, req.Owner)
 
 	response, err := p.orchestrator.CreateService(ctx, &req)
 	if err != nil {
@@ -326,10 +977,33 @@ func (p *PocketstratorApp) handleCreateService(e *core.RequestEvent) error {
 	return e.JSON(200, response)
 }
 
+func (p *PocketstratorApp) handleCloneService(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	var req pkg.CloneRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	// Set the creator and owner
+	if user := e.Auth; user != nil {
+		req.CreatedBy = user.Email()
+	}
+	req.Owner = ownerFor(e.Auth, req.Owner)
+
+	response, err := p.orchestrator.CloneService(ctx, id, &req)
+	if err != nil {
+		return e.InternalServerError("Failed to clone service", err)
+	}
+
+	return e.JSON(200, response)
+}
+
 func (p *PocketstratorApp) handleListServices(e *core.RequestEvent) error {
 	ctx := context.Background()
 
-	services, err := p.orchestrator.ListServices(ctx)
+	services, err := p.accessibleServices(ctx, e)
 	if err != nil {
 		return e.InternalServerError("Failed to list services", err)
 	}
@@ -340,6 +1014,26 @@ func (p *PocketstratorApp) handleListServices(e *core.RequestEvent) error {
 	})
 }
 
+// accessibleServices returns every service for admins, and the services a user owns or
+// collaborates on otherwise, limited to the services of the request's API token
+func (p *PocketstratorApp) accessibleServices(ctx context.Context, e *core.RequestEvent) ([]*database.ServiceRecord, error) {
+	var services []*database.ServiceRecord
+	var err error
+	if auth.RoleOf(e.Auth) == auth.RoleAdmin {
+		services, err = p.orchestrator.ListServices(ctx)
+	} else {
+		services, err = p.orchestrator.ListServicesForUser(ctx, e.Auth.Id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scope := auth.TokenScopeOf(e)
+	return slices.DeleteFunc(services, func(svc *database.ServiceRecord) bool {
+		return !scope.AllowsService(svc.ID)
+	}), nil
+}
+
 func (p *PocketstratorApp) handleGetService(e *core.RequestEvent) error {
 	ctx := context.Background()
 	id := e.Request.PathValue("id")
@@ -352,8 +1046,29 @@ func (p *PocketstratorApp) handleGetService(e *core.RequestEvent) error {
 	return e.JSON(200, response)
 }
 
+func (p *PocketstratorApp) handleUpdateService(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	var req pkg.ServiceUpdateRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	if _, err := p.orchestrator.GetService(ctx, id); err != nil {
+		return e.NotFoundError("Service not found", err)
+	}
+
+	response, err := p.orchestrator.UpdateService(ctx, id, &req)
+	if err != nil {
+		return e.InternalServerError("Failed to update service", err)
+	}
+
+	return e.JSON(200, response)
+}
+
 func (p *PocketstratorApp) handleDeleteService(e *core.RequestEvent) error {
-	ctx := context.Background()
+	ctx := actorContext(e, "api")
 	id := e.Request.PathValue("id")
 
 	response, err := p.orchestrator.DeleteService(ctx, id)
@@ -365,7 +1080,7 @@ func (p *PocketstratorApp) handleDeleteService(e *core.RequestEvent) error {
 }
 
 func (p *PocketstratorApp) handleServiceControl(e *core.RequestEvent) error {
-	ctx := context.Background()
+	ctx := actorContext(e, "api")
 	id := e.Request.PathValue("id")
 
 	var req struct {
@@ -416,6 +1131,649 @@ func (p *PocketstratorApp) handleServiceLogs(e *core.RequestEvent) error {
 	return e.JSON(200, response)
 }
 
+func (p *PocketstratorApp) handleHealthHistory(e *core.RequestEvent) error {
+	ctx := context.Background()
+	id := e.Request.PathValue("id")
+	query := e.Request.URL.Query()
+
+	var from, to time.Time
+	var err error
+	if fromParam := query.Get("from"); fromParam != "" {
+		if from, err = time.Parse(time.RFC3339, fromParam); err != nil {
+			return e.BadRequestError("Invalid from time, expected RFC3339", err)
+		}
+	}
+	if toParam := query.Get("to"); toParam != "" {
+		if to, err = time.Parse(time.RFC3339, toParam); err != nil {
+			return e.BadRequestError("Invalid to time, expected RFC3339", err)
+		}
+	}
+
+	limit := 100 // default
+	if limitParam := query.Get("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = min(parsedLimit, 1000)
+		}
+	}
+
+	response, err := p.orchestrator.GetHealthHistory(ctx, id, from, to, limit)
+	if err != nil {
+		return e.InternalServerError("Failed to get health history", err)
+	}
+
+	return e.JSON(200, response)
+}
+
+func (p *PocketstratorApp) handleCrashEvents(e *core.RequestEvent) error {
+	ctx := context.Background()
+	id := e.Request.PathValue("id")
+
+	limit := 20 // default
+	if limitParam := e.Request.URL.Query().Get("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = min(parsedLimit, 500)
+		}
+	}
+
+	response, err := p.orchestrator.GetCrashEvents(ctx, id, limit)
+	if err != nil {
+		return e.InternalServerError("Failed to get crash events", err)
+	}
+
+	return e.JSON(200, response)
+}
+
+func (p *PocketstratorApp) handleServiceUsage(e *core.RequestEvent) error {
+	ctx := context.Background()
+	id := e.Request.PathValue("id")
+
+	usage, err := p.orchestrator.GetServiceUsage(ctx, id)
+	if err != nil {
+		return e.InternalServerError("Failed to get service usage", err)
+	}
+
+	return e.JSON(200, usage)
+}
+
+func (p *PocketstratorApp) handleListCollaborators(e *core.RequestEvent) error {
+	ctx := context.Background()
+	id := e.Request.PathValue("id")
+
+	collaborators, err := p.orchestrator.ListCollaborators(ctx, id)
+	if err != nil {
+		return e.InternalServerError("Failed to list collaborators", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"collaborators": collaborators,
+		"total":         len(collaborators),
+	})
+}
+
+func (p *PocketstratorApp) handleSetCollaborator(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	var req pkg.CollaboratorRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	collaborator, err := p.orchestrator.SetCollaborator(ctx, id, e.Request.PathValue("userId"), &req)
+	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidCollaborator) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		return e.InternalServerError("Failed to save collaborator", err)
+	}
+
+	return e.JSON(200, collaborator)
+}
+
+func (p *PocketstratorApp) handleRemoveCollaborator(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	if err := p.orchestrator.RemoveCollaborator(ctx, id, e.Request.PathValue("userId")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return e.NotFoundError("Collaborator not found", err)
+		}
+		return e.InternalServerError("Failed to remove collaborator", err)
+	}
+
+	return e.NoContent(204)
+}
+
+func (p *PocketstratorApp) handleListBackups(e *core.RequestEvent) error {
+	ctx := context.Background()
+	id := e.Request.PathValue("id")
+
+	response, err := p.orchestrator.ListBackups(ctx, id)
+	if err != nil {
+		return e.InternalServerError("Failed to list backups", err)
+	}
+
+	return e.JSON(200, response)
+}
+
+func (p *PocketstratorApp) handleCreateBackup(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	backup, err := p.orchestrator.CreateBackup(ctx, id, "manual")
+	if err != nil {
+		if errors.Is(err, pkg.ErrBackupQuota) {
+			return e.BadRequestError("Validation failed", ozzo.Errors{"team": ozzo.NewError("TEAM_QUOTA_BACKUP_STORAGE", err.Error())})
+		}
+		return e.InternalServerError("Failed to create backup", err)
+	}
+
+	return e.JSON(201, backup)
+}
+
+func (p *PocketstratorApp) handleGetBackupPolicy(e *core.RequestEvent) error {
+	ctx := context.Background()
+	id := e.Request.PathValue("id")
+
+	policy, err := p.orchestrator.GetBackupPolicy(ctx, id)
+	if err != nil {
+		return e.InternalServerError("Failed to get backup policy", err)
+	}
+	if policy == nil {
+		return e.NotFoundError("Service has no backup policy", nil)
+	}
+
+	return e.JSON(200, policy)
+}
+
+func (p *PocketstratorApp) handleSetBackupPolicy(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	var req pkg.BackupPolicyRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	policy, err := p.orchestrator.SetBackupPolicy(ctx, id, &req)
+	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidBackupPolicy) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		return e.InternalServerError("Failed to save backup policy", err)
+	}
+
+	return e.JSON(200, policy)
+}
+
+func (p *PocketstratorApp) handleDeleteBackupPolicy(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	if err := p.orchestrator.DeleteBackupPolicy(ctx, id); err != nil {
+		return e.InternalServerError("Failed to delete backup policy", err)
+	}
+
+	return e.NoContent(204)
+}
+
+func (p *PocketstratorApp) handleDownloadBackup(e *core.RequestEvent) error {
+	ctx := context.Background()
+
+	backup, reader, err := p.orchestrator.OpenBackup(ctx, e.Request.PathValue("backupId"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return e.NotFoundError("Backup archive not found", err)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return e.NotFoundError("Backup not found", err)
+		}
+		return e.InternalServerError("Failed to open backup", err)
+	}
+	defer reader.Close()
+
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", backup.Filename))
+	e.Response.Header().Set("Content-Length", strconv.FormatInt(backup.Size, 10))
+	return e.Stream(200, "application/zip", reader)
+}
+
+func (p *PocketstratorApp) handleDeleteBackup(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+
+	if err := p.orchestrator.DeleteBackup(ctx, e.Request.PathValue("backupId")); err != nil {
+		return e.InternalServerError("Failed to delete backup", err)
+	}
+
+	return e.NoContent(204)
+}
+
+func (p *PocketstratorApp) handleRestoreService(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+	id := e.Request.PathValue("id")
+
+	var req pkg.RestoreRequest
+	if strings.HasPrefix(e.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		files, err := e.FindUploadedFiles("file")
+		if err != nil || len(files) != 1 {
+			return e.BadRequestError("Expected a single backup archive in the file field", err)
+		}
+
+		archivePath, err := saveUploadedFile(files[0])
+		if err != nil {
+			return e.InternalServerError("Failed to store uploaded archive", err)
+		}
+		defer os.Remove(archivePath)
+
+		req.ArchivePath = archivePath
+	} else if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	response, err := p.orchestrator.RestoreService(ctx, id, &req)
+	if err != nil {
+		return e.InternalServerError("Failed to restore service", err)
+	}
+
+	return e.JSON(200, response)
+}
+
+// saveUploadedFile copies an uploaded file to a temporary file and returns its path
+func saveUploadedFile(file *filesystem.File) (string, error) {
+	src, err := file.Reader.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "pockestrator-upload-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+
+	return dst.Name(), nil
+}
+
+func (p *PocketstratorApp) handleApplyManifest(e *core.RequestEvent) error {
+	ctx := actorContext(e, "manifest")
+
+	body, err := io.ReadAll(e.Request.Body)
+	if err != nil {
+		return e.BadRequestError("Failed to read manifest", err)
+	}
+
+	manifest, err := pkg.ParseManifest(body)
+	if err != nil {
+		return e.BadRequestError(err.Error(), err)
+	}
+
+	query := e.Request.URL.Query()
+	opts := pkg.ApplyOptions{
+		Prune:  query.Get("prune") == "true",
+		DryRun: query.Get("dry_run") == "true",
+	}
+	// Pruning deletes services, which deploying alone does not allow
+	if opts.Prune && !opts.DryRun && !auth.RoleOf(e.Auth).Can(auth.PermDelete) {
+		return e.ForbiddenError("Your role does not allow the delete permission needed to prune services.", nil)
+	}
+	if opts.Prune && !opts.DryRun && !auth.TokenScopeOf(e).Allows(auth.PermDelete) {
+		return e.ForbiddenError("This API token is not scoped to the delete permission needed to prune services.", nil)
+	}
+	if user := e.Auth; user != nil {
+		opts.CreatedBy = user.Email()
+	}
+	opts.Owner = ownerFor(e.Auth, "")
+	opts.CheckGrants = auth.RoleOf(e.Auth) != auth.RoleAdmin
+
+	result, err := p.orchestrator.ApplyManifest(ctx, manifest, opts)
+	if err != nil {
+		if errors.Is(err, pkg.ErrApplyForbidden) {
+			return e.ForbiddenError(err.Error(), nil)
+		}
+		return e.InternalServerError("Failed to apply manifest", err)
+	}
+
+	return e.JSON(200, result)
+}
+
+func (p *PocketstratorApp) handleListTokens(e *core.RequestEvent) error {
+	ctx := context.Background()
+
+	// Admins see every token, users their own
+	ownerID := e.Auth.Id
+	if auth.RoleOf(e.Auth) == auth.RoleAdmin {
+		ownerID = ""
+	}
+
+	tokens, err := p.orchestrator.ListAPITokens(ctx, ownerID)
+	if err != nil {
+		return e.InternalServerError("Failed to list API tokens", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"tokens": tokens,
+		"total":  len(tokens),
+	})
+}
+
+func (p *PocketstratorApp) handleCreateToken(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+
+	var req pkg.TokenRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	owner := pkg.TokenOwner{
+		Collection: e.Auth.Collection().Name,
+		ID:         e.Auth.Id,
+		Email:      e.Auth.Email(),
+		Role:       auth.RoleOf(e.Auth),
+	}
+
+	token, err := p.orchestrator.CreateAPIToken(ctx, owner, &req)
+	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidToken) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		return e.InternalServerError("Failed to create API token", err)
+	}
+
+	return e.JSON(200, token)
+}
+
+func (p *PocketstratorApp) handleRevokeToken(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+
+	// Users can only revoke their own tokens, and cannot tell whether others exist
+	token, err := p.orchestrator.GetAPIToken(ctx, e.Request.PathValue("tokenId"))
+	if err != nil || (token.OwnerID != e.Auth.Id && auth.RoleOf(e.Auth) != auth.RoleAdmin) {
+		return e.NotFoundError("API token not found", err)
+	}
+
+	if err := p.orchestrator.RevokeAPIToken(ctx, token.ID); err != nil {
+		return e.InternalServerError("Failed to revoke API token", err)
+	}
+
+	return e.NoContent(204)
+}
+
+func (p *PocketstratorApp) handleTeamUsage(e *core.RequestEvent) error {
+	ctx := context.Background()
+
+	// Members can see the usage of their teams, admins of every team
+	team, err := p.orchestrator.GetTeam(ctx, e.Request.PathValue("teamId"))
+	if err != nil || (!team.HasMember(e.Auth.Id) && auth.RoleOf(e.Auth) != auth.RoleAdmin) {
+		return e.NotFoundError("Team not found", err)
+	}
+
+	usage, err := p.orchestrator.GetTeamUsage(ctx, team.ID)
+	if err != nil {
+		return e.InternalServerError("Failed to get team usage", err)
+	}
+
+	return e.JSON(200, usage)
+}
+
+func (p *PocketstratorApp) handleListWebhooks(e *core.RequestEvent) error {
+	webhooks, err := p.orchestrator.ListWebhooks(context.Background())
+	if err != nil {
+		return e.InternalServerError("Failed to list webhooks", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"webhooks": webhooks,
+		"total":    len(webhooks),
+	})
+}
+
+func (p *PocketstratorApp) handleCreateWebhook(e *core.RequestEvent) error {
+	var req pkg.WebhookRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	webhook, err := p.orchestrator.CreateWebhook(actorContext(e, "api"), &req)
+	if err != nil {
+		if errors.Is(err, pkg.ErrInvalidWebhook) {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		return e.InternalServerError("Failed to create webhook", err)
+	}
+
+	return e.JSON(200, webhook)
+}
+
+func (p *PocketstratorApp) handleDeleteWebhook(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+
+	webhook, err := p.orchestrator.GetWebhook(ctx, e.Request.PathValue("webhookId"))
+	if err != nil {
+		return e.NotFoundError("Webhook not found", err)
+	}
+
+	if err := p.orchestrator.DeleteWebhook(ctx, webhook.ID); err != nil {
+		return e.InternalServerError("Failed to delete webhook", err)
+	}
+
+	return e.NoContent(204)
+}
+
+func (p *PocketstratorApp) handleWebhookDeliveries(e *core.RequestEvent) error {
+	ctx := context.Background()
+	query := e.Request.URL.Query()
+
+	webhook, err := p.orchestrator.GetWebhook(ctx, e.Request.PathValue("webhookId"))
+	if err != nil {
+		return e.NotFoundError("Webhook not found", err)
+	}
+
+	status := query.Get("status")
+	if status != "" && !slices.Contains([]string{database.DeliveryPending, database.DeliveryDelivered, database.DeliveryFailed}, status) {
+		return e.BadRequestError("Invalid status, expected pending, delivered or failed", nil)
+	}
+
+	limit := 100 // default
+	if limitParam := query.Get("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = min(parsedLimit, 1000)
+		}
+	}
+
+	deliveries, err := p.orchestrator.ListWebhookDeliveries(ctx, webhook.ID, status, limit)
+	if err != nil {
+		return e.InternalServerError("Failed to list webhook deliveries", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"webhook":    webhook,
+		"deliveries": deliveries,
+		"total":      len(deliveries),
+	})
+}
+
+func (p *PocketstratorApp) handleAuditLog(e *core.RequestEvent) error {
+	ctx := context.Background()
+	query := e.Request.URL.Query()
+	csvExport := query.Get("format") == "csv"
+
+	filter := database.AuditFilter{
+		Actor:   query.Get("actor"),
+		Action:  query.Get("action"),
+		Service: query.Get("service"),
+		Outcome: query.Get("outcome"),
+	}
+
+	var err error
+	if fromParam := query.Get("from"); fromParam != "" {
+		if filter.From, err = time.Parse(time.RFC3339, fromParam); err != nil {
+			return e.BadRequestError("Invalid from time, expected RFC3339", err)
+		}
+	}
+	if toParam := query.Get("to"); toParam != "" {
+		if filter.To, err = time.Parse(time.RFC3339, toParam); err != nil {
+			return e.BadRequestError("Invalid to time, expected RFC3339", err)
+		}
+	}
+
+	// CSV exports include every matching entry unless limited
+	if !csvExport {
+		filter.Limit = 100 // default
+	}
+	if limitParam := query.Get("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			filter.Limit = parsedLimit
+			if !csvExport {
+				filter.Limit = min(parsedLimit, 1000)
+			}
+		}
+	}
+
+	entries, err := p.orchestrator.ListAuditEntries(ctx, filter)
+	if err != nil {
+		return e.InternalServerError("Failed to list audit log", err)
+	}
+
+	if csvExport {
+		e.Response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		e.Response.Header().Set("Content-Disposition", `attachment; filename="pockestrator-audit.csv"`)
+		e.Response.WriteHeader(http.StatusOK)
+		return pkg.WriteAuditCSV(e.Response, entries)
+	}
+
+	return e.JSON(200, map[string]any{
+		"entries": entries,
+		"total":   len(entries),
+	})
+}
+
+func (p *PocketstratorApp) handleEvents(e *core.RequestEvent) error {
+	ctx := context.Background()
+	query := e.Request.URL.Query()
+
+	var filter pkg.EventFilter
+	for _, ref := range query["service"] {
+		svc, err := p.orchestrator.FindService(ctx, ref)
+		if err != nil {
+			return e.NotFoundError("Service not found", err)
+		}
+		if !p.canAccessService(ctx, e, svc.ID) {
+			return e.ForbiddenError(fmt.Sprintf("You cannot access service %s.", svc.ProjectName), nil)
+		}
+		filter.Services = append(filter.Services, svc.ID)
+	}
+	for _, eventType := range query["type"] {
+		if !slices.Contains(pkg.EventTypes, pkg.EventType(eventType)) {
+			return e.BadRequestError(fmt.Sprintf("Unknown event type %q", eventType), nil)
+		}
+		filter.Types = append(filter.Types, pkg.EventType(eventType))
+	}
+
+	// EventSource sends the last ID it received when it reconnects
+	var after uint64
+	lastID := e.Request.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = query.Get("last_event_id")
+	}
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			return e.BadRequestError("Invalid last event ID", err)
+		}
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(e.Response)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return e.InternalServerError("Failed to open event stream", err)
+	}
+
+	events, unsubscribe := p.orchestrator.Events().Subscribe(after, filter)
+	defer unsubscribe()
+
+	e.Response.Header().Set("Content-Type", "text/event-stream")
+	e.Response.Header().Set("Cache-Control", "no-store")
+	e.Response.Header().Set("X-Accel-Buffering", "no")
+	e.Response.WriteHeader(200)
+	if err := e.Flush(); err != nil {
+		return nil
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-e.Request.Context().Done():
+			return nil
+		case event, ok := <-events:
+			// Closed when the client fell too far behind, it reconnects and resumes
+			if !ok {
+				return nil
+			}
+			// Access is checked per event, services can be shared or created mid-stream
+			if !p.canAccessService(ctx, e, event.ServiceID) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(e.Response, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		case <-keepAlive.C:
+			fmt.Fprint(e.Response, ": keep-alive\n\n")
+		}
+		if err := e.Flush(); err != nil {
+			return nil
+		}
+	}
+}
+
+// canAccessService reports whether the caller can read a service: admins can read every
+// service, others need a grant, and API tokens must allow the service
+func (p *PocketstratorApp) canAccessService(ctx context.Context, e *core.RequestEvent, id string) bool {
+	if !auth.TokenScopeOf(e).AllowsService(id) {
+		return false
+	}
+	if auth.RoleOf(e.Auth) == auth.RoleAdmin {
+		return true
+	}
+
+	grant, err := p.orchestrator.ServiceGrant(ctx, id, e.Auth.Id)
+	return err == nil && grant != nil
+}
+
+func (p *PocketstratorApp) handleMetrics(e *core.RequestEvent) error {
+	ctx := context.Background()
+
+	families, err := p.orchestrator.CollectMetrics(ctx)
+	if err != nil {
+		return e.InternalServerError("Failed to collect metrics", err)
+	}
+
+	// Users only see the per-service samples of services they can access
+	if auth.RoleOf(e.Auth) != auth.RoleAdmin || auth.TokenScopeOf(e) != nil {
+		services, err := p.accessibleServices(ctx, e)
+		if err != nil {
+			return e.InternalServerError("Failed to list services", err)
+		}
+		names := make(map[string]bool, len(services))
+		for _, svc := range services {
+			names[svc.ProjectName] = true
+		}
+		families = metrics.FilterLabel(families, "service", func(name string) bool { return names[name] })
+	}
+
+	e.Response.Header().Set("Content-Type", metrics.ContentType)
+	e.Response.WriteHeader(200)
+	return metrics.Write(e.Response, families)
+}
+
 func (p *PocketstratorApp) handleValidateService(e *core.RequestEvent) error {
 	ctx := context.Background()
 
@@ -462,6 +1820,93 @@ func (p *PocketstratorApp) handleValidateSystem(e *core.RequestEvent) error {
 	return e.JSON(200, result)
 }
 
+func (p *PocketstratorApp) handleDiscoverServices(e *core.RequestEvent) error {
+	ctx := context.Background()
+
+	discovered, err := p.orchestrator.DiscoverServices(ctx)
+	if err != nil {
+		return e.InternalServerError("Failed to discover services", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"services": discovered,
+		"total":    len(discovered),
+	})
+}
+
+func (p *PocketstratorApp) handleImportServices(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+
+	var req struct {
+		ProjectNames []string `json:"project_names"`
+	}
+
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	createdBy := ""
+	if user := e.Auth; user != nil {
+		createdBy = user.Email()
+	}
+
+	results, err := p.orchestrator.ImportServices(ctx, req.ProjectNames, createdBy)
+	if err != nil {
+		return e.InternalServerError("Failed to import services", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"results": results,
+		"total":   len(results),
+	})
+}
+
+func (p *PocketstratorApp) handleScanOrphans(e *core.RequestEvent) error {
+	ctx := context.Background()
+
+	report, err := p.orchestrator.ScanOrphans(ctx)
+	if err != nil {
+		return e.InternalServerError("Failed to scan for orphaned resources", err)
+	}
+
+	return e.JSON(200, report)
+}
+
+func (p *PocketstratorApp) handleRemoveOrphans(e *core.RequestEvent) error {
+	ctx := actorContext(e, "api")
+
+	var req pkg.OrphanRemovalRequest
+	if err := e.BindBody(&req); err != nil {
+		return e.BadRequestError("Invalid request body", err)
+	}
+
+	results, err := p.orchestrator.RemoveOrphans(ctx, &req)
+	if err != nil {
+		return e.InternalServerError("Failed to remove orphaned resources", err)
+	}
+
+	return e.JSON(200, map[string]any{
+		"results": results,
+		"total":   len(results),
+	})
+}
+
+func (p *PocketstratorApp) handlePortStatus(e *core.RequestEvent) error {
+	ctx := context.Background()
+
+	port, err := strconv.Atoi(e.Request.PathValue("port"))
+	if err != nil || port < 1 || port > 65535 {
+		return e.BadRequestError("Invalid port", err)
+	}
+
+	status, err := p.orchestrator.ProbePort(ctx, port)
+	if err != nil {
+		return e.InternalServerError("Failed to probe port", err)
+	}
+
+	return e.JSON(200, status)
+}
+
 func (p *PocketstratorApp) handleSystemInfo(e *core.RequestEvent) error {
 	return e.JSON(200, map[string]any{
 		"version": "1.0.0",
@@ -471,6 +1916,22 @@ func (p *PocketstratorApp) handleSystemInfo(e *core.RequestEvent) error {
 			"systemd_dir":    p.config.SystemdDir,
 			"caddy_config":   p.config.CaddyConfig,
 			"default_domain": p.config.DefaultDomain,
+			"backup_dir":     p.config.BackupDir,
+			"backup_storage": p.config.BackupStorage,
+			"caddy_probe":    p.config.CaddyProbeURL,
+			"port_ranges":    p.config.PortRanges,
+			"health_check": map[string]any{
+				"interval":  p.config.HealthCheckInterval.String(),
+				"retention": p.config.HealthCheckRetention.String(),
+			},
+			"webhooks": map[string]any{
+				"delivery_retention": p.config.WebhookDeliveryRetention.String(),
+			},
+			"crash_loop": map[string]any{
+				"window":         p.config.CrashLoopWindow.String(),
+				"threshold":      p.config.CrashLoopThreshold,
+				"restart_budget": p.config.RestartBudget,
+			},
 		},
 	})
 }
@@ -503,30 +1964,45 @@ func (p *PocketstratorApp) performHealthCheck() {
 
 	log.Println("🔍 Performing health check on all services...")
 
-	services, err := p.orchestrator.ListServices(ctx)
+	failed, err := p.orchestrator.RunHealthChecks(ctx)
 	if err != nil {
-		log.Printf("❌ Failed to list services for health check: %v", err)
+		log.Printf("❌ Failed to run health checks: %v", err)
 		return
 	}
+	if failed > 0 {
+		log.Printf("⚠️  %d health checks could not be recorded", failed)
+	}
 
-	for _, svc := range services {
-		status, err := p.orchestrator.GetServiceStatus(ctx, svc.ID)
-		if err != nil {
-			log.Printf("❌ Failed to get status for service %s: %v", svc.ProjectName, err)
-			continue
-		}
-
-		// Log status changes
-		if status.IsRunning && svc.Status != "active" {
-			log.Printf("✅ Service %s is now active", svc.ProjectName)
-		} else if !status.IsRunning && svc.Status == "active" {
-			log.Printf("⚠️  Service %s is now inactive", svc.ProjectName)
-		}
+	pruned, err := p.orchestrator.PruneHealthChecks(ctx, p.config.HealthCheckRetention)
+	if err != nil {
+		log.Printf("❌ Failed to prune health check history: %v", err)
+	} else if pruned > 0 {
+		log.Printf("🧹 Pruned %d old health checks", pruned)
 	}
 
 	log.Println("✅ Health check completed")
 }
 
+func (p *PocketstratorApp) performScheduledBackups() {
+	failed, err := p.orchestrator.RunScheduledBackups(context.Background(), time.Now())
+	if err != nil {
+		log.Printf("❌ Failed to run scheduled backups: %v", err)
+		return
+	}
+	if failed > 0 {
+		log.Printf("⚠️  %d scheduled backups failed", failed)
+	}
+}
+
+func (p *PocketstratorApp) pruneWebhookDeliveries() {
+	pruned, err := p.orchestrator.PruneWebhookDeliveries(context.Background(), p.config.WebhookDeliveryRetention)
+	if err != nil {
+		log.Printf("❌ Failed to prune webhook deliveries: %v", err)
+	} else if pruned > 0 {
+		log.Printf("🧹 Pruned %d old webhook deliveries", pruned)
+	}
+}
+
 // the default pb_public dir location is relative to the executable
 func defaultPublicDir() string {
 	if strings.HasPrefix(os.Args[0], os.TempDir()) {
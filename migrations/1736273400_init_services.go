@@ -4,28 +4,14 @@ import (
 	"encoding/json"
 
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/models"
+	m "github.com/pocketbase/pocketbase/migrations"
 	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 func init() {
-	core.RegisterMigrationDown("1736273400_init_services.go", func(app core.App) error {
-		// Remove the services collection
-		collection, err := app.FindCollectionByNameOrId("services")
-		if err != nil {
-			return err
-		}
-		return app.Delete(collection)
-	})
-
-	core.RegisterMigrationUp("1736273400_init_services.go", func(app core.App) error {
+	m.Register(func(app core.App) error {
 		// Create services collection
-		collection := &models.Collection{}
-		collection.MarkAsNew()
-		collection.Id = "pbc_1234567890" // Use a consistent ID
-		collection.Name = "services"
-		collection.Type = models.CollectionTypeBase
-		collection.System = false
+		collection := core.NewBaseCollection("services", "pbc_1234567890")
 
 		// JSON schema definition
 		jsonData := `[
@@ -35,51 +21,39 @@ func init() {
 				"type": "text",
 				"required": true,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 1,
-					"max": 50,
-					"pattern": ""
-				}
+				"min": 1,
+				"max": 50,
+				"pattern": ""
 			},
 			{
-				"id": "number_port", 
+				"id": "number_port",
 				"name": "port",
 				"type": "number",
 				"required": true,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 1024,
-					"max": 65535,
-					"noDecimal": true
-				}
+				"min": 1024,
+				"max": 65535,
+				"onlyInt": true
 			},
 			{
 				"id": "text_pocketbase_version",
-				"name": "pocketbase_version", 
+				"name": "pocketbase_version",
 				"type": "text",
 				"required": true,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 1,
-					"max": 20,
-					"pattern": ""
-				}
+				"min": 1,
+				"max": 20,
+				"pattern": ""
 			},
 			{
 				"id": "text_domain",
 				"name": "domain",
-				"type": "text", 
+				"type": "text",
 				"required": true,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 3,
-					"max": 253,
-					"pattern": ""
-				}
+				"min": 3,
+				"max": 253,
+				"pattern": ""
 			},
 			{
 				"id": "select_status",
@@ -87,11 +61,8 @@ func init() {
 				"type": "select",
 				"required": true,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"maxSelect": 1,
-					"values": ["active", "inactive", "error", "deploying"]
-				}
+				"maxSelect": 1,
+				"values": ["active", "inactive", "error", "deploying"]
 			},
 			{
 				"id": "text_systemd_config_hash",
@@ -99,47 +70,36 @@ func init() {
 				"type": "text",
 				"required": false,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 0,
-					"max": 64,
-					"pattern": ""
-				}
+				"min": 0,
+				"max": 64,
+				"pattern": ""
 			},
 			{
-				"id": "text_caddy_config_hash", 
+				"id": "text_caddy_config_hash",
 				"name": "caddy_config_hash",
 				"type": "text",
 				"required": false,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 0,
-					"max": 64,
-					"pattern": ""
-				}
+				"min": 0,
+				"max": 64,
+				"pattern": ""
 			},
 			{
 				"id": "date_last_health_check",
 				"name": "last_health_check",
 				"type": "date",
 				"required": false,
-				"presentable": false,
-				"unique": false,
-				"options": {}
+				"presentable": false
 			},
 			{
 				"id": "text_created_by",
-				"name": "created_by", 
+				"name": "created_by",
 				"type": "text",
 				"required": false,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 0,
-					"max": 255,
-					"pattern": ""
-				}
+				"min": 0,
+				"max": 255,
+				"pattern": ""
 			},
 			{
 				"id": "text_description",
@@ -147,21 +107,32 @@ func init() {
 				"type": "text",
 				"required": false,
 				"presentable": false,
-				"unique": false,
-				"options": {
-					"min": 0,
-					"max": 500,
-					"pattern": ""
-				}
+				"min": 0,
+				"max": 500,
+				"pattern": ""
+			},
+			{
+				"id": "autodate_created",
+				"name": "created",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": false
+			},
+			{
+				"id": "autodate_updated",
+				"name": "updated",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": true
 			}
 		]`
 
-		fields := []*models.CollectionField{}
+		fields := core.FieldsList{}
 		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
 			return err
 		}
 
-		collection.Fields = fields
+		collection.Fields.Add(fields...)
 
 		// Set access rules (require authentication)
 		collection.ListRule = types.Pointer("@request.auth.id != ''")
@@ -171,5 +142,12 @@ func init() {
 		collection.DeleteRule = types.Pointer("@request.auth.id != ''")
 
 		return app.Save(collection)
+	}, func(app core.App) error {
+		// Remove the services collection
+		collection, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
 	})
 }
@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Create port reservations collection
+		collection := core.NewBaseCollection("port_reservations", "pbc_port_reservations")
+
+		// JSON schema definition
+		jsonData := `[
+			{
+				"id": "number_port",
+				"name": "port",
+				"type": "number",
+				"required": true,
+				"presentable": true,
+				"min": 1024,
+				"max": 65535,
+				"onlyInt": true
+			},
+			{
+				"id": "text_owner",
+				"name": "owner",
+				"type": "text",
+				"required": true,
+				"presentable": false,
+				"min": 1,
+				"max": 255,
+				"pattern": ""
+			},
+			{
+				"id": "autodate_created",
+				"name": "created",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": false
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
+			return err
+		}
+
+		collection.Fields.Add(fields...)
+
+		// A port can only be reserved once
+		collection.AddIndex("idx_port_reservations_port", true, "port", "")
+
+		// Reservations are managed by the orchestrator only (superusers can still inspect them)
+		collection.ListRule = nil
+		collection.ViewRule = nil
+		collection.CreateRule = nil
+		collection.UpdateRule = nil
+		collection.DeleteRule = nil
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		// Remove the port reservations collection
+		collection, err := app.FindCollectionByNameOrId("port_reservations")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
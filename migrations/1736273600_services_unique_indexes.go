@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Enforce uniqueness at the database level so concurrent creates cannot both succeed
+		collection.AddIndex("idx_services_project_name", true, "project_name", "")
+		collection.AddIndex("idx_services_port", true, "port", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		collection.RemoveIndex("idx_services_project_name")
+		collection.RemoveIndex("idx_services_port")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Create health checks collection
+		collection := core.NewBaseCollection("health_checks", "pbc_health_checks")
+
+		// JSON schema definition
+		jsonData := `[
+			{
+				"id": "relation_service",
+				"name": "service",
+				"type": "relation",
+				"required": true,
+				"presentable": false,
+				"collectionId": "` + services.Id + `",
+				"cascadeDelete": true,
+				"minSelect": 0,
+				"maxSelect": 1
+			},
+			{
+				"id": "text_systemd_status",
+				"name": "systemd_status",
+				"type": "text",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"max": 50,
+				"pattern": ""
+			},
+			{
+				"id": "bool_http_ok",
+				"name": "http_ok",
+				"type": "bool",
+				"required": false,
+				"presentable": false
+			},
+			{
+				"id": "number_http_status",
+				"name": "http_status",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"onlyInt": true
+			},
+			{
+				"id": "number_latency_ms",
+				"name": "latency_ms",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"min": 0
+			},
+			{
+				"id": "bool_healthy",
+				"name": "healthy",
+				"type": "bool",
+				"required": false,
+				"presentable": false
+			},
+			{
+				"id": "text_error",
+				"name": "error",
+				"type": "text",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"max": 2000,
+				"pattern": ""
+			},
+			{
+				"id": "autodate_created",
+				"name": "created",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": false
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
+			return err
+		}
+
+		collection.Fields.Add(fields...)
+
+		collection.AddIndex("idx_health_checks_service_created", false, "service, created", "")
+
+		// Read-only for authenticated users, written by the orchestrator only
+		collection.ListRule = types.Pointer("@request.auth.id != ''")
+		collection.ViewRule = types.Pointer("@request.auth.id != ''")
+		collection.CreateRule = nil
+		collection.UpdateRule = nil
+		collection.DeleteRule = nil
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		// Remove the health checks collection
+		collection, err := app.FindCollectionByNameOrId("health_checks")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("health_checks")
+		if err != nil {
+			return err
+		}
+
+		// Results of the probe through the local Caddy listener
+		jsonData := `[
+			{
+				"id": "bool_caddy_ok",
+				"name": "caddy_ok",
+				"type": "bool",
+				"required": false,
+				"presentable": false
+			},
+			{
+				"id": "text_caddy_status",
+				"name": "caddy_status",
+				"type": "text",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"max": 50,
+				"pattern": ""
+			},
+			{
+				"id": "number_caddy_latency_ms",
+				"name": "caddy_latency_ms",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"min": 0
+			},
+			{
+				"id": "text_verdict",
+				"name": "verdict",
+				"type": "text",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"max": 50,
+				"pattern": ""
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
+			return err
+		}
+
+		collection.Fields.Add(fields...)
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("health_checks")
+		if err != nil {
+			return err
+		}
+
+		for _, name := range []string{"caddy_ok", "caddy_status", "caddy_latency_ms", "verdict"} {
+			collection.Fields.RemoveByName(name)
+		}
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,153 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Allow services to be marked as crash looping
+		status, ok := services.Fields.GetByName("status").(*core.SelectField)
+		if !ok {
+			return fmt.Errorf("services.status is not a select field")
+		}
+		if !slices.Contains(status.Values, "crashlooping") {
+			status.Values = append(status.Values, "crashlooping")
+		}
+		if err := app.Save(services); err != nil {
+			return err
+		}
+
+		// Create crash events collection
+		collection := core.NewBaseCollection("crash_events", "pbc_crash_events")
+
+		// JSON schema definition
+		jsonData := `[
+			{
+				"id": "relation_service",
+				"name": "service",
+				"type": "relation",
+				"required": true,
+				"presentable": false,
+				"collectionId": "` + services.Id + `",
+				"cascadeDelete": true,
+				"minSelect": 0,
+				"maxSelect": 1
+			},
+			{
+				"id": "number_restarts",
+				"name": "restarts",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"onlyInt": true
+			},
+			{
+				"id": "number_n_restarts",
+				"name": "n_restarts",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"onlyInt": true
+			},
+			{
+				"id": "number_exit_status",
+				"name": "exit_status",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"onlyInt": true
+			},
+			{
+				"id": "bool_stopped",
+				"name": "stopped",
+				"type": "bool",
+				"required": false,
+				"presentable": false
+			},
+			{
+				"id": "text_log_tail",
+				"name": "log_tail",
+				"type": "text",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"max": 20000,
+				"pattern": ""
+			},
+			{
+				"id": "autodate_created",
+				"name": "created",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": false
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
+			return err
+		}
+
+		collection.Fields.Add(fields...)
+
+		collection.AddIndex("idx_crash_events_service_created", false, "service, created", "")
+
+		// Read-only for authenticated users, written by the orchestrator only
+		collection.ListRule = types.Pointer("@request.auth.id != ''")
+		collection.ViewRule = types.Pointer("@request.auth.id != ''")
+		collection.CreateRule = nil
+		collection.UpdateRule = nil
+		collection.DeleteRule = nil
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		// Remove the crash events collection
+		collection, err := app.FindCollectionByNameOrId("crash_events")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(collection); err != nil {
+			return err
+		}
+
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Crash looping services fall back to the error status
+		records, err := app.FindAllRecords(services, dbx.HashExp{"status": "crashlooping"})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			record.Set("status", "error")
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+
+		status, ok := services.Fields.GetByName("status").(*core.SelectField)
+		if !ok {
+			return fmt.Errorf("services.status is not a select field")
+		}
+		status.Values = slices.DeleteFunc(status.Values, func(v string) bool { return v == "crashlooping" })
+
+		return app.Save(services)
+	})
+}
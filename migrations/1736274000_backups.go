@@ -0,0 +1,211 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Create backup policies collection, one policy per service
+		policies := core.NewBaseCollection("backup_policies", "pbc_backup_policies")
+
+		policyFields := `[
+			{
+				"id": "relation_service",
+				"name": "service",
+				"type": "relation",
+				"required": true,
+				"presentable": false,
+				"collectionId": "` + services.Id + `",
+				"cascadeDelete": true,
+				"minSelect": 0,
+				"maxSelect": 1
+			},
+			{
+				"id": "text_schedule",
+				"name": "schedule",
+				"type": "text",
+				"required": true,
+				"presentable": false,
+				"min": 1,
+				"max": 100,
+				"pattern": ""
+			},
+			{
+				"id": "number_retention_count",
+				"name": "retention_count",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"onlyInt": true
+			},
+			{
+				"id": "number_retention_days",
+				"name": "retention_days",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"onlyInt": true
+			},
+			{
+				"id": "bool_enabled",
+				"name": "enabled",
+				"type": "bool",
+				"required": false,
+				"presentable": false
+			},
+			{
+				"id": "date_last_run",
+				"name": "last_run",
+				"type": "date",
+				"required": false,
+				"presentable": false
+			},
+			{
+				"id": "autodate_created",
+				"name": "created",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": false
+			},
+			{
+				"id": "autodate_updated",
+				"name": "updated",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": true
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(policyFields), &fields); err != nil {
+			return err
+		}
+
+		policies.Fields.Add(fields...)
+
+		policies.AddIndex("idx_backup_policies_service", true, "service", "")
+
+		policies.ListRule = types.Pointer("@request.auth.id != ''")
+		policies.ViewRule = types.Pointer("@request.auth.id != ''")
+		policies.CreateRule = nil
+		policies.UpdateRule = nil
+		policies.DeleteRule = nil
+
+		if err := app.Save(policies); err != nil {
+			return err
+		}
+
+		// Create backups collection
+		backups := core.NewBaseCollection("backups", "pbc_backups")
+
+		backupFields := `[
+			{
+				"id": "relation_service",
+				"name": "service",
+				"type": "relation",
+				"required": true,
+				"presentable": false,
+				"collectionId": "` + services.Id + `",
+				"cascadeDelete": true,
+				"minSelect": 0,
+				"maxSelect": 1
+			},
+			{
+				"id": "text_filename",
+				"name": "filename",
+				"type": "text",
+				"required": true,
+				"presentable": true,
+				"min": 1,
+				"max": 255,
+				"pattern": ""
+			},
+			{
+				"id": "text_path",
+				"name": "path",
+				"type": "text",
+				"required": true,
+				"presentable": false,
+				"min": 1,
+				"max": 1000,
+				"pattern": ""
+			},
+			{
+				"id": "number_size",
+				"name": "size",
+				"type": "number",
+				"required": false,
+				"presentable": false,
+				"min": 0,
+				"onlyInt": true
+			},
+			{
+				"id": "text_checksum",
+				"name": "checksum",
+				"type": "text",
+				"required": true,
+				"presentable": false,
+				"min": 64,
+				"max": 64,
+				"pattern": "^[a-f0-9]+$"
+			},
+			{
+				"id": "select_trigger",
+				"name": "trigger",
+				"type": "select",
+				"required": true,
+				"presentable": false,
+				"maxSelect": 1,
+				"values": ["scheduled", "manual"]
+			},
+			{
+				"id": "autodate_created",
+				"name": "created",
+				"type": "autodate",
+				"onCreate": true,
+				"onUpdate": false
+			}
+		]`
+
+		fields = core.FieldsList{}
+		if err := json.Unmarshal([]byte(backupFields), &fields); err != nil {
+			return err
+		}
+
+		backups.Fields.Add(fields...)
+
+		backups.AddIndex("idx_backups_service_created", false, "service, created", "")
+
+		// Read-only for authenticated users, written by the orchestrator only
+		backups.ListRule = types.Pointer("@request.auth.id != ''")
+		backups.ViewRule = types.Pointer("@request.auth.id != ''")
+		backups.CreateRule = nil
+		backups.UpdateRule = nil
+		backups.DeleteRule = nil
+
+		return app.Save(backups)
+	}, func(app core.App) error {
+		for _, name := range []string{"backups", "backup_policies"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
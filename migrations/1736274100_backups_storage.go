@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("backups")
+		if err != nil {
+			return err
+		}
+
+		// The backend an archive is kept in; path becomes the key within it
+		jsonData := `[
+			{
+				"id": "select_storage",
+				"name": "storage",
+				"type": "select",
+				"required": false,
+				"presentable": false,
+				"maxSelect": 1,
+				"values": ["local", "s3"]
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
+			return err
+		}
+
+		collection.Fields.Add(fields...)
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// Existing archives were written to <backupDir>/<project_name>/<filename>
+		records, err := app.FindAllRecords(collection)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			service, err := app.FindRecordById("services", record.GetString("service"))
+			if err != nil {
+				return err
+			}
+
+			record.Set("storage", "local")
+			record.Set("path", service.GetString("project_name")+"/"+record.GetString("filename"))
+
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("backups")
+		if err != nil {
+			return err
+		}
+
+		// Keys are left as they are, absolute paths cannot be rebuilt without the backup directory
+		collection.Fields.RemoveByName("storage")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Extra arguments passed to "pocketbase serve" in the unit file
+		jsonData := `[
+			{
+				"id": "json_serve_flags",
+				"name": "serve_flags",
+				"type": "json",
+				"required": false,
+				"presentable": false,
+				"maxSize": 10000
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
+			return err
+		}
+
+		collection.Fields.Add(fields...)
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("serve_flags")
+
+		return app.Save(collection)
+	})
+}
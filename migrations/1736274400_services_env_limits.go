@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Environment variables and resource limits written into the unit file
+		jsonData := `[
+			{
+				"id": "json_env",
+				"name": "env",
+				"type": "json",
+				"required": false,
+				"presentable": false,
+				"maxSize": 100000
+			},
+			{
+				"id": "json_limits",
+				"name": "limits",
+				"type": "json",
+				"required": false,
+				"presentable": false,
+				"maxSize": 10000
+			}
+		]`
+
+		fields := core.FieldsList{}
+		if err := json.Unmarshal([]byte(jsonData), &fields); err != nil {
+			return err
+		}
+
+		collection.Fields.Add(fields...)
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("env")
+		collection.Fields.RemoveByName("limits")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,109 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// readOnlyCollections are written by the orchestrator and only listed through the records API
+var readOnlyCollections = []string{"health_checks", "crash_events", "backups", "backup_policies"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// Pockestrator role of the user, users without one cannot use the API
+		users.Fields.Add(&core.SelectField{
+			Id:        "select_role",
+			Name:      "role",
+			Required:  false,
+			MaxSelect: 1,
+			Values:    []string{"viewer", "operator", "admin"},
+		})
+
+		// Accounts are created by superusers, and users cannot change their own role
+		users.CreateRule = nil
+		users.UpdateRule = types.Pointer("id = @request.auth.id && @request.body.role:isset = false")
+
+		if err := app.Save(users); err != nil {
+			return err
+		}
+
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Records API access follows the same roles as the custom routes
+		services.ListRule = types.Pointer("@request.auth.role != ''")
+		services.ViewRule = types.Pointer("@request.auth.role != ''")
+		services.CreateRule = types.Pointer("@request.auth.role = 'operator' || @request.auth.role = 'admin'")
+		services.UpdateRule = types.Pointer("@request.auth.role = 'operator' || @request.auth.role = 'admin'")
+		services.DeleteRule = types.Pointer("@request.auth.role = 'admin'")
+
+		if err := app.Save(services); err != nil {
+			return err
+		}
+
+		// Health, crash and backup history is readable by any role
+		for _, name := range readOnlyCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			collection.ListRule = types.Pointer("@request.auth.role != ''")
+			collection.ViewRule = types.Pointer("@request.auth.role != ''")
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		for _, name := range readOnlyCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			collection.ListRule = types.Pointer("@request.auth.id != ''")
+			collection.ViewRule = types.Pointer("@request.auth.id != ''")
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		services.ListRule = types.Pointer("@request.auth.id != ''")
+		services.ViewRule = types.Pointer("@request.auth.id != ''")
+		services.CreateRule = types.Pointer("@request.auth.id != ''")
+		services.UpdateRule = types.Pointer("@request.auth.id != ''")
+		services.DeleteRule = types.Pointer("@request.auth.id != ''")
+
+		if err := app.Save(services); err != nil {
+			return err
+		}
+
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		users.Fields.RemoveByName("role")
+		users.CreateRule = types.Pointer("")
+		users.UpdateRule = types.Pointer("id = @request.auth.id")
+
+		return app.Save(users)
+	})
+}
@@ -0,0 +1,152 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// serviceAccessRule matches users who own or collaborate on the service a record belongs to,
+// given the path to the services record (empty for the services collection itself)
+func serviceAccessRule(path string) string {
+	return "@request.auth.role = 'admin' || (@request.auth.role != '' && (" +
+		path + "owner = @request.auth.id || " + path + "service_collaborators_via_service.user ?= @request.auth.id))"
+}
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// User the service belongs to, empty for services created by superusers
+		services.Fields.Add(&core.RelationField{
+			Id:            "relation_owner",
+			Name:          "owner",
+			CollectionId:  users.Id,
+			CascadeDelete: false,
+			MaxSelect:     1,
+		})
+
+		if err := app.Save(services); err != nil {
+			return err
+		}
+
+		// Users the owner shares a service with, and what they may do besides reading it
+		collaborators := core.NewBaseCollection("service_collaborators", "pbc_service_collaborators")
+		collaborators.Fields.Add(
+			&core.RelationField{
+				Id:            "relation_service",
+				Name:          "service",
+				Required:      true,
+				CollectionId:  services.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+			},
+			&core.RelationField{
+				Id:            "relation_user",
+				Name:          "user",
+				Required:      true,
+				CollectionId:  users.Id,
+				CascadeDelete: true,
+				MaxSelect:     1,
+			},
+			&core.SelectField{
+				Id:        "select_permissions",
+				Name:      "permissions",
+				MaxSelect: 4,
+				Values:    []string{"control", "deploy", "backup", "restore"},
+			},
+			&core.AutodateField{
+				Id:       "autodate_created",
+				Name:     "created",
+				OnCreate: true,
+			},
+			&core.AutodateField{
+				Id:       "autodate_updated",
+				Name:     "updated",
+				OnCreate: true,
+				OnUpdate: true,
+			},
+		)
+		collaborators.AddIndex("idx_service_collaborators_service_user", true, "service, user", "")
+
+		// Owners manage who they share with, collaborators can see their own entries
+		collaborators.ListRule = types.Pointer("@request.auth.role = 'admin' || user = @request.auth.id || service.owner = @request.auth.id")
+		collaborators.ViewRule = types.Pointer("@request.auth.role = 'admin' || user = @request.auth.id || service.owner = @request.auth.id")
+		collaborators.CreateRule = types.Pointer("@request.auth.role = 'admin' || (@request.auth.role != '' && service.owner = @request.auth.id)")
+		collaborators.UpdateRule = types.Pointer("@request.auth.role = 'admin' || (@request.auth.role != '' && service.owner = @request.auth.id && @request.body.service:isset = false)")
+		collaborators.DeleteRule = types.Pointer("@request.auth.role = 'admin' || (@request.auth.role != '' && service.owner = @request.auth.id)")
+
+		if err := app.Save(collaborators); err != nil {
+			return err
+		}
+
+		// Services are only visible to their owner and collaborators. Operators can edit the
+		// ones they can access; the record hooks check the exact permission.
+		services.ListRule = types.Pointer(serviceAccessRule(""))
+		services.ViewRule = types.Pointer(serviceAccessRule(""))
+		services.UpdateRule = types.Pointer("@request.auth.role = 'admin' || (@request.auth.role = 'operator' && (" +
+			"owner = @request.auth.id || service_collaborators_via_service.user ?= @request.auth.id))")
+
+		if err := app.Save(services); err != nil {
+			return err
+		}
+
+		for _, name := range readOnlyCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			collection.ListRule = types.Pointer(serviceAccessRule("service."))
+			collection.ViewRule = types.Pointer(serviceAccessRule("service."))
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		for _, name := range readOnlyCollections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			collection.ListRule = types.Pointer("@request.auth.role != ''")
+			collection.ViewRule = types.Pointer("@request.auth.role != ''")
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		collaborators, err := app.FindCollectionByNameOrId("service_collaborators")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(collaborators); err != nil {
+			return err
+		}
+
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		services.Fields.RemoveByName("owner")
+		services.ListRule = types.Pointer("@request.auth.role != ''")
+		services.ViewRule = types.Pointer("@request.auth.role != ''")
+		services.UpdateRule = types.Pointer("@request.auth.role = 'operator' || @request.auth.role = 'admin'")
+
+		return app.Save(services)
+	})
+}
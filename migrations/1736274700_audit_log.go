@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection := core.NewBaseCollection("audit_log", "pbc_audit_log")
+
+		// The service is kept by ID and name rather than a relation, so that entries
+		// outlive the services they describe
+		collection.Fields.Add(
+			&core.TextField{Id: "text_actor", Name: "actor", Required: true},
+			&core.TextField{Id: "text_actor_id", Name: "actor_id"},
+			&core.SelectField{
+				Id:        "select_source",
+				Name:      "source",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"api", "records", "cli", "manifest", "system"},
+			},
+			&core.TextField{Id: "text_action", Name: "action", Required: true},
+			&core.TextField{Id: "text_service_id", Name: "service_id"},
+			&core.TextField{Id: "text_service_name", Name: "service_name"},
+			&core.JSONField{Id: "json_params", Name: "params", MaxSize: 100000},
+			&core.SelectField{
+				Id:        "select_outcome",
+				Name:      "outcome",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"success", "failure", "rejected"},
+			},
+			&core.TextField{Id: "text_error", Name: "error"},
+			&core.AutodateField{Id: "autodate_created", Name: "created", OnCreate: true},
+		)
+		collection.AddIndex("idx_audit_log_created", false, "created", "")
+		collection.AddIndex("idx_audit_log_service", false, "service_name, created", "")
+
+		// Only admins can read the log, and nobody can change it through the API
+		collection.ListRule = types.Pointer("@request.auth.role = 'admin'")
+		collection.ViewRule = types.Pointer("@request.auth.role = 'admin'")
+		collection.CreateRule = nil
+		collection.UpdateRule = nil
+		collection.DeleteRule = nil
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("audit_log")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection := core.NewBaseCollection("api_tokens", "pbc_api_tokens")
+
+		// The owner is kept by collection and ID rather than a relation, so that superusers
+		// can own tokens too. Services are a JSON list rather than a relation: deleting a
+		// service must not widen a token to every service.
+		collection.Fields.Add(
+			&core.TextField{Id: "text_name", Name: "name", Required: true, Max: 100},
+			&core.TextField{Id: "text_owner_collection", Name: "owner_collection", Required: true},
+			&core.TextField{Id: "text_owner_id", Name: "owner_id", Required: true},
+			&core.TextField{Id: "text_owner_email", Name: "owner_email"},
+			&core.TextField{Id: "text_prefix", Name: "prefix", Required: true},
+			&core.TextField{Id: "text_token_hash", Name: "token_hash", Required: true, Hidden: true},
+			&core.SelectField{
+				Id:        "select_permissions",
+				Name:      "permissions",
+				Required:  true,
+				MaxSelect: 8,
+				Values:    []string{"read", "control", "deploy", "backup", "restore", "delete", "manage", "share"},
+			},
+			&core.JSONField{Id: "json_services", Name: "services"},
+			&core.DateField{Id: "date_expires", Name: "expires"},
+			&core.DateField{Id: "date_last_used", Name: "last_used"},
+			&core.AutodateField{Id: "autodate_created", Name: "created", OnCreate: true},
+		)
+		collection.AddIndex("idx_api_tokens_token_hash", true, "token_hash", "")
+		collection.AddIndex("idx_api_tokens_owner", false, "owner_collection, owner_id", "")
+
+		// Tokens are created and revoked through the API, which hashes them
+		collection.ListRule = types.Pointer("@request.auth.role = 'admin' || owner_id = @request.auth.id")
+		collection.ViewRule = types.Pointer("@request.auth.role = 'admin' || owner_id = @request.auth.id")
+		collection.CreateRule = nil
+		collection.UpdateRule = nil
+		collection.DeleteRule = nil
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// Requests authenticated with an API token are audited as such
+		return setAuditSources(app, []string{"api", "records", "cli", "manifest", "system", "token"})
+	}, func(app core.App) error {
+		if err := setAuditSources(app, []string{"api", "records", "cli", "manifest", "system"}); err != nil {
+			return err
+		}
+
+		collection, err := app.FindCollectionByNameOrId("api_tokens")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
+
+// setAuditSources replaces the values of the audit log's source field
+func setAuditSources(app core.App, sources []string) error {
+	auditLog, err := app.FindCollectionByNameOrId("audit_log")
+	if err != nil {
+		return err
+	}
+
+	source, ok := auditLog.Fields.GetByName("source").(*core.SelectField)
+	if !ok {
+		return nil
+	}
+	source.Values = sources
+
+	return app.Save(auditLog)
+}
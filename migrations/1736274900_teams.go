@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// Sizes use the syntax of the memory_max limit, e.g. 4G. Empty quotas are unlimited.
+		teams := core.NewBaseCollection("teams", "pbc_teams")
+		teams.Fields.Add(
+			&core.TextField{Id: "text_name", Name: "name", Required: true, Max: 100},
+			&core.RelationField{
+				Id:            "relation_members",
+				Name:          "members",
+				CollectionId:  users.Id,
+				CascadeDelete: false,
+				MaxSelect:     999,
+			},
+			&core.NumberField{Id: "number_max_services", Name: "max_services", OnlyInt: true, Min: types.Pointer(0.0)},
+			&core.TextField{Id: "text_max_memory", Name: "max_memory", Pattern: `^\d+[KMGT]?$`},
+			&core.TextField{Id: "text_max_backup_storage", Name: "max_backup_storage", Pattern: `^\d+[KMGT]?$`},
+			&core.AutodateField{Id: "autodate_created", Name: "created", OnCreate: true},
+			&core.AutodateField{Id: "autodate_updated", Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		teams.AddIndex("idx_teams_name", true, "name COLLATE NOCASE", "")
+
+		// Admins manage teams, members can see theirs
+		teams.ListRule = types.Pointer("@request.auth.role = 'admin' || members ?= @request.auth.id")
+		teams.ViewRule = types.Pointer("@request.auth.role = 'admin' || members ?= @request.auth.id")
+		teams.CreateRule = types.Pointer("@request.auth.role = 'admin'")
+		teams.UpdateRule = types.Pointer("@request.auth.role = 'admin'")
+		teams.DeleteRule = types.Pointer("@request.auth.role = 'admin'")
+
+		if err := app.Save(teams); err != nil {
+			return err
+		}
+
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		// Team the service belongs to and counts against the quotas of
+		services.Fields.Add(&core.RelationField{
+			Id:            "relation_team",
+			Name:          "team",
+			CollectionId:  teams.Id,
+			CascadeDelete: false,
+			MaxSelect:     1,
+		})
+
+		return app.Save(services)
+	}, func(app core.App) error {
+		services, err := app.FindCollectionByNameOrId("services")
+		if err != nil {
+			return err
+		}
+
+		services.Fields.RemoveByName("team")
+		if err := app.Save(services); err != nil {
+			return err
+		}
+
+		teams, err := app.FindCollectionByNameOrId("teams")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(teams)
+	})
+}
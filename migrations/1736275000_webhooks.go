@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		webhooks := core.NewBaseCollection("webhooks", "pbc_webhooks")
+
+		// Services are a JSON list rather than a relation, like those of API tokens:
+		// deleting a service must not widen a webhook to every service
+		webhooks.Fields.Add(
+			&core.TextField{Id: "text_name", Name: "name", Required: true, Max: 100},
+			&core.URLField{Id: "url_url", Name: "url", Required: true},
+			&core.SelectField{
+				Id:        "select_events",
+				Name:      "events",
+				Required:  true,
+				MaxSelect: 5,
+				Values: []string{
+					"deploy.step_started",
+					"deploy.step_finished",
+					"service.status_changed",
+					"service.health_changed",
+					"backup.completed",
+				},
+			},
+			&core.JSONField{Id: "json_services", Name: "services"},
+			&core.TextField{Id: "text_secret", Name: "secret", Required: true, Hidden: true},
+			&core.BoolField{Id: "bool_enabled", Name: "enabled"},
+			&core.AutodateField{Id: "autodate_created", Name: "created", OnCreate: true},
+			&core.AutodateField{Id: "autodate_updated", Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+
+		// Webhooks are created through the API, which returns the secret once. Admins can
+		// edit and delete them through the records API too.
+		webhooks.ListRule = types.Pointer("@request.auth.role = 'admin'")
+		webhooks.ViewRule = types.Pointer("@request.auth.role = 'admin'")
+		webhooks.CreateRule = nil
+		webhooks.UpdateRule = types.Pointer("@request.auth.role = 'admin'")
+		webhooks.DeleteRule = types.Pointer("@request.auth.role = 'admin'")
+
+		if err := app.Save(webhooks); err != nil {
+			return err
+		}
+
+		// Deliveries are the persistent queue of events to send, and their log
+		deliveries := core.NewBaseCollection("webhook_deliveries", "pbc_webhook_deliveries")
+		deliveries.Fields.Add(
+			&core.RelationField{
+				Id:            "relation_webhook",
+				Name:          "webhook",
+				CollectionId:  webhooks.Id,
+				CascadeDelete: true,
+				Required:      true,
+				MaxSelect:     1,
+			},
+			&core.TextField{Id: "text_event_id", Name: "event_id", Required: true},
+			&core.TextField{Id: "text_event_type", Name: "event_type", Required: true},
+			&core.TextField{Id: "text_service_id", Name: "service_id"},
+			&core.TextField{Id: "text_service_name", Name: "service_name"},
+			&core.JSONField{Id: "json_payload", Name: "payload", Required: true, MaxSize: 1 << 20},
+			&core.SelectField{
+				Id:        "select_status",
+				Name:      "status",
+				Required:  true,
+				MaxSelect: 1,
+				Values:    []string{"pending", "delivered", "failed"},
+			},
+			&core.NumberField{Id: "number_attempts", Name: "attempts", OnlyInt: true, Min: types.Pointer(0.0)},
+			&core.DateField{Id: "date_next_attempt", Name: "next_attempt"},
+			&core.NumberField{Id: "number_response_status", Name: "response_status", OnlyInt: true},
+			&core.TextField{Id: "text_error", Name: "error"},
+			&core.DateField{Id: "date_delivered", Name: "delivered"},
+			&core.AutodateField{Id: "autodate_created", Name: "created", OnCreate: true},
+			&core.AutodateField{Id: "autodate_updated", Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		deliveries.AddIndex("idx_webhook_deliveries_due", false, "status, next_attempt", "")
+		deliveries.AddIndex("idx_webhook_deliveries_webhook", false, "webhook, created", "")
+
+		deliveries.ListRule = types.Pointer("@request.auth.role = 'admin'")
+		deliveries.ViewRule = types.Pointer("@request.auth.role = 'admin'")
+		deliveries.CreateRule = nil
+		deliveries.UpdateRule = nil
+		deliveries.DeleteRule = nil
+
+		return app.Save(deliveries)
+	}, func(app core.App) error {
+		for _, name := range []string{"webhook_deliveries", "webhooks"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
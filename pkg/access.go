@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// ErrInvalidCollaborator is returned when a collaborator fails validation
+var ErrInvalidCollaborator = errors.New("invalid collaborator")
+
+// ErrInvalidOwner is returned when a service is transferred to a user that does not exist,
+// or that is not a member of the service's team
+var ErrInvalidOwner = errors.New("invalid owner")
+
+// CollaboratorRequest represents a request to share a service with a user
+type CollaboratorRequest struct {
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+// ServiceGrant returns a user's grant on a service, or nil when the service is not theirs
+// and not shared with them
+func (o *Orchestrator) ServiceGrant(ctx context.Context, id, userID string) (*auth.Grant, error) {
+	svc, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	if userID == "" {
+		return nil, nil
+	}
+	if svc.Owner == userID {
+		return &auth.Grant{Owner: true}, nil
+	}
+
+	collaborator, err := o.dbManager.GetCollaborator(ctx, id, userID)
+	if err != nil || collaborator == nil {
+		return nil, err
+	}
+
+	grant := &auth.Grant{}
+	for _, perm := range collaborator.Permissions {
+		grant.Permissions = append(grant.Permissions, auth.Permission(perm))
+	}
+
+	return grant, nil
+}
+
+// ListServicesForUser returns the services a user owns or collaborates on
+func (o *Orchestrator) ListServicesForUser(ctx context.Context, userID string) ([]*database.ServiceRecord, error) {
+	return o.dbManager.ListServicesForUser(ctx, userID)
+}
+
+// SetServiceOwner transfers a service to another user
+func (o *Orchestrator) SetServiceOwner(ctx context.Context, id, userID string) (err error) {
+	defer func() {
+		o.recordAuditResult(ctx, AuditTransfer, o.auditedService(ctx, id), map[string]any{"owner": userID}, ErrInvalidOwner, err)
+	}()
+
+	svc, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get service: %w", err)
+	}
+	if err := o.ValidateServiceOwner(ctx, userID, svc.Team); err != nil {
+		return err
+	}
+
+	return o.dbManager.SetServiceOwner(ctx, id, userID)
+}
+
+// ValidateServiceOwner checks that a user can own a service of a team: the user must exist
+// and, when teamID is set, be a member of the team. An empty userID leaves a service without
+// an owner.
+func (o *Orchestrator) ValidateServiceOwner(ctx context.Context, userID, teamID string) error {
+	if userID == "" {
+		return nil
+	}
+
+	exists, err := o.dbManager.UserExists(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: no user %q", ErrInvalidOwner, userID)
+	}
+	if teamID == "" {
+		return nil
+	}
+
+	team, err := o.dbManager.GetTeam(ctx, teamID)
+	if err != nil {
+		return fmt.Errorf("failed to get team: %w", err)
+	}
+	if !team.HasMember(userID) {
+		return fmt.Errorf("%w: the user is not a member of team %s", ErrInvalidOwner, team.Name)
+	}
+
+	return nil
+}
+
+// ListCollaborators returns the users a service is shared with
+func (o *Orchestrator) ListCollaborators(ctx context.Context, id string) ([]*database.CollaboratorRecord, error) {
+	if _, err := o.dbManager.GetService(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	return o.dbManager.ListCollaborators(ctx, id)
+}
+
+// SetCollaborator shares a service with a user, or replaces what they may do on it
+func (o *Orchestrator) SetCollaborator(ctx context.Context, id, userID string, req *CollaboratorRequest) (collaborator *database.CollaboratorRecord, err error) {
+	svc, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	defer func() {
+		params := map[string]any{"user": userID, "permissions": req.Permissions}
+		o.recordAuditResult(ctx, AuditShare, svc, params, ErrInvalidCollaborator, err)
+	}()
+
+	if svc.Owner == userID {
+		return nil, fmt.Errorf("%w: the user already owns the service", ErrInvalidCollaborator)
+	}
+	exists, err := o.dbManager.UserExists(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: no user %q", ErrInvalidCollaborator, userID)
+	}
+
+	permissions := []string{}
+	for _, perm := range req.Permissions {
+		if !slices.Contains(auth.CollaboratorPermissions, perm) {
+			return nil, fmt.Errorf("%w: permission %q cannot be shared, use one of %v", ErrInvalidCollaborator, perm, auth.CollaboratorPermissions)
+		}
+		if !slices.Contains(permissions, string(perm)) {
+			permissions = append(permissions, string(perm))
+		}
+	}
+
+	collaborator = &database.CollaboratorRecord{ServiceID: id, UserID: userID, Permissions: permissions}
+	if err := o.dbManager.SaveCollaborator(ctx, collaborator); err != nil {
+		return nil, err
+	}
+
+	return collaborator, nil
+}
+
+// RemoveCollaborator stops sharing a service with a user
+func (o *Orchestrator) RemoveCollaborator(ctx context.Context, id, userID string) error {
+	err := o.dbManager.DeleteCollaborator(ctx, id, userID)
+	o.RecordAudit(ctx, AuditUnshare, o.auditedService(ctx, id), map[string]any{"user": userID}, err)
+	return err
+}
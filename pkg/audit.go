@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// Audited actions
+const (
+	AuditCreate  = "create"
+	AuditDelete  = "delete"
+	AuditControl = "control"
+	AuditUpdate  = "update"
+	AuditUpgrade = "upgrade" // an update that changes the PocketBase version
+	AuditRestore = "restore"
+
+	AuditBackup             = "backup"
+	AuditDeleteBackup       = "delete_backup"
+	AuditSetBackupPolicy    = "set_backup_policy"
+	AuditDeleteBackupPolicy = "delete_backup_policy"
+
+	AuditShare    = "share"    // a collaborator added, or their permissions changed
+	AuditUnshare  = "unshare"  // a collaborator removed
+	AuditTransfer = "transfer" // a service given to another owner
+	AuditMoveTeam = "move_team"
+
+	AuditCreateTeam = "create_team"
+	AuditUpdateTeam = "update_team"
+	AuditDeleteTeam = "delete_team"
+
+	AuditCreateToken = "create_token"
+	AuditRevokeToken = "revoke_token"
+
+	AuditCreateWebhook = "create_webhook"
+	AuditDeleteWebhook = "delete_webhook"
+
+	AuditRemoveOrphans = "remove_orphans"
+)
+
+// Audit outcomes
+const (
+	AuditSuccess  = "success"
+	AuditFailure  = "failure"
+	AuditRejected = "rejected" // the request failed validation
+)
+
+// Actor is who an operation is performed for, recorded in the audit log
+type Actor struct {
+	Name   string // email of the auth record, or the local user for the CLI
+	ID     string // auth record ID
+	Source string // api, records, cli, manifest or system
+}
+
+// SystemActor is recorded for operations without an actor, such as scheduled jobs
+var SystemActor = Actor{Name: "system", Source: "system"}
+
+type actorKey struct{}
+
+// WithActor returns a context whose operations are recorded as performed by actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of a context, SystemActor when it has none
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return SystemActor
+}
+
+// RecordAudit appends an entry for an operation on a service to the audit log. svc is nil
+// for operations that are not on a single service. A nil err is recorded as a success.
+// Failing to write the entry does not fail the operation.
+func (o *Orchestrator) RecordAudit(ctx context.Context, action string, svc *database.ServiceRecord, params map[string]any, err error) {
+	outcome := AuditSuccess
+	if err != nil {
+		outcome = AuditFailure
+	}
+	o.recordAudit(ctx, action, svc, params, outcome, err)
+}
+
+// auditResponse records an operation that answered with a service response: error
+// responses are validation failures
+func (o *Orchestrator) auditResponse(ctx context.Context, action string, svc *database.ServiceRecord, params map[string]any, response *ServiceResponse, err error) {
+	if err == nil && response != nil && response.Status == "error" {
+		reason := errors.New(response.Message)
+		if len(response.Errors) > 0 {
+			reason = validationFailure(response.Errors)
+		}
+		o.recordAudit(ctx, action, svc, params, AuditRejected, reason)
+		return
+	}
+	o.RecordAudit(ctx, action, svc, params, err)
+}
+
+// recordAuditResult records an operation whose validation failures wrap invalid: those are
+// recorded as rejected and other errors as failures
+func (o *Orchestrator) recordAuditResult(ctx context.Context, action string, svc *database.ServiceRecord, params map[string]any, invalid, err error) {
+	if err != nil && errors.Is(err, invalid) {
+		o.recordAudit(ctx, action, svc, params, AuditRejected, err)
+		return
+	}
+	o.RecordAudit(ctx, action, svc, params, err)
+}
+
+// auditedService returns the service an entry is recorded against, with just its ID when
+// it cannot be loaded
+func (o *Orchestrator) auditedService(ctx context.Context, id string) *database.ServiceRecord {
+	if svc, err := o.dbManager.GetService(ctx, id); err == nil {
+		return svc
+	}
+	return &database.ServiceRecord{ID: id}
+}
+
+func (o *Orchestrator) recordAudit(ctx context.Context, action string, svc *database.ServiceRecord, params map[string]any, outcome string, err error) {
+	actor := ActorFrom(ctx)
+	entry := &database.AuditRecord{
+		Actor:   actor.Name,
+		ActorID: actor.ID,
+		Source:  actor.Source,
+		Action:  action,
+		Params:  params,
+		Outcome: outcome,
+	}
+	if svc != nil {
+		entry.ServiceID = svc.ID
+		entry.ServiceName = svc.ProjectName
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := o.dbManager.CreateAuditEntry(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("⚠️ Failed to record %s of %s in the audit log: %v", action, entry.ServiceName, err)
+	}
+}
+
+// ListAuditEntries returns the audit log entries matching the filter, newest first
+func (o *Orchestrator) ListAuditEntries(ctx context.Context, filter database.AuditFilter) ([]*database.AuditRecord, error) {
+	return o.dbManager.ListAuditEntries(ctx, filter)
+}
+
+// serviceParams returns the audited parameters of a service's settings. Only the names of
+// environment variables are recorded, their values may be secrets.
+func serviceParams(port int, version, domain string, flags []string, env map[string]string, limits *database.ServiceLimits) map[string]any {
+	params := map[string]any{}
+	if port != 0 {
+		params["port"] = port
+	}
+	if version != "" {
+		params["pocketbase_version"] = version
+	}
+	if domain != "" {
+		params["domain"] = domain
+	}
+	if flags != nil {
+		params["serve_flags"] = flags
+	}
+	if env != nil {
+		params["env"] = slices.Sorted(maps.Keys(env))
+	}
+	if limits != nil && *limits != (database.ServiceLimits{}) {
+		params["limits"] = limits
+	}
+	return params
+}
+
+// WriteAuditCSV writes audit log entries as CSV with a header row
+func WriteAuditCSV(w io.Writer, entries []*database.AuditRecord) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"created", "actor", "actor_id", "source", "action", "service_id", "service_name", "outcome", "error", "params"})
+
+	for _, entry := range entries {
+		params := ""
+		if len(entry.Params) > 0 {
+			data, err := json.Marshal(entry.Params)
+			if err != nil {
+				return fmt.Errorf("failed to encode params of %s: %w", entry.ID, err)
+			}
+			params = string(data)
+		}
+
+		cw.Write([]string{
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			entry.Actor,
+			entry.ActorID,
+			entry.Source,
+			entry.Action,
+			entry.ServiceID,
+			entry.ServiceName,
+			entry.Outcome,
+			entry.Error,
+			params,
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
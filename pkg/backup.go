@@ -0,0 +1,385 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/cron"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/storage"
+)
+
+// ErrInvalidBackupPolicy is returned when a backup policy fails validation
+var ErrInvalidBackupPolicy = errors.New("invalid backup policy")
+
+// ErrBackupQuota is returned when a backup would take its team past the team's backup
+// storage quota
+var ErrBackupQuota = errors.New("backup storage quota exceeded")
+
+// BackupPolicyRequest represents a backup policy update request
+type BackupPolicyRequest struct {
+	Schedule       string `json:"schedule"`
+	RetentionCount int    `json:"retention_count"`
+	RetentionDays  int    `json:"retention_days"`
+	Enabled        *bool  `json:"enabled,omitempty"` // defaults to true
+}
+
+// BackupListResponse represents a service's backups and policy
+type BackupListResponse struct {
+	ServiceID   string                       `json:"service_id"`
+	ProjectName string                       `json:"project_name"`
+	Policy      *database.BackupPolicyRecord `json:"policy,omitempty"`
+	Backups     []*database.BackupRecord     `json:"backups"`
+	Total       int                          `json:"total"`
+}
+
+// SetBackupPolicy creates or replaces a service's backup policy
+func (o *Orchestrator) SetBackupPolicy(ctx context.Context, id string, req *BackupPolicyRequest) (policy *database.BackupPolicyRecord, err error) {
+	defer func() {
+		params := map[string]any{"schedule": req.Schedule, "retention_count": req.RetentionCount, "retention_days": req.RetentionDays}
+		if req.Enabled != nil {
+			params["enabled"] = *req.Enabled
+		}
+		o.recordAuditResult(ctx, AuditSetBackupPolicy, o.auditedService(ctx, id), params, ErrInvalidBackupPolicy, err)
+	}()
+
+	if _, err := cron.NewSchedule(req.Schedule); err != nil {
+		return nil, fmt.Errorf("%w: schedule: %v", ErrInvalidBackupPolicy, err)
+	}
+	if req.RetentionCount < 0 || req.RetentionDays < 0 {
+		return nil, fmt.Errorf("%w: retention must not be negative", ErrInvalidBackupPolicy)
+	}
+
+	if _, err := o.dbManager.GetService(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	policy = &database.BackupPolicyRecord{
+		ServiceID:      id,
+		Schedule:       req.Schedule,
+		RetentionCount: req.RetentionCount,
+		RetentionDays:  req.RetentionDays,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+	}
+	if err := o.dbManager.SaveBackupPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// GetBackupPolicy returns a service's backup policy, or nil when it has none
+func (o *Orchestrator) GetBackupPolicy(ctx context.Context, id string) (*database.BackupPolicyRecord, error) {
+	return o.dbManager.GetBackupPolicy(ctx, id)
+}
+
+// DeleteBackupPolicy stops scheduled backups of a service. Existing backups are kept.
+func (o *Orchestrator) DeleteBackupPolicy(ctx context.Context, id string) error {
+	err := o.dbManager.DeleteBackupPolicy(ctx, id)
+	o.RecordAudit(ctx, AuditDeleteBackupPolicy, o.auditedService(ctx, id), nil, err)
+	return err
+}
+
+// newBackupStores returns the stores backups can be read from, keyed by name
+func newBackupStores(config *Config) map[string]storage.Store {
+	local := storage.NewLocalStore(config.BackupDir)
+	stores := map[string]storage.Store{local.Name(): local}
+
+	if config.BackupStore != nil {
+		stores[config.BackupStore.Name()] = config.BackupStore
+	}
+
+	return stores
+}
+
+// backupStore returns the store new backups are written to
+func (o *Orchestrator) backupStore() storage.Store {
+	if o.config.BackupStore != nil {
+		return o.config.BackupStore
+	}
+	return o.backupStores["local"]
+}
+
+// storeFor returns the store a backup was written to
+func (o *Orchestrator) storeFor(backup *database.BackupRecord) (storage.Store, error) {
+	store, ok := o.backupStores[backup.Storage]
+	if !ok {
+		return nil, fmt.Errorf("backup %s is kept in %s storage, which is not configured", backup.ID, backup.Storage)
+	}
+	return store, nil
+}
+
+// CreateBackup snapshots a service's pb_data, uploads it to the backup store and records it
+func (o *Orchestrator) CreateBackup(ctx context.Context, id, trigger string) (backup *database.BackupRecord, err error) {
+	serviceRecord, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	defer func() {
+		params := map[string]any{"trigger": trigger}
+		if backup != nil {
+			params["backup_id"] = backup.ID
+			params["size"] = backup.Size
+		}
+		o.recordAuditResult(ctx, AuditBackup, serviceRecord, params, ErrBackupQuota, err)
+	}()
+
+	// One backup of a service at a time
+	unlock := o.locks.Lock("backup:" + id)
+	defer unlock()
+
+	now := time.Now().UTC()
+	filename := fmt.Sprintf("%s-%s-%03d.zip", serviceRecord.ProjectName, now.Format("20060102-150405"), now.Nanosecond()/int(time.Millisecond))
+	key := serviceRecord.ProjectName + "/" + filename
+
+	// Archives are written next to the local backups first, so moving them into
+	// the local store does not need a copy
+	stagingPath := filepath.Join(o.config.BackupDir, ".staging", filename)
+
+	snapshot, err := o.serviceManager.SnapshotDataDir(ctx, serviceRecord.ProjectName, stagingPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", serviceRecord.ProjectName, err)
+	}
+
+	// The team's backups are added up under its lock, so two backups cannot both take the
+	// last of its quota
+	if serviceRecord.Team != "" {
+		unlockTeam := o.locks.Lock("team:" + serviceRecord.Team)
+		defer unlockTeam()
+
+		if err := o.checkBackupQuota(ctx, serviceRecord.Team, snapshot.Size); err != nil {
+			os.Remove(snapshot.Path)
+			return nil, err
+		}
+	}
+
+	store := o.backupStore()
+	if err := store.Upload(ctx, key, snapshot.Path); err != nil {
+		os.Remove(snapshot.Path)
+		return nil, fmt.Errorf("failed to store backup of %s: %w", serviceRecord.ProjectName, err)
+	}
+
+	backup = &database.BackupRecord{
+		ServiceID: id,
+		Filename:  filename,
+		Storage:   store.Name(),
+		Path:      key,
+		Size:      snapshot.Size,
+		Checksum:  snapshot.Checksum,
+		Trigger:   trigger,
+	}
+	if err := o.dbManager.CreateBackup(ctx, backup); err != nil {
+		store.Delete(ctx, key)
+		return nil, err
+	}
+
+	log.Printf("💾 Backed up %s to %s storage as %s (%d bytes)", serviceRecord.ProjectName, store.Name(), key, snapshot.Size)
+	o.publishServiceEvent(serviceRecord, Event{Type: EventBackupCompleted, Backup: backup})
+
+	return backup, nil
+}
+
+// ListBackups returns a service's backups and backup policy
+func (o *Orchestrator) ListBackups(ctx context.Context, id string) (*BackupListResponse, error) {
+	serviceRecord, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	policy, err := o.dbManager.GetBackupPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	backups, err := o.dbManager.ListBackups(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackupListResponse{
+		ServiceID:   id,
+		ProjectName: serviceRecord.ProjectName,
+		Policy:      policy,
+		Backups:     backups,
+		Total:       len(backups),
+	}, nil
+}
+
+// GetBackup returns a backup record
+func (o *Orchestrator) GetBackup(ctx context.Context, backupID string) (*database.BackupRecord, error) {
+	return o.dbManager.GetBackup(ctx, backupID)
+}
+
+// OpenBackup returns a backup record and a reader for its archive
+func (o *Orchestrator) OpenBackup(ctx context.Context, backupID string) (*database.BackupRecord, io.ReadCloser, error) {
+	backup, err := o.dbManager.GetBackup(ctx, backupID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := o.storeFor(backup)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := store.Open(ctx, backup.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return backup, reader, nil
+}
+
+// DeleteBackup removes a backup archive and its record
+func (o *Orchestrator) DeleteBackup(ctx context.Context, backupID string) (err error) {
+	backup, err := o.dbManager.GetBackup(ctx, backupID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		params := map[string]any{"backup_id": backup.ID, "filename": backup.Filename}
+		o.RecordAudit(ctx, AuditDeleteBackup, o.auditedService(ctx, backup.ServiceID), params, err)
+	}()
+
+	store, err := o.storeFor(backup)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Delete(ctx, backup.Path); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to remove backup archive: %w", err)
+	}
+
+	return o.dbManager.DeleteBackup(ctx, backupID)
+}
+
+// ApplyBackupRetention deletes the backups of a service that fall outside its policy's
+// retention count or age and returns how many were deleted. With a retention age, archives
+// in the backup store that were never recorded (an interrupted backup) are pruned as well.
+func (o *Orchestrator) ApplyBackupRetention(ctx context.Context, policy *database.BackupPolicyRecord, now time.Time) (int, error) {
+	if policy.RetentionCount == 0 && policy.RetentionDays == 0 {
+		return 0, nil
+	}
+
+	backups, err := o.dbManager.ListBackups(ctx, policy.ServiceID)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := now.AddDate(0, 0, -policy.RetentionDays)
+	deleted := 0
+	for i, backup := range backups {
+		tooMany := policy.RetentionCount > 0 && i >= policy.RetentionCount
+		tooOld := policy.RetentionDays > 0 && backup.CreatedAt.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if err := o.DeleteBackup(ctx, backup.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	if policy.RetentionDays == 0 {
+		return deleted, nil
+	}
+
+	pruned, err := o.pruneUnrecordedBackups(ctx, policy.ServiceID, cutoff)
+	return deleted + pruned, err
+}
+
+// pruneUnrecordedBackups deletes a service's archives older than cutoff that have no backup record
+func (o *Orchestrator) pruneUnrecordedBackups(ctx context.Context, id string, cutoff time.Time) (int, error) {
+	serviceRecord, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	backups, err := o.dbManager.ListBackups(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	store := o.backupStore()
+	recorded := make(map[string]bool, len(backups))
+	for _, backup := range backups {
+		if backup.Storage == store.Name() {
+			recorded[backup.Path] = true
+		}
+	}
+
+	// Only archives named the way CreateBackup names them are considered
+	prefix := serviceRecord.ProjectName + "/" + serviceRecord.ProjectName + "-"
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, obj := range objects {
+		if recorded[obj.Key] || !strings.HasSuffix(obj.Key, ".zip") || !obj.ModTime.Before(cutoff) {
+			continue
+		}
+
+		if err := store.Delete(ctx, obj.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return pruned, err
+		}
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// RunScheduledBackups backs up every service whose enabled policy is due at now (in UTC)
+// and applies retention afterwards. It returns the number of failed backups.
+func (o *Orchestrator) RunScheduledBackups(ctx context.Context, now time.Time) (int, error) {
+	policies, err := o.dbManager.ListBackupPolicies(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	moment := cron.NewMoment(now.UTC())
+	failed := 0
+	for _, policy := range policies {
+		if !policy.Enabled {
+			continue
+		}
+
+		schedule, err := cron.NewSchedule(policy.Schedule)
+		if err != nil {
+			log.Printf("❌ Invalid backup schedule %q for service %s: %v", policy.Schedule, policy.ServiceID, err)
+			failed++
+			continue
+		}
+		if !schedule.IsDue(moment) {
+			continue
+		}
+
+		if _, err := o.CreateBackup(ctx, policy.ServiceID, "scheduled"); err != nil {
+			log.Printf("❌ Scheduled backup failed for service %s: %v", policy.ServiceID, err)
+			failed++
+			continue
+		}
+
+		if err := o.dbManager.MarkBackupPolicyRun(ctx, policy.ID, now); err != nil {
+			log.Printf("⚠️ Failed to record backup run for service %s: %v", policy.ServiceID, err)
+		}
+
+		if deleted, err := o.ApplyBackupRetention(ctx, policy, now); err != nil {
+			log.Printf("❌ Backup retention failed for service %s: %v", policy.ServiceID, err)
+		} else if deleted > 0 {
+			log.Printf("🧹 Deleted %d expired backups of service %s", deleted, policy.ServiceID)
+		}
+	}
+
+	return failed, nil
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// GetAuditLog returns the audit log entries matching the filter, newest first. A zero
+// limit uses the server default.
+func (c *Client) GetAuditLog(ctx context.Context, filter database.AuditFilter) ([]*database.AuditRecord, error) {
+	var response struct {
+		Entries []*database.AuditRecord `json:"entries"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/audit"+encodeQuery(auditQuery(filter)), nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Entries, nil
+}
+
+// ExportAuditLog returns a reader for the matching audit log entries as CSV, which the
+// caller must close. A zero limit exports every matching entry.
+func (c *Client) ExportAuditLog(ctx context.Context, filter database.AuditFilter) (io.ReadCloser, error) {
+	query := auditQuery(filter)
+	query.Set("format", "csv")
+
+	resp, err := c.send(ctx, http.MethodGet, "/api/pockestrator/audit"+encodeQuery(query), "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// auditQuery encodes an audit filter as the audit route's query parameters
+func auditQuery(filter database.AuditFilter) url.Values {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"actor":   filter.Actor,
+		"action":  filter.Action,
+		"service": filter.Service,
+		"outcome": filter.Outcome,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if !filter.From.IsZero() {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	return query
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// ListBackups returns a service's backups and backup policy
+func (c *Client) ListBackups(ctx context.Context, id string) (*pkg.BackupListResponse, error) {
+	var response pkg.BackupListResponse
+	if err := c.do(ctx, http.MethodGet, servicePath(id, "backups"), nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// CreateBackup backs up a service's pb_data
+func (c *Client) CreateBackup(ctx context.Context, id string) (*database.BackupRecord, error) {
+	var backup database.BackupRecord
+	if err := c.do(ctx, http.MethodPost, servicePath(id, "backups"), nil, &backup); err != nil {
+		return nil, err
+	}
+
+	return &backup, nil
+}
+
+// GetBackupPolicy returns a service's backup policy. A service without one is a 404 *APIError.
+func (c *Client) GetBackupPolicy(ctx context.Context, id string) (*database.BackupPolicyRecord, error) {
+	var policy database.BackupPolicyRecord
+	if err := c.do(ctx, http.MethodGet, servicePath(id, "backup-policy"), nil, &policy); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// SetBackupPolicy creates or replaces a service's backup policy
+func (c *Client) SetBackupPolicy(ctx context.Context, id string, req *pkg.BackupPolicyRequest) (*database.BackupPolicyRecord, error) {
+	var policy database.BackupPolicyRecord
+	if err := c.do(ctx, http.MethodPut, servicePath(id, "backup-policy"), req, &policy); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// DeleteBackupPolicy stops scheduled backups of a service
+func (c *Client) DeleteBackupPolicy(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, servicePath(id, "backup-policy"), nil, nil)
+}
+
+// DownloadBackup returns a reader for a backup archive, which the caller must close
+func (c *Client) DownloadBackup(ctx context.Context, backupID string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/api/pockestrator/backups/"+url.PathEscape(backupID)+"/download", "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// DeleteBackup removes a backup archive and its record
+func (c *Client) DeleteBackup(ctx context.Context, backupID string) error {
+	return c.do(ctx, http.MethodDelete, "/api/pockestrator/backups/"+url.PathEscape(backupID), nil, nil)
+}
+
+// RestoreService replaces a service's pb_data with one of its recorded backups
+func (c *Client) RestoreService(ctx context.Context, id, backupID string) (*pkg.RestoreResponse, error) {
+	var response pkg.RestoreResponse
+	body := &pkg.RestoreRequest{BackupID: backupID}
+	if err := c.do(ctx, http.MethodPost, servicePath(id, "restore"), body, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// RestoreServiceFromArchive replaces a service's pb_data with an uploaded backup archive.
+// The archive is streamed, so it is never held in memory.
+func (c *Client) RestoreServiceFromArchive(ctx context.Context, id, filename string, archive io.Reader) (*pkg.RestoreResponse, error) {
+	body, bodyWriter := io.Pipe()
+	writer := multipart.NewWriter(bodyWriter)
+
+	go func() {
+		part, err := writer.CreateFormFile("file", filename)
+		if err == nil {
+			_, err = io.Copy(part, archive)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		bodyWriter.CloseWithError(err)
+	}()
+
+	resp, err := c.send(ctx, http.MethodPost, servicePath(id, "restore"), writer.FormDataContentType(), body)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response pkg.RestoreResponse
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
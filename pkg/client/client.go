@@ -0,0 +1,170 @@
+// Package client is a typed client for the Pockestrator REST API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/validation"
+)
+
+// Client calls the /api/pockestrator routes of a Pockestrator server
+type Client struct {
+	BaseURL string
+	// Token is a PocketBase auth token, sent as the Authorization header
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New creates a client for the server at baseURL
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// APIError is an error response from the server, in PocketBase's error format
+type APIError struct {
+	Status  int            `json:"status"`
+	Message string         `json:"message"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("pockestrator: %d %s", e.Status, e.Message)
+}
+
+// ValidationFailedError is returned when the server rejects a request's values. Errors
+// carries the validation codes, e.g. DUPLICATE_SERVICE or PORT_IN_USE.
+type ValidationFailedError struct {
+	Message string
+	Errors  []validation.ValidationError
+}
+
+func (e *ValidationFailedError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, ve := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s (%s)", ve.Field, ve.Message, ve.Code)
+	}
+	return fmt.Sprintf("pockestrator: %s: %s", e.Message, strings.Join(messages, "; "))
+}
+
+// HasCode reports whether one of the validation errors has the given code
+func (e *ValidationFailedError) HasCode(code string) bool {
+	return slices.ContainsFunc(e.Errors, func(ve validation.ValidationError) bool { return ve.Code == code })
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// AuthWithPassword signs in to an auth collection, such as _superusers, and keeps the token
+func (c *Client) AuthWithPassword(ctx context.Context, collection, identity, password string) error {
+	var response struct {
+		Token string `json:"token"`
+	}
+
+	path := fmt.Sprintf("/api/collections/%s/auth-with-password", url.PathEscape(collection))
+	body := map[string]string{"identity": identity, "password": password}
+	if err := c.do(ctx, http.MethodPost, path, body, &response); err != nil {
+		return err
+	}
+
+	c.Token = response.Token
+	return nil
+}
+
+// do sends a JSON request and decodes a JSON response into out, if it is not nil.
+// Error statuses listed in accept are decoded like successful responses.
+func (c *Client) do(ctx context.Context, method, path string, body, out any, accept ...int) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	resp, err := c.send(ctx, method, path, "application/json", reader, accept...)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, out)
+}
+
+// send sends a request and returns the response of a successful call. Error responses
+// with a status not listed in accept are closed and returned as an *APIError.
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader, accept ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("pockestrator: %s %s: %w", method, path, err)
+	}
+
+	if resp.StatusCode >= 400 && !slices.Contains(accept, resp.StatusCode) {
+		defer resp.Body.Close()
+		return nil, readAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// decodeResponse decodes a JSON response body into out, if it is not nil
+func decodeResponse(resp *http.Response, out any) error {
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("pockestrator: failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// readAPIError builds an *APIError from an error response
+func readAPIError(resp *http.Response) error {
+	apiErr := &APIError{Status: resp.StatusCode}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	apiErr.Status = resp.StatusCode
+
+	return apiErr
+}
+
+// servicePath returns the path of a service route
+func servicePath(id string, parts ...string) string {
+	return "/api/pockestrator/services/" + url.PathEscape(id) + strings.Join(append([]string{""}, parts...), "/")
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// EventOptions selects the events StreamEvents follows. Empty fields follow everything.
+type EventOptions struct {
+	// Services are names or IDs of services
+	Services []string
+	Types    []pkg.EventType
+	// After resumes the stream after the event with this ID, as far as the server still
+	// has the events
+	After uint64
+}
+
+// StreamEvents follows the server's event stream and calls handle with each event. It
+// returns when ctx is done, handle fails or the server ends the stream; a caller can
+// resume with After set to the last event it handled.
+func (c *Client) StreamEvents(ctx context.Context, opts EventOptions, handle func(*pkg.Event) error) error {
+	query := url.Values{}
+	for _, service := range opts.Services {
+		query.Add("service", service)
+	}
+	for _, eventType := range opts.Types {
+		query.Add("type", string(eventType))
+	}
+	if opts.After > 0 {
+		query.Set("last_event_id", strconv.FormatUint(opts.After, 10))
+	}
+
+	// The stream stays open for longer than the client's timeout allows
+	stream := *c
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = 0
+	stream.HTTPClient = &httpClient
+
+	resp, err := stream.send(ctx, http.MethodGet, "/api/pockestrator/events"+encodeQuery(query), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	// Events end with a blank line; their ID and type are part of the JSON data
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		var event pkg.Event
+		if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+			return fmt.Errorf("pockestrator: failed to decode event: %w", err)
+		}
+		data.Reset()
+
+		if err := handle(&event); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
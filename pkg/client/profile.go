@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultProfile is the profile used when none is named
+const DefaultProfile = "default"
+
+// Profile is a saved server URL and auth token
+type Profile struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// Client creates a client for the profile's server
+func (p *Profile) Client() *Client {
+	return New(p.URL, p.Token)
+}
+
+// ProfilesPath returns the file profiles are saved in, under the user's config directory
+func ProfilesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "pockestrator", "remote.json"), nil
+}
+
+// LoadProfile reads a named profile from the profiles file at path
+func LoadProfile(path, name string) (*Profile, error) {
+	profiles, err := readProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("no remote profile %q, run 'pockestrator remote login' first", name)
+	}
+
+	return profile, nil
+}
+
+// SaveProfile adds or replaces a named profile in the profiles file at path. The file
+// holds auth tokens, so it is only readable by its owner.
+func SaveProfile(path, name string, profile *Profile) error {
+	profiles, err := readProfiles(path)
+	if err != nil {
+		return err
+	}
+	profiles[name] = profile
+
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// readProfiles reads the profiles file, treating a missing file as empty
+func readProfiles(path string) (map[string]*Profile, error) {
+	profiles := make(map[string]*Profile)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote profiles: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse remote profiles %s: %w", path, err)
+	}
+
+	return profiles, nil
+}
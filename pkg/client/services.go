@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// CreateService creates a service and starts deploying it. A rejected request returns
+// the response together with a *ValidationFailedError.
+func (c *Client) CreateService(ctx context.Context, req *pkg.ServiceRequest) (*pkg.ServiceResponse, error) {
+	var response pkg.ServiceResponse
+	if err := c.do(ctx, http.MethodPost, "/api/pockestrator/services", req, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, responseError(&response)
+}
+
+// ListServices returns the services the caller can access, which is every service for admins
+func (c *Client) ListServices(ctx context.Context) ([]*database.ServiceRecord, error) {
+	var response struct {
+		Services []*database.ServiceRecord `json:"services"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/services", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Services, nil
+}
+
+// GetService returns a service by ID
+func (c *Client) GetService(ctx context.Context, id string) (*database.ServiceRecord, error) {
+	var response pkg.ServiceResponse
+	if err := c.do(ctx, http.MethodGet, servicePath(id), nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Data, nil
+}
+
+// FindService returns a service by project name or ID
+func (c *Client) FindService(ctx context.Context, ref string) (*database.ServiceRecord, error) {
+	services, err := c.ListServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, svc := range services {
+		if svc.ProjectName == ref || svc.ID == ref {
+			return svc, nil
+		}
+	}
+
+	return nil, &APIError{Status: http.StatusNotFound, Message: fmt.Sprintf("no service named or with ID %q", ref)}
+}
+
+// UpdateService changes a service's port, domain, version, flags, environment or limits.
+// The change is applied in the background and rolled back if the service does not come
+// back healthy; a rejected request returns the response with a *ValidationFailedError.
+func (c *Client) UpdateService(ctx context.Context, id string, req *pkg.ServiceUpdateRequest) (*pkg.ServiceResponse, error) {
+	var response pkg.ServiceResponse
+	if err := c.do(ctx, http.MethodPatch, servicePath(id), req, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, responseError(&response)
+}
+
+// DeleteService removes a service with its unit, Caddy site and files
+func (c *Client) DeleteService(ctx context.Context, id string) (*pkg.ServiceResponse, error) {
+	var response pkg.ServiceResponse
+	if err := c.do(ctx, http.MethodDelete, servicePath(id), nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, responseError(&response)
+}
+
+// ControlService starts, stops or restarts a service
+func (c *Client) ControlService(ctx context.Context, id, action string) (*pkg.ServiceResponse, error) {
+	var response pkg.ServiceResponse
+	body := map[string]string{"action": action}
+	if err := c.do(ctx, http.MethodPost, servicePath(id, "control"), body, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, responseError(&response)
+}
+
+// CloneService creates a new service from an existing one
+func (c *Client) CloneService(ctx context.Context, id string, req *pkg.CloneRequest) (*pkg.ServiceResponse, error) {
+	var response pkg.ServiceResponse
+	if err := c.do(ctx, http.MethodPost, servicePath(id, "clone"), req, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, responseError(&response)
+}
+
+// GetServiceStatus checks the health of a service
+func (c *Client) GetServiceStatus(ctx context.Context, id string) (*service.HealthStatus, error) {
+	var status service.HealthStatus
+	if err := c.do(ctx, http.MethodGet, servicePath(id, "status"), nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// GetServiceLogs returns the last lines of a service's journal
+func (c *Client) GetServiceLogs(ctx context.Context, id string, lines int) (*pkg.ServiceLogsResponse, error) {
+	var response pkg.ServiceLogsResponse
+	path := servicePath(id, "logs") + "?lines=" + strconv.Itoa(lines)
+	if err := c.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// GetHealthHistory returns a service's recorded health checks, newest first. Zero times
+// leave the range open and a zero limit uses the server default.
+func (c *Client) GetHealthHistory(ctx context.Context, id string, from, to time.Time, limit int) (*pkg.HealthHistoryResponse, error) {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var response pkg.HealthHistoryResponse
+	if err := c.do(ctx, http.MethodGet, servicePath(id, "health", "history")+encodeQuery(query), nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// GetCrashEvents returns a service's crash loop state and recent crash events
+func (c *Client) GetCrashEvents(ctx context.Context, id string, limit int) (*pkg.CrashEventsResponse, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var response pkg.CrashEventsResponse
+	if err := c.do(ctx, http.MethodGet, servicePath(id, "crashes")+encodeQuery(query), nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// GetServiceUsage returns a service's resource usage
+func (c *Client) GetServiceUsage(ctx context.Context, id string) (*pkg.ServiceUsage, error) {
+	var usage pkg.ServiceUsage
+	if err := c.do(ctx, http.MethodGet, servicePath(id, "usage"), nil, &usage); err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+// ListCollaborators returns the users a service is shared with
+func (c *Client) ListCollaborators(ctx context.Context, id string) ([]*database.CollaboratorRecord, error) {
+	var response struct {
+		Collaborators []*database.CollaboratorRecord `json:"collaborators"`
+	}
+	if err := c.do(ctx, http.MethodGet, servicePath(id, "collaborators"), nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Collaborators, nil
+}
+
+// SetCollaborator shares a service with a user, or replaces what they may do on it.
+// Only the owner and admins can share a service.
+func (c *Client) SetCollaborator(ctx context.Context, id, userID string, permissions ...auth.Permission) (*database.CollaboratorRecord, error) {
+	var collaborator database.CollaboratorRecord
+	body := &pkg.CollaboratorRequest{Permissions: permissions}
+	if err := c.do(ctx, http.MethodPut, servicePath(id, "collaborators", userID), body, &collaborator); err != nil {
+		return nil, err
+	}
+
+	return &collaborator, nil
+}
+
+// RemoveCollaborator stops sharing a service with a user
+func (c *Client) RemoveCollaborator(ctx context.Context, id, userID string) error {
+	return c.do(ctx, http.MethodDelete, servicePath(id, "collaborators", userID), nil, nil)
+}
+
+// responseError returns a *ValidationFailedError for a rejected service operation
+func responseError(response *pkg.ServiceResponse) error {
+	if response.Status != "error" {
+		return nil
+	}
+
+	return &ValidationFailedError{Message: response.Message, Errors: response.Errors}
+}
+
+// encodeQuery returns query as a query string, empty when there are no values
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/tigawanna/pockestrator/internal/validation"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// SystemInfo describes the server's version and configuration
+type SystemInfo struct {
+	Version string         `json:"version"`
+	Uptime  string         `json:"uptime"`
+	Config  map[string]any `json:"config"`
+}
+
+// SystemHealth is the outcome of the server's system requirements check
+type SystemHealth struct {
+	Healthy  bool                         `json:"healthy"`
+	Checks   map[string]bool              `json:"checks"`
+	Errors   []validation.ValidationError `json:"errors"`
+	Warnings []validation.ValidationError `json:"warnings"`
+}
+
+// ServiceValidation is the outcome of validating a service configuration
+type ServiceValidation struct {
+	Valid    bool                         `json:"valid"`
+	Errors   []validation.ValidationError `json:"errors"`
+	Warnings []validation.ValidationError `json:"warnings"`
+}
+
+// ApplyManifest brings the server's services in line with a manifest
+func (c *Client) ApplyManifest(ctx context.Context, manifest *pkg.Manifest, opts pkg.ApplyOptions) (*pkg.ApplyResult, error) {
+	query := url.Values{}
+	if opts.Prune {
+		query.Set("prune", "true")
+	}
+	if opts.DryRun {
+		query.Set("dry_run", "true")
+	}
+
+	var result pkg.ApplyResult
+	if err := c.do(ctx, http.MethodPost, "/api/pockestrator/apply"+encodeQuery(query), manifest, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetMetrics returns the metrics in the Prometheus text format
+func (c *Client) GetMetrics(ctx context.Context) (string, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/api/pockestrator/metrics", "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// ValidateService validates a service configuration without creating it. An invalid
+// configuration is reported in the result, not as an error.
+func (c *Client) ValidateService(ctx context.Context, req *pkg.ServiceRequest) (*ServiceValidation, error) {
+	// Invalid configurations are answered with 400 and the validation result as the body,
+	// unreadable requests with 400 and a PocketBase error
+	var response struct {
+		ServiceValidation
+		Message string `json:"message"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/pockestrator/validate/service", req, &response, http.StatusBadRequest); err != nil {
+		return nil, err
+	}
+	if response.Message != "" {
+		return nil, &APIError{Status: http.StatusBadRequest, Message: response.Message}
+	}
+
+	return &response.ServiceValidation, nil
+}
+
+// ValidateSystem checks the server's system requirements
+func (c *Client) ValidateSystem(ctx context.Context) (*validation.ValidationResult, error) {
+	var result validation.ValidationResult
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/validate/system", nil, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DiscoverServices lists PocketBase instances deployed on the server, managed or not
+func (c *Client) DiscoverServices(ctx context.Context) ([]*pkg.DiscoveredService, error) {
+	var response struct {
+		Services []*pkg.DiscoveredService `json:"services"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/discovery", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Services, nil
+}
+
+// ImportServices adopts discovered instances as services
+func (c *Client) ImportServices(ctx context.Context, projectNames []string) ([]*pkg.ImportResult, error) {
+	var response struct {
+		Results []*pkg.ImportResult `json:"results"`
+	}
+	body := map[string][]string{"project_names": projectNames}
+	if err := c.do(ctx, http.MethodPost, "/api/pockestrator/discovery/import", body, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Results, nil
+}
+
+// ScanOrphans lists units, Caddy sites and directories that belong to no service
+func (c *Client) ScanOrphans(ctx context.Context) (*pkg.OrphanReport, error) {
+	var report pkg.OrphanReport
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/orphans", nil, &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// RemoveOrphans removes orphaned resources
+func (c *Client) RemoveOrphans(ctx context.Context, req *pkg.OrphanRemovalRequest) ([]*pkg.OrphanRemovalResult, error) {
+	var response struct {
+		Results []*pkg.OrphanRemovalResult `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/pockestrator/orphans/remove", req, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Results, nil
+}
+
+// GetPortStatus reports who holds a port
+func (c *Client) GetPortStatus(ctx context.Context, port int) (*pkg.PortStatus, error) {
+	var status pkg.PortStatus
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/ports/"+strconv.Itoa(port), nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// GetSystemInfo returns the server's version and configuration
+func (c *Client) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
+	var info SystemInfo
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/system/info", nil, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// GetSystemHealth checks the server's system requirements. An unhealthy system is
+// reported in the result, not as an error.
+func (c *Client) GetSystemHealth(ctx context.Context) (*SystemHealth, error) {
+	// An unhealthy system is answered with 503 and the health report as the body
+	var health SystemHealth
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/system/health", nil, &health, http.StatusServiceUnavailable); err != nil {
+		return nil, err
+	}
+
+	return &health, nil
+}
@@ -0,0 +1,19 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// GetTeamUsage returns what a team's services use of its quotas
+func (c *Client) GetTeamUsage(ctx context.Context, teamID string) (*pkg.TeamUsage, error) {
+	var usage pkg.TeamUsage
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/teams/"+url.PathEscape(teamID)+"/usage", nil, &usage); err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// CreateToken creates an API token for the signed-in user. The token itself is only
+// returned here. API tokens cannot manage tokens, so the client must use a sign-in token.
+func (c *Client) CreateToken(ctx context.Context, req *pkg.TokenRequest) (*pkg.CreatedToken, error) {
+	var token pkg.CreatedToken
+	if err := c.do(ctx, http.MethodPost, "/api/pockestrator/tokens", req, &token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ListTokens returns the signed-in user's API tokens, or every token for admins
+func (c *Client) ListTokens(ctx context.Context) ([]*database.TokenRecord, error) {
+	var response struct {
+		Tokens []*database.TokenRecord `json:"tokens"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/tokens", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Tokens, nil
+}
+
+// RevokeToken deletes an API token, which stops working immediately
+func (c *Client) RevokeToken(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/pockestrator/tokens/"+url.PathEscape(id), nil, nil)
+}
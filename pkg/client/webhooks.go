@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// CreateWebhook creates a webhook. The secret signing its payloads is only returned here.
+func (c *Client) CreateWebhook(ctx context.Context, req *pkg.WebhookRequest) (*pkg.CreatedWebhook, error) {
+	var webhook pkg.CreatedWebhook
+	if err := c.do(ctx, http.MethodPost, "/api/pockestrator/webhooks", req, &webhook); err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// ListWebhooks returns every webhook
+func (c *Client) ListWebhooks(ctx context.Context) ([]*database.WebhookRecord, error) {
+	var response struct {
+		Webhooks []*database.WebhookRecord `json:"webhooks"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/pockestrator/webhooks", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook along with its queued deliveries and delivery log
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/pockestrator/webhooks/"+url.PathEscape(id), nil, nil)
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook, newest first. An empty status
+// returns every delivery and a zero limit uses the server default.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id, status string, limit int) ([]*database.WebhookDeliveryRecord, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var response struct {
+		Deliveries []*database.WebhookDeliveryRecord `json:"deliveries"`
+	}
+	path := "/api/pockestrator/webhooks/" + url.PathEscape(id) + "/deliveries" + encodeQuery(query)
+	if err := c.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Deliveries, nil
+}
@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// CloneRequest represents a request to clone a service into a new one
+type CloneRequest struct {
+	ProjectName string `json:"project_name"`
+	Port        int    `json:"port,omitempty"`   // allocated when omitted
+	Domain      string `json:"domain,omitempty"` // defaults to the source's domain
+	// IncludeData copies a consistent snapshot of the source's pb_data
+	IncludeData bool   `json:"include_data"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+}
+
+// CloneService creates a new service from an existing one. The clone runs the source's
+// PocketBase version with its serve flags and gets copies of pb_hooks, pb_migrations,
+// pb_public and optionally pb_data, then deploys like any new service.
+func (o *Orchestrator) CloneService(ctx context.Context, id string, req *CloneRequest) (*ServiceResponse, error) {
+	source, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	domain := req.Domain
+	if domain == "" {
+		domain = source.Domain
+	}
+
+	serviceRecord, response, err := o.createServiceRecord(ctx, &ServiceRequest{
+		ProjectName:       req.ProjectName,
+		PocketBaseVersion: source.PocketBaseVersion,
+		Port:              req.Port,
+		Domain:            domain,
+		CreatedBy:         req.CreatedBy,
+		Owner:             req.Owner,
+		Team:              source.Team,
+		Limits:            source.Limits,
+		ServeFlags:        o.sourceServeFlags(source),
+	})
+	if err != nil || response != nil {
+		return response, err
+	}
+
+	params := map[string]any{"clone_of": source.ProjectName, "include_data": req.IncludeData}
+	go func() {
+		started := time.Now()
+		err := o.cloneServiceAsync(context.Background(), source, serviceRecord, req.IncludeData)
+		o.observeDeployment(started, err)
+		o.RecordAudit(ctx, AuditCreate, serviceRecord, params, err)
+		if err != nil {
+			log.Printf("❌ Failed to clone %s into %s: %v", source.ProjectName, serviceRecord.ProjectName, err)
+			o.dbManager.UpdateServiceStatus(context.Background(), serviceRecord.ID, "error")
+		}
+	}()
+
+	return &ServiceResponse{
+		ID:      serviceRecord.ID,
+		Status:  "deploying",
+		Message: fmt.Sprintf("Cloning %s, deployment started", source.ProjectName),
+		Data:    serviceRecord,
+	}, nil
+}
+
+// cloneServiceAsync copies the source's files into the clone's directory and deploys it
+func (o *Orchestrator) cloneServiceAsync(ctx context.Context, source, clone *database.ServiceRecord, includeData bool) error {
+	copied, err := o.serviceManager.CopyAppDirs(source.ProjectName, clone.ProjectName)
+	if err != nil {
+		return err
+	}
+	log.Printf("📋 Copied %v from %s to %s", copied, source.ProjectName, clone.ProjectName)
+
+	if includeData {
+		// Keep restores of the source from swapping pb_data mid snapshot
+		unlock := o.locks.Lock("backup:" + source.ID)
+		err := o.serviceManager.CloneDataDir(ctx, source.ProjectName, clone.ProjectName)
+		unlock()
+		if err != nil {
+			return fmt.Errorf("failed to copy pb_data: %w", err)
+		}
+	}
+
+	return o.deployServiceAsync(ctx, clone)
+}
+
+// sourceServeFlags returns the serve flags a clone inherits. The source's unit file is
+// authoritative, since flags may have been added by hand; the record is the fallback.
+func (o *Orchestrator) sourceServeFlags(source *database.ServiceRecord) []string {
+	unitFile := filepath.Join(o.config.SystemdDir, source.ProjectName+"-pocketbase.service")
+
+	info, err := o.systemdManager.ParseServiceFile(unitFile)
+	if err != nil {
+		return source.ServeFlags
+	}
+
+	return info.ServeFlags
+}
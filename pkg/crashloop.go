@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// Crash loop defaults used when the configuration leaves them unset
+const (
+	DefaultCrashLoopWindow    = 15 * time.Minute
+	DefaultCrashLoopThreshold = 5
+)
+
+// crashLogLines is the number of errors.log lines attached to a crash event
+const crashLogLines = 50
+
+// CrashLoopDetector tracks systemd restart counters over a sliding window
+type CrashLoopDetector struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples map[string][]restartSample
+}
+
+// restartSample is a single observation of a unit's NRestarts counter
+type restartSample struct {
+	at        time.Time
+	nRestarts int
+}
+
+// CrashEventsResponse represents a service's crash loop history
+type CrashEventsResponse struct {
+	ServiceID   string                       `json:"service_id"`
+	ProjectName string                       `json:"project_name"`
+	Events      []*database.CrashEventRecord `json:"events"`
+	Total       int                          `json:"total"`
+}
+
+// NewCrashLoopDetector creates a detector that counts restarts within window
+func NewCrashLoopDetector(window time.Duration) *CrashLoopDetector {
+	if window <= 0 {
+		window = DefaultCrashLoopWindow
+	}
+
+	return &CrashLoopDetector{
+		window:  window,
+		samples: make(map[string][]restartSample),
+	}
+}
+
+// Observe records the restart counter of a unit and returns how many restarts
+// happened within the window. A counter that went down (the unit was started
+// manually or systemd was reloaded) starts a fresh history.
+func (d *CrashLoopDetector) Observe(key string, nRestarts int, at time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	samples := d.samples[key]
+	if len(samples) > 0 && nRestarts < samples[len(samples)-1].nRestarts {
+		samples = nil
+	}
+	samples = append(samples, restartSample{at: at, nRestarts: nRestarts})
+
+	// Drop observations that fell out of the window
+	cutoff := at.Add(-d.window)
+	first := 0
+	for first < len(samples)-1 && samples[first].at.Before(cutoff) {
+		first++
+	}
+	samples = samples[first:]
+	d.samples[key] = samples
+
+	return nRestarts - samples[0].nRestarts
+}
+
+// Reset forgets the restart history of a unit
+func (d *CrashLoopDetector) Reset(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.samples, key)
+}
+
+// checkCrashLoop reads the unit's restart counter and reports whether the service is
+// crash looping. On entering a crash loop, or when the restart budget is exhausted and
+// the service is stopped, an event with the tail of errors.log is recorded.
+func (o *Orchestrator) checkCrashLoop(ctx context.Context, svc *database.ServiceRecord) (bool, error) {
+	state, err := o.systemdManager.GetUnitState(svc.ProjectName)
+	if err != nil {
+		return false, err
+	}
+
+	restarts := o.crashLoops.Observe(svc.ID, state.NRestarts, time.Now())
+
+	threshold := o.config.CrashLoopThreshold
+	if threshold <= 0 {
+		threshold = DefaultCrashLoopThreshold
+	}
+
+	stop := o.config.RestartBudget > 0 && restarts >= o.config.RestartBudget && state.ActiveState != "inactive"
+	if restarts < threshold && !stop {
+		return false, nil
+	}
+
+	if stop {
+		if err := o.serviceManager.Stop(svc.ProjectName); err != nil {
+			return true, fmt.Errorf("failed to stop crash looping service: %w", err)
+		}
+		log.Printf("🛑 Stopped service %s after %d restarts (budget %d)", svc.ProjectName, restarts, o.config.RestartBudget)
+	}
+
+	// Only record the transition into the loop and the stop itself
+	if svc.Status == "crashlooping" && !stop {
+		return true, nil
+	}
+
+	logTail, err := o.serviceManager.TailErrorLog(svc.ProjectName, crashLogLines)
+	if err != nil {
+		log.Printf("⚠️ Failed to read error log of %s: %v", svc.ProjectName, err)
+	}
+
+	event := &database.CrashEventRecord{
+		ServiceID:  svc.ID,
+		Restarts:   restarts,
+		NRestarts:  state.NRestarts,
+		ExitStatus: state.ExecMainStatus,
+		Stopped:    stop,
+		LogTail:    strings.Join(logTail, "\n"),
+	}
+	if err := o.dbManager.CreateCrashEvent(ctx, event); err != nil {
+		return true, err
+	}
+
+	log.Printf("💥 Service %s is crash looping: %d restarts in %s, last exit status %d",
+		svc.ProjectName, restarts, o.crashLoops.window, state.ExecMainStatus)
+
+	return true, nil
+}
+
+// GetCrashEvents returns a service's most recent crash loop events
+func (o *Orchestrator) GetCrashEvents(ctx context.Context, id string, limit int) (*CrashEventsResponse, error) {
+	serviceRecord, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	events, err := o.dbManager.ListCrashEvents(ctx, id, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CrashEventsResponse{
+		ServiceID:   id,
+		ProjectName: serviceRecord.ProjectName,
+		Events:      events,
+		Total:       len(events),
+	}, nil
+}
@@ -0,0 +1,234 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// DiscoveredService describes a PocketBase instance found on the host
+type DiscoveredService struct {
+	ProjectName       string   `json:"project_name"`
+	UnitFile          string   `json:"unit_file"`
+	ServiceDir        string   `json:"service_dir"`
+	Port              int      `json:"port"`
+	PocketBaseVersion string   `json:"pocketbase_version"`
+	Domain            string   `json:"domain"`
+	CaddySite         string   `json:"caddy_site"`
+	SystemdStatus     string   `json:"systemd_status"`
+	Managed           bool     `json:"managed"`
+	Importable        bool     `json:"importable"`
+	Warnings          []string `json:"warnings,omitempty"`
+	Errors            []string `json:"errors,omitempty"`
+}
+
+// ImportResult represents the outcome of importing a discovered service
+type ImportResult struct {
+	ProjectName string `json:"project_name"`
+	ID          string `json:"id,omitempty"`
+	Status      string `json:"status"` // imported, skipped, error
+	Message     string `json:"message"`
+}
+
+// DiscoverServices scans the systemd directory for PocketBase units and
+// reports each one together with its Caddy site and whether it is already managed
+func (o *Orchestrator) DiscoverServices(ctx context.Context) ([]*DiscoveredService, error) {
+	unitFiles, err := o.systemdManager.ListServiceFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	existingServices, err := o.dbManager.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing services: %w", err)
+	}
+
+	managedNames := make(map[string]bool)
+	managedPorts := make(map[int]bool)
+	for _, svc := range existingServices {
+		managedNames[strings.ToLower(svc.ProjectName)] = true
+		managedPorts[svc.Port] = true
+	}
+
+	discovered := make([]*DiscoveredService, 0, len(unitFiles))
+	for _, unitFile := range unitFiles {
+		discovered = append(discovered, o.inspectUnit(ctx, unitFile, managedNames, managedPorts))
+	}
+
+	return discovered, nil
+}
+
+// inspectUnit recovers everything needed to import a single unit file
+func (o *Orchestrator) inspectUnit(ctx context.Context, unitFile string, managedNames map[string]bool, managedPorts map[int]bool) *DiscoveredService {
+	discovered := &DiscoveredService{
+		ProjectName: strings.TrimSuffix(filepath.Base(unitFile), "-pocketbase.service"),
+		UnitFile:    unitFile,
+	}
+
+	discovered.Managed = managedNames[strings.ToLower(discovered.ProjectName)]
+
+	unit, err := o.systemdManager.ParseServiceFile(unitFile)
+	if err != nil {
+		discovered.Errors = append(discovered.Errors, err.Error())
+		return discovered
+	}
+
+	discovered.ServiceDir = unit.WorkingDirectory
+	discovered.Port = unit.Port
+
+	if !discovered.Managed && managedPorts[unit.Port] {
+		discovered.Errors = append(discovered.Errors, fmt.Sprintf("port %d is already used by a managed service", unit.Port))
+	}
+
+	expectedDir := filepath.Join(o.config.BaseDir, discovered.ProjectName)
+	if unit.WorkingDirectory != expectedDir {
+		discovered.Warnings = append(discovered.Warnings, fmt.Sprintf("service directory %s differs from expected %s", unit.WorkingDirectory, expectedDir))
+	}
+
+	version, err := o.serviceManager.GetBinaryVersion(ctx, unit.BinaryPath)
+	if err != nil {
+		discovered.Errors = append(discovered.Errors, err.Error())
+	} else {
+		discovered.PocketBaseVersion = version
+	}
+
+	discovered.SystemdStatus, _ = o.systemdManager.GetServiceStatus(discovered.ProjectName)
+
+	discovered.Domain = o.config.DefaultDomain
+	site, err := o.caddyManager.FindSiteByPort(unit.Port)
+	if err != nil {
+		discovered.Warnings = append(discovered.Warnings, fmt.Sprintf("no Caddy site found: %v", err))
+	} else {
+		discovered.CaddySite = site
+		if domain, ok := strings.CutPrefix(site, discovered.ProjectName+"."); ok {
+			discovered.Domain = domain
+		} else {
+			discovered.Warnings = append(discovered.Warnings, fmt.Sprintf("Caddy site %s does not follow the <project>.<domain> convention", site))
+		}
+	}
+
+	discovered.Importable = !discovered.Managed && len(discovered.Errors) == 0
+
+	return discovered
+}
+
+// ImportServices creates service records for discovered instances without restarting them.
+// When projectNames is empty every importable instance is imported.
+func (o *Orchestrator) ImportServices(ctx context.Context, projectNames []string, createdBy string) ([]*ImportResult, error) {
+	discovered, err := o.DiscoverServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, name := range projectNames {
+		wanted[strings.ToLower(name)] = true
+	}
+
+	// Names are crossed off as they are found, the rest are reported as missing
+	var results []*ImportResult
+	for _, candidate := range discovered {
+		name := strings.ToLower(candidate.ProjectName)
+		if len(projectNames) > 0 && !wanted[name] {
+			continue
+		}
+		delete(wanted, name)
+
+		results = append(results, o.importService(ctx, candidate, createdBy))
+	}
+
+	for name := range wanted {
+		results = append(results, &ImportResult{
+			ProjectName: name,
+			Status:      "error",
+			Message:     "No pocketbase unit file found for this project",
+		})
+	}
+
+	return results, nil
+}
+
+// importService records a single discovered instance
+func (o *Orchestrator) importService(ctx context.Context, candidate *DiscoveredService, createdBy string) *ImportResult {
+	result := &ImportResult{ProjectName: candidate.ProjectName}
+
+	if candidate.Managed {
+		result.Status = "skipped"
+		result.Message = "Service is already managed by Pockestrator"
+		return result
+	}
+
+	if !candidate.Importable {
+		result.Status = "error"
+		result.Message = strings.Join(candidate.Errors, "; ")
+		return result
+	}
+
+	// Only check the name format and version here: the port is expected to be bound
+	nameResult := o.validator.ValidateProjectName(candidate.ProjectName)
+	versionResult := o.validator.ValidateVersion(candidate.PocketBaseVersion)
+	if !nameResult.IsValid || !versionResult.IsValid {
+		var messages []string
+		for _, e := range append(nameResult.Errors, versionResult.Errors...) {
+			messages = append(messages, e.Message)
+		}
+		result.Status = "error"
+		result.Message = strings.Join(messages, "; ")
+		return result
+	}
+
+	status := "inactive"
+	if candidate.SystemdStatus == "active" {
+		status = "active"
+	}
+
+	serviceRecord := &database.ServiceRecord{
+		ProjectName:       candidate.ProjectName,
+		Port:              candidate.Port,
+		PocketBaseVersion: candidate.PocketBaseVersion,
+		Domain:            candidate.Domain,
+		Status:            status,
+		CreatedBy:         createdBy,
+		LastHealthCheck:   time.Now(),
+	}
+
+	// Hash the unit and site the service would be deployed with, like every other service
+	systemdHash, caddyHash, err := o.configHashes(o.systemdConfigFor(serviceRecord), caddyConfigFor(serviceRecord))
+	if err != nil {
+		result.Status = "error"
+		result.Message = err.Error()
+		return result
+	}
+	serviceRecord.SystemdConfigHash = systemdHash
+	serviceRecord.CaddyConfigHash = caddyHash
+
+	// The instance already listens on its port, which is reserved for it like an allocated one
+	unlockName := o.locks.Lock("name:" + strings.ToLower(candidate.ProjectName))
+	defer unlockName()
+	unlockPort := o.locks.Lock(fmt.Sprintf("port:%d", candidate.Port))
+	defer unlockPort()
+
+	if err := o.portManager.Adopt(ctx, candidate.ProjectName, candidate.Port); err != nil {
+		result.Status = "error"
+		result.Message = err.Error()
+		return result
+	}
+
+	err = o.dbManager.CreateService(ctx, serviceRecord)
+	o.RecordAudit(ctx, AuditCreate, serviceRecord, map[string]any{"import": true, "port": candidate.Port}, err)
+	if err != nil {
+		o.portManager.Release(ctx, candidate.Port)
+		result.Status = "error"
+		result.Message = err.Error()
+		return result
+	}
+
+	result.ID = serviceRecord.ID
+	result.Status = "imported"
+	result.Message = "Service imported successfully"
+	return result
+}
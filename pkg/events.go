@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// EventType is the kind of an orchestration event
+type EventType string
+
+// Event types
+const (
+	EventDeployStepStarted  EventType = "deploy.step_started"
+	EventDeployStepFinished EventType = "deploy.step_finished"
+	EventStatusChanged      EventType = "service.status_changed"
+	EventHealthChanged      EventType = "service.health_changed"
+	EventBackupCompleted    EventType = "backup.completed"
+)
+
+// EventTypes lists every event type
+var EventTypes = []EventType{
+	EventDeployStepStarted,
+	EventDeployStepFinished,
+	EventStatusChanged,
+	EventHealthChanged,
+	EventBackupCompleted,
+}
+
+// Deploy steps, in the order a deploy runs them. Updates skip the steps they do not need.
+const (
+	DeployStepInstall = "install" // download the PocketBase binary
+	DeployStepSystemd = "systemd" // write, enable and (re)start the unit
+	DeployStepCaddy   = "caddy"   // add or move the site and reload Caddy
+	DeployStepHealth  = "health"  // wait for the service to come up
+)
+
+const (
+	// eventHistorySize is how many recent events the bus keeps for subscribers resuming
+	// after a disconnect
+	eventHistorySize = 256
+	// eventSubscriberBuffer is how many events a subscriber can fall behind by before
+	// it is disconnected
+	eventSubscriberBuffer = 64
+)
+
+// Event is something that happened to a service. Exactly one of Step, Status, Health and
+// Backup is set, depending on the type.
+type Event struct {
+	ID          uint64    `json:"id"`
+	Type        EventType `json:"type"`
+	ServiceID   string    `json:"service_id"`
+	ServiceName string    `json:"service_name"`
+	Time        time.Time `json:"time"`
+
+	Step   *DeployStep            `json:"step,omitempty"`
+	Status *StatusChange          `json:"status,omitempty"`
+	Health *HealthChange          `json:"health,omitempty"`
+	Backup *database.BackupRecord `json:"backup,omitempty"`
+}
+
+// DeployStep is a step of deploying or updating a service. Error and DurationMs are only
+// set once the step has finished.
+type DeployStep struct {
+	Name       string `json:"name"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+// StatusChange is a change of a service's status. From is empty for new services.
+type StatusChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// HealthChange is a change of the outcome of a service's health checks
+type HealthChange struct {
+	Healthy bool   `json:"healthy"`
+	Verdict string `json:"verdict"`
+	Error   string `json:"error,omitempty"`
+}
+
+// EventFilter selects events. Empty fields match everything.
+type EventFilter struct {
+	Services []string
+	Types    []EventType
+}
+
+// Matches reports whether an event passes the filter
+func (f EventFilter) Matches(event *Event) bool {
+	return (len(f.Services) == 0 || slices.Contains(f.Services, event.ServiceID)) &&
+		(len(f.Types) == 0 || slices.Contains(f.Types, event.Type))
+}
+
+// EventBus fans events out to subscribers. Publishing never blocks: a subscriber that
+// falls too far behind has its channel closed, and can resume from the last event it
+// received while that is still in the history.
+type EventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	subscribers map[*eventSubscriber]struct{}
+}
+
+// eventSubscriber is a channel of events passing a filter
+type eventSubscriber struct {
+	events chan Event
+	filter EventFilter
+}
+
+// NewEventBus creates an event bus. IDs start at the current time in microseconds, so
+// they keep increasing across restarts and resuming never replays an older process's IDs.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		nextID:      uint64(time.Now().UnixMicro()),
+		subscribers: make(map[*eventSubscriber]struct{}),
+	}
+}
+
+// Publish assigns an event its ID and time and delivers it to the subscribers
+func (b *EventBus) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+	event.Time = time.Now().UTC()
+
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = slices.Delete(b.history, 0, len(b.history)-eventHistorySize)
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(&event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+
+	return event
+}
+
+// Subscribe returns a channel of the events passing filter, and the function that ends
+// the subscription. When after is set, the kept events newer than it are delivered first.
+func (b *EventBus) Subscribe(after uint64, filter EventFilter) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []Event
+	if after > 0 {
+		for _, event := range b.history {
+			if event.ID > after && filter.Matches(&event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	sub := &eventSubscriber{events: make(chan Event, eventSubscriberBuffer+len(missed)), filter: filter}
+	for _, event := range missed {
+		sub.events <- event
+	}
+	b.subscribers[sub] = struct{}{}
+
+	return sub.events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[sub]; ok {
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Events returns the orchestrator's event bus
+func (o *Orchestrator) Events() *EventBus {
+	return o.events
+}
+
+// publishServiceEvent publishes an event about a service
+func (o *Orchestrator) publishServiceEvent(svc *database.ServiceRecord, event Event) {
+	event.ServiceID = svc.ID
+	event.ServiceName = svc.ProjectName
+	o.events.Publish(event)
+}
+
+// deployStep runs a step of deploying a service, publishing when it starts and finishes
+func (o *Orchestrator) deployStep(svc *database.ServiceRecord, name string, run func() error) error {
+	o.publishServiceEvent(svc, Event{Type: EventDeployStepStarted, Step: &DeployStep{Name: name}})
+
+	started := time.Now()
+	err := run()
+
+	step := &DeployStep{Name: name, DurationMs: time.Since(started).Milliseconds()}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	o.publishServiceEvent(svc, Event{Type: EventDeployStepFinished, Step: step})
+
+	return err
+}
+
+// publishStatusChange publishes a change of a service's status, however it was saved
+func (o *Orchestrator) publishStatusChange(svc *database.ServiceRecord, previous string) {
+	o.publishServiceEvent(svc, Event{Type: EventStatusChanged, Status: &StatusChange{From: previous, To: svc.Status}})
+}
@@ -0,0 +1,274 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OrphanReport lists resources on the host that have no matching service record
+type OrphanReport struct {
+	Directories []OrphanResource `json:"directories"`
+	UnitFiles   []OrphanResource `json:"unit_files"`
+	CaddySites  []OrphanResource `json:"caddy_sites"`
+	Total       int              `json:"total"`
+}
+
+// OrphanResource describes a single orphaned resource
+type OrphanResource struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+	Port int    `json:"port,omitempty"`
+	// Active is set when the resource belongs to a unit systemd reports as running
+	Active bool `json:"active,omitempty"`
+}
+
+// OrphanRemovalRequest selects which orphans to remove, by category
+type OrphanRemovalRequest struct {
+	Directories []string `json:"directories"`
+	UnitFiles   []string `json:"unit_files"`
+	CaddySites  []string `json:"caddy_sites"`
+	// Force removes unit files and directories whose unit is still running
+	Force bool `json:"force"`
+}
+
+// OrphanRemovalResult represents the outcome of removing a single orphan
+type OrphanRemovalResult struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Status   string `json:"status"` // removed, skipped, error
+	Message  string `json:"message"`
+	Backup   string `json:"backup,omitempty"`
+}
+
+// ScanOrphans cross-references service records with the filesystem, systemd and Caddy
+func (o *Orchestrator) ScanOrphans(ctx context.Context) (*OrphanReport, error) {
+	services, err := o.dbManager.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	knownNames := make(map[string]bool)
+	knownPorts := make(map[int]bool)
+	knownSites := make(map[string]bool)
+	for _, svc := range services {
+		knownNames[strings.ToLower(svc.ProjectName)] = true
+		knownPorts[svc.Port] = true
+		knownSites[strings.ToLower(svc.ProjectName+"."+svc.Domain)] = true
+	}
+
+	report := &OrphanReport{
+		Directories: []OrphanResource{},
+		UnitFiles:   []OrphanResource{},
+		CaddySites:  []OrphanResource{},
+	}
+
+	// Units that are not yet imported may still be serving traffic
+	activeUnits := make(map[string]bool)
+	unitFiles, err := o.systemdManager.ListServiceFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, unitFile := range unitFiles {
+		name := strings.TrimSuffix(filepath.Base(unitFile), "-pocketbase.service")
+		if knownNames[strings.ToLower(name)] {
+			continue
+		}
+
+		status, _ := o.systemdManager.GetServiceStatus(name)
+		active := status == "active" || status == "activating" || status == "reloading"
+		activeUnits[name] = active
+		report.UnitFiles = append(report.UnitFiles, OrphanResource{Name: name, Path: unitFile, Active: active})
+	}
+
+	dirs, err := o.serviceManager.ListServiceDirs()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if !knownNames[strings.ToLower(dir)] {
+			report.Directories = append(report.Directories, OrphanResource{
+				Name:   dir,
+				Path:   filepath.Join(o.config.BaseDir, dir),
+				Active: activeUnits[dir],
+			})
+		}
+	}
+
+	blocks, err := o.caddyManager.ParseSiteBlocks()
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		// Only sites proxying to a local port can belong to a managed instance
+		port := block.UpstreamPort()
+		if port == 0 || knownPorts[port] || knownSites[strings.ToLower(block.Address)] {
+			continue
+		}
+		report.CaddySites = append(report.CaddySites, OrphanResource{Name: block.Address, Port: port})
+	}
+
+	report.Total = len(report.Directories) + len(report.UnitFiles) + len(report.CaddySites)
+
+	return report, nil
+}
+
+// RemoveOrphans removes the selected orphans. Only resources that are still
+// reported as orphaned are touched, unit files and directories of running units
+// are skipped unless the request is forced, and any pb_data is snapshotted
+// before its directory is deleted.
+func (o *Orchestrator) RemoveOrphans(ctx context.Context, req *OrphanRemovalRequest) (results []*OrphanRemovalResult, err error) {
+	defer func() {
+		o.RecordAudit(ctx, AuditRemoveOrphans, nil, orphanRemovalParams(req, results), orphanRemovalError(results, err))
+	}()
+
+	report, err := o.ScanOrphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	caddyChanged := false
+
+	for _, name := range req.UnitFiles {
+		result := &OrphanRemovalResult{Category: "unit_files", Name: name}
+		orphan := findOrphan(report.UnitFiles, name)
+		if orphan == nil {
+			result.Status = "skipped"
+			result.Message = "Not an orphaned unit file"
+		} else if orphan.Active && !req.Force {
+			result.Status = "skipped"
+			result.Message = "Unit is running; stop it or set force to remove it"
+		} else if err := o.systemdManager.RemoveService(name); err != nil {
+			result.Status = "error"
+			result.Message = err.Error()
+		} else {
+			result.Status = "removed"
+			result.Message = "Unit file removed"
+		}
+		results = append(results, result)
+	}
+
+	for _, name := range req.Directories {
+		result := &OrphanRemovalResult{Category: "directories", Name: name}
+		results = append(results, result)
+
+		orphan := findOrphan(report.Directories, name)
+		if orphan == nil {
+			result.Status = "skipped"
+			result.Message = "Not an orphaned service directory"
+			continue
+		}
+		if orphan.Active && !req.Force {
+			result.Status = "skipped"
+			result.Message = "Unit is running; stop it or set force to remove it"
+			continue
+		}
+
+		backupPath, err := o.snapshotOrphanData(ctx, name)
+		if err != nil {
+			result.Status = "error"
+			result.Message = fmt.Sprintf("pb_data backup failed, directory kept: %v", err)
+			continue
+		}
+		result.Backup = backupPath
+
+		if err := o.serviceManager.RemoveServiceDir(name); err != nil {
+			result.Status = "error"
+			result.Message = err.Error()
+			continue
+		}
+
+		result.Status = "removed"
+		result.Message = "Service directory removed"
+	}
+
+	for _, address := range req.CaddySites {
+		result := &OrphanRemovalResult{Category: "caddy_sites", Name: address}
+		if findOrphan(report.CaddySites, address) == nil {
+			result.Status = "skipped"
+			result.Message = "Not an orphaned Caddy site"
+		} else if err := o.caddyManager.RemoveSite(address); err != nil {
+			result.Status = "error"
+			result.Message = err.Error()
+		} else {
+			result.Status = "removed"
+			result.Message = "Caddy site removed"
+			caddyChanged = true
+		}
+		results = append(results, result)
+	}
+
+	if caddyChanged {
+		if err := o.caddyManager.ReloadConfig(); err != nil {
+			return results, fmt.Errorf("failed to reload Caddy: %w", err)
+		}
+	}
+
+	return results, nil
+}
+
+// snapshotOrphanData writes a consistent snapshot of an orphaned directory's pb_data to the
+// backup directory and returns its path. It returns an empty path when there is no pb_data.
+func (o *Orchestrator) snapshotOrphanData(ctx context.Context, name string) (string, error) {
+	if _, err := os.Stat(filepath.Join(o.config.BaseDir, name, "pb_data")); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	destPath := filepath.Join(o.config.BackupDir, fmt.Sprintf("%s-pb_data-%s.zip", name, time.Now().Format("20060102-150405")))
+	snapshot, err := o.serviceManager.SnapshotDataDir(ctx, name, destPath)
+	if err != nil {
+		return "", err
+	}
+
+	return snapshot.Path, nil
+}
+
+// orphanRemovalParams returns the audited parameters of an orphan removal: what was
+// requested, what was removed and where the pb_data backups went
+func orphanRemovalParams(req *OrphanRemovalRequest, results []*OrphanRemovalResult) map[string]any {
+	removed := []string{}
+	backups := []string{}
+	for _, result := range results {
+		if result.Status == "removed" {
+			removed = append(removed, result.Category+"/"+result.Name)
+		}
+		if result.Backup != "" {
+			backups = append(backups, result.Backup)
+		}
+	}
+
+	return map[string]any{
+		"directories": req.Directories,
+		"unit_files":  req.UnitFiles,
+		"caddy_sites": req.CaddySites,
+		"force":       req.Force,
+		"removed":     removed,
+		"backups":     backups,
+	}
+}
+
+// orphanRemovalError combines the error of an orphan removal with those of the resources
+// that could not be removed
+func orphanRemovalError(results []*OrphanRemovalResult, err error) error {
+	errs := []error{err}
+	for _, result := range results {
+		if result.Status == "error" {
+			errs = append(errs, fmt.Errorf("%s %s: %s", result.Category, result.Name, result.Message))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findOrphan returns the named resource from an orphan list, or nil if it is not present
+func findOrphan(resources []OrphanResource, name string) *OrphanResource {
+	for i := range resources {
+		if resources[i].Name == name {
+			return &resources[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/service"
+)
+
+// HealthHistoryResponse represents a service's health check history
+type HealthHistoryResponse struct {
+	ServiceID   string                        `json:"service_id"`
+	ProjectName string                        `json:"project_name"`
+	From        *time.Time                    `json:"from,omitempty"`
+	To          *time.Time                    `json:"to,omitempty"`
+	Checks      []*database.HealthCheckRecord `json:"checks"`
+	Total       int                           `json:"total"`
+}
+
+// CheckServiceHealth probes a service through systemd and HTTP, persists the
+// result and updates the service status when it changes
+func (o *Orchestrator) CheckServiceHealth(ctx context.Context, svc *database.ServiceRecord) (*database.HealthCheckRecord, error) {
+	status := o.inspectHealth(ctx, svc)
+
+	check := &database.HealthCheckRecord{
+		ServiceID:     svc.ID,
+		SystemdStatus: status.SystemdStatus,
+		HTTPOK:        status.DirectProbe.OK,
+		HTTPStatus:    status.DirectProbe.StatusCode,
+		LatencyMs:     latencyMs(status.DirectProbe.Latency),
+		CaddyStatus:   status.CaddyStatus,
+		Verdict:       status.Verdict,
+		Healthy:       status.SystemdStatus == "active" && status.Verdict == service.VerdictHealthy,
+		Error:         status.ErrorMessage,
+	}
+	if status.CaddyProbe != nil {
+		check.CaddyOK = status.CaddyProbe.OK
+		check.CaddyLatencyMs = latencyMs(status.CaddyProbe.Latency)
+	}
+
+	previous, err := o.dbManager.ListHealthChecks(ctx, svc.ID, time.Time{}, time.Time{}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.dbManager.CreateHealthCheck(ctx, check); err != nil {
+		return nil, err
+	}
+	if len(previous) == 0 || previous[0].Healthy != check.Healthy {
+		o.publishServiceEvent(svc, Event{
+			Type:   EventHealthChanged,
+			Health: &HealthChange{Healthy: check.Healthy, Verdict: check.Verdict, Error: check.Error},
+		})
+	}
+
+	// Leave services that are still being deployed alone
+	newStatus := ""
+	if svc.Status != "deploying" {
+		status := healthStatus(check)
+
+		// Units missing from systemd (or no systemctl at all) are not crash looping,
+		// but the failure to read them is still worth knowing about
+		crashLooping, err := o.checkCrashLoop(ctx, svc)
+		if err != nil {
+			log.Printf("❌ Crash loop check failed for service %s: %v", svc.ProjectName, err)
+		}
+
+		switch {
+		case crashLooping:
+			status = "crashlooping"
+		case svc.Status == "crashlooping" && status != "active":
+			// Stay crashlooping until the service comes back healthy
+			status = svc.Status
+		}
+
+		if status != svc.Status {
+			newStatus = status
+			log.Printf("🔁 Service %s status changed: %s → %s", svc.ProjectName, svc.Status, status)
+		}
+	}
+
+	if err := o.dbManager.RecordHealthCheckResult(ctx, svc.ID, newStatus, check.CreatedAt); err != nil {
+		return check, err
+	}
+
+	return check, nil
+}
+
+// inspectHealth probes a service through systemd, directly on the loopback
+// interface and through the local Caddy listener, and combines the results
+func (o *Orchestrator) inspectHealth(ctx context.Context, svc *database.ServiceRecord) *service.HealthStatus {
+	status := &service.HealthStatus{
+		ServiceID:   svc.ID,
+		LastChecked: time.Now(),
+	}
+
+	status.SystemdStatus, _ = o.systemdManager.GetServiceStatus(svc.ProjectName)
+	status.IsRunning = status.SystemdStatus == "active"
+
+	status.DirectProbe = o.serviceManager.ProbeHTTP(ctx, svc.Port)
+
+	host := svc.ProjectName + "." + svc.Domain
+	if _, err := o.caddyManager.GetServiceConfig(svc.ProjectName, svc.Domain); err != nil {
+		status.CaddyStatus = service.CaddyStatusRouteMissing
+	} else {
+		status.CaddyProbe = o.serviceManager.ProbeViaCaddy(ctx, o.config.CaddyProbeURL, host)
+		switch {
+		case status.CaddyProbe.OK:
+			status.CaddyStatus = service.CaddyStatusOK
+		case status.CaddyProbe.Unreachable:
+			status.CaddyStatus = service.CaddyStatusUnreachable
+		case !status.DirectProbe.OK && isUpstreamError(status.CaddyProbe.StatusCode):
+			// Caddy routed the request but PocketBase itself is down
+			status.CaddyStatus = service.CaddyStatusOK
+		default:
+			status.CaddyStatus = service.CaddyStatusMisconfigured
+		}
+	}
+
+	switch {
+	case !status.DirectProbe.OK:
+		status.Verdict = service.VerdictPocketBaseDown
+		status.ErrorMessage = status.DirectProbe.Error
+	case status.CaddyStatus == service.CaddyStatusRouteMissing:
+		status.Verdict = service.VerdictCaddyRouteMissing
+		status.ErrorMessage = fmt.Sprintf("no Caddy site block for %s", host)
+	case status.CaddyStatus == service.CaddyStatusUnreachable:
+		status.Verdict = service.VerdictCaddyUnreachable
+		status.ErrorMessage = status.CaddyProbe.Error
+	case status.CaddyStatus == service.CaddyStatusMisconfigured:
+		status.Verdict = service.VerdictCaddyMisconfig
+		status.ErrorMessage = status.CaddyProbe.Error
+	default:
+		status.Verdict = service.VerdictHealthy
+	}
+
+	return status
+}
+
+// isUpstreamError reports whether a proxy status code means the upstream could not be reached
+func isUpstreamError(statusCode int) bool {
+	return statusCode == 502 || statusCode == 503 || statusCode == 504
+}
+
+// latencyMs converts a duration to fractional milliseconds
+func latencyMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// healthStatus maps a health check to a service status
+func healthStatus(check *database.HealthCheckRecord) string {
+	switch {
+	case check.SystemdStatus == "active" && check.HTTPOK:
+		// PocketBase is up; Caddy problems are reported through the verdict
+		return "active"
+	case check.SystemdStatus == "active", check.SystemdStatus == "failed":
+		// Running but not answering, or crashed
+		return "error"
+	default:
+		return "inactive"
+	}
+}
+
+// RunHealthChecks checks every service and returns the number of failed checks
+func (o *Orchestrator) RunHealthChecks(ctx context.Context) (int, error) {
+	services, err := o.dbManager.ListServices(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	failed := 0
+	for _, svc := range services {
+		if _, err := o.CheckServiceHealth(ctx, svc); err != nil {
+			log.Printf("❌ Health check failed for service %s: %v", svc.ProjectName, err)
+			failed++
+		}
+	}
+
+	return failed, nil
+}
+
+// PruneHealthChecks deletes health checks older than the retention period
+func (o *Orchestrator) PruneHealthChecks(ctx context.Context, retention time.Duration) (int, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	return o.dbManager.DeleteHealthChecksBefore(ctx, time.Now().Add(-retention))
+}
+
+// GetHealthHistory returns a service's health checks within an optional time range
+func (o *Orchestrator) GetHealthHistory(ctx context.Context, id string, from, to time.Time, limit int) (*HealthHistoryResponse, error) {
+	serviceRecord, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	checks, err := o.dbManager.ListHealthChecks(ctx, id, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &HealthHistoryResponse{
+		ServiceID:   id,
+		ProjectName: serviceRecord.ProjectName,
+		Checks:      checks,
+		Total:       len(checks),
+	}
+	if !from.IsZero() {
+		response.From = &from
+	}
+	if !to.IsZero() {
+		response.To = &to
+	}
+
+	return response, nil
+}
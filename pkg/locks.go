@@ -0,0 +1,45 @@
+package pkg
+
+import "sync"
+
+// keyedLocker hands out one mutex per key so unrelated operations do not block each other
+type keyedLocker struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is a reference counted mutex for a single key
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// newKeyedLocker creates a new keyed locker
+func newKeyedLocker() *keyedLocker {
+	return &keyedLocker{locks: make(map[string]*keyedLock)}
+}
+
+// Lock acquires the mutex for key and returns the function that releases it
+func (k *keyedLocker) Lock(key string) func() {
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
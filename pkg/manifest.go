@@ -0,0 +1,458 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/validation"
+)
+
+// ErrInvalidManifest is returned when a manifest fails to parse or validate
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+var (
+	envNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	memoryMaxPattern = regexp.MustCompile(`^\d+[KMGT]?$`)
+	cpuQuotaPattern  = regexp.MustCompile(`^\d+%$`)
+)
+
+// managedServeFlags are the serve flags Pockestrator sets itself, which a manifest may not override
+var managedServeFlags = []string{"--http", "--https", "--dir", "--hooksDir", "--migrationsDir", "--publicDir"}
+
+// Manifest declares the services a host should run
+type Manifest struct {
+	Services []ManifestService `yaml:"services" json:"services"`
+}
+
+// ManifestService declares one service. Fields left out of the manifest keep their
+// current value on existing services and their default on new ones.
+type ManifestService struct {
+	Name    string            `yaml:"name" json:"name"`
+	Version string            `yaml:"version,omitempty" json:"version,omitempty"` // latest release when omitted
+	Port    int               `yaml:"port,omitempty" json:"port,omitempty"`       // allocated when omitted
+	Domain  string            `yaml:"domain,omitempty" json:"domain,omitempty"`   // default domain when omitted
+	Flags   []string          `yaml:"flags,omitempty" json:"flags,omitempty"`     // extra "pocketbase serve" arguments
+	Limits  *ManifestLimits   `yaml:"limits,omitempty" json:"limits,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+}
+
+// ManifestLimits declares the resource limits of a service
+type ManifestLimits struct {
+	MemoryMax    string `yaml:"memory_max,omitempty" json:"memory_max,omitempty"`
+	CPUQuota     string `yaml:"cpu_quota,omitempty" json:"cpu_quota,omitempty"`
+	MaxOpenFiles int    `yaml:"max_open_files,omitempty" json:"max_open_files,omitempty"`
+}
+
+// serviceLimits converts manifest limits to their record form
+func (l *ManifestLimits) serviceLimits() database.ServiceLimits {
+	return database.ServiceLimits{
+		MemoryMax:    l.MemoryMax,
+		CPUQuota:     l.CPUQuota,
+		MaxOpenFiles: l.MaxOpenFiles,
+	}
+}
+
+// ApplyOptions controls how a manifest is applied
+type ApplyOptions struct {
+	// Prune deletes services that are not in the manifest
+	Prune bool
+	// DryRun only computes the plan
+	DryRun    bool
+	CreatedBy string
+	// Owner owns the services the apply creates
+	Owner string
+	// CheckGrants refuses applies that would update services Owner cannot deploy or delete
+	// services Owner cannot delete, and limits the prune to services Owner has a grant on
+	CheckGrants bool
+}
+
+// ErrApplyForbidden is returned when an apply would change services the caller has no access to
+var ErrApplyForbidden = errors.New("apply would change services you cannot deploy or delete")
+
+// FieldChange describes a field an apply changes
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from,omitempty"`
+	To    any    `json:"to,omitempty"`
+}
+
+// PlanAction is what an apply does to one service
+type PlanAction struct {
+	Action    string        `json:"action"` // create, update, delete, unchanged
+	Name      string        `json:"name"`
+	ServiceID string        `json:"service_id,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+	// Status is the outcome once applied: deploying, deleted or error
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ApplyResult represents the plan of an apply and, unless it was a dry run, its outcome
+type ApplyResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Prune   bool          `json:"prune"`
+	Actions []*PlanAction `json:"actions"`
+	Failed  int           `json:"failed"`
+}
+
+// ParseManifest decodes and validates a YAML or JSON manifest
+func ParseManifest(data []byte) (*Manifest, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var manifest Manifest
+	if err := decoder.Decode(&manifest); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: manifest is empty", ErrInvalidManifest)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// Validate checks a manifest for problems that can be found without looking at the host
+func (m *Manifest) Validate() error {
+	var problems []string
+	names := make(map[string]bool)
+	ports := make(map[int]string)
+
+	for i, svc := range m.Services {
+		label := svc.Name
+		if label == "" {
+			label = fmt.Sprintf("services[%d]", i)
+			problems = append(problems, label+": name is required")
+		}
+
+		if key := strings.ToLower(svc.Name); svc.Name != "" {
+			if names[key] {
+				problems = append(problems, fmt.Sprintf("%s: declared more than once", label))
+			}
+			names[key] = true
+		}
+
+		if svc.Port != 0 {
+			if svc.Port < 1024 || svc.Port > 65535 {
+				problems = append(problems, fmt.Sprintf("%s: port must be between 1024 and 65535", label))
+			}
+			if other, ok := ports[svc.Port]; ok {
+				problems = append(problems, fmt.Sprintf("%s: port %d is also declared by %s", label, svc.Port, other))
+			}
+			ports[svc.Port] = label
+		}
+
+		var errs []validation.ValidationError
+		errs = append(errs, validateServeFlags(svc.Flags)...)
+		errs = append(errs, validateEnv(svc.Env)...)
+		if svc.Limits != nil {
+			errs = append(errs, validateLimits(svc.Limits.serviceLimits())...)
+		}
+		for _, e := range errs {
+			problems = append(problems, fmt.Sprintf("%s: %s", label, e.Message))
+		}
+	}
+
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("%w: %s", ErrInvalidManifest, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// PlanManifest compares a manifest with the recorded services and returns the actions
+// applying it would take. Services missing from the manifest are only deleted with prune.
+func (o *Orchestrator) PlanManifest(ctx context.Context, manifest *Manifest, prune bool) ([]*PlanAction, error) {
+	existing, err := o.dbManager.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	// Names are matched regardless of case, as Validate compares them
+	byName := make(map[string]*database.ServiceRecord, len(existing))
+	for _, svc := range existing {
+		byName[strings.ToLower(svc.ProjectName)] = svc
+	}
+
+	var actions []*PlanAction
+	declared := make(map[string]bool, len(manifest.Services))
+	for _, desired := range manifest.Services {
+		declared[strings.ToLower(desired.Name)] = true
+
+		current, ok := byName[strings.ToLower(desired.Name)]
+		if !ok {
+			actions = append(actions, &PlanAction{
+				Action:  "create",
+				Name:    desired.Name,
+				Changes: diffService(&database.ServiceRecord{}, &desired),
+			})
+			continue
+		}
+
+		action := &PlanAction{
+			Action:    "unchanged",
+			Name:      current.ProjectName,
+			ServiceID: current.ID,
+			Changes:   diffService(current, &desired),
+		}
+		if len(action.Changes) > 0 {
+			action.Action = "update"
+		}
+		actions = append(actions, action)
+	}
+
+	if prune {
+		var removed []*PlanAction
+		for _, svc := range existing {
+			if !declared[strings.ToLower(svc.ProjectName)] {
+				removed = append(removed, &PlanAction{Action: "delete", Name: svc.ProjectName, ServiceID: svc.ID})
+			}
+		}
+		slices.SortFunc(removed, func(a, b *PlanAction) int { return strings.Compare(a.Name, b.Name) })
+		actions = append(actions, removed...)
+	}
+
+	return actions, nil
+}
+
+// ApplyManifest plans a manifest and, unless it is a dry run, carries out the plan.
+// Creates and updates are recorded right away and deployed in the background, like
+// CreateService; a failed action is reported on the action and does not stop the others.
+func (o *Orchestrator) ApplyManifest(ctx context.Context, manifest *Manifest, opts ApplyOptions) (*ApplyResult, error) {
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	// One apply at a time, so plans are not computed against records another apply is changing
+	unlock := o.locks.Lock("apply")
+	defer unlock()
+
+	actions, err := o.PlanManifest(ctx, manifest, opts.Prune)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CheckGrants {
+		actions, err = o.checkApplyGrants(ctx, actions, opts.Owner)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ApplyResult{DryRun: opts.DryRun, Prune: opts.Prune, Actions: actions}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	desired := make(map[string]*ManifestService, len(manifest.Services))
+	for i := range manifest.Services {
+		desired[strings.ToLower(manifest.Services[i].Name)] = &manifest.Services[i]
+	}
+
+	for _, action := range actions {
+		var err error
+		switch action.Action {
+		case "create":
+			action.ServiceID, err = o.applyCreate(ctx, desired[strings.ToLower(action.Name)], opts)
+			action.Status = "deploying"
+		case "update":
+			err = o.applyUpdate(ctx, action.ServiceID, desired[strings.ToLower(action.Name)])
+			action.Status = "deploying"
+		case "delete":
+			_, err = o.DeleteService(ctx, action.ServiceID)
+			action.Status = "deleted"
+		default:
+			continue
+		}
+
+		if err != nil {
+			log.Printf("❌ Failed to %s %s from manifest: %v", action.Action, action.Name, err)
+			action.Status = "error"
+			action.Error = err.Error()
+			result.Failed++
+		}
+	}
+
+	return result, nil
+}
+
+// checkApplyGrants checks a plan against the services a non-admin can access. Updates need
+// the deploy permission and deletes the delete permission. Services the user has no grant on
+// are left out of the plan and not named in errors, so a plan never reveals them.
+func (o *Orchestrator) checkApplyGrants(ctx context.Context, actions []*PlanAction, userID string) ([]*PlanAction, error) {
+	allowed := make([]*PlanAction, 0, len(actions))
+	var forbidden []string
+	hidden := 0
+	for _, action := range actions {
+		if action.Action == "create" {
+			allowed = append(allowed, action)
+			continue
+		}
+
+		grant, err := o.ServiceGrant(ctx, action.ServiceID, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case grant == nil && action.Action == "update":
+			hidden++
+		case grant == nil:
+			// Unchanged services and prunes the user cannot see are dropped
+		case action.Action == "update" && !grant.Allows(auth.PermDeploy),
+			action.Action == "delete" && !grant.Allows(auth.PermDelete):
+			forbidden = append(forbidden, action.Name)
+		default:
+			allowed = append(allowed, action)
+		}
+	}
+
+	if hidden > 0 {
+		forbidden = append(forbidden, fmt.Sprintf("%d service(s) you have no access to", hidden))
+	}
+	if len(forbidden) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrApplyForbidden, strings.Join(forbidden, ", "))
+	}
+
+	return allowed, nil
+}
+
+// applyCreate records a declared service and starts deploying it
+func (o *Orchestrator) applyCreate(ctx context.Context, desired *ManifestService, opts ApplyOptions) (string, error) {
+	req := &ServiceRequest{
+		ProjectName:       desired.Name,
+		PocketBaseVersion: desired.Version,
+		Port:              desired.Port,
+		Domain:            desired.Domain,
+		CreatedBy:         opts.CreatedBy,
+		Owner:             opts.Owner,
+		ServeFlags:        desired.Flags,
+		Env:               desired.Env,
+	}
+	if desired.Limits != nil {
+		req.Limits = desired.Limits.serviceLimits()
+	}
+
+	serviceRecord, response, err := o.createServiceRecord(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if response != nil {
+		return "", validationFailure(response.Errors)
+	}
+
+	params := createParams(req)
+	go func() {
+		started := time.Now()
+		err := o.deployServiceAsync(context.Background(), serviceRecord)
+		o.observeDeployment(started, err)
+		o.RecordAudit(ctx, AuditCreate, serviceRecord, params, err)
+		if err != nil {
+			o.dbManager.UpdateServiceStatus(context.Background(), serviceRecord.ID, "error")
+		}
+	}()
+
+	return serviceRecord.ID, nil
+}
+
+// applyUpdate records the declared settings of an existing service and starts applying them
+func (o *Orchestrator) applyUpdate(ctx context.Context, id string, desired *ManifestService) error {
+	req := &ServiceUpdateRequest{
+		PocketBaseVersion: desired.Version,
+		Port:              desired.Port,
+		Domain:            desired.Domain,
+		ServeFlags:        desired.Flags,
+		Env:               desired.Env,
+	}
+	if desired.Limits != nil {
+		limits := desired.Limits.serviceLimits()
+		req.Limits = &limits
+	}
+
+	response, err := o.UpdateService(ctx, id, req)
+	if err != nil {
+		return err
+	}
+	if response.Status == "error" {
+		return validationFailure(response.Errors)
+	}
+
+	return nil
+}
+
+// diffService lists the fields of current a declared service changes. Fields the
+// declaration leaves out are not compared. Environment values are never included,
+// since they commonly hold secrets.
+func diffService(current *database.ServiceRecord, desired *ManifestService) []FieldChange {
+	var changes []FieldChange
+
+	if desired.Version != "" && desired.Version != current.PocketBaseVersion {
+		changes = append(changes, FieldChange{Field: "version", From: current.PocketBaseVersion, To: desired.Version})
+	}
+	if desired.Port != 0 && desired.Port != current.Port {
+		changes = append(changes, FieldChange{Field: "port", From: current.Port, To: desired.Port})
+	}
+	if desired.Domain != "" && desired.Domain != current.Domain {
+		changes = append(changes, FieldChange{Field: "domain", From: current.Domain, To: desired.Domain})
+	}
+	if desired.Flags != nil && !slices.Equal(desired.Flags, current.ServeFlags) {
+		changes = append(changes, FieldChange{Field: "flags", From: current.ServeFlags, To: desired.Flags})
+	}
+	if desired.Limits != nil && desired.Limits.serviceLimits() != current.Limits {
+		changes = append(changes, FieldChange{Field: "limits", From: current.Limits, To: desired.Limits.serviceLimits()})
+	}
+	if desired.Env != nil {
+		changes = append(changes, diffEnv(current.Env, desired.Env)...)
+	}
+
+	return changes
+}
+
+// diffEnv lists the environment variables that are added, changed or removed, by name only
+func diffEnv(current, desired map[string]string) []FieldChange {
+	var changes []FieldChange
+
+	for _, name := range slices.Sorted(maps.Keys(desired)) {
+		value, ok := current[name]
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Field: "env." + name, To: "(set)"})
+		case value != desired[name]:
+			changes = append(changes, FieldChange{Field: "env." + name, From: "(set)", To: "(changed)"})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		if _, ok := desired[name]; !ok {
+			changes = append(changes, FieldChange{Field: "env." + name, From: "(set)"})
+		}
+	}
+
+	return changes
+}
+
+// validationFailure joins validation errors into a single error
+func validationFailure(errs []validation.ValidationError) error {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Message
+	}
+	return fmt.Errorf("validation failed: %s", strings.Join(messages, "; "))
+}
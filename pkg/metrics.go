@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/metrics"
+)
+
+// processStart is when this Pockestrator process started
+var processStart = time.Now()
+
+// deploymentBuckets are the upper bounds in seconds of the deployment duration histogram
+var deploymentBuckets = []float64{5, 10, 15, 30, 60, 120, 300, 600}
+
+// newDeploymentHistogram creates the histogram of deployment durations by outcome
+func newDeploymentHistogram() *metrics.Histogram {
+	return metrics.NewHistogram("outcome", deploymentBuckets)
+}
+
+// observeDeployment records the duration and outcome of a deployment
+func (o *Orchestrator) observeDeployment(started time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	o.deployments.Observe(outcome, time.Since(started).Seconds())
+}
+
+// CollectMetrics gathers per-service and process metrics for the Prometheus endpoint
+func (o *Orchestrator) CollectMetrics(ctx context.Context) ([]*metrics.Family, error) {
+	services, err := o.dbManager.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	byStatus := metrics.NewFamily("pockestrator_services", metrics.TypeGauge, "Number of managed services by status.")
+	up := metrics.NewFamily("pockestrator_service_up", metrics.TypeGauge, "Whether the service's systemd unit is active.")
+	restarts := metrics.NewFamily("pockestrator_service_restarts_total", metrics.TypeCounter, "Automatic restarts of the unit since it was last started (systemd NRestarts).")
+	memory := metrics.NewFamily("pockestrator_service_memory_bytes", metrics.TypeGauge, "Memory used by the service, by where it was read (systemd or proc).")
+	cpu := metrics.NewFamily("pockestrator_service_cpu_seconds_total", metrics.TypeCounter, "CPU time consumed by the service, by where it was read (systemd or proc).")
+	dataSize := metrics.NewFamily("pockestrator_service_pb_data_bytes", metrics.TypeGauge, "Size of the service's pb_data directory.")
+	healthy := metrics.NewFamily("pockestrator_service_healthy", metrics.TypeGauge, "Whether the service's most recent health check passed.")
+	latency := metrics.NewFamily("pockestrator_service_probe_latency_seconds", metrics.TypeGauge, "Latency of the most recent health probe.")
+
+	counts := make(map[string]int)
+	for _, svc := range services {
+		counts[svc.Status]++
+		name := svc.ProjectName
+
+		state, err := o.systemdManager.GetUnitState(name)
+		if err != nil {
+			up.Add(0, "service", name)
+		} else {
+			up.Add(boolValue(state.ActiveState == "active"), "service", name)
+			restarts.Add(float64(state.NRestarts), "service", name)
+
+			// Prefer systemd accounting and fall back to /proc for units without it. The
+			// source label keeps the two readings in separate series, so a counter never
+			// jumps between the unit's and the main process's CPU time.
+			var stats *metrics.ProcessStats
+			if state.MainPID > 0 && (state.MemoryCurrent == 0 || state.CPUUsageNSec == 0) {
+				stats, _ = metrics.ReadProcessStats("/proc", state.MainPID)
+			}
+
+			switch {
+			case state.MemoryCurrent > 0:
+				memory.Add(float64(state.MemoryCurrent), "service", name, "source", "systemd")
+			case stats != nil:
+				memory.Add(float64(stats.RSSBytes), "service", name, "source", "proc")
+			}
+			switch {
+			case state.CPUUsageNSec > 0:
+				cpu.Add(float64(state.CPUUsageNSec)/1e9, "service", name, "source", "systemd")
+			case stats != nil:
+				cpu.Add(stats.CPUSeconds, "service", name, "source", "proc")
+			}
+		}
+
+		if usage, err := o.serviceManager.DataDirUsage(name); err == nil {
+			dataSize.Add(float64(usage.Total), "service", name)
+		}
+
+		checks, err := o.dbManager.ListHealthChecks(ctx, svc.ID, time.Time{}, time.Time{}, 1)
+		if err == nil && len(checks) > 0 {
+			check := checks[0]
+			healthy.Add(boolValue(check.Healthy), "service", name)
+			latency.Add(check.LatencyMs/1000, "service", name, "probe", "direct")
+			if check.CaddyLatencyMs > 0 {
+				latency.Add(check.CaddyLatencyMs/1000, "service", name, "probe", "caddy")
+			}
+		}
+	}
+
+	for _, status := range []string{"active", "inactive", "error", "deploying", "crashlooping"} {
+		byStatus.Add(float64(counts[status]), "status", status)
+	}
+
+	deployments := metrics.NewFamily("pockestrator_deployments_total", metrics.TypeCounter, "Deployments by outcome.")
+	deploymentCounts := o.deployments.Counts()
+	for _, outcome := range []string{"success", "failure"} {
+		deployments.Add(float64(deploymentCounts[outcome]), "outcome", outcome)
+	}
+
+	families := []*metrics.Family{
+		byStatus, up, restarts, memory, cpu, dataSize, healthy, latency,
+		deployments,
+		o.deployments.Family("pockestrator_deployment_duration_seconds", "Time taken to deploy a service."),
+	}
+
+	return append(families, processMetrics()...), nil
+}
+
+// processMetrics reports Pockestrator's own resource usage
+func processMetrics() []*metrics.Family {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	families := []*metrics.Family{
+		metrics.NewFamily("process_start_time_seconds", metrics.TypeGauge, "Start time of the process since unix epoch in seconds.").
+			Add(float64(processStart.Unix())),
+		metrics.NewFamily("go_goroutines", metrics.TypeGauge, "Number of goroutines that currently exist.").
+			Add(float64(runtime.NumGoroutine())),
+		metrics.NewFamily("go_memstats_heap_alloc_bytes", metrics.TypeGauge, "Number of heap bytes allocated and still in use.").
+			Add(float64(mem.HeapAlloc)),
+		metrics.NewFamily("go_memstats_sys_bytes", metrics.TypeGauge, "Number of bytes obtained from the system.").
+			Add(float64(mem.Sys)),
+	}
+
+	if stats, err := metrics.ReadProcessStats("/proc", os.Getpid()); err == nil {
+		families = append(families,
+			metrics.NewFamily("process_resident_memory_bytes", metrics.TypeGauge, "Resident memory size in bytes.").
+				Add(float64(stats.RSSBytes)),
+			metrics.NewFamily("process_cpu_seconds_total", metrics.TypeCounter, "Total user and system CPU time spent in seconds.").
+				Add(stats.CPUSeconds),
+			metrics.NewFamily("process_open_fds", metrics.TypeGauge, "Number of open file descriptors.").
+				Add(float64(stats.OpenFDs)),
+			metrics.NewFamily("process_threads", metrics.TypeGauge, "Number of OS threads in the process.").
+				Add(float64(stats.Threads)),
+		)
+	}
+
+	return families
+}
+
+// boolValue converts a boolean to a 0/1 sample value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
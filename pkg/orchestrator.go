@@ -2,13 +2,18 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/tigawanna/pockestrator/internal/caddy"
 	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/metrics"
+	"github.com/tigawanna/pockestrator/internal/ports"
 	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/internal/storage"
 	"github.com/tigawanna/pockestrator/internal/systemd"
 	"github.com/tigawanna/pockestrator/internal/validation"
 )
@@ -20,7 +25,13 @@ type Orchestrator struct {
 	caddyManager   *caddy.Manager
 	validator      *validation.Validator
 	dbManager      *database.Manager
+	portManager    *ports.Manager
 	config         *Config
+	locks          *keyedLocker
+	crashLoops     *CrashLoopDetector
+	deployments    *metrics.Histogram
+	backupStores   map[string]storage.Store
+	events         *EventBus
 }
 
 // Config holds orchestrator configuration
@@ -29,6 +40,32 @@ type Config struct {
 	SystemdDir    string
 	CaddyConfig   string
 	DefaultDomain string
+	BackupDir     string
+	CaddyProbeURL string
+
+	// BackupStore is where new backups are written; nil keeps them in BackupDir.
+	// Backups already in BackupDir stay readable either way.
+	BackupStore storage.Store
+
+	// Installer installs PocketBase during deploys; nil downloads releases from GitHub
+	Installer service.Installer
+
+	// Crash loop detection: a service restarted CrashLoopThreshold times within
+	// CrashLoopWindow is marked crashlooping, and stopped once it reaches
+	// RestartBudget restarts (0 disables stopping)
+	CrashLoopWindow    time.Duration
+	CrashLoopThreshold int
+	RestartBudget      int
+
+	// DeployHealthTimeout is how long a newly deployed service gets to pass its health check
+	DeployHealthTimeout time.Duration
+
+	// RestoreHealthTimeout is how long a restored service gets to pass its health check
+	RestoreHealthTimeout time.Duration
+
+	// UpdateHealthTimeout is how long an updated service gets to pass its health check
+	// before the update is rolled back
+	UpdateHealthTimeout time.Duration
 }
 
 // NewOrchestrator creates a new orchestrator
@@ -38,16 +75,26 @@ func NewOrchestrator(
 	caddyManager *caddy.Manager,
 	validator *validation.Validator,
 	dbManager *database.Manager,
+	portManager *ports.Manager,
 	config *Config,
 ) *Orchestrator {
-	return &Orchestrator{
+	o := &Orchestrator{
 		serviceManager: serviceManager,
 		systemdManager: systemdManager,
 		caddyManager:   caddyManager,
 		validator:      validator,
 		dbManager:      dbManager,
+		portManager:    portManager,
 		config:         config,
+		locks:          newKeyedLocker(),
+		crashLoops:     NewCrashLoopDetector(config.CrashLoopWindow),
+		deployments:    newDeploymentHistogram(),
+		backupStores:   newBackupStores(config),
+		events:         NewEventBus(),
 	}
+	dbManager.OnServiceStatusChange(o.publishStatusChange)
+
+	return o
 }
 
 // ServiceRequest represents a service creation request
@@ -58,6 +105,15 @@ type ServiceRequest struct {
 	Domain            string `json:"domain,omitempty"`
 	Description       string `json:"description,omitempty"`
 	CreatedBy         string `json:"created_by,omitempty"`
+	// Owner is the ID of the users record the service belongs to
+	Owner string `json:"owner,omitempty"`
+	// Team is the ID of the teams record the service counts against the quotas of
+	Team   string                 `json:"team,omitempty"`
+	Limits database.ServiceLimits `json:"limits,omitzero"`
+	// ServeFlags and Env are only set internally: when cloning, applying a manifest or
+	// creating a services record through the records API
+	ServeFlags []string          `json:"-"`
+	Env        map[string]string `json:"-"`
 }
 
 // ServiceResponse represents a service operation response
@@ -69,6 +125,15 @@ type ServiceResponse struct {
 	Errors  []validation.ValidationError `json:"errors,omitempty"`
 }
 
+// PortStatus describes who holds a port
+type PortStatus struct {
+	Port       int             `json:"port"`
+	Available  bool            `json:"available"`
+	InRange    bool            `json:"in_range"`
+	ReservedBy string          `json:"reserved_by,omitempty"`
+	Listener   *ports.Conflict `json:"listener,omitempty"`
+}
+
 // ServiceLogsResponse represents a service logs response
 type ServiceLogsResponse struct {
 	ServiceID   string    `json:"service_id"`
@@ -80,11 +145,64 @@ type ServiceLogsResponse struct {
 
 // CreateService creates and deploys a new PocketBase service
 func (o *Orchestrator) CreateService(ctx context.Context, req *ServiceRequest) (*ServiceResponse, error) {
+	serviceRecord, response, err := o.createServiceRecord(ctx, req)
+	if err != nil || response != nil {
+		return response, err
+	}
+
+	// Deploy the service asynchronously. The request's context ends with the handler, so the
+	// outcome is audited under a detached one for the same actor.
+	params := createParams(req)
+	auditCtx := WithActor(context.WithoutCancel(ctx), ActorFrom(ctx))
+	go func() {
+		started := time.Now()
+		err := o.deployServiceAsync(context.Background(), serviceRecord)
+		o.observeDeployment(started, err)
+		o.RecordAudit(auditCtx, AuditCreate, serviceRecord, params, err)
+		if err != nil {
+			// Update status to error
+			o.dbManager.UpdateServiceStatus(context.Background(), serviceRecord.ID, "error")
+		}
+	}()
+
+	return &ServiceResponse{
+		ID:      serviceRecord.ID,
+		Status:  "deploying",
+		Message: "Service deployment started",
+		Data:    serviceRecord,
+	}, nil
+}
+
+// createServiceRecord validates a service request, reserves its port and records the service
+// as deploying. Validation failures are returned as an error response. Rejected and failed
+// creates are audited here, callers audit the outcome of the deploy.
+func (o *Orchestrator) createServiceRecord(ctx context.Context, req *ServiceRequest) (*database.ServiceRecord, *ServiceResponse, error) {
+	serviceRecord, response, err := o.recordNewService(ctx, req)
+	if err != nil || response != nil {
+		o.auditResponse(ctx, AuditCreate, &database.ServiceRecord{ProjectName: req.ProjectName}, createParams(req), response, err)
+	}
+	return serviceRecord, response, err
+}
+
+// createParams returns the audited parameters of a service request
+func createParams(req *ServiceRequest) map[string]any {
+	params := serviceParams(req.Port, req.PocketBaseVersion, req.Domain, req.ServeFlags, req.Env, &req.Limits)
+	if req.Owner != "" {
+		params["owner"] = req.Owner
+	}
+	if req.Team != "" {
+		params["team"] = req.Team
+	}
+	return params
+}
+
+// recordNewService does the work of createServiceRecord
+func (o *Orchestrator) recordNewService(ctx context.Context, req *ServiceRequest) (*database.ServiceRecord, *ServiceResponse, error) {
 	// Set defaults
 	if req.PocketBaseVersion == "" {
 		version, err := o.serviceManager.GetLatestVersion(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get latest version: %w", err)
+			return nil, nil, fmt.Errorf("failed to get latest version: %w", err)
 		}
 		req.PocketBaseVersion = version
 	}
@@ -93,20 +211,40 @@ func (o *Orchestrator) CreateService(ctx context.Context, req *ServiceRequest) (
 		req.Domain = o.config.DefaultDomain
 	}
 
+	// Serialise creates for the same name and port so that validation and
+	// record creation act as a single step. Name locks are always taken first.
+	unlockName := o.locks.Lock("name:" + strings.ToLower(req.ProjectName))
+	defer unlockName()
+
+	if req.Port != 0 {
+		unlockPort := o.locks.Lock(fmt.Sprintf("port:%d", req.Port))
+		defer unlockPort()
+	}
+
 	// Get existing services and ports for validation
 	existingServices, err := o.dbManager.GetExistingServices(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get existing services: %w", err)
+		return nil, nil, fmt.Errorf("failed to get existing services: %w", err)
 	}
 
 	usedPorts, err := o.dbManager.GetUsedPorts(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get used ports: %w", err)
+		return nil, nil, fmt.Errorf("failed to get used ports: %w", err)
 	}
 
-	// Auto-assign port if not provided
-	if req.Port == 0 {
-		req.Port = o.serviceManager.GetNextPort(usedPorts)
+	// Auto-assign port if not provided. The allocator reserves the port
+	// so concurrent requests cannot be handed the same one.
+	autoPort := req.Port == 0
+	if autoPort {
+		port, err := o.portManager.Allocate(ctx, req.ProjectName, 0)
+		if err != nil {
+			return nil, &ServiceResponse{
+				Status:  "error",
+				Message: "Validation failed",
+				Errors:  []validation.ValidationError{portAllocationError(err)},
+			}, nil
+		}
+		req.Port = port
 	}
 
 	// Validate the service configuration
@@ -119,49 +257,167 @@ func (o *Orchestrator) CreateService(ctx context.Context, req *ServiceRequest) (
 		usedPorts,
 	)
 
-	if !validationResult.IsValid {
-		return &ServiceResponse{
+	// Flags, environment and limits come from manifests, clones and the records API
+	errs := validationResult.Errors
+	errs = append(errs, validateServeFlags(req.ServeFlags)...)
+	errs = append(errs, validateEnv(req.Env)...)
+	errs = append(errs, validateLimits(req.Limits)...)
+
+	if req.Owner != "" {
+		exists, err := o.dbManager.UserExists(ctx, req.Owner)
+		if err != nil {
+			if autoPort {
+				o.portManager.Release(ctx, req.Port)
+			}
+			return nil, nil, err
+		}
+		if !exists {
+			errs = append(errs, validation.ValidationError{
+				Field:   "owner",
+				Message: fmt.Sprintf("No user with ID %q", req.Owner),
+				Code:    "INVALID_OWNER",
+			})
+		}
+	}
+
+	// The team's quotas are checked and used up as one step, like names and ports
+	if req.Team != "" {
+		unlockTeam := o.locks.Lock("team:" + req.Team)
+		defer unlockTeam()
+
+		teamErrs, err := o.checkTeamQuotas(ctx, req.Team, req.Owner, req.Limits, 0, "")
+		if err != nil {
+			if autoPort {
+				o.portManager.Release(ctx, req.Port)
+			}
+			return nil, nil, err
+		}
+		errs = append(errs, teamErrs...)
+	}
+
+	if !validationResult.IsValid || len(errs) > 0 {
+		if autoPort {
+			o.portManager.Release(ctx, req.Port)
+		}
+		return nil, &ServiceResponse{
 			Status:  "error",
 			Message: "Validation failed",
-			Errors:  validationResult.Errors,
+			Errors:  errs,
 		}, nil
 	}
 
+	// Reserve an explicitly requested port
+	if !autoPort {
+		if _, err := o.portManager.Allocate(ctx, req.ProjectName, req.Port); err != nil {
+			return nil, &ServiceResponse{
+				Status:  "error",
+				Message: "Validation failed",
+				Errors:  []validation.ValidationError{portAllocationError(err)},
+			}, nil
+		}
+	}
+
 	// Create service record
 	serviceRecord := &database.ServiceRecord{
 		ProjectName:       req.ProjectName,
 		Port:              req.Port,
 		PocketBaseVersion: req.PocketBaseVersion,
 		Domain:            req.Domain,
+		ServeFlags:        req.ServeFlags,
+		Env:               req.Env,
+		Limits:            req.Limits,
 		Status:            "deploying",
 		CreatedBy:         req.CreatedBy,
+		Owner:             req.Owner,
+		Team:              req.Team,
+		Description:       req.Description,
 		LastHealthCheck:   time.Now(),
 	}
 
 	if err := o.dbManager.CreateService(ctx, serviceRecord); err != nil {
-		return nil, fmt.Errorf("failed to create service record: %w", err)
-	}
-
-	// Deploy the service asynchronously
-	go func() {
-		if err := o.deployServiceAsync(context.Background(), serviceRecord); err != nil {
-			// Update status to error
-			o.dbManager.UpdateServiceStatus(context.Background(), serviceRecord.ID, "error")
+		o.portManager.Release(ctx, req.Port)
+
+		// The unique indexes catch anything that slipped past validation
+		if duplicate, ok := duplicateRecordError(err, req); ok {
+			return nil, &ServiceResponse{
+				Status:  "error",
+				Message: "Validation failed",
+				Errors:  []validation.ValidationError{duplicate},
+			}, nil
 		}
-	}()
 
-	return &ServiceResponse{
-		ID:      serviceRecord.ID,
-		Status:  "deploying",
-		Message: "Service deployment started",
-		Data:    serviceRecord,
-	}, nil
+		return nil, nil, fmt.Errorf("failed to create service record: %w", err)
+	}
+
+	return serviceRecord, nil, nil
 }
 
 // deployServiceAsync deploys a service asynchronously
 func (o *Orchestrator) deployServiceAsync(ctx context.Context, serviceRecord *database.ServiceRecord) error {
-	// Create deployment config
-	deployConfig := &service.DeploymentConfig{
+	// Deploy PocketBase instance
+	err := o.deployStep(serviceRecord, DeployStepInstall, func() error {
+		if err := o.serviceManager.Deploy(ctx, o.deploymentConfigFor(serviceRecord)); err != nil {
+			return fmt.Errorf("failed to deploy PocketBase: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Create, enable and start systemd service
+	systemdConfig := o.systemdConfigFor(serviceRecord)
+	err = o.deployStep(serviceRecord, DeployStepSystemd, func() error {
+		if err := o.systemdManager.CreateService(systemdConfig); err != nil {
+			return fmt.Errorf("failed to create systemd service: %w", err)
+		}
+		if err := o.systemdManager.EnableService(serviceRecord.ProjectName); err != nil {
+			return fmt.Errorf("failed to enable systemd service: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Wait for service to start
+	timeout := o.config.DeployHealthTimeout
+	if timeout <= 0 {
+		timeout = defaultDeployHealthTimeout
+	}
+	err = o.deployStep(serviceRecord, DeployStepHealth, func() error {
+		return o.waitForHealthy(ctx, serviceRecord.Port, timeout)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Add Caddy configuration and reload Caddy
+	caddyConfig := caddyConfigFor(serviceRecord)
+	err = o.deployStep(serviceRecord, DeployStepCaddy, func() error {
+		if err := o.caddyManager.AddService(caddyConfig); err != nil {
+			return fmt.Errorf("failed to add Caddy configuration: %w", err)
+		}
+		if err := o.caddyManager.ReloadConfig(); err != nil {
+			return fmt.Errorf("failed to reload Caddy: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Update service to active
+	if err := o.dbManager.UpdateServiceStatus(ctx, serviceRecord.ID, "active"); err != nil {
+		return fmt.Errorf("failed to update service status: %w", err)
+	}
+
+	return o.storeConfigHashes(ctx, serviceRecord.ID, systemdConfig, caddyConfig)
+}
+
+// deploymentConfigFor returns the deployment settings of a service record
+func (o *Orchestrator) deploymentConfigFor(serviceRecord *database.ServiceRecord) *service.DeploymentConfig {
+	return &service.DeploymentConfig{
 		ServiceConfig: service.ServiceConfig{
 			ProjectName:       serviceRecord.ProjectName,
 			Port:              serviceRecord.Port,
@@ -172,61 +428,41 @@ func (o *Orchestrator) deployServiceAsync(ctx context.Context, serviceRecord *da
 		SystemdDir:      o.config.SystemdDir,
 		CaddyConfigPath: o.config.CaddyConfig,
 		SuperuserEmail:  fmt.Sprintf("admin@%s.%s", serviceRecord.ProjectName, serviceRecord.Domain),
+		Install:         o.config.Installer,
 	}
+}
 
-	// Deploy PocketBase instance
-	if err := o.serviceManager.Deploy(ctx, deployConfig); err != nil {
-		return fmt.Errorf("failed to deploy PocketBase: %w", err)
-	}
-
-	// Create systemd service
-	systemdConfig := &systemd.ServiceConfig{
+// systemdConfigFor returns the unit settings of a service record
+func (o *Orchestrator) systemdConfigFor(serviceRecord *database.ServiceRecord) *systemd.ServiceConfig {
+	return &systemd.ServiceConfig{
 		ProjectName: serviceRecord.ProjectName,
 		ServiceDir:  fmt.Sprintf("%s/%s", o.config.BaseDir, serviceRecord.ProjectName),
 		Port:        serviceRecord.Port,
+		ServeFlags:  serviceRecord.ServeFlags,
+		Environment: serviceRecord.Env,
+		MemoryMax:   serviceRecord.Limits.MemoryMax,
+		CPUQuota:    serviceRecord.Limits.CPUQuota,
+		LimitNOFILE: serviceRecord.Limits.MaxOpenFiles,
 	}
+}
 
-	if err := o.systemdManager.CreateService(systemdConfig); err != nil {
-		return fmt.Errorf("failed to create systemd service: %w", err)
-	}
-
-	// Enable and start systemd service
-	if err := o.systemdManager.EnableService(serviceRecord.ProjectName); err != nil {
-		return fmt.Errorf("failed to enable systemd service: %w", err)
-	}
-
-	// Wait for service to start
-	time.Sleep(5 * time.Second)
-
-	// Add Caddy configuration
-	caddyConfig := &caddy.ServiceConfig{
+// caddyConfigFor returns the site settings of a service record
+func caddyConfigFor(serviceRecord *database.ServiceRecord) *caddy.ServiceConfig {
+	return &caddy.ServiceConfig{
 		Subdomain: serviceRecord.ProjectName,
 		Domain:    serviceRecord.Domain,
 		Port:      serviceRecord.Port,
 	}
+}
 
-	if err := o.caddyManager.AddService(caddyConfig); err != nil {
-		return fmt.Errorf("failed to add Caddy configuration: %w", err)
-	}
-
-	// Reload Caddy
-	if err := o.caddyManager.ReloadConfig(); err != nil {
-		return fmt.Errorf("failed to reload Caddy: %w", err)
-	}
-
-	// Update service to active
-	if err := o.dbManager.UpdateServiceStatus(ctx, serviceRecord.ID, "active"); err != nil {
-		return fmt.Errorf("failed to update service status: %w", err)
+// storeConfigHashes generates and stores the configuration hashes of a deployed service
+func (o *Orchestrator) storeConfigHashes(ctx context.Context, id string, systemdConfig *systemd.ServiceConfig, caddyConfig *caddy.ServiceConfig) error {
+	systemdHash, caddyHash, err := o.configHashes(systemdConfig, caddyConfig)
+	if err != nil {
+		return err
 	}
 
-	// Generate and store configuration hashes
-	systemdContent, _ := o.generateSystemdConfig(systemdConfig)
-	caddyContent, _ := o.generateCaddyConfig(caddyConfig)
-
-	systemdHash := database.GenerateConfigHash(systemdContent)
-	caddyHash := database.GenerateConfigHash(caddyContent)
-
-	if err := o.dbManager.UpdateConfigHashes(ctx, serviceRecord.ID, systemdHash, caddyHash); err != nil {
+	if err := o.dbManager.UpdateConfigHashes(ctx, id, systemdHash, caddyHash); err != nil {
 		return fmt.Errorf("failed to update config hashes: %w", err)
 	}
 
@@ -248,18 +484,35 @@ func (o *Orchestrator) GetService(ctx context.Context, id string) (*ServiceRespo
 	}, nil
 }
 
+// FindService retrieves a service by project name or ID
+func (o *Orchestrator) FindService(ctx context.Context, ref string) (*database.ServiceRecord, error) {
+	if serviceRecord, err := o.dbManager.GetServiceByName(ctx, ref); err == nil {
+		return serviceRecord, nil
+	}
+
+	serviceRecord, err := o.dbManager.GetService(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("no service named or with ID %q", ref)
+	}
+
+	return serviceRecord, nil
+}
+
 // ListServices retrieves all services
 func (o *Orchestrator) ListServices(ctx context.Context) ([]*database.ServiceRecord, error) {
 	return o.dbManager.ListServices(ctx)
 }
 
 // DeleteService removes a service completely
-func (o *Orchestrator) DeleteService(ctx context.Context, id string) (*ServiceResponse, error) {
+func (o *Orchestrator) DeleteService(ctx context.Context, id string) (response *ServiceResponse, err error) {
 	// Get service record
 	serviceRecord, err := o.dbManager.GetService(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get service: %w", err)
 	}
+	defer func() {
+		o.auditResponse(ctx, AuditDelete, serviceRecord, nil, response, err)
+	}()
 
 	// Remove systemd service
 	if err := o.systemdManager.RemoveService(serviceRecord.ProjectName); err != nil {
@@ -292,6 +545,11 @@ func (o *Orchestrator) DeleteService(ctx context.Context, id string) (*ServiceRe
 		return nil, fmt.Errorf("failed to delete service record: %w", err)
 	}
 
+	// Free the port reservation
+	if err := o.portManager.Release(ctx, serviceRecord.Port); err != nil {
+		return nil, fmt.Errorf("failed to release port: %w", err)
+	}
+
 	return &ServiceResponse{
 		ID:      id,
 		Status:  "success",
@@ -300,11 +558,14 @@ func (o *Orchestrator) DeleteService(ctx context.Context, id string) (*ServiceRe
 }
 
 // ControlService controls service operations (start/stop/restart)
-func (o *Orchestrator) ControlService(ctx context.Context, id, action string) (*ServiceResponse, error) {
+func (o *Orchestrator) ControlService(ctx context.Context, id, action string) (response *ServiceResponse, err error) {
 	service, err := o.dbManager.GetService(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get service: %w", err)
 	}
+	defer func() {
+		o.auditResponse(ctx, AuditControl, service, map[string]any{"action": action}, response, err)
+	}()
 
 	switch action {
 	case "start":
@@ -324,6 +585,9 @@ func (o *Orchestrator) ControlService(ctx context.Context, id, action string) (*
 		return nil, fmt.Errorf("failed to %s service: %w", action, err)
 	}
 
+	// A manual start gives the service a fresh restart budget
+	o.crashLoops.Reset(id)
+
 	// Update service status
 	newStatus := "active"
 	if action == "stop" {
@@ -348,7 +612,7 @@ func (o *Orchestrator) GetServiceStatus(ctx context.Context, id string) (*servic
 		return nil, fmt.Errorf("failed to get service: %w", err)
 	}
 
-	return o.serviceManager.GetServiceStatus(serviceRecord.ProjectName)
+	return o.inspectHealth(ctx, serviceRecord), nil
 }
 
 // ValidateSystemRequirements validates system prerequisites
@@ -357,6 +621,131 @@ func (o *Orchestrator) ValidateSystemRequirements() *validation.ValidationResult
 	return &result
 }
 
+// ServiceVersion compares a service's recorded PocketBase version with its installed binary
+type ServiceVersion struct {
+	ServiceID   string `json:"service_id"`
+	ProjectName string `json:"project_name"`
+	Recorded    string `json:"recorded"`
+	Installed   string `json:"installed,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// VersionsReport lists the latest PocketBase release and the versions services run
+type VersionsReport struct {
+	Latest   string            `json:"latest"`
+	Services []*ServiceVersion `json:"services"`
+}
+
+// GetVersions reports the latest PocketBase release and, for every service, the recorded
+// version next to the version its binary reports
+func (o *Orchestrator) GetVersions(ctx context.Context) (*VersionsReport, error) {
+	latest, err := o.serviceManager.GetLatestVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest version: %w", err)
+	}
+
+	services, err := o.dbManager.ListServices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	report := &VersionsReport{Latest: latest, Services: make([]*ServiceVersion, len(services))}
+	for i, svc := range services {
+		version := &ServiceVersion{
+			ServiceID:   svc.ID,
+			ProjectName: svc.ProjectName,
+			Recorded:    svc.PocketBaseVersion,
+		}
+
+		binaryPath := filepath.Join(o.config.BaseDir, svc.ProjectName, "pocketbase")
+		if installed, err := o.serviceManager.GetBinaryVersion(ctx, binaryPath); err != nil {
+			version.Error = err.Error()
+		} else {
+			version.Installed = installed
+		}
+
+		report.Services[i] = version
+	}
+
+	return report, nil
+}
+
+// ProbePort reports the reservation owner and listening process for a port
+func (o *Orchestrator) ProbePort(ctx context.Context, port int) (*PortStatus, error) {
+	reserved, err := o.dbManager.GetReservedPorts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reserved ports: %w", err)
+	}
+
+	conflict, err := o.portManager.Probe(port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe port: %w", err)
+	}
+
+	status := &PortStatus{
+		Port:       port,
+		InRange:    o.portManager.InRange(port),
+		ReservedBy: reserved[port],
+		Listener:   conflict,
+	}
+	status.Available = status.ReservedBy == "" && status.Listener == nil
+
+	return status, nil
+}
+
+// duplicateRecordError converts a unique index violation into a validation error
+func duplicateRecordError(err error, req *ServiceRequest) (validation.ValidationError, bool) {
+	switch {
+	case errors.Is(err, database.ErrDuplicateProjectName):
+		return validation.ValidationError{
+			Field:   "project_name",
+			Message: fmt.Sprintf("Service '%s' already exists", req.ProjectName),
+			Code:    "DUPLICATE_SERVICE",
+		}, true
+	case errors.Is(err, database.ErrDuplicatePort):
+		return validation.ValidationError{
+			Field:   "port",
+			Message: fmt.Sprintf("Port %d is already used by another service", req.Port),
+			Code:    "DUPLICATE_PORT",
+		}, true
+	default:
+		return validation.ValidationError{}, false
+	}
+}
+
+// portAllocationError converts a port allocator error into a validation error
+func portAllocationError(err error) validation.ValidationError {
+	var reservedErr *ports.ReservedError
+	var conflictErr *ports.ConflictError
+
+	switch {
+	case errors.As(err, &reservedErr):
+		return validation.ValidationError{
+			Field:   "port",
+			Message: fmt.Sprintf("Port %d is already used by another service", reservedErr.Port),
+			Code:    "DUPLICATE_PORT",
+		}
+	case errors.As(err, &conflictErr):
+		return validation.ValidationError{
+			Field:   "port",
+			Message: conflictErr.Error(),
+			Code:    "PORT_IN_USE",
+		}
+	case errors.Is(err, ports.ErrNoPortsAvailable):
+		return validation.ValidationError{
+			Field:   "port",
+			Message: "No free ports left in the configured ranges",
+			Code:    "NO_PORTS_AVAILABLE",
+		}
+	default:
+		return validation.ValidationError{
+			Field:   "port",
+			Message: err.Error(),
+			Code:    "PORT_ALLOCATION_FAILED",
+		}
+	}
+}
+
 // GetUsedPorts retrieves all used ports from existing services
 func (o *Orchestrator) GetUsedPorts(ctx context.Context) ([]int, error) {
 	return o.dbManager.GetUsedPorts(ctx)
@@ -389,16 +778,29 @@ func (o *Orchestrator) ValidateServiceConfiguration(
 	return &result
 }
 
+// configHashes hashes the unit and site a service is deployed with. Every service is hashed
+// this way, whether it was created, updated or imported.
+func (o *Orchestrator) configHashes(systemdConfig *systemd.ServiceConfig, caddyConfig *caddy.ServiceConfig) (string, string, error) {
+	systemdContent, err := o.generateSystemdConfig(systemdConfig)
+	if err != nil {
+		return "", "", err
+	}
+	caddyContent, err := o.generateCaddyConfig(caddyConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	return database.GenerateConfigHash(systemdContent), database.GenerateConfigHash(caddyContent), nil
+}
+
 // generateSystemdConfig generates systemd configuration content
 func (o *Orchestrator) generateSystemdConfig(config *systemd.ServiceConfig) (string, error) {
-	// This would generate the actual systemd config content
-	return fmt.Sprintf("systemd config for %s on port %d", config.ProjectName, config.Port), nil
+	return systemd.RenderService(config)
 }
 
 // generateCaddyConfig generates Caddy configuration content
 func (o *Orchestrator) generateCaddyConfig(config *caddy.ServiceConfig) (string, error) {
-	// This would generate the actual Caddy config content
-	return fmt.Sprintf("caddy config for %s.%s on port %d", config.Subdomain, config.Domain, config.Port), nil
+	return caddy.RenderSite(config)
 }
 
 // GetServiceLogs retrieves service logs
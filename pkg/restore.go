@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// defaultRestoreHealthTimeout is how long a restored service gets to answer its health check
+const defaultRestoreHealthTimeout = time.Minute
+
+// RestoreRequest represents a restore request. Either BackupID names a recorded
+// backup of the service, or ArchivePath points at an uploaded zip.
+type RestoreRequest struct {
+	BackupID    string `json:"backup_id,omitempty"`
+	ArchivePath string `json:"-"`
+}
+
+// RestoreResponse represents the outcome of a restore
+type RestoreResponse struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"` // success, error, reverted
+	Message string `json:"message"`
+	// PreviousDataDir is where the replaced pb_data was moved, kept until removed by hand
+	PreviousDataDir string `json:"previous_data_dir,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// RestoreService replaces a service's pb_data with a backup. The archive is unpacked and
+// integrity checked before the service is touched; the unit is then stopped, the current
+// pb_data moved aside, the restored data moved in and the service restarted. If it does
+// not come back healthy the moved-aside data is put back and the service restarted again.
+func (o *Orchestrator) RestoreService(ctx context.Context, id string, req *RestoreRequest) (response *RestoreResponse, err error) {
+	serviceRecord, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	params := map[string]any{"backup_id": req.BackupID}
+	if req.ArchivePath != "" {
+		params = map[string]any{"upload": true}
+	}
+	defer func() {
+		auditErr := err
+		if err == nil && response.Status != "success" {
+			auditErr = fmt.Errorf("%s: %s", response.Message, response.Error)
+		}
+		o.RecordAudit(ctx, AuditRestore, serviceRecord, params, auditErr)
+	}()
+
+	// Restores and backups of the same service must not overlap
+	unlock := o.locks.Lock("backup:" + id)
+	defer unlock()
+
+	archivePath, cleanup, err := o.restoreArchive(ctx, id, req)
+	if err != nil {
+		return restoreError(id, "Invalid backup", err), nil
+	}
+	defer cleanup()
+
+	stagingDir, err := o.serviceManager.StageRestore(ctx, serviceRecord.ProjectName, archivePath)
+	if err != nil {
+		return restoreError(id, "Backup failed verification", err), nil
+	}
+
+	if err := o.serviceManager.Stop(serviceRecord.ProjectName); err != nil {
+		os.RemoveAll(stagingDir)
+		return restoreError(id, "Failed to stop service", err), nil
+	}
+
+	asideDir, err := o.serviceManager.SwapDataDir(serviceRecord.ProjectName, stagingDir)
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		o.restartAfterRestore(ctx, serviceRecord)
+		return restoreError(id, "Failed to replace pb_data", err), nil
+	}
+
+	healthErr := o.restartAfterRestore(ctx, serviceRecord)
+	if healthErr == nil {
+		log.Printf("♻️ Restored service %s, previous data kept at %s", serviceRecord.ProjectName, asideDir)
+		return &RestoreResponse{
+			ID:              id,
+			Status:          "success",
+			Message:         "Service restored successfully",
+			PreviousDataDir: asideDir,
+		}, nil
+	}
+
+	log.Printf("❌ Restored service %s failed to start, reverting: %v", serviceRecord.ProjectName, healthErr)
+
+	o.serviceManager.Stop(serviceRecord.ProjectName)
+	if err := o.serviceManager.RevertDataDir(serviceRecord.ProjectName, asideDir); err != nil {
+		o.dbManager.UpdateServiceStatus(ctx, id, "error")
+		return restoreError(id, "Restore failed and the previous data could not be put back", err), nil
+	}
+
+	if err := o.restartAfterRestore(ctx, serviceRecord); err != nil {
+		return restoreError(id, "Restore failed and the service did not recover after reverting", err), nil
+	}
+
+	return &RestoreResponse{
+		ID:      id,
+		Status:  "reverted",
+		Message: "Restored service failed its health check, previous data was put back",
+		Error:   healthErr.Error(),
+	}, nil
+}
+
+// restoreArchive resolves the archive a restore request refers to. Recorded backups are
+// downloaded from their store to a temporary file and verified against their checksum;
+// the returned function removes the download.
+func (o *Orchestrator) restoreArchive(ctx context.Context, id string, req *RestoreRequest) (string, func(), error) {
+	if req.ArchivePath != "" {
+		return req.ArchivePath, func() {}, nil
+	}
+	if req.BackupID == "" {
+		return "", nil, fmt.Errorf("either a backup_id or an uploaded archive is required")
+	}
+
+	backup, reader, err := o.OpenBackup(ctx, req.BackupID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+
+	if backup.ServiceID != id {
+		return "", nil, fmt.Errorf("backup %s belongs to another service", req.BackupID)
+	}
+
+	archive, err := os.CreateTemp("", "pockestrator-restore-*.zip")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	cleanup := func() { os.Remove(archive.Name()) }
+	defer archive.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(archive, hash), reader); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to download backup archive: %w", err)
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != backup.Checksum {
+		cleanup()
+		return "", nil, fmt.Errorf("backup %s is corrupt: checksum mismatch", req.BackupID)
+	}
+
+	return archive.Name(), cleanup, nil
+}
+
+// restartAfterRestore starts the service and waits for it to pass its HTTP health check
+func (o *Orchestrator) restartAfterRestore(ctx context.Context, serviceRecord *database.ServiceRecord) error {
+	if err := o.serviceManager.Start(serviceRecord.ProjectName); err != nil {
+		o.dbManager.UpdateServiceStatus(ctx, serviceRecord.ID, "error")
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+
+	timeout := o.config.RestoreHealthTimeout
+	if timeout <= 0 {
+		timeout = defaultRestoreHealthTimeout
+	}
+
+	if err := o.waitForHealthy(ctx, serviceRecord.Port, timeout); err != nil {
+		o.dbManager.UpdateServiceStatus(ctx, serviceRecord.ID, "error")
+		return err
+	}
+
+	o.crashLoops.Reset(serviceRecord.ID)
+	return o.dbManager.UpdateServiceStatus(ctx, serviceRecord.ID, "active")
+}
+
+// restoreError builds a failed restore response
+func restoreError(id, message string, err error) *RestoreResponse {
+	return &RestoreResponse{
+		ID:      id,
+		Status:  "error",
+		Message: message,
+		Error:   err.Error(),
+	}
+}
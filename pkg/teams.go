@@ -0,0 +1,290 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/validation"
+)
+
+// ErrInvalidTeam is returned when a service cannot be moved to a team
+var ErrInvalidTeam = errors.New("invalid team")
+
+// TeamUsage is what a team's services use of its quotas. A zero maximum is unlimited.
+type TeamUsage struct {
+	TeamID         string `json:"team_id"`
+	Name           string `json:"name"`
+	Services       int    `json:"services"`
+	MaxServices    int    `json:"max_services"`
+	MemoryBytes    int64  `json:"memory_bytes"`
+	MaxMemoryBytes int64  `json:"max_memory_bytes"`
+	BackupBytes    int64  `json:"backup_bytes"`
+	MaxBackupBytes int64  `json:"max_backup_bytes"`
+}
+
+// GetTeam returns a team by ID
+func (o *Orchestrator) GetTeam(ctx context.Context, id string) (*database.TeamRecord, error) {
+	return o.dbManager.GetTeam(ctx, id)
+}
+
+// GetTeamUsage returns what a team's services use of its quotas
+func (o *Orchestrator) GetTeamUsage(ctx context.Context, id string) (*TeamUsage, error) {
+	team, err := o.dbManager.GetTeam(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.teamUsage(ctx, team, "")
+}
+
+// SetServiceTeam moves a service to a team, which must have room for it, or out of its
+// team when teamID is empty. The owner does not need to be a member.
+func (o *Orchestrator) SetServiceTeam(ctx context.Context, id, teamID string) (err error) {
+	defer func() {
+		o.recordAuditResult(ctx, AuditMoveTeam, o.auditedService(ctx, id), map[string]any{"team": teamID}, ErrInvalidTeam, err)
+	}()
+
+	if teamID == "" {
+		return o.dbManager.SetServiceTeam(ctx, id, "")
+	}
+
+	svc, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get service: %w", err)
+	}
+	if svc.Team == teamID {
+		return nil
+	}
+
+	unlock, errs, err := o.lockTeamMove(ctx, svc, teamID, svc.Limits)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return teamMoveError(errs)
+	}
+	defer unlock()
+
+	return o.dbManager.SetServiceTeam(ctx, id, teamID)
+}
+
+// CheckServiceTeam checks that a service can move to a team, so the move can be saved with
+// other changes to its record. On success the team stays locked until unlock is called.
+func (o *Orchestrator) CheckServiceTeam(ctx context.Context, id, teamID string) (unlock func(), err error) {
+	svc, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	if teamID == "" || svc.Team == teamID {
+		return func() {}, nil
+	}
+
+	unlock, errs, err := o.lockTeamMove(ctx, svc, teamID, svc.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, teamMoveError(errs)
+	}
+
+	return unlock, nil
+}
+
+// lockTeamMove locks a team and checks that a service with the limits can move into it,
+// bringing its backups along. The team is only left locked when the move fits, and the
+// caller unlocks it once the move is saved.
+func (o *Orchestrator) lockTeamMove(ctx context.Context, svc *database.ServiceRecord, teamID string, limits database.ServiceLimits) (func(), []validation.ValidationError, error) {
+	unlock := o.locks.Lock("team:" + teamID)
+
+	backupBytes, err := o.dbManager.GetServiceBackupSize(ctx, svc.ID)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+
+	errs, err := o.checkTeamQuotas(ctx, teamID, "", limits, backupBytes, "")
+	if err != nil || len(errs) > 0 {
+		unlock()
+		return nil, errs, err
+	}
+
+	return unlock, nil, nil
+}
+
+// teamMoveError joins the validation errors of a team move into an ErrInvalidTeam error
+func teamMoveError(errs []validation.ValidationError) error {
+	messages := make([]string, len(errs))
+	for i, ve := range errs {
+		messages[i] = ve.Message
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidTeam, strings.Join(messages, "; "))
+}
+
+// teamUsage adds up the quota usage of a team's services, leaving out the service with the
+// ID exclude
+func (o *Orchestrator) teamUsage(ctx context.Context, team *database.TeamRecord, exclude string) (*TeamUsage, error) {
+	services, err := o.dbManager.ListServicesForTeam(ctx, team.ID)
+	if err != nil {
+		return nil, err
+	}
+	backupBytes, err := o.dbManager.GetTeamBackupSize(ctx, team.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &TeamUsage{
+		TeamID:         team.ID,
+		Name:           team.Name,
+		MaxServices:    team.MaxServices,
+		MaxMemoryBytes: parseSize(team.MaxMemory),
+		BackupBytes:    backupBytes,
+		MaxBackupBytes: parseSize(team.MaxBackupStorage),
+	}
+	for _, svc := range services {
+		if svc.ID == exclude {
+			continue
+		}
+		usage.Services++
+		usage.MemoryBytes += parseSize(svc.Limits.MemoryMax)
+	}
+
+	return usage, nil
+}
+
+// checkTeamQuotas validates a service joining a team: the team must exist, the owner must
+// be a member and the team must have room for a service with the limits and backupBytes of
+// backups. When exclude is set, the service with that ID is already in the team and only
+// its limits are checked. Callers hold the team's lock.
+func (o *Orchestrator) checkTeamQuotas(ctx context.Context, teamID, owner string, limits database.ServiceLimits, backupBytes int64, exclude string) ([]validation.ValidationError, error) {
+	team, err := o.dbManager.GetTeam(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []validation.ValidationError{{
+			Field:   "team",
+			Message: fmt.Sprintf("No team with ID %q", teamID),
+			Code:    "INVALID_TEAM",
+		}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []validation.ValidationError
+	if owner != "" && !team.HasMember(owner) {
+		errs = append(errs, validation.ValidationError{
+			Field:   "team",
+			Message: fmt.Sprintf("The owner is not a member of team %s", team.Name),
+			Code:    "TEAM_MEMBERSHIP",
+		})
+	}
+
+	usage, err := o.teamUsage(ctx, team, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	if exclude == "" && usage.MaxServices > 0 && usage.Services >= usage.MaxServices {
+		errs = append(errs, validation.ValidationError{
+			Field:   "team",
+			Message: fmt.Sprintf("Team %s already has %d of its %d services", team.Name, usage.Services, usage.MaxServices),
+			Code:    "TEAM_QUOTA_SERVICES",
+		})
+	}
+
+	if usage.MaxMemoryBytes > 0 {
+		if limits.MemoryMax == "" {
+			errs = append(errs, validation.ValidationError{
+				Field:   "limits",
+				Message: fmt.Sprintf("Services of team %s need a memory_max limit", team.Name),
+				Code:    "MEMORY_LIMIT_REQUIRED",
+			})
+		} else if total := usage.MemoryBytes + parseSize(limits.MemoryMax); total > usage.MaxMemoryBytes {
+			errs = append(errs, validation.ValidationError{
+				Field:   "limits",
+				Message: fmt.Sprintf("Team %s would use %s of its %s memory quota", team.Name, formatSize(total), team.MaxMemory),
+				Code:    "TEAM_QUOTA_MEMORY",
+			})
+		}
+	}
+
+	if exclude == "" && usage.MaxBackupBytes > 0 {
+		switch total := usage.BackupBytes + backupBytes; {
+		case usage.BackupBytes >= usage.MaxBackupBytes:
+			errs = append(errs, validation.ValidationError{
+				Field:   "team",
+				Message: fmt.Sprintf("Backups of team %s use %s of its %s backup storage quota, delete some first", team.Name, formatSize(usage.BackupBytes), team.MaxBackupStorage),
+				Code:    "TEAM_QUOTA_BACKUP_STORAGE",
+			})
+		case total > usage.MaxBackupBytes:
+			errs = append(errs, validation.ValidationError{
+				Field:   "team",
+				Message: fmt.Sprintf("With the service's backups, team %s would use %s of its %s backup storage quota", team.Name, formatSize(total), team.MaxBackupStorage),
+				Code:    "TEAM_QUOTA_BACKUP_STORAGE",
+			})
+		}
+	}
+
+	return errs, nil
+}
+
+// checkBackupQuota returns ErrBackupQuota when a backup of size bytes would take a team
+// past its backup storage quota. Callers hold the team's lock.
+func (o *Orchestrator) checkBackupQuota(ctx context.Context, teamID string, size int64) error {
+	team, err := o.dbManager.GetTeam(ctx, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	maxBytes := parseSize(team.MaxBackupStorage)
+	if maxBytes == 0 {
+		return nil
+	}
+
+	used, err := o.dbManager.GetTeamBackupSize(ctx, team.ID)
+	if err != nil {
+		return err
+	}
+	if total := used + size; total > maxBytes {
+		return fmt.Errorf("%w: backups of team %s would use %s of its %s backup storage quota, delete some first", ErrBackupQuota, team.Name, formatSize(total), team.MaxBackupStorage)
+	}
+
+	return nil
+}
+
+// parseSize returns the bytes of a size such as 512M, as used by memory_max and the team
+// quotas. Suffixes are powers of 1024 like systemd's; empty or malformed sizes are 0.
+func parseSize(s string) int64 {
+	if s == "" {
+		return 0
+	}
+
+	multiplier := int64(1)
+	if i := strings.IndexAny(s, "KMGT"); i == len(s)-1 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMGT", s[i]) + 1))
+		s = s[:i]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n * multiplier
+}
+
+// formatSize returns bytes in the largest unit parseSize accepts, e.g. 1.5G
+func formatSize(bytes int64) string {
+	for i := 4; i > 0; i-- {
+		if unit := int64(1) << (10 * i); bytes >= unit {
+			value := strconv.FormatFloat(float64(bytes)/float64(unit), 'f', 1, 64)
+			return strings.TrimSuffix(value, ".0") + string("KMGT"[i-1])
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
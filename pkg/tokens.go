@@ -0,0 +1,180 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+// tokenTouchInterval is how often the last use of an API token is written, so that busy
+// tokens do not write on every request
+const tokenTouchInterval = time.Minute
+
+// ErrInvalidToken is returned when an API token request fails validation
+var ErrInvalidToken = errors.New("invalid API token")
+
+// TokenRequest represents a request for a new API token
+type TokenRequest struct {
+	Name        string            `json:"name"`
+	Permissions []auth.Permission `json:"permissions"`
+	// Services limits the token to these service IDs; empty allows every service the
+	// owner can access
+	Services  []string   `json:"services,omitempty"`
+	ExpiresAt *time.Time `json:"expires,omitempty"`
+}
+
+// TokenOwner is the auth record an API token acts for
+type TokenOwner struct {
+	Collection string
+	ID         string
+	Email      string
+	Role       auth.Role
+}
+
+// CreatedToken is a new API token. The token itself is only ever returned here.
+type CreatedToken struct {
+	*database.TokenRecord
+	Token string `json:"token"`
+}
+
+// CreateAPIToken creates an API token for owner. The token cannot do more than the owner's
+// role allows, and can only be limited to services the owner can access.
+func (o *Orchestrator) CreateAPIToken(ctx context.Context, owner TokenOwner, req *TokenRequest) (created *CreatedToken, err error) {
+	defer func() {
+		params := map[string]any{"name": req.Name, "owner": owner.Email, "permissions": req.Permissions}
+		if len(req.Services) > 0 {
+			params["services"] = req.Services
+		}
+		if created != nil {
+			params["token_id"] = created.ID
+		}
+		o.recordAuditResult(ctx, AuditCreateToken, nil, params, ErrInvalidToken, err)
+	}()
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: a name is required", ErrInvalidToken)
+	}
+	if len(req.Permissions) == 0 {
+		return nil, fmt.Errorf("%w: at least one permission is required", ErrInvalidToken)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: the expiry must be in the future", ErrInvalidToken)
+	}
+
+	permissions := []string{}
+	for _, perm := range req.Permissions {
+		if !owner.Role.Can(perm) {
+			return nil, fmt.Errorf("%w: your role does not allow the %q permission", ErrInvalidToken, perm)
+		}
+		if !slices.Contains(permissions, string(perm)) {
+			permissions = append(permissions, string(perm))
+		}
+	}
+
+	services := []string{}
+	for _, id := range req.Services {
+		if slices.Contains(services, id) {
+			continue
+		}
+		if _, err := o.dbManager.GetService(ctx, id); err != nil {
+			return nil, fmt.Errorf("%w: no service %q", ErrInvalidToken, id)
+		}
+		if owner.Role != auth.RoleAdmin {
+			grant, err := o.ServiceGrant(ctx, id, owner.ID)
+			if err != nil {
+				return nil, err
+			}
+			if grant == nil {
+				return nil, fmt.Errorf("%w: no service %q", ErrInvalidToken, id)
+			}
+		}
+		services = append(services, id)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token := auth.TokenPrefix + hex.EncodeToString(secret)
+
+	record := &database.TokenRecord{
+		Name:            name,
+		OwnerCollection: owner.Collection,
+		OwnerID:         owner.ID,
+		OwnerEmail:      owner.Email,
+		Prefix:          token[:len(auth.TokenPrefix)+8],
+		Hash:            hashToken(token),
+		Permissions:     permissions,
+		Services:        services,
+		ExpiresAt:       req.ExpiresAt,
+	}
+	if err := o.dbManager.CreateAPIToken(ctx, record); err != nil {
+		return nil, err
+	}
+
+	return &CreatedToken{TokenRecord: record, Token: token}, nil
+}
+
+// AuthenticateAPIToken returns the API token a request presents, or nil when it is unknown
+// or expired, and records that it was used
+func (o *Orchestrator) AuthenticateAPIToken(ctx context.Context, token string) (*database.TokenRecord, error) {
+	record, err := o.dbManager.FindAPITokenByHash(ctx, hashToken(token))
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if record.ExpiresAt != nil && !record.ExpiresAt.After(now) {
+		return nil, nil
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= tokenTouchInterval {
+		if err := o.dbManager.TouchAPIToken(ctx, record.ID, now); err != nil {
+			log.Printf("⚠️ Failed to record use of API token %s: %v", record.Prefix, err)
+		}
+		record.LastUsedAt = &now
+	}
+
+	return record, nil
+}
+
+// GetAPIToken returns an API token by ID
+func (o *Orchestrator) GetAPIToken(ctx context.Context, id string) (*database.TokenRecord, error) {
+	return o.dbManager.GetAPIToken(ctx, id)
+}
+
+// ListAPITokens returns the API tokens of an owner, or every token when ownerID is empty
+func (o *Orchestrator) ListAPITokens(ctx context.Context, ownerID string) ([]*database.TokenRecord, error) {
+	return o.dbManager.ListAPITokens(ctx, ownerID)
+}
+
+// RevokeAPIToken deletes an API token, which stops working immediately
+func (o *Orchestrator) RevokeAPIToken(ctx context.Context, id string) error {
+	params := map[string]any{"token_id": id}
+	if token, err := o.dbManager.GetAPIToken(ctx, id); err == nil {
+		params["name"] = token.Name
+		params["owner"] = token.OwnerEmail
+	}
+
+	err := o.dbManager.DeleteAPIToken(ctx, id)
+	o.RecordAudit(ctx, AuditRevokeToken, nil, params, err)
+	return err
+}
+
+// hashToken returns the stored form of an API token. Tokens are random, so a plain hash is
+// enough to make a leaked database useless.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
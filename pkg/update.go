@@ -0,0 +1,453 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/validation"
+)
+
+// defaultDeployHealthTimeout is how long a new service gets to answer its health check
+const defaultDeployHealthTimeout = time.Minute
+
+// defaultUpdateHealthTimeout is how long an updated service gets to answer its health check
+const defaultUpdateHealthTimeout = time.Minute
+
+// ServiceUpdateRequest represents a change to a deployed service. Fields left empty keep
+// their current value; an empty, non-nil ServeFlags or Env clears them.
+type ServiceUpdateRequest struct {
+	PocketBaseVersion string                  `json:"pocketbase_version,omitempty"`
+	Port              int                     `json:"port,omitempty"`
+	Domain            string                  `json:"domain,omitempty"`
+	ServeFlags        []string                `json:"serve_flags,omitempty"`
+	Env               map[string]string       `json:"env,omitempty"`
+	Limits            *database.ServiceLimits `json:"limits,omitempty"`
+	// Team moves the service to a team, or out of its team when empty; nil keeps it. Only
+	// admins move services, through the records API.
+	Team *string `json:"-"`
+}
+
+// UpdateService validates a change to a service, records it and starts applying it in the
+// background: the binary is replaced on a version change, the unit re-rendered and
+// restarted and the Caddy site moved. If the service does not come back healthy the
+// record and configuration are rolled back to the previous settings.
+func (o *Orchestrator) UpdateService(ctx context.Context, id string, req *ServiceUpdateRequest) (response *ServiceResponse, err error) {
+	previous, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	unlockName := o.locks.Lock("name:" + strings.ToLower(previous.ProjectName))
+	defer unlockName()
+
+	// Re-read under the lock, another update may have finished in the meantime
+	previous, err = o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	// Started updates are audited once they finish
+	action, params := updateAudit(previous, req)
+	defer func() {
+		if err != nil || response.Status == "error" {
+			o.auditResponse(ctx, action, previous, params, response, err)
+		}
+	}()
+
+	if previous.Status == "deploying" {
+		return &ServiceResponse{
+			ID:      id,
+			Status:  "error",
+			Message: "Validation failed",
+			Errors: []validation.ValidationError{{
+				Field:   "status",
+				Message: fmt.Sprintf("%s is being deployed, try again once it is done", previous.ProjectName),
+				Code:    "SERVICE_BUSY",
+			}},
+		}, nil
+	}
+
+	updated, errs := o.validateServiceUpdate(previous, req)
+	if len(errs) > 0 {
+		return &ServiceResponse{ID: id, Status: "error", Message: "Validation failed", Errors: errs}, nil
+	}
+
+	teamChanged := updated.Team != previous.Team
+	if !serviceConfigChanged(previous, updated) && !teamChanged {
+		return &ServiceResponse{ID: id, Status: "success", Message: "Service is already up to date", Data: previous}, nil
+	}
+
+	portChanged := updated.Port != previous.Port
+	if portChanged {
+		unlockPort := o.locks.Lock(fmt.Sprintf("port:%d", updated.Port))
+		defer unlockPort()
+
+		if _, err := o.portManager.Allocate(ctx, previous.ProjectName, updated.Port); err != nil {
+			return &ServiceResponse{
+				ID:      id,
+				Status:  "error",
+				Message: "Validation failed",
+				Errors:  []validation.ValidationError{portAllocationError(err)},
+			}, nil
+		}
+	}
+
+	// A service moving to a team must fit its quotas, and a changed memory limit must still
+	// fit the memory quota of the service's team. The team stays locked until the record is saved.
+	var teamErrs []validation.ValidationError
+	switch {
+	case teamChanged && updated.Team != "":
+		var unlockTeam func()
+		unlockTeam, teamErrs, err = o.lockTeamMove(ctx, previous, updated.Team, updated.Limits)
+		if unlockTeam != nil {
+			defer unlockTeam()
+		}
+	case updated.Team != "" && updated.Limits.MemoryMax != previous.Limits.MemoryMax:
+		unlockTeam := o.locks.Lock("team:" + updated.Team)
+		defer unlockTeam()
+
+		teamErrs, err = o.checkTeamQuotas(ctx, updated.Team, "", updated.Limits, 0, previous.ID)
+	}
+	if err != nil || len(teamErrs) > 0 {
+		if portChanged {
+			o.portManager.Release(ctx, updated.Port)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &ServiceResponse{ID: id, Status: "error", Message: "Validation failed", Errors: teamErrs}, nil
+	}
+
+	// A move that changes nothing on the host is saved without a deploy
+	if !serviceConfigChanged(previous, updated) {
+		if err := o.dbManager.SetServiceTeam(ctx, id, updated.Team); err != nil {
+			return nil, err
+		}
+		o.RecordAudit(ctx, AuditMoveTeam, previous, map[string]any{"team": updated.Team}, nil)
+		return &ServiceResponse{ID: id, Status: "success", Message: "Service moved", Data: updated}, nil
+	}
+
+	// The previous port stays reserved until the update succeeds, so a rollback can return to it
+	updated.Status = "deploying"
+	if err := o.dbManager.UpdateService(ctx, updated); err != nil {
+		if portChanged {
+			o.portManager.Release(ctx, updated.Port)
+		}
+		return nil, fmt.Errorf("failed to update service record: %w", err)
+	}
+
+	// The outcome is audited once the update finishes, after the request is gone
+	auditCtx := WithActor(context.WithoutCancel(ctx), ActorFrom(ctx))
+	go func() {
+		started := time.Now()
+		err := o.updateServiceAsync(context.Background(), previous, updated)
+		o.observeDeployment(started, err)
+		o.RecordAudit(auditCtx, action, updated, params, err)
+		if err != nil {
+			log.Printf("❌ Failed to update %s: %v", updated.ProjectName, err)
+		}
+	}()
+
+	return &ServiceResponse{
+		ID:      id,
+		Status:  "success",
+		Message: "Service update started",
+		Data:    updated,
+	}, nil
+}
+
+// validateServiceUpdate applies an update request to a copy of a service record and
+// validates the changed fields. Port availability is checked when the port is reserved.
+func (o *Orchestrator) validateServiceUpdate(current *database.ServiceRecord, req *ServiceUpdateRequest) (*database.ServiceRecord, []validation.ValidationError) {
+	updated := *current
+	var errs []validation.ValidationError
+
+	if req.PocketBaseVersion != "" && req.PocketBaseVersion != current.PocketBaseVersion {
+		errs = append(errs, o.validator.ValidateVersion(req.PocketBaseVersion).Errors...)
+		updated.PocketBaseVersion = req.PocketBaseVersion
+	}
+	if req.Domain != "" && req.Domain != current.Domain {
+		errs = append(errs, o.validator.ValidateDomain(req.Domain).Errors...)
+		updated.Domain = req.Domain
+	}
+	if req.Port != 0 && req.Port != current.Port {
+		if req.Port < 1024 || req.Port > 65535 {
+			errs = append(errs, validation.ValidationError{
+				Field:   "port",
+				Message: "Port must be between 1024 and 65535",
+				Code:    "INVALID_PORT_RANGE",
+			})
+		}
+		updated.Port = req.Port
+	}
+	if req.ServeFlags != nil {
+		errs = append(errs, validateServeFlags(req.ServeFlags)...)
+		updated.ServeFlags = req.ServeFlags
+	}
+	if req.Env != nil {
+		errs = append(errs, validateEnv(req.Env)...)
+		updated.Env = req.Env
+	}
+	if req.Limits != nil {
+		errs = append(errs, validateLimits(*req.Limits)...)
+		updated.Limits = *req.Limits
+	}
+	if req.Team != nil {
+		updated.Team = *req.Team
+	}
+
+	return &updated, errs
+}
+
+// updateAudit returns the audited action and parameters of an update request: updates
+// that change the PocketBase version are upgrades
+func updateAudit(previous *database.ServiceRecord, req *ServiceUpdateRequest) (string, map[string]any) {
+	action := AuditUpdate
+	if req.PocketBaseVersion != "" && req.PocketBaseVersion != previous.PocketBaseVersion {
+		action = AuditUpgrade
+	}
+	params := serviceParams(req.Port, req.PocketBaseVersion, req.Domain, req.ServeFlags, req.Env, req.Limits)
+	if req.Team != nil && *req.Team != previous.Team {
+		params["team"] = *req.Team
+	}
+	return action, params
+}
+
+// updateServiceAsync applies an update to the host and waits for the service to become
+// healthy. On failure the previous record and configuration are put back; the service
+// ends up active when the rollback succeeds and in error otherwise.
+func (o *Orchestrator) updateServiceAsync(ctx context.Context, previous, updated *database.ServiceRecord) error {
+	updateErr := o.reconfigureServiceAsync(ctx, previous, updated)
+	if updateErr == nil {
+		o.releaseUnusedPort(ctx, updated.ProjectName, previous.Port, updated.Port)
+		return nil
+	}
+
+	log.Printf("↩️ Update of %s failed, rolling back: %v", updated.ProjectName, updateErr)
+
+	// The team is not part of the host configuration, so a move made with the update is kept
+	restored := *previous
+	restored.Team = updated.Team
+	restored.Status = "deploying"
+	if err := o.dbManager.UpdateService(ctx, &restored); err != nil {
+		o.dbManager.UpdateServiceStatus(ctx, updated.ID, "error")
+		return errors.Join(updateErr, fmt.Errorf("failed to roll back the service record: %w", err))
+	}
+	o.releaseUnusedPort(ctx, updated.ProjectName, updated.Port, previous.Port)
+
+	if err := o.reconfigureServiceAsync(ctx, updated, &restored); err != nil {
+		o.dbManager.UpdateServiceStatus(ctx, previous.ID, "error")
+		return errors.Join(updateErr, fmt.Errorf("failed to roll back the service: %w", err))
+	}
+
+	return fmt.Errorf("rolled back: %w", updateErr)
+}
+
+// releaseUnusedPort releases the port a service no longer uses after an update or rollback
+func (o *Orchestrator) releaseUnusedPort(ctx context.Context, projectName string, unused, inUse int) {
+	if unused == inUse {
+		return
+	}
+	if err := o.portManager.Release(ctx, unused); err != nil {
+		log.Printf("⚠️ Failed to release port %d of %s: %v", unused, projectName, err)
+	}
+}
+
+// waitForHealthy polls a service's HTTP health check until it passes or timeout elapses
+func (o *Orchestrator) waitForHealthy(ctx context.Context, port int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		probe := o.serviceManager.ProbeHTTP(ctx, port)
+		if probe.OK {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not become healthy within %s: %s", timeout, probe.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// serviceConfigChanged reports whether two records differ in anything that is deployed
+func serviceConfigChanged(a, b *database.ServiceRecord) bool {
+	return a.PocketBaseVersion != b.PocketBaseVersion ||
+		a.Port != b.Port ||
+		a.Domain != b.Domain ||
+		!slices.Equal(a.ServeFlags, b.ServeFlags) ||
+		!maps.Equal(a.Env, b.Env) ||
+		a.Limits != b.Limits
+}
+
+// reconfigureServiceAsync brings a deployed service in line with its updated record: the
+// binary is replaced on a version change, the unit rewritten and restarted, and the Caddy
+// site moved when the port or domain changed. The service must then pass its health check.
+func (o *Orchestrator) reconfigureServiceAsync(ctx context.Context, previous, updated *database.ServiceRecord) error {
+	if updated.PocketBaseVersion != previous.PocketBaseVersion {
+		err := o.deployStep(updated, DeployStepInstall, func() error {
+			// The binary is replaced in place, which fails while it is running
+			o.serviceManager.Stop(updated.ProjectName)
+
+			if err := o.serviceManager.Deploy(ctx, o.deploymentConfigFor(updated)); err != nil {
+				return fmt.Errorf("failed to deploy PocketBase %s: %w", updated.PocketBaseVersion, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	systemdConfig := o.systemdConfigFor(updated)
+	err := o.deployStep(updated, DeployStepSystemd, func() error {
+		if err := o.systemdManager.CreateService(systemdConfig); err != nil {
+			return fmt.Errorf("failed to update systemd service: %w", err)
+		}
+
+		// Reloads the unit and starts the service if it was stopped
+		if err := o.systemdManager.EnableService(updated.ProjectName); err != nil {
+			return fmt.Errorf("failed to enable systemd service: %w", err)
+		}
+		if err := o.systemdManager.RestartService(updated.ProjectName); err != nil {
+			return fmt.Errorf("failed to restart systemd service: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	caddyConfig := caddyConfigFor(updated)
+	if updated.Port != previous.Port || updated.Domain != previous.Domain {
+		err := o.deployStep(updated, DeployStepCaddy, func() error {
+			if err := o.caddyManager.UpdateServiceConfig(previous.ProjectName, previous.Domain, caddyConfig); err != nil {
+				return fmt.Errorf("failed to update Caddy configuration: %w", err)
+			}
+			if err := o.caddyManager.ReloadConfig(); err != nil {
+				return fmt.Errorf("failed to reload Caddy: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	timeout := o.config.UpdateHealthTimeout
+	if timeout <= 0 {
+		timeout = defaultUpdateHealthTimeout
+	}
+	err = o.deployStep(updated, DeployStepHealth, func() error {
+		return o.waitForHealthy(ctx, updated.Port, timeout)
+	})
+	if err != nil {
+		return err
+	}
+
+	// A deliberate restart gives the service a fresh restart budget
+	o.crashLoops.Reset(updated.ID)
+
+	if err := o.dbManager.UpdateServiceStatus(ctx, updated.ID, "active"); err != nil {
+		return fmt.Errorf("failed to update service status: %w", err)
+	}
+
+	return o.storeConfigHashes(ctx, updated.ID, systemdConfig, caddyConfig)
+}
+
+// validateServeFlags checks extra "pocketbase serve" arguments. Each flag is written to
+// ExecStart as one quoted argument, so spaces, quotes and % are allowed; line breaks are not.
+func validateServeFlags(flags []string) []validation.ValidationError {
+	var errs []validation.ValidationError
+
+	for _, flag := range flags {
+		if !strings.HasPrefix(flag, "-") {
+			errs = append(errs, validation.ValidationError{
+				Field:   "serve_flags",
+				Message: fmt.Sprintf("flag %q must start with -", flag),
+				Code:    "INVALID_FLAG",
+			})
+		}
+		if strings.ContainsAny(flag, "\r\n") {
+			errs = append(errs, validation.ValidationError{
+				Field:   "serve_flags",
+				Message: fmt.Sprintf("flag %q must not contain line breaks", flag),
+				Code:    "INVALID_FLAG",
+			})
+		}
+		name, _, _ := strings.Cut(flag, "=")
+		if slices.Contains(managedServeFlags, name) {
+			errs = append(errs, validation.ValidationError{
+				Field:   "serve_flags",
+				Message: fmt.Sprintf("flag %s is managed by Pockestrator", name),
+				Code:    "MANAGED_FLAG",
+			})
+		}
+	}
+
+	return errs
+}
+
+// validateEnv checks the environment variables of a unit
+func validateEnv(env map[string]string) []validation.ValidationError {
+	var errs []validation.ValidationError
+
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if !envNamePattern.MatchString(name) {
+			errs = append(errs, validation.ValidationError{
+				Field:   "env",
+				Message: fmt.Sprintf("invalid environment variable name %q", name),
+				Code:    "INVALID_ENV",
+			})
+		}
+		if strings.ContainsAny(env[name], "\r\n") {
+			errs = append(errs, validation.ValidationError{
+				Field:   "env",
+				Message: fmt.Sprintf("environment variable %s must not contain line breaks", name),
+				Code:    "INVALID_ENV",
+			})
+		}
+	}
+
+	return errs
+}
+
+// validateLimits checks the resource limits of a unit
+func validateLimits(limits database.ServiceLimits) []validation.ValidationError {
+	var errs []validation.ValidationError
+
+	if limits.MemoryMax != "" && !memoryMaxPattern.MatchString(limits.MemoryMax) {
+		errs = append(errs, validation.ValidationError{
+			Field:   "limits",
+			Message: fmt.Sprintf("memory_max %q must be a size such as 512M", limits.MemoryMax),
+			Code:    "INVALID_LIMITS",
+		})
+	}
+	if limits.CPUQuota != "" && !cpuQuotaPattern.MatchString(limits.CPUQuota) {
+		errs = append(errs, validation.ValidationError{
+			Field:   "limits",
+			Message: fmt.Sprintf("cpu_quota %q must be a percentage such as 50%%", limits.CPUQuota),
+			Code:    "INVALID_LIMITS",
+		})
+	}
+	if limits.MaxOpenFiles < 0 {
+		errs = append(errs, validation.ValidationError{
+			Field:   "limits",
+			Message: "max_open_files must not be negative",
+			Code:    "INVALID_LIMITS",
+		})
+	}
+
+	return errs
+}
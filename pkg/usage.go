@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/metrics"
+	"github.com/tigawanna/pockestrator/internal/service"
+)
+
+// ServiceUsage represents the resource usage of a running service
+type ServiceUsage struct {
+	ServiceID     string  `json:"service_id"`
+	ProjectName   string  `json:"project_name"`
+	SystemdStatus string  `json:"systemd_status"`
+	MainPID       int     `json:"main_pid"`
+	RSSBytes      uint64  `json:"rss_bytes"`
+	CPUSeconds    float64 `json:"cpu_seconds"`
+	Threads       int     `json:"threads"`
+	OpenFDs       int     `json:"open_fds"`
+	MaxOpenFiles  uint64  `json:"max_open_files"`
+	// FDUsagePercent is OpenFDs as a percentage of MaxOpenFiles
+	FDUsagePercent float64            `json:"fd_usage_percent"`
+	StartedAt      *time.Time         `json:"started_at,omitempty"`
+	UptimeSeconds  float64            `json:"uptime_seconds"`
+	Disk           *service.DataUsage `json:"disk"`
+	CollectedAt    time.Time          `json:"collected_at"`
+	Error          string             `json:"error,omitempty"`
+}
+
+// GetServiceUsage reads a service's process usage from /proc and its pb_data disk usage.
+// Process fields are left empty when the service is not running.
+func (o *Orchestrator) GetServiceUsage(ctx context.Context, id string) (*ServiceUsage, error) {
+	serviceRecord, err := o.dbManager.GetService(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+
+	usage := &ServiceUsage{
+		ServiceID:     id,
+		ProjectName:   serviceRecord.ProjectName,
+		SystemdStatus: "unknown",
+		CollectedAt:   time.Now(),
+	}
+
+	usage.Disk, err = o.serviceManager.DataDirUsage(serviceRecord.ProjectName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := o.systemdManager.GetUnitState(serviceRecord.ProjectName)
+	if err != nil {
+		usage.Error = err.Error()
+		return usage, nil
+	}
+
+	usage.SystemdStatus = state.ActiveState
+	usage.MainPID = state.MainPID
+
+	if state.ActiveState == "active" && !state.ActiveEnterTimestamp.IsZero() {
+		startedAt := state.ActiveEnterTimestamp
+		usage.StartedAt = &startedAt
+		usage.UptimeSeconds = time.Since(startedAt).Truncate(time.Second).Seconds()
+	}
+
+	if state.MainPID == 0 {
+		return usage, nil
+	}
+
+	stats, err := metrics.ReadProcessStats("/proc", state.MainPID)
+	if err != nil {
+		usage.Error = err.Error()
+		return usage, nil
+	}
+
+	usage.RSSBytes = stats.RSSBytes
+	usage.CPUSeconds = stats.CPUSeconds
+	usage.Threads = stats.Threads
+	usage.OpenFDs = stats.OpenFDs
+	usage.MaxOpenFiles = stats.MaxOpenFiles
+	if stats.MaxOpenFiles > 0 {
+		usage.FDUsagePercent = float64(stats.OpenFDs) / float64(stats.MaxOpenFiles) * 100
+	}
+
+	return usage, nil
+}
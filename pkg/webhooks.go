@@ -0,0 +1,408 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+)
+
+const (
+	// WebhookMaxAttempts is how many times a delivery is tried before it is marked failed
+	WebhookMaxAttempts = 8
+	// webhookRetryBase is the wait before the first retry; each retry doubles it, up to
+	// webhookRetryMax
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = time.Hour
+	// webhookTimeout bounds a single delivery attempt
+	webhookTimeout = 10 * time.Second
+	// webhookPollInterval is how often due retries are looked for when no new event arrives
+	webhookPollInterval = 5 * time.Second
+	// webhookBatchSize is how many due deliveries are sent per round
+	webhookBatchSize = 50
+	// webhookErrorBody is how much of a failed response's body is kept in the delivery log
+	webhookErrorBody = 512
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookEventHeader     = "X-Pockestrator-Event"
+	WebhookDeliveryHeader  = "X-Pockestrator-Delivery"
+	WebhookSignatureHeader = "X-Pockestrator-Signature-256"
+)
+
+// ErrInvalidWebhook is returned when a webhook request fails validation
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// WebhookRequest represents a request for a new webhook
+type WebhookRequest struct {
+	Name   string      `json:"name"`
+	URL    string      `json:"url"`
+	Events []EventType `json:"events"`
+	// Services limits the webhook to these services, by name or ID; empty sends the
+	// events of every service
+	Services []string `json:"services,omitempty"`
+	// Secret signs the payloads; one is generated when empty
+	Secret string `json:"secret,omitempty"`
+}
+
+// CreatedWebhook is a new webhook. The secret is only ever returned here.
+type CreatedWebhook struct {
+	*database.WebhookRecord
+	Secret string `json:"secret"`
+}
+
+// webhookClient sends deliveries. Redirects are not followed, so a receiver cannot point
+// signed payloads somewhere else.
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// CreateWebhook validates and saves a webhook. New webhooks are enabled.
+func (o *Orchestrator) CreateWebhook(ctx context.Context, req *WebhookRequest) (created *CreatedWebhook, err error) {
+	// Receiver URLs often embed a token, so neither the URL nor the secret is recorded
+	defer func() {
+		params := map[string]any{"name": req.Name, "events": req.Events}
+		if len(req.Services) > 0 {
+			params["services"] = req.Services
+		}
+		if created != nil {
+			params["webhook_id"] = created.ID
+		}
+		o.recordAuditResult(ctx, AuditCreateWebhook, nil, params, ErrInvalidWebhook, err)
+	}()
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: a name is required", ErrInvalidWebhook)
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: the URL must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+
+	if len(req.Events) == 0 {
+		return nil, fmt.Errorf("%w: at least one event type is required", ErrInvalidWebhook)
+	}
+	events := []string{}
+	for _, eventType := range req.Events {
+		if !slices.Contains(EventTypes, eventType) {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+		if !slices.Contains(events, string(eventType)) {
+			events = append(events, string(eventType))
+		}
+	}
+
+	services := []string{}
+	for _, ref := range req.Services {
+		svc, err := o.FindService(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("%w: no service %q", ErrInvalidWebhook, ref)
+		}
+		if !slices.Contains(services, svc.ID) {
+			services = append(services, svc.ID)
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		secret = hex.EncodeToString(raw)
+	}
+
+	record := &database.WebhookRecord{
+		Name:     name,
+		URL:      target.String(),
+		Events:   events,
+		Services: services,
+		Secret:   secret,
+		Enabled:  true,
+	}
+	if err := o.dbManager.CreateWebhook(ctx, record); err != nil {
+		return nil, err
+	}
+
+	return &CreatedWebhook{WebhookRecord: record, Secret: secret}, nil
+}
+
+// GetWebhook returns a webhook by ID
+func (o *Orchestrator) GetWebhook(ctx context.Context, id string) (*database.WebhookRecord, error) {
+	return o.dbManager.GetWebhook(ctx, id)
+}
+
+// ListWebhooks returns every webhook
+func (o *Orchestrator) ListWebhooks(ctx context.Context) ([]*database.WebhookRecord, error) {
+	return o.dbManager.ListWebhooks(ctx, false)
+}
+
+// DeleteWebhook deletes a webhook, dropping its queued deliveries and delivery log
+func (o *Orchestrator) DeleteWebhook(ctx context.Context, id string) error {
+	params := map[string]any{"webhook_id": id}
+	if webhook, err := o.dbManager.GetWebhook(ctx, id); err == nil {
+		params["name"] = webhook.Name
+	}
+
+	err := o.dbManager.DeleteWebhook(ctx, id)
+	o.RecordAudit(ctx, AuditDeleteWebhook, nil, params, err)
+	return err
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook, newest first
+func (o *Orchestrator) ListWebhookDeliveries(ctx context.Context, webhookID, status string, limit int) ([]*database.WebhookDeliveryRecord, error) {
+	return o.dbManager.ListWebhookDeliveries(ctx, webhookID, status, limit)
+}
+
+// PruneWebhookDeliveries deletes delivered and failed deliveries older than the retention period
+func (o *Orchestrator) PruneWebhookDeliveries(ctx context.Context, retention time.Duration) (int, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	return o.dbManager.DeleteWebhookDeliveriesBefore(ctx, time.Now().Add(-retention))
+}
+
+// SignWebhookPayload returns the signature header value of a payload: the hex HMAC-SHA256
+// of the body keyed with the webhook's secret
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RunWebhooks queues a delivery for every event an enabled webhook subscribes to, and
+// sends the deliveries that are due, until ctx is done. Deliveries are stored before they
+// are sent, so those still pending when the process stops are sent after a restart.
+func (o *Orchestrator) RunWebhooks(ctx context.Context) {
+	wake := make(chan struct{}, 1)
+	go o.deliverWebhooks(ctx, wake)
+
+	var last uint64
+	for ctx.Err() == nil {
+		// A subscription falling behind is closed; resubscribing replays what it missed
+		events, unsubscribe := o.events.Subscribe(last, EventFilter{})
+		o.queueWebhookEvents(ctx, events, wake, &last)
+		unsubscribe()
+	}
+}
+
+// queueWebhookEvents queues deliveries for the events of a subscription until it is closed
+// or ctx is done, keeping the ID of the last event in last
+func (o *Orchestrator) queueWebhookEvents(ctx context.Context, events <-chan Event, wake chan<- struct{}, last *uint64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			*last = event.ID
+
+			queued, err := o.EnqueueWebhookDeliveries(ctx, &event)
+			if err != nil {
+				log.Printf("❌ Failed to queue webhook deliveries for event %d: %v", event.ID, err)
+			}
+			if queued > 0 {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// deliverWebhooks sends due deliveries whenever an event is queued, and regularly for retries
+func (o *Orchestrator) deliverWebhooks(ctx context.Context, wake <-chan struct{}) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+
+		if _, err := o.DeliverDueWebhooks(ctx, time.Now()); err != nil {
+			log.Printf("❌ Failed to deliver webhooks: %v", err)
+		}
+	}
+}
+
+// EnqueueWebhookDeliveries queues the event for every enabled webhook that subscribes to it
+// and returns how many deliveries were queued
+func (o *Orchestrator) EnqueueWebhookDeliveries(ctx context.Context, event *Event) (int, error) {
+	webhooks, err := o.dbManager.ListWebhooks(ctx, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var payload []byte
+	queued := 0
+	for _, webhook := range webhooks {
+		if !webhookMatches(webhook, event) {
+			continue
+		}
+
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return queued, fmt.Errorf("failed to encode event: %w", err)
+			}
+		}
+
+		now := time.Now()
+		delivery := &database.WebhookDeliveryRecord{
+			WebhookID:   webhook.ID,
+			EventID:     strconv.FormatUint(event.ID, 10),
+			EventType:   string(event.Type),
+			ServiceID:   event.ServiceID,
+			ServiceName: event.ServiceName,
+			Payload:     payload,
+			Status:      database.DeliveryPending,
+			NextAttempt: &now,
+		}
+		if err := o.dbManager.CreateWebhookDelivery(ctx, delivery); err != nil {
+			return queued, err
+		}
+		queued++
+	}
+
+	return queued, nil
+}
+
+// DeliverDueWebhooks sends the deliveries due at now and returns how many were delivered.
+// Failed attempts are retried with exponential backoff until WebhookMaxAttempts.
+func (o *Orchestrator) DeliverDueWebhooks(ctx context.Context, now time.Time) (int, error) {
+	deliveries, err := o.dbManager.ListDueWebhookDeliveries(ctx, now, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	webhooks := make(map[string]*database.WebhookRecord)
+	lookupErrs := make(map[string]error)
+	delivered := 0
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.WebhookID]
+		lookupErr := lookupErrs[delivery.WebhookID]
+		if !ok && lookupErr == nil {
+			if webhook, lookupErr = o.dbManager.GetWebhook(ctx, delivery.WebhookID); lookupErr != nil {
+				log.Printf("❌ Failed to load webhook %s: %v", delivery.WebhookID, lookupErr)
+				lookupErrs[delivery.WebhookID] = lookupErr
+			} else {
+				webhooks[delivery.WebhookID] = webhook
+			}
+		}
+
+		// Deliveries whose webhook cannot be loaded, or that were queued before it was
+		// disabled, are not sent, so they do not hold up the rest of the queue
+		switch {
+		case lookupErr != nil:
+			delivery.Status = database.DeliveryFailed
+			delivery.Error = lookupErr.Error()
+			delivery.NextAttempt = nil
+		case !webhook.Enabled:
+			delivery.Status = database.DeliveryFailed
+			delivery.Error = "webhook disabled"
+			delivery.NextAttempt = nil
+		default:
+			o.attemptWebhookDelivery(ctx, webhook, delivery, now)
+		}
+
+		if err := o.dbManager.UpdateWebhookDelivery(ctx, delivery); err != nil {
+			return delivered, err
+		}
+		if delivery.Status == database.DeliveryDelivered {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// attemptWebhookDelivery sends a delivery once and records the outcome on it
+func (o *Orchestrator) attemptWebhookDelivery(ctx context.Context, webhook *database.WebhookRecord, delivery *database.WebhookDeliveryRecord, now time.Time) {
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "Pockestrator-Webhook")
+		req.Header.Set(WebhookEventHeader, delivery.EventType)
+		req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, delivery.Payload))
+
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		delivery.ResponseStatus = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBody))
+			return fmt.Errorf("receiver responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}()
+
+	switch {
+	case err == nil:
+		delivery.Status = database.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttempt = nil
+	case delivery.Attempts >= WebhookMaxAttempts:
+		delivery.Status = database.DeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttempt = nil
+	default:
+		next := now.Add(WebhookRetryDelay(delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttempt = &next
+	}
+}
+
+// WebhookRetryDelay returns how long to wait after the given number of failed attempts
+func WebhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookRetryMax)
+}
+
+// webhookMatches reports whether a webhook subscribes to an event
+func webhookMatches(webhook *database.WebhookRecord, event *Event) bool {
+	return slices.Contains(webhook.Events, string(event.Type)) &&
+		(len(webhook.Services) == 0 || slices.Contains(webhook.Services, event.ServiceID))
+}
@@ -0,0 +1,823 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+	"github.com/tigawanna/pockestrator/pkg/client"
+)
+
+// remoteOptions are the flags shared by the remote subcommands
+type remoteOptions struct {
+	profile string
+	asJSON  bool
+}
+
+// client creates an API client from the selected profile
+func (o *remoteOptions) client() (*client.Client, error) {
+	path, err := client.ProfilesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := client.LoadProfile(path, o.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return profile.Client(), nil
+}
+
+// findService resolves a service name or ID on the remote server
+func (o *remoteOptions) findService(ctx context.Context, ref string) (*client.Client, *database.ServiceRecord, error) {
+	c, err := o.client()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceRecord, err := c.FindService(ctx, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, serviceRecord, nil
+}
+
+// newRemoteCommand creates the command group that manages a Pockestrator server over its API.
+// Unlike the other commands it never opens the local data directory.
+func newRemoteCommand() *cobra.Command {
+	opts := &remoteOptions{}
+
+	command := &cobra.Command{
+		Use:   "remote",
+		Short: "Manage services on a remote Pockestrator server through its API",
+	}
+	command.PersistentFlags().StringVar(&opts.profile, "profile", client.DefaultProfile, "saved server profile to use")
+	command.PersistentFlags().BoolVar(&opts.asJSON, "json", false, "print JSON instead of a table")
+
+	command.AddCommand(
+		newRemoteLoginCommand(opts),
+		newRemoteServicesCommand(opts),
+		newRemoteBackupsCommand(opts),
+		newRemoteTokensCommand(opts),
+		newRemoteApplyCommand(opts),
+		newRemoteEventsCommand(opts),
+		newRemoteHealthCommand(opts),
+	)
+
+	return command
+}
+
+func newRemoteLoginCommand(opts *remoteOptions) *cobra.Command {
+	var serverURL, token, email, password, collection string
+
+	command := &cobra.Command{
+		Use:          "login",
+		Short:        "Save a server URL and auth token as a profile",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			c := client.New(serverURL, token)
+
+			if token == "" {
+				if email == "" {
+					return fmt.Errorf("either --token or --email is required")
+				}
+				if password == "" {
+					fmt.Print("Password: ")
+					line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+					password = strings.TrimSpace(line)
+				}
+				if err := c.AuthWithPassword(ctx, collection, email, password); err != nil {
+					return err
+				}
+			}
+
+			// Make sure the token is accepted before saving it
+			if _, err := c.ListServices(ctx); err != nil {
+				return err
+			}
+
+			path, err := client.ProfilesPath()
+			if err != nil {
+				return err
+			}
+			if err := client.SaveProfile(path, opts.profile, &client.Profile{URL: c.BaseURL, Token: c.Token}); err != nil {
+				return err
+			}
+
+			fmt.Printf("Saved profile %q for %s\n", opts.profile, c.BaseURL)
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&serverURL, "url", "", "URL of the Pockestrator server")
+	command.Flags().StringVar(&token, "token", "", "PocketBase auth token or API token")
+	command.Flags().StringVar(&email, "email", "", "email to sign in with instead of a token")
+	command.Flags().StringVar(&password, "password", "", "password to sign in with, prompted when omitted")
+	command.Flags().StringVar(&collection, "collection", "_superusers", "auth collection to sign in to")
+	command.MarkFlagRequired("url")
+
+	return command
+}
+
+// newRemoteServicesCommand creates the remote counterpart of the services command group
+func newRemoteServicesCommand(opts *remoteOptions) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "services",
+		Short: "List, create, delete and control remote services",
+	}
+
+	command.AddCommand(
+		newRemoteServicesListCommand(opts),
+		newRemoteServicesCreateCommand(opts),
+		newRemoteServicesUpdateCommand(opts),
+		newRemoteServicesDeleteCommand(opts),
+		newRemoteServicesLogsCommand(opts),
+		newRemoteServicesStatusCommand(opts),
+	)
+	for _, action := range []string{"start", "stop", "restart"} {
+		command.AddCommand(newRemoteServicesControlCommand(action, opts))
+	}
+
+	return command
+}
+
+func newRemoteServicesListCommand(opts *remoteOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:          "list",
+		Short:        "List the remote services",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			services, err := c.ListServices(context.Background())
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				return printJSON(map[string]any{"services": services, "total": len(services)})
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tPROJECT\tPORT\tVERSION\tDOMAIN\tSTATUS")
+			for _, svc := range services {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n",
+					svc.ID, svc.ProjectName, svc.Port, svc.PocketBaseVersion, svc.Domain, svc.Status)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newRemoteServicesCreateCommand(opts *remoteOptions) *cobra.Command {
+	var req pkg.ServiceRequest
+	var wait bool
+	var timeout time.Duration
+
+	command := &cobra.Command{
+		Use:          "create <project-name>",
+		Short:        "Create and deploy a remote service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			req.ProjectName = args[0]
+
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			response, err := c.CreateService(ctx, &req)
+			if response == nil {
+				return err
+			}
+			if !wait || response.Status == "error" {
+				return printRemoteResponse(response, opts.asJSON)
+			}
+
+			serviceRecord, err := waitForRemoteDeployment(ctx, c, response.ID, timeout)
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				if err := printJSON(serviceRecord); err != nil {
+					return err
+				}
+			} else {
+				fmt.Printf("%s: %s on port %d (%s.%s)\n",
+					serviceRecord.ProjectName, serviceRecord.Status, serviceRecord.Port, serviceRecord.ProjectName, serviceRecord.Domain)
+			}
+
+			if serviceRecord.Status == "error" {
+				return fmt.Errorf("deployment of %s failed, see the logs for details", serviceRecord.ProjectName)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().IntVar(&req.Port, "port", 0, "port to listen on, allocated when omitted")
+	command.Flags().StringVar(&req.PocketBaseVersion, "version", "", "PocketBase version, the latest when omitted")
+	command.Flags().StringVar(&req.Domain, "domain", "", "domain the service is served under")
+	command.Flags().BoolVar(&wait, "wait", false, "wait for the deploy to finish")
+	command.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "how long to wait for the deploy")
+
+	return command
+}
+
+func newRemoteServicesUpdateCommand(opts *remoteOptions) *cobra.Command {
+	var req pkg.ServiceUpdateRequest
+	var wait bool
+	var timeout time.Duration
+
+	command := &cobra.Command{
+		Use:          "update <service>",
+		Short:        "Change the port, domain, version or serve flags of a remote service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, serviceRecord, err := opts.findService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			// An empty --flag= clears the serve flags
+			if cmd.Flags().Changed("flag") {
+				req.ServeFlags = slices.DeleteFunc(req.ServeFlags, func(flag string) bool { return flag == "" })
+			}
+
+			response, err := c.UpdateService(ctx, serviceRecord.ID, &req)
+			if response == nil {
+				return err
+			}
+			if !wait || response.Status == "error" || response.Data.Status != "deploying" {
+				return printRemoteResponse(response, opts.asJSON)
+			}
+
+			serviceRecord, err = waitForRemoteDeployment(ctx, c, serviceRecord.ID, timeout)
+			if err != nil {
+				return err
+			}
+
+			return printUpdateOutcome(&req, serviceRecord, opts.asJSON)
+		},
+	}
+
+	command.Flags().IntVar(&req.Port, "port", 0, "new port")
+	command.Flags().StringVar(&req.PocketBaseVersion, "version", "", "PocketBase version to switch to")
+	command.Flags().StringVar(&req.Domain, "domain", "", "new domain")
+	command.Flags().StringArrayVar(&req.ServeFlags, "flag", nil, "extra \"pocketbase serve\" argument, repeatable; --flag= clears them")
+	command.Flags().BoolVar(&wait, "wait", false, "wait for the update to finish")
+	command.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "how long to wait for the update")
+
+	return command
+}
+
+func newRemoteServicesDeleteCommand(opts *remoteOptions) *cobra.Command {
+	var assumeYes bool
+
+	command := &cobra.Command{
+		Use:          "delete <service>",
+		Short:        "Delete a remote service with its unit, Caddy site and files",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, serviceRecord, err := opts.findService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if !assumeYes {
+				fmt.Printf("Delete %s and all of its data? [y/N] ", serviceRecord.ProjectName)
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				answer = strings.ToLower(strings.TrimSpace(answer))
+				if answer != "y" && answer != "yes" {
+					return fmt.Errorf("aborted")
+				}
+			}
+
+			response, err := c.DeleteService(ctx, serviceRecord.ID)
+			if response == nil {
+				return err
+			}
+
+			return printRemoteResponse(response, opts.asJSON)
+		},
+	}
+
+	command.Flags().BoolVarP(&assumeYes, "yes", "y", false, "delete without prompting")
+
+	return command
+}
+
+func newRemoteServicesControlCommand(action string, opts *remoteOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:          action + " <service>",
+		Short:        fmt.Sprintf("%s a remote service", strings.ToUpper(action[:1])+action[1:]),
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, serviceRecord, err := opts.findService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			response, err := c.ControlService(ctx, serviceRecord.ID, action)
+			if response == nil {
+				return err
+			}
+
+			return printRemoteResponse(response, opts.asJSON)
+		},
+	}
+}
+
+func newRemoteServicesLogsCommand(opts *remoteOptions) *cobra.Command {
+	var lines int
+
+	command := &cobra.Command{
+		Use:          "logs <service>",
+		Short:        "Print the journal of a remote service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, serviceRecord, err := opts.findService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			logs, err := c.GetServiceLogs(ctx, serviceRecord.ID, lines)
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				return printJSON(logs)
+			}
+
+			for _, line := range logs.Logs {
+				fmt.Println(line)
+			}
+			return nil
+		},
+	}
+
+	command.Flags().IntVarP(&lines, "lines", "n", 100, "number of lines to print")
+
+	return command
+}
+
+func newRemoteServicesStatusCommand(opts *remoteOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:          "status <service>",
+		Short:        "Check the health of a remote service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, serviceRecord, err := opts.findService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			status, err := c.GetServiceStatus(ctx, serviceRecord.ID)
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				return printJSON(status)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Service\t%s (%s)\n", serviceRecord.ProjectName, serviceRecord.ID)
+			fmt.Fprintf(w, "Running\t%t\n", status.IsRunning)
+			fmt.Fprintf(w, "Systemd\t%s\n", status.SystemdStatus)
+			fmt.Fprintf(w, "Caddy\t%s\n", status.CaddyStatus)
+			fmt.Fprintf(w, "Config match\t%t\n", status.ConfigMatch)
+			if status.Verdict != "" {
+				fmt.Fprintf(w, "Verdict\t%s\n", status.Verdict)
+			}
+			if status.ErrorMessage != "" {
+				fmt.Fprintf(w, "Error\t%s\n", status.ErrorMessage)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// newRemoteBackupsCommand creates the command group that lists and takes backups of remote services
+func newRemoteBackupsCommand(opts *remoteOptions) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "backups",
+		Short: "List and create backups of remote services",
+	}
+
+	command.AddCommand(&cobra.Command{
+		Use:          "list <service>",
+		Short:        "List the backups of a remote service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, serviceRecord, err := opts.findService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			backups, err := c.ListBackups(ctx, serviceRecord.ID)
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				return printJSON(backups)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tFILENAME\tSTORAGE\tSIZE\tTRIGGER\tCREATED")
+			for _, backup := range backups.Backups {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+					backup.ID, backup.Filename, backup.Storage, backup.Size, backup.Trigger, backup.CreatedAt.Format(time.RFC3339))
+			}
+			return w.Flush()
+		},
+	})
+
+	command.AddCommand(&cobra.Command{
+		Use:          "create <service>",
+		Short:        "Back up the data of a remote service",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, serviceRecord, err := opts.findService(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			backup, err := c.CreateBackup(ctx, serviceRecord.ID)
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				return printJSON(backup)
+			}
+
+			fmt.Printf("Created backup %s (%s, %d bytes)\n", backup.ID, backup.Filename, backup.Size)
+			return nil
+		},
+	})
+
+	return command
+}
+
+func newRemoteTokensCommand(opts *remoteOptions) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "tokens",
+		Short: "Create, list and revoke API tokens for automation",
+	}
+
+	var req pkg.TokenRequest
+	var permissions, services []string
+	var expiresIn time.Duration
+
+	create := &cobra.Command{
+		Use:          "create <name>",
+		Short:        "Create an API token and print it once",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			req.Name = args[0]
+			for _, perm := range permissions {
+				req.Permissions = append(req.Permissions, auth.Permission(perm))
+			}
+			for _, ref := range services {
+				serviceRecord, err := c.FindService(ctx, ref)
+				if err != nil {
+					return err
+				}
+				req.Services = append(req.Services, serviceRecord.ID)
+			}
+			if expiresIn > 0 {
+				expires := time.Now().Add(expiresIn)
+				req.ExpiresAt = &expires
+			}
+
+			token, err := c.CreateToken(ctx, &req)
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				return printJSON(token)
+			}
+
+			fmt.Printf("Created API token %s (%s). Store it now, it is not shown again:\n%s\n", token.Name, token.ID, token.Token)
+			return nil
+		},
+	}
+	create.Flags().StringArrayVar(&permissions, "permission", nil, "permission the token is scoped to, repeatable")
+	create.Flags().StringArrayVar(&services, "service", nil, "service the token is limited to, repeatable; every service when omitted")
+	create.Flags().DurationVar(&expiresIn, "expires-in", 0, "how long the token is valid, forever when omitted")
+	create.MarkFlagRequired("permission")
+
+	command.AddCommand(create, &cobra.Command{
+		Use:          "list",
+		Short:        "List your API tokens, or every token for admins",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			tokens, err := c.ListTokens(ctx)
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				return printJSON(tokens)
+			}
+
+			formatTime := func(t *time.Time) string {
+				if t == nil {
+					return "-"
+				}
+				return t.Format(time.RFC3339)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tPREFIX\tOWNER\tPERMISSIONS\tSERVICES\tEXPIRES\tLAST USED")
+			for _, token := range tokens {
+				scopedServices := "all"
+				if len(token.Services) > 0 {
+					scopedServices = strings.Join(token.Services, ",")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					token.ID, token.Name, token.Prefix, token.OwnerEmail, strings.Join(token.Permissions, ","),
+					scopedServices, formatTime(token.ExpiresAt), formatTime(token.LastUsedAt))
+			}
+			return w.Flush()
+		},
+	}, &cobra.Command{
+		Use:          "revoke <id>",
+		Short:        "Revoke an API token",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			if err := c.RevokeToken(context.Background(), args[0]); err != nil {
+				return err
+			}
+
+			fmt.Printf("Revoked API token %s\n", args[0])
+			return nil
+		},
+	})
+
+	return command
+}
+
+func newRemoteApplyCommand(opts *remoteOptions) *cobra.Command {
+	var file string
+	var prune bool
+	var planOnly bool
+
+	command := &cobra.Command{
+		Use:          "apply",
+		Short:        "Bring the remote services in line with a YAML or JSON manifest",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if file == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read manifest: %w", err)
+			}
+
+			// Validate locally so mistakes are caught before anything is sent
+			manifest, err := pkg.ParseManifest(data)
+			if err != nil {
+				return err
+			}
+
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			result, err := c.ApplyManifest(context.Background(), manifest, pkg.ApplyOptions{Prune: prune, DryRun: planOnly})
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				if err := printJSON(result); err != nil {
+					return err
+				}
+			} else {
+				printApplyResult(result)
+			}
+
+			if result.Failed > 0 {
+				return fmt.Errorf("%d of %d actions failed", result.Failed, len(result.Actions))
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVarP(&file, "file", "f", "", "manifest file, or - to read standard input")
+	command.Flags().BoolVar(&prune, "prune", false, "delete services that are not in the manifest")
+	command.Flags().BoolVar(&planOnly, "plan", false, "only print what would change")
+	command.MarkFlagRequired("file")
+
+	return command
+}
+
+func newRemoteEventsCommand(opts *remoteOptions) *cobra.Command {
+	var types []string
+
+	command := &cobra.Command{
+		Use:          "events [service...]",
+		Short:        "Follow the events of remote services, such as deploy steps and status changes",
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			eventOpts := client.EventOptions{Services: args}
+			for _, eventType := range types {
+				eventOpts.Types = append(eventOpts.Types, pkg.EventType(eventType))
+			}
+
+			// The server ends the stream of a client that falls behind, which resumes
+			// after the last event it printed
+			for {
+				err := c.StreamEvents(context.Background(), eventOpts, func(event *pkg.Event) error {
+					eventOpts.After = event.ID
+					if opts.asJSON {
+						return json.NewEncoder(os.Stdout).Encode(event)
+					}
+					fmt.Println(formatEvent(event))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				time.Sleep(time.Second)
+			}
+		},
+	}
+
+	command.Flags().StringSliceVar(&types, "type", nil, "only print events of these types, e.g. deploy.step_finished")
+
+	return command
+}
+
+// formatEvent describes an event on one line
+func formatEvent(event *pkg.Event) string {
+	var detail string
+	switch {
+	case event.Step != nil && event.Step.Error != "":
+		detail = fmt.Sprintf("%s failed: %s", event.Step.Name, event.Step.Error)
+	case event.Step != nil && event.Type == pkg.EventDeployStepFinished:
+		detail = fmt.Sprintf("%s (%s)", event.Step.Name, time.Duration(event.Step.DurationMs)*time.Millisecond)
+	case event.Step != nil:
+		detail = event.Step.Name
+	case event.Status != nil:
+		detail = fmt.Sprintf("%s → %s", cmp.Or(event.Status.From, "new"), event.Status.To)
+	case event.Health != nil && event.Health.Healthy:
+		detail = "healthy"
+	case event.Health != nil:
+		detail = fmt.Sprintf("unhealthy (%s) %s", event.Health.Verdict, event.Health.Error)
+	case event.Backup != nil:
+		detail = fmt.Sprintf("%s (%d bytes)", event.Backup.Filename, event.Backup.Size)
+	}
+
+	return fmt.Sprintf("%s  %-20s %-22s %s", event.Time.Local().Format("15:04:05"), event.ServiceName, event.Type, detail)
+}
+
+func newRemoteHealthCommand(opts *remoteOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:          "health",
+		Short:        "Check the system requirements of the remote server",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			health, err := c.GetSystemHealth(context.Background())
+			if err != nil {
+				return err
+			}
+
+			if opts.asJSON {
+				if err := printJSON(health); err != nil {
+					return err
+				}
+			} else if health.Healthy && len(health.Warnings) == 0 {
+				fmt.Println("System requirements met")
+			} else {
+				printValidationErrors(health.Errors)
+				for _, warning := range health.Warnings {
+					fmt.Printf("⚠️  %s: %s (%s)\n", warning.Field, warning.Message, warning.Code)
+				}
+			}
+
+			if !health.Healthy {
+				return fmt.Errorf("system requirements not met")
+			}
+			return nil
+		},
+	}
+}
+
+// waitForRemoteDeployment polls a remote service until it leaves the deploying status
+func waitForRemoteDeployment(ctx context.Context, c *client.Client, id string, timeout time.Duration) (*database.ServiceRecord, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		serviceRecord, err := c.GetService(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if serviceRecord.Status != "deploying" {
+			return serviceRecord, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is still deploying after %s", serviceRecord.ProjectName, timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// printRemoteResponse prints a service operation response, with its validation errors
+// when the server rejected it
+func printRemoteResponse(response *pkg.ServiceResponse, asJSON bool) error {
+	if !asJSON {
+		printValidationErrors(response.Errors)
+	}
+
+	return printResponse(response, asJSON)
+}
@@ -0,0 +1,218 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// newTestUser saves a users record with the role
+func newTestUser(t *testing.T, app *tests.TestApp, email, role string) *core.Record {
+	t.Helper()
+
+	collection, err := app.FindCollectionByNameOrId(auth.UsersCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := core.NewRecord(collection)
+	user.SetEmail(email)
+	user.SetPassword("hunter2222")
+	user.Set("role", role)
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestServiceAccess(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, app := env.Orchestrator, env.DB, env.App
+	ctx := context.Background()
+
+	alice := newTestUser(t, app, "alice@example.com", "operator")
+	bob := newTestUser(t, app, "bob@example.com", "operator")
+	vera := newTestUser(t, app, "vera@example.com", "viewer")
+
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18150, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id}
+	blog := &database.ServiceRecord{ProjectName: "blog", Port: 18151, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	for _, s := range []*database.ServiceRecord{shop, blog} {
+		if err := dbManager.CreateService(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	grant, err := orchestrator.ServiceGrant(ctx, shop.ID, alice.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grant.Owner || !auth.CanOnService(alice, auth.PermDeploy, grant) || auth.CanOnService(alice, auth.PermDelete, grant) {
+		t.Errorf("Expected the owner to have what their role allows, got %+v", grant)
+	}
+
+	// Services are invisible until shared
+	if grant, _ := orchestrator.ServiceGrant(ctx, shop.ID, bob.Id); grant != nil || auth.CanOnService(bob, auth.PermRead, grant) {
+		t.Errorf("Expected no grant for a stranger, got %+v", grant)
+	}
+
+	if _, err := orchestrator.SetCollaborator(ctx, shop.ID, bob.Id, &pkg.CollaboratorRequest{Permissions: []auth.Permission{auth.PermDelete}}); !errors.Is(err, pkg.ErrInvalidCollaborator) {
+		t.Errorf("Expected the delete permission not to be shareable, got %v", err)
+	}
+	if _, err := orchestrator.SetCollaborator(ctx, shop.ID, alice.Id, &pkg.CollaboratorRequest{}); !errors.Is(err, pkg.ErrInvalidCollaborator) {
+		t.Errorf("Expected the owner not to be added as a collaborator, got %v", err)
+	}
+	if _, err := orchestrator.SetCollaborator(ctx, shop.ID, "missing", &pkg.CollaboratorRequest{}); !errors.Is(err, pkg.ErrInvalidCollaborator) {
+		t.Errorf("Expected an unknown user to be rejected, got %v", err)
+	}
+
+	for _, user := range []*core.Record{bob, vera} {
+		if _, err := orchestrator.SetCollaborator(ctx, shop.ID, user.Id, &pkg.CollaboratorRequest{Permissions: []auth.Permission{auth.PermControl}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	grant, err = orchestrator.ServiceGrant(ctx, shop.ID, bob.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.CanOnService(bob, auth.PermRead, grant) || !auth.CanOnService(bob, auth.PermControl, grant) || auth.CanOnService(bob, auth.PermDeploy, grant) {
+		t.Errorf("Expected the collaborator to read and control only, got %+v", grant)
+	}
+
+	// The role caps what a collaborator can do
+	grant, _ = orchestrator.ServiceGrant(ctx, shop.ID, vera.Id)
+	if !auth.CanOnService(vera, auth.PermRead, grant) || auth.CanOnService(vera, auth.PermControl, grant) {
+		t.Errorf("Expected a viewer collaborator to read only, got %+v", grant)
+	}
+
+	services, err := orchestrator.ListServicesForUser(ctx, bob.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].ID != shop.ID {
+		t.Errorf("Expected the collaborator to see the shared service only, got %+v", services)
+	}
+
+	collaborators, err := orchestrator.ListCollaborators(ctx, shop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collaborators) != 2 || collaborators[0].Email != "bob@example.com" {
+		t.Errorf("Unexpected collaborators: %+v", collaborators)
+	}
+
+	if err := orchestrator.RemoveCollaborator(ctx, shop.ID, bob.Id); err != nil {
+		t.Fatal(err)
+	}
+	if services, _ := orchestrator.ListServicesForUser(ctx, bob.Id); len(services) != 0 {
+		t.Errorf("Expected removed collaborators to lose access, got %+v", services)
+	}
+
+	// Applies by non-admins cannot update services they cannot deploy
+	manifest := &pkg.Manifest{Services: []pkg.ManifestService{{Name: "blog", Version: "0.29.0", Port: 18151, Domain: "example.com"}}}
+	if _, err := orchestrator.ApplyManifest(ctx, manifest, pkg.ApplyOptions{DryRun: true, Owner: alice.Id, CheckGrants: true}); !errors.Is(err, pkg.ErrApplyForbidden) || strings.Contains(err.Error(), "blog") {
+		t.Errorf("Expected the apply to be forbidden without naming blog, got %v", err)
+	}
+	if _, err := orchestrator.ApplyManifest(ctx, manifest, pkg.ApplyOptions{DryRun: true}); err != nil {
+		t.Errorf("Expected admins to apply, got %v", err)
+	}
+
+	// Unchanged services the caller cannot access are left out of the plan
+	unchanged := &pkg.Manifest{Services: []pkg.ManifestService{{Name: "shop"}, {Name: "blog"}}}
+	plan, err := orchestrator.ApplyManifest(ctx, unchanged, pkg.ApplyOptions{DryRun: true, Owner: alice.Id, CheckGrants: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 1 || plan.Actions[0].Name != "shop" {
+		t.Errorf("Expected only shop in the plan, got %+v", plan.Actions)
+	}
+
+	// Prunes by non-admins only cover services they have a grant on, and need the delete permission
+	notes := &pkg.Manifest{Services: []pkg.ManifestService{{Name: "notes"}}}
+	plan, err = orchestrator.ApplyManifest(ctx, notes, pkg.ApplyOptions{DryRun: true, Prune: true, Owner: alice.Id, CheckGrants: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 2 || plan.Actions[0].Name != "notes" || plan.Actions[1].Action != "delete" || plan.Actions[1].Name != "shop" {
+		t.Errorf("Expected to create notes and delete shop only, got %+v", plan.Actions)
+	}
+	_, err = orchestrator.ApplyManifest(ctx, notes, pkg.ApplyOptions{DryRun: true, Prune: true, Owner: vera.Id, CheckGrants: true})
+	if !errors.Is(err, pkg.ErrApplyForbidden) || !strings.Contains(err.Error(), "shop") || strings.Contains(err.Error(), "blog") {
+		t.Errorf("Expected the prune of shop to be forbidden without naming blog, got %v", err)
+	}
+}
+
+func TestCreateServiceOwner(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, app := env.Orchestrator, env.App
+	ctx := context.Background()
+
+	alice := newTestUser(t, app, "alice@example.com", "operator")
+
+	response, err := orchestrator.CreateService(ctx, &pkg.ServiceRequest{ProjectName: "orphan", PocketBaseVersion: "0.28.4", Owner: "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" || response.Errors[0].Code != "INVALID_OWNER" {
+		t.Errorf("Expected an unknown owner to be rejected, got %+v", response)
+	}
+
+	response, err = orchestrator.CreateService(ctx, &pkg.ServiceRequest{ProjectName: "owned", PocketBaseVersion: "0.28.4", Owner: alice.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status == "error" || response.Data.Owner != alice.Id {
+		t.Errorf("Expected the service to belong to alice, got %+v", response)
+	}
+}
+
+func TestTransferService(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, app := env.Orchestrator, env.DB, env.App
+	ctx := context.Background()
+
+	alice := newTestUser(t, app, "alice@example.com", "operator")
+	bob := newTestUser(t, app, "bob@example.com", "operator")
+	team := newTestTeam(t, app, "web", 0, "", "", alice.Id)
+
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18190, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id, Team: team.Id}
+	if err := dbManager.CreateService(ctx, shop); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{"unknown user": "missing", "not a member": bob.Id}
+	for name, userID := range cases {
+		if err := orchestrator.ValidateServiceOwner(ctx, userID, team.Id); !errors.Is(err, pkg.ErrInvalidOwner) {
+			t.Errorf("%s: expected the owner to be rejected, got %v", name, err)
+		}
+		if err := orchestrator.SetServiceOwner(ctx, shop.ID, userID); !errors.Is(err, pkg.ErrInvalidOwner) {
+			t.Errorf("%s: expected the transfer to be rejected, got %v", name, err)
+		}
+	}
+	if current, _ := dbManager.GetService(ctx, shop.ID); current.Owner != alice.Id {
+		t.Errorf("Expected rejected transfers to keep alice as the owner, got %q", current.Owner)
+	}
+
+	// Bob can own the service once it leaves the team
+	if err := orchestrator.ValidateServiceOwner(ctx, bob.Id, ""); err != nil {
+		t.Errorf("Expected bob to own a service outside any team, got %v", err)
+	}
+	if err := orchestrator.SetServiceTeam(ctx, shop.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.SetServiceOwner(ctx, shop.ID, bob.Id); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := dbManager.GetService(ctx, shop.ID); current.Owner != bob.Id {
+		t.Errorf("Expected bob to own the service, got %q", current.Owner)
+	}
+}
@@ -0,0 +1,213 @@
+package validation_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestAuditLog(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := pkg.WithActor(context.Background(), pkg.Actor{Name: "alice@example.com", ID: "alice", Source: "api"})
+
+	response, err := orchestrator.CreateService(ctx, &pkg.ServiceRequest{ProjectName: "Not Valid", PocketBaseVersion: "0.28.4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" {
+		t.Fatalf("Expected the create to be rejected, got %+v", response)
+	}
+
+	// The request is over before the deploy finishes
+	requestCtx, cancel := context.WithCancel(ctx)
+	response, err = orchestrator.CreateService(requestCtx, &pkg.ServiceRequest{
+		ProjectName:       "shop",
+		PocketBaseVersion: "0.28.4",
+		Env:               map[string]string{"SMTP_PASSWORD": "secret"},
+	})
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceID := response.ID
+
+	if response, err := orchestrator.ControlService(ctx, serviceID, "explode"); err != nil || response.Status != "error" {
+		t.Fatalf("Expected the control action to be rejected, got %+v, %v", response, err)
+	}
+
+	// The deploy fails without a real host and is audited once it finishes
+	waitForDeployments(t, dbManager)
+	var created []*database.AuditRecord
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		created, err = orchestrator.ListAuditEntries(context.Background(), database.AuditFilter{Service: "shop", Action: pkg.AuditCreate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(created) > 0 {
+			break
+		}
+	}
+	if len(created) != 1 || created[0].Outcome != pkg.AuditFailure || created[0].ServiceID != serviceID || created[0].Actor != "alice@example.com" {
+		t.Fatalf("Expected the failed deploy to be audited for alice, got %+v", created)
+	}
+	if env, _ := created[0].Params["env"].([]any); len(env) != 1 || env[0] != "SMTP_PASSWORD" {
+		t.Errorf("Expected only the names of environment variables to be recorded, got %v", created[0].Params)
+	}
+
+	rejected, err := orchestrator.ListAuditEntries(context.Background(), database.AuditFilter{Actor: "alice", Outcome: pkg.AuditRejected})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejected) != 2 {
+		t.Fatalf("Expected two rejected operations, got %+v", rejected)
+	}
+	// Newest first
+	if rejected[0].Action != pkg.AuditControl || rejected[0].Error != "Invalid action: explode" || rejected[0].Params["action"] != "explode" {
+		t.Errorf("Unexpected control entry: %+v", rejected[0])
+	}
+	if rejected[1].Action != pkg.AuditCreate || rejected[1].ServiceName != "Not Valid" || rejected[1].Source != "api" || rejected[1].Actor != "alice@example.com" {
+		t.Errorf("Unexpected create entry: %+v", rejected[1])
+	}
+
+	if entries, _ := orchestrator.ListAuditEntries(context.Background(), database.AuditFilter{From: time.Now().Add(time.Hour)}); len(entries) != 0 {
+		t.Errorf("Expected no entries in the future, got %+v", entries)
+	}
+
+	var buf bytes.Buffer
+	if err := pkg.WriteAuditCSV(&buf, rejected); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][1] != "actor" || rows[1][4] != pkg.AuditControl || rows[1][9] != `{"action":"explode"}` {
+		t.Errorf("Unexpected CSV export: %v", rows)
+	}
+}
+
+func TestAuditSystemActor(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	svc := &database.ServiceRecord{ProjectName: "blog", Port: 18160, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	orchestrator.RecordAudit(ctx, pkg.AuditUpdate, svc, map[string]any{"description": "Blog"}, nil)
+
+	entries, err := orchestrator.ListAuditEntries(ctx, database.AuditFilter{Service: svc.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "system" || entries[0].Source != "system" || entries[0].Outcome != pkg.AuditSuccess {
+		t.Errorf("Expected operations without an actor to be recorded as the system, got %+v", entries)
+	}
+}
+
+func TestAuditAdministrativeActions(t *testing.T) {
+	fakeHostCommands(t)
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, app := env.Orchestrator, env.DB, env.App
+	ctx := pkg.WithActor(context.Background(), pkg.Actor{Name: "root@example.com", ID: "root", Source: "api"})
+
+	bob := newTestUser(t, app, "bob@example.com", "operator")
+	team := newTestTeam(t, app, "core", 0, "", "")
+
+	svc := &database.ServiceRecord{ProjectName: "shop", Port: 18150, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	closeDB := writeTestDataDir(t, env.BaseDir, "shop")
+	defer closeDB()
+
+	backup, err := orchestrator.CreateBackup(ctx, svc.ID, "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.DeleteBackup(ctx, backup.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orchestrator.SetBackupPolicy(ctx, svc.ID, &pkg.BackupPolicyRequest{Schedule: "not a schedule"}); err == nil {
+		t.Fatal("Expected the backup policy to be rejected")
+	}
+
+	if _, err := orchestrator.SetCollaborator(ctx, svc.ID, bob.Id, &pkg.CollaboratorRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.RemoveCollaborator(ctx, svc.ID, bob.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.SetServiceOwner(ctx, svc.ID, bob.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.SetServiceTeam(ctx, svc.ID, team.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	owner := pkg.TokenOwner{Collection: "users", ID: bob.Id, Email: "bob@example.com", Role: "operator"}
+	token, err := orchestrator.CreateAPIToken(ctx, owner, &pkg.TokenRequest{Name: "ci", Permissions: []auth.Permission{auth.PermRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.RevokeAPIToken(ctx, token.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	writeUnmanagedService(t, env, "ghost", 18175)
+	if _, err := orchestrator.RemoveOrphans(ctx, &pkg.OrphanRemovalRequest{UnitFiles: []string{"ghost"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := orchestrator.ListAuditEntries(context.Background(), database.AuditFilter{Actor: "root@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes := make(map[string]*database.AuditRecord)
+	for _, entry := range entries {
+		outcomes[entry.Action] = entry
+	}
+
+	for action, expected := range map[string]string{
+		pkg.AuditBackup:          pkg.AuditSuccess,
+		pkg.AuditDeleteBackup:    pkg.AuditSuccess,
+		pkg.AuditSetBackupPolicy: pkg.AuditRejected,
+		pkg.AuditShare:           pkg.AuditSuccess,
+		pkg.AuditUnshare:         pkg.AuditSuccess,
+		pkg.AuditTransfer:        pkg.AuditSuccess,
+		pkg.AuditMoveTeam:        pkg.AuditSuccess,
+		pkg.AuditCreateToken:     pkg.AuditSuccess,
+		pkg.AuditRevokeToken:     pkg.AuditSuccess,
+		pkg.AuditRemoveOrphans:   pkg.AuditSuccess,
+	} {
+		entry := outcomes[action]
+		if entry == nil {
+			t.Errorf("Expected a %s entry", action)
+			continue
+		}
+		if entry.Outcome != expected {
+			t.Errorf("Expected %s to be recorded as %s, got %s (%s)", action, expected, entry.Outcome, entry.Error)
+		}
+	}
+
+	if entry := outcomes[pkg.AuditBackup]; entry != nil && entry.ServiceName != "shop" {
+		t.Errorf("Expected the backup to be recorded against shop, got %+v", entry)
+	}
+	if entry := outcomes[pkg.AuditRemoveOrphans]; entry != nil {
+		if removed, _ := entry.Params["removed"].([]any); len(removed) != 1 || removed[0] != "unit_files/ghost" {
+			t.Errorf("Expected the removed unit file to be recorded, got %+v", entry.Params)
+		}
+	}
+	if entry := outcomes[pkg.AuditCreateToken]; entry != nil && entry.Params["token_id"] != token.ID {
+		t.Errorf("Expected the token ID to be recorded, got %+v", entry.Params)
+	}
+}
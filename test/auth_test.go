@@ -0,0 +1,84 @@
+package validation_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+)
+
+func newAuthRecord(collection, role string) *core.Record {
+	record := core.NewRecord(core.NewAuthCollection(collection))
+	record.Set("role", role)
+	return record
+}
+
+func TestRolePermissions(t *testing.T) {
+	cases := []struct {
+		role    auth.Role
+		perm    auth.Permission
+		allowed bool
+	}{
+		{auth.RoleViewer, auth.PermRead, true},
+		{auth.RoleViewer, auth.PermControl, false},
+		{auth.RoleViewer, auth.PermDeploy, false},
+		{auth.RoleViewer, auth.PermShare, false},
+		{auth.RoleOperator, auth.PermControl, true},
+		{auth.RoleOperator, auth.PermRestore, true},
+		{auth.RoleOperator, auth.PermDelete, false},
+		{auth.RoleOperator, auth.PermManage, false},
+		{auth.RoleAdmin, auth.PermDelete, true},
+		{auth.RoleAdmin, auth.PermManage, true},
+		{auth.Role("owner"), auth.PermRead, false},
+	}
+	for _, tc := range cases {
+		if got := tc.role.Can(tc.perm); got != tc.allowed {
+			t.Errorf("%s.Can(%s) = %v, expected %v", tc.role, tc.perm, got, tc.allowed)
+		}
+	}
+
+	roles := map[*core.Record]auth.Role{
+		newAuthRecord(core.CollectionNameSuperusers, ""): auth.RoleAdmin,
+		newAuthRecord(auth.UsersCollection, "operator"):  auth.RoleOperator,
+		newAuthRecord(auth.UsersCollection, ""):          "",
+		newAuthRecord(auth.UsersCollection, "root"):      "",
+		newAuthRecord("customers", "admin"):              "",
+	}
+	for record, expected := range roles {
+		if got := auth.RoleOf(record); got != expected {
+			t.Errorf("Expected %s record with role %q to be %q, got %q", record.Collection().Name, record.GetString("role"), expected, got)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	middleware := auth.Require(auth.PermDelete)
+
+	status := func(record *core.Record) int {
+		err := middleware.Func(&core.RequestEvent{Auth: record})
+		var apiErr *router.ApiError
+		if errors.As(err, &apiErr) {
+			return apiErr.Status
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 200
+	}
+
+	if got := status(nil); got != 401 {
+		t.Errorf("Expected anonymous requests to be unauthorized, got %d", got)
+	}
+	if got := status(newAuthRecord(auth.UsersCollection, "viewer")); got != 403 {
+		t.Errorf("Expected viewers to be forbidden, got %d", got)
+	}
+	if got := status(newAuthRecord(auth.UsersCollection, "admin")); got != 200 {
+		t.Errorf("Expected admins to be allowed, got %d", got)
+	}
+	if got := status(newAuthRecord(core.CollectionNameSuperusers, "")); got != 200 {
+		t.Errorf("Expected superusers to be allowed, got %d", got)
+	}
+}
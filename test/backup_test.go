@@ -0,0 +1,190 @@
+package validation_test
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// writeTestDataDir creates a pb_data with a WAL mode data.db that stays open, like a running
+// instance, and a storage file. The returned function closes the database.
+func writeTestDataDir(t *testing.T, baseDir, projectName string) func() {
+	t.Helper()
+
+	dataDir := filepath.Join(baseDir, projectName, "pb_data")
+	if err := os.MkdirAll(filepath.Join(dataDir, "storage", "coll"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "storage", "coll", "avatar.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := dbx.Open("sqlite", filepath.Join(dataDir, "data.db")+"?_pragma=journal_mode(WAL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		"CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)",
+		"INSERT INTO notes (body) VALUES ('committed to the WAL only')",
+	} {
+		if _, err := db.NewQuery(query).Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return func() { db.Close() }
+}
+
+func TestSnapshotDataDir(t *testing.T) {
+	baseDir := t.TempDir()
+	closeDB := writeTestDataDir(t, baseDir, "app")
+	defer closeDB()
+
+	manager := service.NewManager(baseDir, t.TempDir(), "")
+	destPath := filepath.Join(t.TempDir(), "app", "backup.zip")
+
+	snapshot, err := manager.SnapshotDataDir(context.Background(), "app", destPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if snapshot.Size != int64(len(data)) || snapshot.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("Snapshot size/checksum do not match the archive: %+v", snapshot)
+	}
+
+	archive, err := zip.OpenReader(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	restoreDir := t.TempDir()
+	entries := make(map[string]bool)
+	for _, file := range archive.File {
+		entries[file.Name] = true
+		if file.Name != "data.db" {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored, _ := os.Create(filepath.Join(restoreDir, "data.db"))
+		if _, err := restored.ReadFrom(reader); err != nil {
+			t.Fatal(err)
+		}
+		restored.Close()
+		reader.Close()
+	}
+
+	for _, name := range []string{"data.db", "storage/coll/avatar.png"} {
+		if !entries[name] {
+			t.Errorf("Expected archive to contain %s, got %v", name, entries)
+		}
+	}
+	if entries["data.db-wal"] {
+		t.Error("Expected the WAL to be folded into the snapshot")
+	}
+
+	db, err := dbx.Open("sqlite", filepath.Join(restoreDir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var body string
+	if err := db.NewQuery("SELECT body FROM notes").Row(&body); err != nil || body != "committed to the WAL only" {
+		t.Errorf("Expected snapshot to contain the committed row, got %q (%v)", body, err)
+	}
+}
+
+func TestScheduledBackupsAndRetention(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, baseDir, backupDir := env.Orchestrator, env.DB, env.BaseDir, env.BackupDir
+	ctx := context.Background()
+
+	closeDB := writeTestDataDir(t, baseDir, "backed")
+	defer closeDB()
+
+	svc := &database.ServiceRecord{ProjectName: "backed", Port: 18160, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := orchestrator.SetBackupPolicy(ctx, svc.ID, &pkg.BackupPolicyRequest{Schedule: "every day"}); !errors.Is(err, pkg.ErrInvalidBackupPolicy) {
+		t.Errorf("Expected ErrInvalidBackupPolicy, got %v", err)
+	}
+
+	if _, err := orchestrator.SetBackupPolicy(ctx, svc.ID, &pkg.BackupPolicyRequest{Schedule: "@daily"}); err != nil {
+		t.Errorf("Expected cron macros to be accepted, got %v", err)
+	}
+
+	policy, err := orchestrator.SetBackupPolicy(ctx, svc.ID, &pkg.BackupPolicyRequest{Schedule: "0 3 * * *", RetentionCount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.Enabled {
+		t.Error("Expected policy to be enabled by default")
+	}
+
+	// Not due at 04:00
+	if failed, err := orchestrator.RunScheduledBackups(ctx, time.Date(2025, 8, 1, 4, 0, 0, 0, time.UTC)); err != nil || failed != 0 {
+		t.Fatalf("Unexpected result: %d failed (%v)", failed, err)
+	}
+
+	for day := 1; day <= 3; day++ {
+		if failed, err := orchestrator.RunScheduledBackups(ctx, time.Date(2025, 8, day, 3, 0, 0, 0, time.UTC)); err != nil || failed != 0 {
+			t.Fatalf("Unexpected result: %d failed (%v)", failed, err)
+		}
+	}
+
+	response, err := orchestrator.ListBackups(ctx, svc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Total != 2 || response.Policy == nil || response.Policy.LastRun == nil {
+		t.Fatalf("Expected two retained backups and a recorded run, got %+v", response)
+	}
+	for _, backup := range response.Backups {
+		if backup.Trigger != "scheduled" || len(backup.Checksum) != 64 {
+			t.Errorf("Unexpected backup record: %+v", backup)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(backupDir, "backed", "*.zip"))
+	if len(files) != 2 {
+		t.Errorf("Expected retention to leave two archives on disk, got %v", files)
+	}
+
+	manual, err := orchestrator.CreateBackup(ctx, svc.ID, "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.DeleteBackup(ctx, manual.ID); err != nil {
+		t.Fatal(err)
+	}
+	if manual.Storage != "local" {
+		t.Errorf("Expected backups to default to local storage, got %q", manual.Storage)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, manual.Path)); !os.IsNotExist(err) {
+		t.Errorf("Expected deleted backup archive to be removed, got %v", err)
+	}
+}
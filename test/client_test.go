@@ -0,0 +1,177 @@
+package validation_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/validation"
+	"github.com/tigawanna/pockestrator/pkg"
+	"github.com/tigawanna/pockestrator/pkg/client"
+)
+
+// newAPIStub serves canned responses by method and path, rejecting requests without the token
+func newAPIStub(t *testing.T, token string, routes map[string]func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != token {
+			writeStubJSON(w, http.StatusUnauthorized, map[string]any{"status": 401, "message": "The request requires valid record authorization token.", "data": map[string]any{}})
+			return
+		}
+
+		handler, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			writeStubJSON(w, http.StatusNotFound, map[string]any{"status": 404, "message": "The requested resource wasn't found.", "data": map[string]any{}})
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func writeStubJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	server := newAPIStub(t, "secret", map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/pockestrator/services": func(w http.ResponseWriter, r *http.Request) {
+			writeStubJSON(w, 200, map[string]any{"services": []map[string]any{{"id": "abc123", "project_name": "shop", "port": 8091}}, "total": 1})
+		},
+		"POST /api/pockestrator/services": func(w http.ResponseWriter, r *http.Request) {
+			var req pkg.ServiceRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			writeStubJSON(w, 200, pkg.ServiceResponse{
+				Status:  "error",
+				Message: "Validation failed",
+				Errors:  []validation.ValidationError{{Field: "project_name", Message: req.ProjectName + " exists", Code: "DUPLICATE_SERVICE"}},
+			})
+		},
+		"POST /api/pockestrator/services/abc123/control": func(w http.ResponseWriter, r *http.Request) {
+			writeStubJSON(w, 500, map[string]any{"status": 500, "message": "Failed to control service", "data": map[string]any{}})
+		},
+		"POST /api/pockestrator/validate/service": func(w http.ResponseWriter, r *http.Request) {
+			writeStubJSON(w, 400, map[string]any{"valid": false, "errors": []validation.ValidationError{{Field: "port", Code: "PORT_IN_USE"}}})
+		},
+		"GET /api/pockestrator/system/health": func(w http.ResponseWriter, r *http.Request) {
+			writeStubJSON(w, 503, map[string]any{"healthy": false, "checks": map[string]bool{"systemd": false}})
+		},
+	})
+
+	c := client.New(server.URL+"/", "secret")
+
+	svc, err := c.FindService(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.ID != "abc123" || svc.Port != 8091 {
+		t.Errorf("Unexpected service: %+v", svc)
+	}
+
+	if _, err := c.FindService(ctx, "blog"); !client.IsNotFound(err) {
+		t.Errorf("Expected a missing service to be a 404, got %v", err)
+	}
+
+	// Rejected operations carry the validation codes
+	response, err := c.CreateService(ctx, &pkg.ServiceRequest{ProjectName: "shop"})
+	var validationErr *client.ValidationFailedError
+	if !errors.As(err, &validationErr) || !validationErr.HasCode("DUPLICATE_SERVICE") {
+		t.Errorf("Expected a DUPLICATE_SERVICE validation error, got %v", err)
+	}
+	if response == nil || response.Status != "error" {
+		t.Errorf("Expected the response to be returned with the error, got %+v", response)
+	}
+
+	var apiErr *client.APIError
+	if _, err := c.ControlService(ctx, "abc123", "start"); !errors.As(err, &apiErr) || apiErr.Status != 500 || apiErr.Message != "Failed to control service" {
+		t.Errorf("Expected a 500 APIError, got %v", err)
+	}
+
+	// Invalid configurations and unhealthy systems are results, not errors
+	result, err := c.ValidateService(ctx, &pkg.ServiceRequest{ProjectName: "blog", Port: 8091})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || len(result.Errors) != 1 || result.Errors[0].Code != "PORT_IN_USE" {
+		t.Errorf("Unexpected validation result: %+v", result)
+	}
+
+	health, err := c.GetSystemHealth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Healthy || health.Checks["systemd"] {
+		t.Errorf("Unexpected health: %+v", health)
+	}
+
+	// Requests without the token are rejected
+	if _, err := client.New(server.URL, "wrong").ListServices(ctx); !errors.As(err, &apiErr) || apiErr.Status != 401 {
+		t.Errorf("Expected a 401 APIError, got %v", err)
+	}
+}
+
+func TestClientAuthWithPassword(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if r.URL.Path != "/api/collections/_superusers/auth-with-password" || body["password"] != "hunter22" {
+			writeStubJSON(w, 400, map[string]any{"status": 400, "message": "Failed to authenticate.", "data": map[string]any{}})
+			return
+		}
+		writeStubJSON(w, 200, map[string]any{"token": "issued", "record": map[string]any{"email": body["identity"]}})
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL, "")
+	if err := c.AuthWithPassword(context.Background(), "_superusers", "admin@example.com", "wrong"); err == nil {
+		t.Error("Expected a wrong password to fail")
+	}
+	if err := c.AuthWithPassword(context.Background(), "_superusers", "admin@example.com", "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "issued" {
+		t.Errorf("Expected the token to be kept, got %q", c.Token)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pockestrator", "remote.json")
+
+	if _, err := client.LoadProfile(path, client.DefaultProfile); err == nil {
+		t.Error("Expected a missing profile to be an error")
+	}
+
+	if err := client.SaveProfile(path, client.DefaultProfile, &client.Profile{URL: "https://a.example.com", Token: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SaveProfile(path, "staging", &client.Profile{URL: "https://b.example.com", Token: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := client.LoadProfile(path, client.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.URL != "https://a.example.com" || profile.Token != "a" {
+		t.Errorf("Unexpected profile: %+v", profile)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the profiles file to be private, got %v", info.Mode().Perm())
+	}
+}
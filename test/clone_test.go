@@ -0,0 +1,148 @@
+package validation_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/systemd"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestServeFlags(t *testing.T) {
+	dir := t.TempDir()
+	manager := systemd.NewManager(dir)
+
+	path := filepath.Join(dir, "app-pocketbase.service")
+	content := `[Service]
+ExecStart=/srv/app/pocketbase serve --http="127.0.0.1:8095" --dir /srv/app/pb_data --encryptionEnv=PB_KEY --origins https://app.example.com --publicDir=/srv/app/pb_public --dev
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := manager.ParseServiceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"--encryptionEnv=PB_KEY", "--origins", "https://app.example.com", "--dev"}
+	if !reflect.DeepEqual(info.ServeFlags, expected) {
+		t.Errorf("Expected serve flags %v, got %v", expected, info.ServeFlags)
+	}
+
+	// The flags round trip through a generated unit
+	if err := manager.CreateService(&systemd.ServiceConfig{ProjectName: "copy", ServiceDir: "/srv/copy", Port: 8096, ServeFlags: info.ServeFlags}); err != nil {
+		t.Fatal(err)
+	}
+	unit, _ := os.ReadFile(filepath.Join(dir, "copy-pocketbase.service"))
+	if !strings.Contains(string(unit), `serve --http="127.0.0.1:8096" "--encryptionEnv=PB_KEY" "--origins" "https://app.example.com" "--dev"`) {
+		t.Errorf("Expected serve flags in the generated unit, got:\n%s", unit)
+	}
+
+	// Spaces, quotes, backslashes and specifiers stay inside their own argument
+	tricky := []string{"--x=%h", `--name=a b "c" \d`, "--dev"}
+	if err := manager.CreateService(&systemd.ServiceConfig{ProjectName: "tricky", ServiceDir: "/srv/tricky", Port: 8097, ServeFlags: tricky}); err != nil {
+		t.Fatal(err)
+	}
+	unit, _ = os.ReadFile(filepath.Join(dir, "tricky-pocketbase.service"))
+	if !strings.Contains(string(unit), `"--x=%%h" "--name=a b \"c\" \\d" "--dev"`) {
+		t.Errorf("Expected escaped serve flags in the generated unit, got:\n%s", unit)
+	}
+	info, err = manager.ParseServiceFile(filepath.Join(dir, "tricky-pocketbase.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info.ServeFlags, tricky) || info.Port != 8097 {
+		t.Errorf("Expected serve flags %v on port 8097, got %v on %d", tricky, info.ServeFlags, info.Port)
+	}
+}
+
+func TestCloneService(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, baseDir := env.Orchestrator, env.DB, env.BaseDir
+	ctx := context.Background()
+
+	closeDB := writeTestDataDir(t, baseDir, "production")
+	defer closeDB()
+
+	for path, content := range map[string]string{
+		"pb_hooks/main.pb.js":      "routerAdd('GET', '/hello', () => {})",
+		"pb_migrations/1_init.js":  "migrate(() => {})",
+		"pb_public/index.html":     "<h1>hi</h1>",
+		"pb_public/assets/app.css": "body {}",
+		"errors.log":               "not copied",
+	} {
+		fullPath := filepath.Join(baseDir, "production", path)
+		os.MkdirAll(filepath.Dir(fullPath), 0755)
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := &database.ServiceRecord{
+		ProjectName:       "production",
+		Port:              18185,
+		PocketBaseVersion: "0.28.4",
+		Domain:            "example.com",
+		ServeFlags:        []string{"--encryptionEnv=PB_KEY"},
+		Status:            "active",
+	}
+	if err := dbManager.CreateService(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := orchestrator.CloneService(ctx, source.ID, &pkg.CloneRequest{ProjectName: "production", IncludeData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" {
+		t.Errorf("Expected cloning into an existing name to fail validation, got %+v", response)
+	}
+
+	response, err = orchestrator.CloneService(ctx, source.ID, &pkg.CloneRequest{ProjectName: "staging", IncludeData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "deploying" {
+		t.Fatalf("Expected clone to start deploying, got %+v", response)
+	}
+
+	clone := response.Data
+	if clone.PocketBaseVersion != source.PocketBaseVersion || clone.Domain != source.Domain || clone.Port == source.Port {
+		t.Errorf("Unexpected clone record: %+v", clone)
+	}
+	if !reflect.DeepEqual(clone.ServeFlags, source.ServeFlags) {
+		t.Errorf("Expected serve flags %v, got %v", source.ServeFlags, clone.ServeFlags)
+	}
+
+	// The files are copied before the deploy, which fails without a real host
+	waitForDeployments(t, dbManager)
+
+	cloneDir := filepath.Join(baseDir, "staging")
+	for _, path := range []string{"pb_hooks/main.pb.js", "pb_migrations/1_init.js", "pb_public/assets/app.css", "pb_data/storage/coll/avatar.png"} {
+		if _, err := os.Stat(filepath.Join(cloneDir, path)); err != nil {
+			t.Errorf("Expected %s to be copied: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cloneDir, "errors.log")); !os.IsNotExist(err) {
+		t.Error("Expected only the application directories to be copied")
+	}
+
+	db, err := dbx.Open("sqlite", filepath.Join(cloneDir, "pb_data", "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var body string
+	if err := db.NewQuery("SELECT body FROM notes").Row(&body); err != nil || body != "committed to the WAL only" {
+		t.Errorf("Expected the clone's pb_data to contain the source's rows, got %q (%v)", body, err)
+	}
+}
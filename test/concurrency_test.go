@@ -0,0 +1,264 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/tigawanna/pockestrator/internal/caddy"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/ports"
+	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/internal/storage"
+	"github.com/tigawanna/pockestrator/internal/systemd"
+	"github.com/tigawanna/pockestrator/internal/validation"
+	_ "github.com/tigawanna/pockestrator/migrations"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// errNoDownloads is returned by the test installer: tests never download PocketBase
+var errNoDownloads = errors.New("PocketBase is not downloaded in tests")
+
+// testOptions configures newTestEnv. The zero value suits most tests.
+type testOptions struct {
+	// BackupStore is where backups are written; nil keeps them in BackupDir
+	BackupStore storage.Store
+	// Install replaces installing PocketBase during deploys, which fails by default so
+	// background deploys settle quickly without network access
+	Install service.Installer
+	// DeployHealthTimeout bounds the health step of deploys that get that far
+	DeployHealthTimeout time.Duration
+}
+
+// testEnv is an orchestrator backed by a throwaway PocketBase app and directories
+type testEnv struct {
+	Orchestrator *pkg.Orchestrator
+	DB           *database.Manager
+	App          *tests.TestApp
+	BaseDir      string
+	SystemdDir   string
+	Caddyfile    string
+	BackupDir    string
+}
+
+// newTestEnv builds an orchestrator backed by a throwaway PocketBase app
+func newTestEnv(t *testing.T, opts testOptions) *testEnv {
+	t.Helper()
+
+	app, err := tests.NewTestApp(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{
+		App:        app,
+		BaseDir:    t.TempDir(),
+		SystemdDir: t.TempDir(),
+		Caddyfile:  filepath.Join(t.TempDir(), "Caddyfile"),
+		BackupDir:  t.TempDir(),
+	}
+
+	install := opts.Install
+	if install == nil {
+		install = func(ctx context.Context, version, serviceDir string) error { return errNoDownloads }
+	}
+
+	env.DB = database.NewManager(app)
+	env.Orchestrator = pkg.NewOrchestrator(
+		service.NewManager(env.BaseDir, env.SystemdDir, env.Caddyfile),
+		systemd.NewManager(env.SystemdDir),
+		caddy.NewManager(env.Caddyfile),
+		validation.NewValidator(env.BaseDir, env.SystemdDir, env.Caddyfile),
+		env.DB,
+		ports.NewManager([]ports.Range{{Start: 18091, End: 18190}}, env.DB),
+		&pkg.Config{
+			BaseDir:       env.BaseDir,
+			SystemdDir:    env.SystemdDir,
+			CaddyConfig:   env.Caddyfile,
+			DefaultDomain: "example.com",
+			BackupDir:     env.BackupDir,
+			BackupStore:   opts.BackupStore,
+			Installer:     install,
+
+			DeployHealthTimeout: opts.DeployHealthTimeout,
+		},
+	)
+
+	t.Cleanup(func() {
+		waitForDeployments(t, env.DB)
+		app.Cleanup()
+	})
+
+	return env
+}
+
+// waitForDeployments waits for the background deploys to settle
+func waitForDeployments(t *testing.T, dbManager *database.Manager) {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		services, err := dbManager.ListServices(context.Background())
+		if err != nil {
+			return
+		}
+
+		deploying := false
+		for _, svc := range services {
+			if svc.Status == "deploying" {
+				deploying = true
+			}
+		}
+		if !deploying {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Log("deployments still running at cleanup")
+}
+
+// createConcurrently fires all requests at once and returns the responses
+func createConcurrently(t *testing.T, orchestrator *pkg.Orchestrator, requests []*pkg.ServiceRequest) []*pkg.ServiceResponse {
+	t.Helper()
+
+	responses := make([]*pkg.ServiceResponse, len(requests))
+	errs := make([]error, len(requests))
+
+	var start sync.WaitGroup
+	var done sync.WaitGroup
+	start.Add(1)
+
+	for i, req := range requests {
+		done.Add(1)
+		go func(i int, req *pkg.ServiceRequest) {
+			defer done.Done()
+			start.Wait()
+			responses[i], errs[i] = orchestrator.CreateService(context.Background(), req)
+		}(i, req)
+	}
+
+	start.Done()
+	done.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	return responses
+}
+
+// countOutcomes returns the number of accepted requests and the error codes of the rejected ones
+func countOutcomes(responses []*pkg.ServiceResponse) (int, map[string]int) {
+	accepted := 0
+	codes := make(map[string]int)
+	for _, resp := range responses {
+		if resp.Status == "deploying" {
+			accepted++
+			continue
+		}
+		for _, e := range resp.Errors {
+			codes[e.Code]++
+		}
+	}
+	return accepted, codes
+}
+
+func TestConcurrentCreateSameName(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+
+	requests := make([]*pkg.ServiceRequest, 10)
+	for i := range requests {
+		requests[i] = &pkg.ServiceRequest{ProjectName: "raceapp", PocketBaseVersion: "0.0.1"}
+	}
+
+	accepted, codes := countOutcomes(createConcurrently(t, orchestrator, requests))
+	if accepted != 1 {
+		t.Errorf("Expected exactly one create to succeed, got %d", accepted)
+	}
+	if codes["DUPLICATE_SERVICE"] != len(requests)-1 {
+		t.Errorf("Expected %d DUPLICATE_SERVICE errors, got %v", len(requests)-1, codes)
+	}
+
+	services, err := dbManager.ListServices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 {
+		t.Errorf("Expected one service record, got %d", len(services))
+	}
+}
+
+func TestConcurrentCreateSamePort(t *testing.T) {
+	orchestrator := newTestEnv(t, testOptions{}).Orchestrator
+
+	requests := make([]*pkg.ServiceRequest, 10)
+	for i := range requests {
+		requests[i] = &pkg.ServiceRequest{
+			ProjectName:       fmt.Sprintf("portrace%d", i),
+			PocketBaseVersion: "0.0.1",
+			Port:              18150,
+		}
+	}
+
+	accepted, codes := countOutcomes(createConcurrently(t, orchestrator, requests))
+	if accepted != 1 {
+		t.Errorf("Expected exactly one create to succeed, got %d", accepted)
+	}
+	if codes["DUPLICATE_PORT"] != len(requests)-1 {
+		t.Errorf("Expected %d DUPLICATE_PORT errors, got %v", len(requests)-1, codes)
+	}
+}
+
+func TestConcurrentCreateAutoPorts(t *testing.T) {
+	orchestrator := newTestEnv(t, testOptions{}).Orchestrator
+
+	requests := make([]*pkg.ServiceRequest, 10)
+	for i := range requests {
+		requests[i] = &pkg.ServiceRequest{
+			ProjectName:       fmt.Sprintf("autorace%d", i),
+			PocketBaseVersion: "0.0.1",
+		}
+	}
+
+	responses := createConcurrently(t, orchestrator, requests)
+
+	seen := make(map[int]string)
+	for _, resp := range responses {
+		if resp.Status != "deploying" {
+			t.Errorf("Expected create to succeed, got %+v", resp.Errors)
+			continue
+		}
+		if other, ok := seen[resp.Data.Port]; ok {
+			t.Errorf("Port %d assigned to both %s and %s", resp.Data.Port, other, resp.Data.ProjectName)
+		}
+		seen[resp.Data.Port] = resp.Data.ProjectName
+	}
+}
+
+func TestUniqueIndexes(t *testing.T) {
+	dbManager := newTestEnv(t, testOptions{}).DB
+	ctx := context.Background()
+
+	first := &database.ServiceRecord{ProjectName: "unique", Port: 18100, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "inactive"}
+	if err := dbManager.CreateService(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	sameName := &database.ServiceRecord{ProjectName: "unique", Port: 18101, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "inactive"}
+	if err := dbManager.CreateService(ctx, sameName); !errors.Is(err, database.ErrDuplicateProjectName) {
+		t.Errorf("Expected ErrDuplicateProjectName, got %v", err)
+	}
+
+	samePort := &database.ServiceRecord{ProjectName: "other", Port: 18100, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "inactive"}
+	if err := dbManager.CreateService(ctx, samePort); !errors.Is(err, database.ErrDuplicatePort) {
+		t.Errorf("Expected ErrDuplicatePort, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package validation_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/internal/systemd"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestParseUnitState(t *testing.T) {
+	output := "ActiveState=activating\nSubState=auto-restart\nNRestarts=17\nExecMainStatus=1\n" +
+		"MainPID=0\nMemoryCurrent=[not set]\nCPUUsageNSec=18446744073709551615\nActiveEnterTimestamp=\n"
+
+	state, err := systemd.ParseUnitState(output)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.ActiveState != "activating" || state.SubState != "auto-restart" || state.NRestarts != 17 || state.ExecMainStatus != 1 {
+		t.Errorf("Unexpected unit state: %+v", state)
+	}
+	if state.MemoryCurrent != 0 || state.CPUUsageNSec != 0 || !state.ActiveEnterTimestamp.IsZero() {
+		t.Errorf("Expected unset accounting and timestamp to be zero, got %+v", state)
+	}
+
+	state, err = systemd.ParseUnitState("ActiveState=active\nMainPID=4242\nMemoryCurrent=52428800\nCPUUsageNSec=1500000000\n" +
+		"ActiveEnterTimestamp=Thu 2025-07-31 19:30:00 UTC\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.MainPID != 4242 || state.MemoryCurrent != 52428800 || state.CPUUsageNSec != 1500000000 ||
+		!state.ActiveEnterTimestamp.Equal(time.Date(2025, 7, 31, 19, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected unit state: %+v", state)
+	}
+
+	if _, err := systemd.ParseUnitState("NRestarts=many\n"); err == nil {
+		t.Error("Expected error for a non-numeric NRestarts")
+	}
+}
+
+func TestCrashLoopDetector(t *testing.T) {
+	detector := pkg.NewCrashLoopDetector(10 * time.Minute)
+	start := time.Now()
+
+	if restarts := detector.Observe("svc", 3, start); restarts != 0 {
+		t.Errorf("Expected no restarts on the first observation, got %d", restarts)
+	}
+	if restarts := detector.Observe("svc", 9, start.Add(5*time.Minute)); restarts != 6 {
+		t.Errorf("Expected 6 restarts within the window, got %d", restarts)
+	}
+
+	// The first sample falls out of the window
+	if restarts := detector.Observe("svc", 10, start.Add(12*time.Minute)); restarts != 1 {
+		t.Errorf("Expected 1 restart within the window, got %d", restarts)
+	}
+
+	// A counter reset starts a fresh history
+	if restarts := detector.Observe("svc", 0, start.Add(13*time.Minute)); restarts != 0 {
+		t.Errorf("Expected counter reset to clear the history, got %d", restarts)
+	}
+
+	detector.Observe("other", 2, start)
+	detector.Reset("other")
+	if restarts := detector.Observe("other", 8, start.Add(time.Minute)); restarts != 0 {
+		t.Errorf("Expected reset to clear the history, got %d", restarts)
+	}
+}
+
+func TestTailErrorLog(t *testing.T) {
+	baseDir := t.TempDir()
+	manager := service.NewManager(baseDir, t.TempDir(), "")
+
+	lines, err := manager.TailErrorLog("missing", 10)
+	if err != nil || lines != nil {
+		t.Errorf("Expected no lines for a missing log, got %v (%v)", lines, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(baseDir, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var log strings.Builder
+	for i := 1; i <= 5000; i++ {
+		fmt.Fprintf(&log, "migration failed: attempt %d\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, "app", "errors.log"), []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err = manager.TailErrorLog("app", 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"migration failed: attempt 4998", "migration failed: attempt 4999", "migration failed: attempt 5000"}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+}
+
+func TestCrashEvents(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	svc := &database.ServiceRecord{ProjectName: "crashy", Port: 18120, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dbManager.UpdateServiceStatus(ctx, svc.ID, "crashlooping"); err != nil {
+		t.Fatalf("Expected crashlooping to be a valid status: %v", err)
+	}
+
+	event := &database.CrashEventRecord{ServiceID: svc.ID, Restarts: 12, NRestarts: 40, ExitStatus: 1, Stopped: true, LogTail: "panic: bad migration"}
+	if err := dbManager.CreateCrashEvent(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := orchestrator.GetCrashEvents(ctx, svc.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Total != 1 || response.Events[0].LogTail != "panic: bad migration" || !response.Events[0].Stopped {
+		t.Errorf("Unexpected crash events: %+v", response.Events)
+	}
+
+	// The health check must not clear a crashlooping status while the service is down
+	svc, err = dbManager.GetService(ctx, svc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orchestrator.CheckServiceHealth(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := dbManager.GetService(ctx, svc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status != "crashlooping" {
+		t.Errorf("Expected status to stay crashlooping, got %s", updated.Status)
+	}
+}
@@ -0,0 +1,259 @@
+package validation_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/caddy"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/systemd"
+)
+
+// writeUnmanagedService lays out a deployment Pockestrator did not create: a binary that
+// reports its version, a unit file and a Caddy site. It returns the unit and site text.
+func writeUnmanagedService(t *testing.T, env *testEnv, name string, port int) (string, string) {
+	t.Helper()
+
+	serviceDir := filepath.Join(env.BaseDir, name)
+	if err := os.MkdirAll(filepath.Join(serviceDir, "pb_data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(serviceDir, "pocketbase")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\necho pocketbase version 0.28.4\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	unit := fmt.Sprintf("[Service]\nWorkingDirectory=%s\nExecStart=%s serve --http=\"127.0.0.1:%d\"\n", serviceDir, binary, port)
+	if err := os.WriteFile(filepath.Join(env.SystemdDir, name+"-pocketbase.service"), []byte(unit), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	site := fmt.Sprintf("%s.example.com {\n    reverse_proxy 127.0.0.1:%d\n}", name, port)
+	caddyfile, _ := os.ReadFile(env.Caddyfile)
+	if err := os.WriteFile(env.Caddyfile, append(caddyfile, []byte(site+"\n\n")...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return unit, site
+}
+
+func TestParseServiceFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		content     string
+		expectPort  int
+		expectDir   string
+		expectError bool
+	}{
+		{
+			name: "Bash script unit",
+			content: `[Service]
+WorkingDirectory = /home/ubuntu/moots/
+ExecStart      = /home/ubuntu/moots/pocketbase serve --http="127.0.0.1:8094"
+`,
+			expectPort: 8094,
+			expectDir:  "/home/ubuntu/moots",
+		},
+		{
+			name: "Separate http argument",
+			content: `[Service]
+ExecStart=/srv/app/pocketbase serve --http 127.0.0.1:8095 --dir /srv/app/pb_data
+`,
+			expectPort: 8095,
+			expectDir:  "/srv/app",
+		},
+		{
+			name: "Default listen address",
+			content: `[Service]
+ExecStart=/srv/app/pocketbase serve
+`,
+			expectPort: 8090,
+			expectDir:  "/srv/app",
+		},
+		{
+			name: "Missing ExecStart",
+			content: `[Service]
+WorkingDirectory=/srv/app
+`,
+			expectError: true,
+		},
+	}
+
+	manager := systemd.NewManager(dir)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "app-pocketbase.service")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := manager.ParseServiceFile(path)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if info.ProjectName != "app" {
+				t.Errorf("Expected project name app, got %s", info.ProjectName)
+			}
+			if info.Port != tt.expectPort {
+				t.Errorf("Expected port %d, got %d", tt.expectPort, info.Port)
+			}
+			if info.WorkingDirectory != tt.expectDir {
+				t.Errorf("Expected directory %s, got %s", tt.expectDir, info.WorkingDirectory)
+			}
+		})
+	}
+}
+
+func TestFindSiteByPort(t *testing.T) {
+	caddyfile := filepath.Join(t.TempDir(), "Caddyfile")
+	content := `{
+    email admin@example.com
+}
+
+moots.tigawanna.vip {
+    request_body {
+        max_size 10MB
+    }
+    reverse_proxy 127.0.0.1:8094 {
+        transport http {
+            read_timeout 360s
+        }
+    }
+}
+
+other.example.com {
+    reverse_proxy localhost:80940
+}
+`
+	if err := os.WriteFile(caddyfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := caddy.NewManager(caddyfile)
+
+	site, err := manager.FindSiteByPort(8094)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if site != "moots.tigawanna.vip" {
+		t.Errorf("Expected moots.tigawanna.vip, got %s", site)
+	}
+
+	site, err = manager.FindSiteByPort(80940)
+	if err != nil || site != "other.example.com" {
+		t.Errorf("Expected other.example.com, got %s (%v)", site, err)
+	}
+
+	if _, err := manager.FindSiteByPort(8095); err == nil {
+		t.Error("Expected error for unproxied port")
+	}
+}
+
+func TestRemoveSite(t *testing.T) {
+	caddyfile := filepath.Join(t.TempDir(), "Caddyfile")
+	content := `keep.example.com {
+    reverse_proxy 127.0.0.1:8091
+}
+
+orphan.example.com {
+    reverse_proxy 127.0.0.1:8092 {
+        header_up X-Real-IP {remote_host}
+    }
+}
+`
+	if err := os.WriteFile(caddyfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := caddy.NewManager(caddyfile)
+	if err := manager.RemoveSite("orphan.example.com"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	blocks, err := manager.ParseSiteBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].Address != "keep.example.com" {
+		t.Errorf("Expected only keep.example.com to remain, got %+v", blocks)
+	}
+
+	backup, err := os.ReadFile(caddyfile + ".backup")
+	if err != nil || string(backup) != content {
+		t.Errorf("Expected the previous Caddyfile to be backed up, got %q (%v)", backup, err)
+	}
+
+	if err := manager.RemoveSite("missing.example.com"); err == nil {
+		t.Error("Expected error for missing site")
+	}
+}
+
+func TestImportServices(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	ctx := context.Background()
+
+	writeUnmanagedService(t, env, "moots", 18171)
+	writeUnmanagedService(t, env, "other", 18172)
+	if err := env.DB.ReservePort(ctx, 18172, "elsewhere"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the named services are imported, wherever their units are listed
+	results, err := env.Orchestrator.ImportServices(ctx, []string{"MOOTS"}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != "imported" {
+		t.Fatalf("Expected only moots to be imported, got %d results", len(results))
+	}
+
+	// The hashes are of the unit and site Pockestrator would write, as for every other service
+	svc, err := env.DB.GetService(ctx, results[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.PocketBaseVersion != "0.28.4" || svc.Domain != "example.com" {
+		t.Errorf("Unexpected service: %+v", svc)
+	}
+	unit, err := systemd.RenderService(&systemd.ServiceConfig{ProjectName: "moots", ServiceDir: filepath.Join(env.BaseDir, "moots"), Port: 18171})
+	if err != nil {
+		t.Fatal(err)
+	}
+	site, err := caddy.RenderSite(&caddy.ServiceConfig{Subdomain: "moots", Domain: "example.com", Port: 18171})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.SystemdConfigHash != database.GenerateConfigHash(unit) || svc.CaddyConfigHash != database.GenerateConfigHash(site) {
+		t.Errorf("Expected the hashes of the rendered unit and site, got %s and %s", svc.SystemdConfigHash, svc.CaddyConfigHash)
+	}
+
+	// The adopted port is reserved, and a port reserved for someone else is not taken over
+	reservations, err := env.App.FindRecordsByFilter("port_reservations", "port = 18171", "", 0, 0)
+	if err != nil || len(reservations) != 1 || reservations[0].GetString("owner") != "moots" {
+		t.Errorf("Expected port 18171 to be reserved for moots, got %v (%v)", reservations, err)
+	}
+
+	results, err = env.Orchestrator.ImportServices(ctx, []string{"other"}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != "error" {
+		t.Errorf("Expected other to be refused its reserved port, got %+v", results)
+	}
+	if services, _ := env.DB.ListServices(ctx); len(services) != 1 {
+		t.Errorf("Expected only moots to be recorded, got %d services", len(services))
+	}
+}
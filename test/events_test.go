@@ -0,0 +1,157 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+	"github.com/tigawanna/pockestrator/pkg/client"
+)
+
+// nextEvent returns the next event of a subscription, failing when none arrives
+func nextEvent(t *testing.T, events <-chan pkg.Event) pkg.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("Expected an event, the subscription was closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event")
+		return pkg.Event{}
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	bus := pkg.NewEventBus()
+
+	first := bus.Publish(pkg.Event{Type: pkg.EventStatusChanged, ServiceID: "shop"})
+	second := bus.Publish(pkg.Event{Type: pkg.EventHealthChanged, ServiceID: "blog"})
+	if second.ID <= first.ID || first.Time.IsZero() {
+		t.Fatalf("Expected increasing IDs and a time, got %+v and %+v", first, second)
+	}
+
+	// Resuming replays the missed events that pass the filter
+	events, unsubscribe := bus.Subscribe(first.ID-1, pkg.EventFilter{Services: []string{"shop"}})
+	defer unsubscribe()
+	if event := nextEvent(t, events); event.ID != first.ID {
+		t.Errorf("Expected the missed shop event, got %+v", event)
+	}
+
+	bus.Publish(pkg.Event{Type: pkg.EventBackupCompleted, ServiceID: "blog"})
+	third := bus.Publish(pkg.Event{Type: pkg.EventBackupCompleted, ServiceID: "shop"})
+	if event := nextEvent(t, events); event.ID != third.ID {
+		t.Errorf("Expected only shop events, got %+v", event)
+	}
+
+	// Subscribers that fall behind are disconnected instead of blocking the bus
+	slow, unsubscribeSlow := bus.Subscribe(0, pkg.EventFilter{Types: []pkg.EventType{pkg.EventStatusChanged}})
+	defer unsubscribeSlow()
+	for range 100 {
+		bus.Publish(pkg.Event{Type: pkg.EventStatusChanged, ServiceID: "shop"})
+	}
+	received := 0
+	for range slow {
+		received++
+	}
+	if received == 0 || received >= 100 {
+		t.Errorf("Expected the slow subscriber to be closed after its buffer filled, got %d events", received)
+	}
+}
+
+func TestServiceEvents(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	events, unsubscribe := orchestrator.Events().Subscribe(0, pkg.EventFilter{})
+	defer unsubscribe()
+
+	// There is no systemd unit in the test environment, so health checks fail
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":200}`))
+	}))
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	svc := &database.ServiceRecord{ProjectName: "shop", Port: port, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Type != pkg.EventStatusChanged || event.ServiceName != "shop" || *event.Status != (pkg.StatusChange{To: "active"}) {
+		t.Errorf("Expected the new service's status, got %+v", event)
+	}
+
+	if _, err := orchestrator.CheckServiceHealth(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Type != pkg.EventHealthChanged || event.Health.Healthy {
+		t.Errorf("Expected the first check to report the health, got %+v", event)
+	}
+	if event := nextEvent(t, events); event.Type != pkg.EventStatusChanged || event.Status.From != "active" || event.Status.To == "active" {
+		t.Errorf("Expected the failed check to change the status, got %+v", event)
+	}
+
+	// Unchanged health and status are not published again
+	svc, _ = dbManager.GetService(ctx, svc.ID)
+	if _, err := orchestrator.CheckServiceHealth(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbManager.UpdateServiceStatus(ctx, svc.ID, "error"); err != nil {
+		t.Fatal(err)
+	}
+	event := nextEvent(t, events)
+	if event.Type != pkg.EventStatusChanged || *event.Status != (pkg.StatusChange{From: svc.Status, To: "error"}) {
+		t.Errorf("Expected only the status update, got %+v", event)
+	}
+}
+
+func TestClientStreamEvents(t *testing.T) {
+	ctx := context.Background()
+
+	server := newAPIStub(t, "secret", map[string]func(w http.ResponseWriter, r *http.Request){
+		"GET /api/pockestrator/events": func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if query.Get("service") != "shop" || query.Get("type") != string(pkg.EventDeployStepFinished) || query.Get("last_event_id") != "41" {
+				t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": keep-alive\n\n")
+			for id, step := range map[int]string{42: "install", 43: "systemd"} {
+				fmt.Fprintf(w, "id: %d\nevent: deploy.step_finished\ndata: {\"id\":%d,\"type\":\"deploy.step_finished\",\"service_id\":\"abc123\",\"step\":{\"name\":%q}}\n\n", id, id, step)
+			}
+		},
+	})
+
+	c := client.New(server.URL, "secret")
+	opts := client.EventOptions{Services: []string{"shop"}, Types: []pkg.EventType{pkg.EventDeployStepFinished}, After: 41}
+
+	var received []*pkg.Event
+	err := c.StreamEvents(ctx, opts, func(event *pkg.Event) error {
+		received = append(received, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].ServiceID != "abc123" || received[0].Step == nil || received[0].Step.Name == "" {
+		t.Fatalf("Unexpected events: %+v", received)
+	}
+
+	// Handlers can stop the stream
+	stop := errors.New("stop")
+	err = c.StreamEvents(ctx, opts, func(event *pkg.Event) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("Expected the handler's error, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package validation_test
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// fakeHostCommands puts stub sudo and caddy commands on the PATH. systemctl reports the
+// units of the named projects as active and every other unit as inactive.
+func fakeHostCommands(t *testing.T, active ...string) {
+	t.Helper()
+
+	var cases strings.Builder
+	for _, name := range active {
+		cases.WriteString("    " + name + "-pocketbase.service) echo active; exit 0;;\n")
+	}
+
+	sudo := "#!/bin/sh\n" +
+		"if [ \"$1\" = systemctl ] && [ \"$2\" = is-active ]; then\n" +
+		"  case \"$3\" in\n" + cases.String() + "  esac\n" +
+		"  echo inactive; exit 3\n" +
+		"fi\n" +
+		"exit 0\n"
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sudo"), []byte(sudo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "caddy"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// findOrphan returns the named resource from a report category, or nil
+func findOrphan(resources []pkg.OrphanResource, name string) *pkg.OrphanResource {
+	for i := range resources {
+		if resources[i].Name == name {
+			return &resources[i]
+		}
+	}
+	return nil
+}
+
+// orphanResults indexes removal results by category and name
+func orphanResults(results []*pkg.OrphanRemovalResult) map[string]*pkg.OrphanRemovalResult {
+	indexed := make(map[string]*pkg.OrphanRemovalResult)
+	for _, result := range results {
+		indexed[result.Category+"/"+result.Name] = result
+	}
+	return indexed
+}
+
+func TestScanOrphans(t *testing.T) {
+	fakeHostCommands(t, "busy")
+	env := newTestEnv(t, testOptions{})
+	ctx := context.Background()
+
+	writeUnmanagedService(t, env, "ghost", 18175)
+	writeUnmanagedService(t, env, "busy", 18176)
+	writeUnmanagedService(t, env, "kept", 18177)
+
+	kept := &database.ServiceRecord{ProjectName: "kept", Port: 18177, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	if err := env.DB.CreateService(ctx, kept); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := env.Orchestrator.ScanOrphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 6 {
+		t.Errorf("Expected 6 orphans, got %d: %+v", report.Total, report)
+	}
+	for category, resources := range map[string][]pkg.OrphanResource{
+		"directories": report.Directories,
+		"unit_files":  report.UnitFiles,
+	} {
+		if orphan := findOrphan(resources, "kept"); orphan != nil {
+			t.Errorf("Expected kept to be managed, found in %s", category)
+		}
+		if orphan := findOrphan(resources, "ghost"); orphan == nil || orphan.Active {
+			t.Errorf("Expected an inactive ghost in %s, got %+v", category, orphan)
+		}
+		if orphan := findOrphan(resources, "busy"); orphan == nil || !orphan.Active {
+			t.Errorf("Expected an active busy in %s, got %+v", category, orphan)
+		}
+	}
+	if orphan := findOrphan(report.CaddySites, "ghost.example.com"); orphan == nil || orphan.Port != 18175 {
+		t.Errorf("Expected ghost.example.com proxying to 18175, got %+v", orphan)
+	}
+	if orphan := findOrphan(report.CaddySites, "kept.example.com"); orphan != nil {
+		t.Errorf("Expected kept.example.com to be managed, got %+v", orphan)
+	}
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	fakeHostCommands(t, "busy")
+	env := newTestEnv(t, testOptions{})
+	ctx := context.Background()
+
+	_, ghostSite := writeUnmanagedService(t, env, "ghost", 18175)
+	writeUnmanagedService(t, env, "busy", 18176)
+	closeDB := writeTestDataDir(t, env.BaseDir, "ghost")
+	defer closeDB()
+
+	results, err := env.Orchestrator.RemoveOrphans(ctx, &pkg.OrphanRemovalRequest{
+		Directories: []string{"ghost", "busy", "missing"},
+		UnitFiles:   []string{"ghost", "busy"},
+		CaddySites:  []string{"ghost.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexed := orphanResults(results)
+	for _, key := range []string{"directories/ghost", "unit_files/ghost", "caddy_sites/ghost.example.com"} {
+		if result := indexed[key]; result == nil || result.Status != "removed" {
+			t.Errorf("Expected %s to be removed, got %+v", key, result)
+		}
+	}
+	for _, key := range []string{"directories/busy", "unit_files/busy", "directories/missing"} {
+		if result := indexed[key]; result == nil || result.Status != "skipped" {
+			t.Errorf("Expected %s to be skipped, got %+v", key, result)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(env.BaseDir, "ghost")); !os.IsNotExist(err) {
+		t.Errorf("Expected the ghost directory to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(env.SystemdDir, "ghost-pocketbase.service")); !os.IsNotExist(err) {
+		t.Errorf("Expected the ghost unit file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(env.BaseDir, "busy")); err != nil {
+		t.Errorf("Expected the running busy directory to be kept, got %v", err)
+	}
+
+	caddyfile, _ := os.ReadFile(env.Caddyfile)
+	if strings.Contains(string(caddyfile), "ghost.example.com") {
+		t.Error("Expected the ghost site to be removed from the Caddyfile")
+	}
+	backup, _ := os.ReadFile(env.Caddyfile + ".backup")
+	if !strings.Contains(string(backup), ghostSite) {
+		t.Error("Expected the Caddyfile to be backed up before the site was removed")
+	}
+
+	// The pb_data snapshot was written before the directory was deleted
+	archivePath := indexed["directories/ghost"].Backup
+	if filepath.Dir(archivePath) != env.BackupDir {
+		t.Fatalf("Expected a backup in %s, got %q", env.BackupDir, archivePath)
+	}
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	entries := make(map[string]bool)
+	for _, file := range archive.File {
+		entries[file.Name] = true
+	}
+	if !entries["data.db"] || !entries["storage/coll/avatar.png"] || entries["data.db-wal"] {
+		t.Errorf("Expected a snapshot of data.db and storage, got %v", entries)
+	}
+
+	// Forcing removes the running unit too
+	results, err = env.Orchestrator.RemoveOrphans(ctx, &pkg.OrphanRemovalRequest{
+		Directories: []string{"busy"},
+		UnitFiles:   []string{"busy"},
+		Force:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, result := range orphanResults(results) {
+		if result.Status != "removed" {
+			t.Errorf("Expected forced %s to be removed, got %+v", key, result)
+		}
+	}
+}
+
+func TestRemoveOrphansKeepsDirectoryWhenBackupFails(t *testing.T) {
+	fakeHostCommands(t)
+	env := newTestEnv(t, testOptions{})
+
+	writeUnmanagedService(t, env, "ghost", 18175)
+	closeDB := writeTestDataDir(t, env.BaseDir, "ghost")
+	defer closeDB()
+
+	// A file in place of the backup directory makes the snapshot fail
+	if err := os.RemoveAll(env.BackupDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env.BackupDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := env.Orchestrator.RemoveOrphans(context.Background(), &pkg.OrphanRemovalRequest{
+		Directories: []string{"ghost"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Status != "error" || !strings.Contains(results[0].Message, "directory kept") {
+		t.Errorf("Expected the backup failure to be reported, got %+v", results)
+	}
+	if _, err := os.Stat(filepath.Join(env.BaseDir, "ghost", "pb_data", "data.db")); err != nil {
+		t.Errorf("Expected the ghost data to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package validation_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestCheckServiceHealth(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"code":200}`))
+	}))
+	defer server.Close()
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	svc := &database.ServiceRecord{ProjectName: "healthy", Port: port, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := orchestrator.CheckServiceHealth(ctx, svc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !check.HTTPOK || check.HTTPStatus != 200 {
+		t.Errorf("Expected a successful HTTP probe, got %+v", check)
+	}
+
+	// There is no systemd unit in the test environment, so the service is not healthy
+	if check.Healthy {
+		t.Errorf("Expected unhealthy check without a running unit, got %+v", check)
+	}
+
+	// The test Caddyfile has no site block for the service
+	if check.Verdict != service.VerdictCaddyRouteMissing || check.CaddyStatus != service.CaddyStatusRouteMissing {
+		t.Errorf("Expected a missing Caddy route, got %+v", check)
+	}
+
+	updated, err := dbManager.GetService(ctx, svc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status == "active" {
+		t.Errorf("Expected status to move away from active, got %s", updated.Status)
+	}
+	if updated.LastHealthCheck.IsZero() {
+		t.Error("Expected last_health_check to be set")
+	}
+
+	history, err := orchestrator.GetHealthHistory(ctx, svc.ID, time.Time{}, time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Total != 1 || history.Checks[0].ID != check.ID {
+		t.Errorf("Expected the check in the history, got %+v", history)
+	}
+}
+
+func TestHealthHistoryRangeAndRetention(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	svc := &database.ServiceRecord{ProjectName: "history", Port: 18120, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "inactive"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := dbManager.CreateHealthCheck(ctx, &database.HealthCheckRecord{ServiceID: svc.ID, SystemdStatus: "active"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := orchestrator.GetHealthHistory(ctx, svc.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Total != 3 {
+		t.Errorf("Expected 3 checks in range, got %d", history.Total)
+	}
+
+	history, err = orchestrator.GetHealthHistory(ctx, svc.ID, time.Now().Add(time.Hour), time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Total != 0 {
+		t.Errorf("Expected no checks in the future, got %d", history.Total)
+	}
+
+	pruned, err := orchestrator.PruneHealthChecks(ctx, time.Hour)
+	if err != nil || pruned != 0 {
+		t.Errorf("Expected nothing to prune, got %d (%v)", pruned, err)
+	}
+
+	// A cutoff in the future removes everything
+	pruned, err = dbManager.DeleteHealthChecksBefore(ctx, time.Now().Add(time.Minute))
+	if err != nil || pruned != 3 {
+		t.Errorf("Expected 3 pruned checks, got %d (%v)", pruned, err)
+	}
+}
+
+func TestProbeViaCaddy(t *testing.T) {
+	// Stand-in for the local Caddy listener that only routes one site
+	caddyListener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "app.example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"code":200}`))
+	}))
+	defer caddyListener.Close()
+
+	manager := service.NewManager(t.TempDir(), t.TempDir(), "")
+	ctx := context.Background()
+
+	result := manager.ProbeViaCaddy(ctx, caddyListener.URL, "app.example.com")
+	if !result.OK || result.URL != "http://app.example.com/api/health" {
+		t.Errorf("Expected successful probe with Host header, got %+v", result)
+	}
+
+	result = manager.ProbeViaCaddy(ctx, caddyListener.URL, "other.example.com")
+	if result.OK || result.StatusCode != http.StatusNotFound || result.Unreachable {
+		t.Errorf("Expected 404 for unrouted host, got %+v", result)
+	}
+
+	caddyListener.Close()
+	result = manager.ProbeViaCaddy(ctx, caddyListener.URL, "app.example.com")
+	if result.OK || !result.Unreachable {
+		t.Errorf("Expected unreachable listener, got %+v", result)
+	}
+}
+
+func TestDeployWaitsForHealthCheck(t *testing.T) {
+	fakeHostCommands(t)
+	env := newTestEnv(t, testOptions{
+		Install: func(ctx context.Context, version, serviceDir string) error {
+			return os.WriteFile(filepath.Join(serviceDir, "pocketbase"), []byte("#!/bin/sh\n"), 0755)
+		},
+		DeployHealthTimeout: 2 * time.Second,
+	})
+	ctx := context.Background()
+
+	if err := os.WriteFile(env.Caddyfile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing ever listens on the port of the silent service
+	silent, err := env.Orchestrator.CreateService(ctx, &pkg.ServiceRequest{ProjectName: "silent", PocketBaseVersion: "0.0.1"})
+	if err != nil || silent.Status != "deploying" {
+		t.Fatalf("Expected the deploy to start, got %+v (%v)", silent, err)
+	}
+
+	healthy, err := env.Orchestrator.CreateService(ctx, &pkg.ServiceRequest{ProjectName: "healthy", PocketBaseVersion: "0.0.1"})
+	if err != nil || healthy.Status != "deploying" {
+		t.Fatalf("Expected the deploy to start, got %+v (%v)", healthy, err)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", healthy.Data.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"code":200}`))
+		})},
+	}
+	server.Start()
+	defer server.Close()
+
+	waitForDeployments(t, env.DB)
+
+	for id, expected := range map[string]string{silent.ID: "error", healthy.ID: "active"} {
+		svc, err := env.DB.GetService(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if svc.Status != expected {
+			t.Errorf("Expected %s to be %s, got %s", svc.ProjectName, expected, svc.Status)
+		}
+	}
+}
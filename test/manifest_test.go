@@ -0,0 +1,215 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/systemd"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+const testManifest = `
+services:
+  - name: shop
+    version: 0.28.4
+    port: 18120
+    flags: ["--encryptionEnv=PB_KEY"]
+    limits:
+      memory_max: 512M
+      cpu_quota: 50%
+    env:
+      PB_KEY: secret
+  - name: blog
+    version: 0.28.4
+`
+
+func TestParseManifest(t *testing.T) {
+	manifest, err := pkg.ParseManifest([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Services) != 2 || manifest.Services[0].Limits.MemoryMax != "512M" || manifest.Services[0].Env["PB_KEY"] != "secret" {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	// JSON is accepted as well
+	if _, err := pkg.ParseManifest([]byte(`{"services": [{"name": "api", "port": 18121}]}`)); err != nil {
+		t.Errorf("Expected JSON manifest to parse, got %v", err)
+	}
+
+	invalid := map[string]string{
+		"empty":          ``,
+		"unknown field":  `services: [{name: a, ports: 18120}]`,
+		"missing name":   `services: [{port: 18120}]`,
+		"duplicate name": `services: [{name: a}, {name: A}]`,
+		"duplicate port": `services: [{name: a, port: 18120}, {name: b, port: 18120}]`,
+		"managed flag":   `services: [{name: a, flags: ["--http=0.0.0.0:80"]}]`,
+		"bare flag":      `services: [{name: a, flags: ["dev"]}]`,
+		"env name":       `services: [{name: a, env: {"BAD-NAME": x}}]`,
+		"env newline":    `services: [{name: a, env: {A: "x\ny"}}]`,
+		"memory":         `services: [{name: a, limits: {memory_max: lots}}]`,
+		"cpu":            `services: [{name: a, limits: {cpu_quota: "0.5"}}]`,
+	}
+	for name, data := range invalid {
+		if _, err := pkg.ParseManifest([]byte(data)); !errors.Is(err, pkg.ErrInvalidManifest) {
+			t.Errorf("%s: expected ErrInvalidManifest, got %v", name, err)
+		}
+	}
+}
+
+func TestUnitEnvironmentAndLimits(t *testing.T) {
+	dir := t.TempDir()
+	manager := systemd.NewManager(dir)
+
+	if err := manager.CreateService(&systemd.ServiceConfig{ProjectName: "plain", ServiceDir: "/srv/plain", Port: 8095}); err != nil {
+		t.Fatal(err)
+	}
+	unit, _ := os.ReadFile(filepath.Join(dir, "plain-pocketbase.service"))
+	if !strings.Contains(string(unit), "LimitNOFILE    = 4096\nRestart") || strings.Contains(string(unit), "Environment") {
+		t.Errorf("Expected the default unit to be unchanged, got:\n%s", unit)
+	}
+
+	err := manager.CreateService(&systemd.ServiceConfig{
+		ProjectName: "limited",
+		ServiceDir:  "/srv/limited",
+		Port:        8096,
+		Environment: map[string]string{"B": `say "100%" \o/`, "A": "1"},
+		MemoryMax:   "512M",
+		CPUQuota:    "50%",
+		LimitNOFILE: 8192,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit, _ = os.ReadFile(filepath.Join(dir, "limited-pocketbase.service"))
+	for _, line := range []string{
+		"LimitNOFILE    = 8192",
+		"MemoryMax      = 512M",
+		"CPUQuota       = 50%",
+		`Environment    = "A=1"` + "\n" + `Environment    = "B=say \"100%%\" \\o/"`,
+	} {
+		if !strings.Contains(string(unit), line) {
+			t.Errorf("Expected unit to contain %q, got:\n%s", line, unit)
+		}
+	}
+}
+
+func TestApplyManifest(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	existing := &database.ServiceRecord{ProjectName: "shop", Port: 18110, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	legacy := &database.ServiceRecord{ProjectName: "legacy", Port: 18111, PocketBaseVersion: "0.22.0", Domain: "example.com", Status: "active"}
+	for _, svc := range []*database.ServiceRecord{existing, legacy} {
+		if err := dbManager.CreateService(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest, err := pkg.ParseManifest([]byte(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := orchestrator.ApplyManifest(ctx, manifest, pkg.ApplyOptions{Prune: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := make(map[string]*pkg.PlanAction)
+	for _, action := range plan.Actions {
+		actions[action.Name] = action
+	}
+	if len(plan.Actions) != 3 || actions["shop"].Action != "update" || actions["blog"].Action != "create" || actions["legacy"].Action != "delete" {
+		t.Fatalf("Unexpected plan: %+v", plan.Actions)
+	}
+
+	var fields []string
+	for _, change := range actions["shop"].Changes {
+		fields = append(fields, change.Field)
+		if change.Field == "env.PB_KEY" && change.To != "(set)" {
+			t.Errorf("Expected environment values to be hidden from the plan, got %+v", change)
+		}
+	}
+	if expected := []string{"port", "flags", "limits", "env.PB_KEY"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected changes to %v, got %v", expected, fields)
+	}
+
+	// A dry run leaves the records alone
+	if services, _ := dbManager.ListServices(ctx); len(services) != 2 {
+		t.Fatalf("Expected a dry run not to create services, got %d", len(services))
+	}
+
+	result, err := orchestrator.ApplyManifest(ctx, manifest, pkg.ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 0 || len(result.Actions) != 2 {
+		t.Fatalf("Expected the create and update to be applied without pruning, got %+v", result.Actions)
+	}
+
+	if _, err := dbManager.GetServiceByName(ctx, "blog"); err != nil {
+		t.Errorf("Expected blog to be created: %v", err)
+	}
+
+	// Without a real host the update cannot pass its health check, so it is rolled back
+	waitForDeployments(t, dbManager)
+
+	rolledBack, err := dbManager.GetService(ctx, existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.Port != 18110 || len(rolledBack.Env) != 0 || rolledBack.Limits.CPUQuota != "" || len(rolledBack.ServeFlags) != 0 {
+		t.Errorf("Expected the failed update to be rolled back, got %+v", rolledBack)
+	}
+
+	reserved, err := dbManager.GetReservedPorts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved[18110] != "shop" || reserved[18120] != "" {
+		t.Errorf("Expected shop to keep its previous port only, got %v", reserved)
+	}
+
+	plan, err = orchestrator.ApplyManifest(ctx, manifest, pkg.ApplyOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range plan.Actions {
+		if expected := map[string]string{"shop": "update", "blog": "unchanged"}[action.Name]; action.Action != expected {
+			t.Errorf("Expected %s to be %s, got %+v", action.Name, expected, action)
+		}
+	}
+
+	// Declared names match recorded services whatever their case
+	renamed := &pkg.Manifest{Services: []pkg.ManifestService{{Name: "SHOP"}, {Name: "Blog"}, {Name: "legacy"}}}
+	plan, err = orchestrator.ApplyManifest(ctx, renamed, pkg.ApplyOptions{Prune: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 3 {
+		t.Fatalf("Expected no creates or deletes, got %+v", plan.Actions)
+	}
+	for _, action := range plan.Actions {
+		if action.Action != "unchanged" || action.ServiceID == "" {
+			t.Errorf("Expected %s to match its recorded service, got %+v", action.Name, action)
+		}
+	}
+
+	// Ports held by another service are rejected
+	conflicting := &pkg.Manifest{Services: []pkg.ManifestService{{Name: "shop", Port: 18111}}}
+	result, err = orchestrator.ApplyManifest(ctx, conflicting, pkg.ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 1 || result.Actions[0].Status != "error" {
+		t.Errorf("Expected the port conflict to fail the update, got %+v", result.Actions[0])
+	}
+}
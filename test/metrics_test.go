@@ -0,0 +1,179 @@
+package validation_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/metrics"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	gauge := metrics.NewFamily("test_up", metrics.TypeGauge, "Whether it is up.\nSecond line.").
+		Add(1, "service", `my"app`).
+		Add(0, "service", "other")
+	empty := metrics.NewFamily("test_empty", metrics.TypeGauge, "Never written.")
+
+	histogram := metrics.NewHistogram("outcome", []float64{10, 1})
+	histogram.Observe("success", 0.5)
+	histogram.Observe("success", 5)
+	histogram.Observe("failure", 20)
+
+	var out strings.Builder
+	if err := metrics.Write(&out, []*metrics.Family{gauge, empty, histogram.Family("test_duration_seconds", "Durations.")}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP test_up Whether it is up.\nSecond line.
+# TYPE test_up gauge
+test_up{service="my\"app"} 1
+test_up{service="other"} 0
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{outcome="failure",le="1"} 0
+test_duration_seconds_bucket{outcome="failure",le="10"} 0
+test_duration_seconds_bucket{outcome="failure",le="+Inf"} 1
+test_duration_seconds_sum{outcome="failure"} 20
+test_duration_seconds_count{outcome="failure"} 1
+test_duration_seconds_bucket{outcome="success",le="1"} 1
+test_duration_seconds_bucket{outcome="success",le="10"} 2
+test_duration_seconds_bucket{outcome="success",le="+Inf"} 2
+test_duration_seconds_sum{outcome="success"} 5.5
+test_duration_seconds_count{outcome="success"} 2
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestReadProcessStats(t *testing.T) {
+	procRoot := t.TempDir()
+	procDir := filepath.Join(procRoot, "777")
+	if err := os.MkdirAll(filepath.Join(procDir, "fd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	status := "Name:\tpocketbase\nVmRSS:\t   20480 kB\nThreads:\t9\n"
+	stat := "777 (pocket base) S 1 777 777 0 -1 4194560 1000 0 0 0 250 50 0 0 20 0 9 0 12345 0 0\n"
+	if err := os.WriteFile(filepath.Join(procDir, "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procDir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	limits := "Limit                     Soft Limit           Hard Limit           Units     \n" +
+		"Max processes             63432                63432                processes \n" +
+		"Max open files            4096                 4096                 files     \n"
+	if err := os.WriteFile(filepath.Join(procDir, "limits"), []byte(limits), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range []string{"0", "1", "2"} {
+		if err := os.Symlink("/dev/null", filepath.Join(procDir, "fd", fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := metrics.ReadProcessStats(procRoot, 777)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats.RSSBytes != 20480*1024 || stats.Threads != 9 || stats.CPUSeconds != 3 || stats.OpenFDs != 3 || stats.MaxOpenFiles != 4096 {
+		t.Errorf("Unexpected process stats: %+v", stats)
+	}
+
+	if _, err := metrics.ReadProcessStats(procRoot, 778); err == nil {
+		t.Error("Expected error for a missing process")
+	}
+}
+
+func TestCollectMetrics(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	svc := &database.ServiceRecord{ProjectName: "metered", Port: 18130, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "inactive"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbManager.CreateHealthCheck(ctx, &database.HealthCheckRecord{ServiceID: svc.ID, HTTPOK: true, LatencyMs: 12.5, Healthy: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := orchestrator.CollectMetrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := metrics.Write(&out, families); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`pockestrator_services{status="inactive"} 1`,
+		`pockestrator_service_up{service="metered"} 0`,
+		`pockestrator_service_healthy{service="metered"} 1`,
+		`pockestrator_service_probe_latency_seconds{service="metered",probe="direct"} 0.0125`,
+		`pockestrator_service_pb_data_bytes{service="metered"} 0`,
+		`pockestrator_deployments_total{outcome="failure"} 0`,
+		`# TYPE go_goroutines gauge`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestCollectMetricsSources(t *testing.T) {
+	// systemd tracks the accounted unit; the plain unit only reports its main PID
+	sudo := fmt.Sprintf(`#!/bin/sh
+case "$3" in
+  accounted-pocketbase.service)
+    printf 'ActiveState=active\nNRestarts=3\nMainPID=%[1]d\nMemoryCurrent=1048576\nCPUUsageNSec=2500000000\n';;
+  *)
+    printf 'ActiveState=active\nNRestarts=0\nMainPID=%[1]d\nMemoryCurrent=[not set]\nCPUUsageNSec=[not set]\n';;
+esac
+`, os.Getpid())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sudo"), []byte(sudo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	env := newTestEnv(t, testOptions{})
+	ctx := context.Background()
+
+	for i, name := range []string{"accounted", "plain"} {
+		svc := &database.ServiceRecord{ProjectName: name, Port: 18130 + i, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "active"}
+		if err := env.DB.CreateService(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	families, err := env.Orchestrator.CollectMetrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := metrics.Write(&out, families); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"# TYPE pockestrator_service_restarts_total counter\n",
+		`pockestrator_service_restarts_total{service="accounted"} 3` + "\n",
+		`pockestrator_service_memory_bytes{service="accounted",source="systemd"} 1.048576e+06` + "\n",
+		`pockestrator_service_cpu_seconds_total{service="accounted",source="systemd"} 2.5` + "\n",
+		`pockestrator_service_memory_bytes{service="plain",source="proc"} `,
+		`pockestrator_service_cpu_seconds_total{service="plain",source="proc"} `,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
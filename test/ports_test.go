@@ -0,0 +1,199 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/ports"
+)
+
+// memoryPortStore is an in-memory ports.Store
+type memoryPortStore struct {
+	mu       sync.Mutex
+	reserved map[int]string
+}
+
+func newMemoryPortStore() *memoryPortStore {
+	return &memoryPortStore{reserved: make(map[int]string)}
+}
+
+func (s *memoryPortStore) GetReservedPorts(ctx context.Context) (map[int]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reserved := make(map[int]string, len(s.reserved))
+	for port, owner := range s.reserved {
+		reserved[port] = owner
+	}
+	return reserved, nil
+}
+
+func (s *memoryPortStore) ReservePort(ctx context.Context, port int, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reserved[port]; ok {
+		return errors.New("duplicate port")
+	}
+	s.reserved[port] = owner
+	return nil
+}
+
+func (s *memoryPortStore) ReleasePort(ctx context.Context, port int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.reserved, port)
+	return nil
+}
+
+// writeFakeProc creates a proc tree where pid 4242 ("nginx") listens on 127.0.0.1:8091
+// and something listens on [::]:8093, while 8092 only has an established connection
+func writeFakeProc(t *testing.T) string {
+	t.Helper()
+
+	procRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procRoot, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tcp := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F9B 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 111 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F9C 0100007F:D431 01 00000000:00000000 00:00000000 00000000     0        0 222 1 0000000000000000 100 0 0 10 0
+`
+	tcp6 := `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F9D 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 333 1 0000000000000000 100 0 0 10 0
+`
+	if err := os.WriteFile(filepath.Join(procRoot, "net", "tcp"), []byte(tcp), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "net", "tcp6"), []byte(tcp6), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fdDir := filepath.Join(procRoot, "4242", "fd")
+	if err := os.MkdirAll(fdDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("socket:[111]", filepath.Join(fdDir, "3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "4242", "comm"), []byte("nginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return procRoot
+}
+
+func TestPortProbe(t *testing.T) {
+	manager := ports.NewManager(nil, newMemoryPortStore())
+	manager.SetProcRoot(writeFakeProc(t))
+
+	conflict, err := manager.Probe(8091)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if conflict == nil || conflict.PID != 4242 || conflict.Process != "nginx" || conflict.Address != "127.0.0.1:8091" {
+		t.Errorf("Expected nginx (pid 4242) on 127.0.0.1:8091, got %+v", conflict)
+	}
+
+	// Established connections are not listeners, and ports must match exactly
+	for _, port := range []int{8092, 809, 80910} {
+		conflict, err := manager.Probe(port)
+		if err != nil || conflict != nil {
+			t.Errorf("Expected port %d to be free, got %+v (%v)", port, conflict, err)
+		}
+	}
+
+	conflict, err = manager.Probe(8093)
+	if err != nil || conflict == nil || conflict.Address != "[0:0:0:0:0:0:0:0]:8093" {
+		t.Errorf("Expected IPv6 listener on 8093, got %+v (%v)", conflict, err)
+	}
+}
+
+func TestPortAllocate(t *testing.T) {
+	store := newMemoryPortStore()
+	store.reserved[8094] = "existing"
+
+	manager := ports.NewManager([]ports.Range{{Start: 8091, End: 8095}}, store)
+	manager.SetProcRoot(writeFakeProc(t))
+	ctx := context.Background()
+
+	// 8091 and 8093 are listening on the host, 8094 is reserved
+	port, err := manager.Allocate(ctx, "first", 0)
+	if err != nil || port != 8092 {
+		t.Fatalf("Expected 8092, got %d (%v)", port, err)
+	}
+
+	port, err = manager.Allocate(ctx, "second", 0)
+	if err != nil || port != 8095 {
+		t.Fatalf("Expected 8095, got %d (%v)", port, err)
+	}
+
+	if _, err := manager.Allocate(ctx, "third", 0); !errors.Is(err, ports.ErrNoPortsAvailable) {
+		t.Errorf("Expected ErrNoPortsAvailable, got %v", err)
+	}
+
+	var reservedErr *ports.ReservedError
+	if _, err := manager.Allocate(ctx, "third", 8094); !errors.As(err, &reservedErr) || reservedErr.Owner != "existing" {
+		t.Errorf("Expected ReservedError owned by existing, got %v", err)
+	}
+
+	var conflictErr *ports.ConflictError
+	if _, err := manager.Allocate(ctx, "third", 8091); !errors.As(err, &conflictErr) || conflictErr.Conflict.Process != "nginx" {
+		t.Errorf("Expected ConflictError from nginx, got %v", err)
+	}
+
+	if port, err := manager.Allocate(ctx, "first", 8092); err != nil || port != 8092 {
+		t.Errorf("Expected owner to keep 8092, got %d (%v)", port, err)
+	}
+
+	if err := manager.Release(ctx, 8092); err != nil {
+		t.Fatal(err)
+	}
+	if port, err := manager.Allocate(ctx, "third", 0); err != nil || port != 8092 {
+		t.Errorf("Expected released port 8092 to be reused, got %d (%v)", port, err)
+	}
+}
+
+func TestPortAdopt(t *testing.T) {
+	store := newMemoryPortStore()
+	store.reserved[8094] = "existing"
+
+	manager := ports.NewManager([]ports.Range{{Start: 8091, End: 8095}}, store)
+	manager.SetProcRoot(writeFakeProc(t))
+	ctx := context.Background()
+
+	// 8091 is listening on the host, which is expected of an instance being taken over
+	if err := manager.Adopt(ctx, "imported", 8091); err != nil || store.reserved[8091] != "imported" {
+		t.Errorf("Expected 8091 to be reserved for imported, got %q (%v)", store.reserved[8091], err)
+	}
+	if err := manager.Adopt(ctx, "imported", 8091); err != nil {
+		t.Errorf("Expected the owner to keep 8091, got %v", err)
+	}
+
+	var reservedErr *ports.ReservedError
+	if err := manager.Adopt(ctx, "imported", 8094); !errors.As(err, &reservedErr) || reservedErr.Owner != "existing" {
+		t.Errorf("Expected ReservedError owned by existing, got %v", err)
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	ranges, err := ports.ParseRanges("8091-8999, 9100")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ranges) != 2 || ranges[0] != (ports.Range{Start: 8091, End: 8999}) || ranges[1] != (ports.Range{Start: 9100, End: 9100}) {
+		t.Errorf("Unexpected ranges: %+v", ranges)
+	}
+
+	for _, spec := range []string{"80-90", "9000-8000", "abc", "8091-70000"} {
+		if _, err := ports.ParseRanges(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package validation_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/service"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestStageAndSwapDataDir(t *testing.T) {
+	baseDir := t.TempDir()
+	closeDB := writeTestDataDir(t, baseDir, "app")
+	manager := service.NewManager(baseDir, t.TempDir(), "")
+	ctx := context.Background()
+
+	archivePath := filepath.Join(t.TempDir(), "backup.zip")
+	if _, err := manager.SnapshotDataDir(ctx, "app", archivePath); err != nil {
+		t.Fatal(err)
+	}
+	closeDB()
+
+	dataDir := filepath.Join(baseDir, "app", "pb_data")
+	if err := os.WriteFile(filepath.Join(dataDir, "marker"), []byte("live"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stagingDir, err := manager.StageRestore(ctx, "app", archivePath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(stagingDir, "storage", "coll", "avatar.png")); err != nil {
+		t.Errorf("Expected storage to be unpacked: %v", err)
+	}
+
+	asideDir, err := manager.SwapDataDir("app", stagingDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "marker")); !os.IsNotExist(err) {
+		t.Error("Expected restored pb_data to replace the live one")
+	}
+	if _, err := os.Stat(filepath.Join(asideDir, "marker")); err != nil {
+		t.Errorf("Expected previous pb_data to be moved aside: %v", err)
+	}
+
+	if err := manager.RevertDataDir("app", asideDir); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dataDir, "marker")); err != nil || string(data) != "live" {
+		t.Errorf("Expected revert to put the previous pb_data back, got %q (%v)", data, err)
+	}
+}
+
+func TestStageRestoreRejectsCorruptDatabase(t *testing.T) {
+	baseDir := t.TempDir()
+	manager := service.NewManager(baseDir, t.TempDir(), "")
+
+	// A pb_data whose data.db is not a SQLite database
+	source := filepath.Join(baseDir, "broken", "pb_data")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "data.db"), []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "broken.zip")
+	if err := manager.ArchiveDirectory(source, archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.StageRestore(context.Background(), "broken", archivePath); err == nil {
+		t.Fatal("Expected corrupt data.db to fail verification")
+	}
+
+	staged, _ := filepath.Glob(filepath.Join(baseDir, "broken", "pb_data.restore-*"))
+	if len(staged) != 0 {
+		t.Errorf("Expected staging directory to be removed, got %v", staged)
+	}
+}
+
+func TestRestoreServiceRejectsBadBackups(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, baseDir, backupDir := env.Orchestrator, env.DB, env.BaseDir, env.BackupDir
+	ctx := context.Background()
+
+	closeDB := writeTestDataDir(t, baseDir, "restored")
+	defer closeDB()
+
+	svc := &database.ServiceRecord{ProjectName: "restored", Port: 18170, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := orchestrator.CreateBackup(ctx, svc.ID, "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the archive after its checksum was recorded
+	if err := os.WriteFile(filepath.Join(backupDir, backup.Path), []byte("truncated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := orchestrator.RestoreService(ctx, svc.ID, &pkg.RestoreRequest{BackupID: backup.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" {
+		t.Errorf("Expected checksum mismatch to fail the restore, got %+v", response)
+	}
+
+	response, err = orchestrator.RestoreService(ctx, svc.ID, &pkg.RestoreRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" {
+		t.Errorf("Expected a request without a backup to fail, got %+v", response)
+	}
+
+	if _, err := os.Stat(filepath.Join(baseDir, "restored", "pb_data", "data.db")); err != nil {
+		t.Errorf("Expected live pb_data to be untouched: %v", err)
+	}
+	aside, _ := filepath.Glob(filepath.Join(baseDir, "restored", "pb_data.*"))
+	if len(aside) != 0 {
+		t.Errorf("Expected no staged or moved-aside directories, got %v", aside)
+	}
+}
@@ -0,0 +1,131 @@
+package validation_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestFindService(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	svc := &database.ServiceRecord{ProjectName: "lookup", Port: 18130, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ref := range []string{"lookup", svc.ID} {
+		found, err := orchestrator.FindService(ctx, ref)
+		if err != nil || found.ID != svc.ID {
+			t.Errorf("Expected %q to find the service, got %+v (%v)", ref, found, err)
+		}
+	}
+
+	if _, err := orchestrator.FindService(ctx, "missing"); err == nil {
+		t.Error("Expected an unknown service to be an error")
+	}
+}
+
+func TestGetVersions(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, baseDir := env.Orchestrator, env.DB, env.BaseDir
+	ctx := context.Background()
+
+	for i, name := range []string{"current", "drifted", "missing"} {
+		svc := &database.ServiceRecord{ProjectName: name, Port: 18140 + i, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+		if err := dbManager.CreateService(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, version := range map[string]string{"current": "0.28.4", "drifted": "0.27.1"} {
+		os.MkdirAll(filepath.Join(baseDir, name), 0755)
+		script := "#!/bin/sh\necho \"pocketbase version " + version + "\"\n"
+		if err := os.WriteFile(filepath.Join(baseDir, name, "pocketbase"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := orchestrator.GetVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Latest == "" || len(report.Services) != 3 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	for _, svc := range report.Services {
+		switch svc.ProjectName {
+		case "current":
+			if svc.Installed != "0.28.4" || svc.Error != "" {
+				t.Errorf("Unexpected version of current: %+v", svc)
+			}
+		case "drifted":
+			if svc.Installed != "0.27.1" || svc.Recorded != "0.28.4" {
+				t.Errorf("Unexpected version of drifted: %+v", svc)
+			}
+		case "missing":
+			if svc.Installed != "" || svc.Error == "" {
+				t.Errorf("Expected a missing binary to be reported, got %+v", svc)
+			}
+		}
+	}
+}
+
+func TestCreateServiceValidatesUnitSettings(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	response, err := orchestrator.CreateService(ctx, &pkg.ServiceRequest{
+		ProjectName:       "settings",
+		PocketBaseVersion: "0.28.4",
+		Port:              18150,
+		ServeFlags:        []string{"--dir=/tmp"},
+		Env:               map[string]string{"A": "x\ny"},
+		Limits:            database.ServiceLimits{MemoryMax: "lots"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var codes []string
+	for _, e := range response.Errors {
+		codes = append(codes, e.Code)
+	}
+	if response.Status != "error" || !reflect.DeepEqual(codes, []string{"MANAGED_FLAG", "INVALID_ENV", "INVALID_LIMITS"}) {
+		t.Errorf("Expected the flag, environment and limits to be rejected, got %+v", response)
+	}
+
+	// The port of a rejected request is not kept
+	if reserved, _ := dbManager.GetReservedPorts(ctx); reserved[18150] != "" {
+		t.Errorf("Expected port 18150 to be free, got %v", reserved)
+	}
+
+	response, err = orchestrator.CreateService(ctx, &pkg.ServiceRequest{
+		ProjectName:       "settings",
+		PocketBaseVersion: "0.28.4",
+		Description:       "created from the admin UI",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "deploying" {
+		t.Fatalf("Expected the service to be created, got %+v", response)
+	}
+
+	created, err := dbManager.GetService(ctx, response.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Description != "created from the admin UI" {
+		t.Errorf("Expected the description to be stored, got %q", created.Description)
+	}
+}
@@ -0,0 +1,312 @@
+package validation_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/storage"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// s3Stub is an in-memory, path-style S3-compatible server that supports just enough of
+// the API for the backup store: PutObject, GetObject, HeadObject, DeleteObject and ListObjectsV2
+type s3Stub struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string]s3StubObject
+}
+
+type s3StubObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+type s3StubListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string   `xml:"Name"`
+	Prefix      string   `xml:"Prefix"`
+	KeyCount    int      `xml:"KeyCount"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Contents    []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func newS3Stub(t *testing.T, bucket string) (*s3Stub, *httptest.Server) {
+	stub := &s3Stub{bucket: bucket, objects: make(map[string]s3StubObject)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+func (s *s3Stub) put(key string, data []byte, modTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = s3StubObject{data: data, modTime: modTime}
+}
+
+func (s *s3Stub) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-access/") {
+		s3StubError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		s3StubError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		prefix := r.URL.Query().Get("prefix")
+		result := s3StubListResult{Name: s.bucket, Prefix: prefix}
+		for objKey, obj := range s.objects {
+			if !strings.HasPrefix(objKey, prefix) {
+				continue
+			}
+			result.Contents = append(result.Contents, struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			}{objKey, int64(len(obj.data)), obj.modTime})
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		result.KeyCount = len(result.Contents)
+
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			s3StubError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[key] = s3StubObject{data: data, modTime: time.Now().UTC()}
+		w.Header().Set("ETag", `"stub"`)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := s.objects[key]
+		if !ok {
+			s3StubError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s3StubError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func s3StubError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code><Message>"+code+"</Message></Error>")
+}
+
+func newTestS3Store(t *testing.T, endpoint string) *storage.S3Store {
+	store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:  endpoint,
+		Bucket:    "backups",
+		AccessKey: "test-access",
+		SecretKey: "test-secret",
+		PathStyle: true,
+		Prefix:    "pockestrator",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// testStore runs the same upload, list, download and delete cycle against any store
+func testStore(t *testing.T, store storage.Store) {
+	ctx := context.Background()
+
+	localPath := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(localPath, []byte("archive contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Upload(ctx, "app/app-1.zip", localPath); err != nil {
+		t.Fatalf("Unexpected upload error: %v", err)
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Error("Expected upload to consume the local file")
+	}
+
+	objects, err := store.List(ctx, "app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "app/app-1.zip" || objects[0].Size != int64(len("archive contents")) {
+		t.Fatalf("Unexpected listing: %+v", objects)
+	}
+	if objects, _ := store.List(ctx, "other/"); len(objects) != 0 {
+		t.Errorf("Expected prefix to filter the listing, got %+v", objects)
+	}
+
+	reader, err := store.Open(ctx, "app/app-1.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "archive contents" {
+		t.Errorf("Expected archive contents, got %q (%v)", data, err)
+	}
+
+	if err := store.Delete(ctx, "app/app-1.zip"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(ctx, "app/app-1.zip"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store := storage.NewLocalStore(filepath.Join(t.TempDir(), "backups"))
+	testStore(t, store)
+
+	if err := store.Delete(context.Background(), "../outside.zip"); err == nil || errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected keys outside the store to be rejected, got %v", err)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	if _, err := storage.NewS3Store(storage.S3Config{Endpoint: "http://127.0.0.1:9000"}); err == nil {
+		t.Error("Expected a missing bucket to be rejected")
+	}
+
+	stub, server := newS3Stub(t, "backups")
+	store := newTestS3Store(t, server.URL)
+
+	localPath := filepath.Join(t.TempDir(), "archive.zip")
+	os.WriteFile(localPath, []byte("prefixed"), 0644)
+	if err := store.Upload(context.Background(), "app/prefixed.zip", localPath); err != nil {
+		t.Fatal(err)
+	}
+	if keys := stub.keys(); len(keys) != 1 || keys[0] != "pockestrator/app/prefixed.zip" {
+		t.Errorf("Expected the key prefix to be applied in the bucket, got %v", keys)
+	}
+	store.Delete(context.Background(), "app/prefixed.zip")
+
+	testStore(t, store)
+}
+
+func TestBackupsToS3(t *testing.T) {
+	stub, server := newS3Stub(t, "backups")
+	env := newTestEnv(t, testOptions{BackupStore: newTestS3Store(t, server.URL)})
+	orchestrator, dbManager, baseDir, backupDir := env.Orchestrator, env.DB, env.BaseDir, env.BackupDir
+	ctx := context.Background()
+
+	closeDB := writeTestDataDir(t, baseDir, "offsite")
+	defer closeDB()
+
+	svc := &database.ServiceRecord{ProjectName: "offsite", Port: 18180, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := orchestrator.CreateBackup(ctx, svc.ID, "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Storage != "s3" || backup.Path != "offsite/"+backup.Filename {
+		t.Errorf("Unexpected backup record: %+v", backup)
+	}
+	if keys := stub.keys(); len(keys) != 1 || keys[0] != "pockestrator/"+backup.Path {
+		t.Errorf("Expected the archive in the bucket, got %v", keys)
+	}
+	if local, _ := filepath.Glob(filepath.Join(backupDir, "*", "*.zip")); len(local) != 0 {
+		t.Errorf("Expected no archives left on local disk, got %v", local)
+	}
+
+	_, reader, err := orchestrator.OpenBackup(ctx, backup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != backup.Checksum {
+		t.Error("Expected the downloaded archive to match the recorded checksum")
+	}
+
+	// The archive downloads and verifies; the restore only fails once it tries to stop the unit
+	response, err := orchestrator.RestoreService(ctx, svc.ID, &pkg.RestoreRequest{BackupID: backup.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Message == "Invalid backup" || response.Message == "Backup failed verification" {
+		t.Errorf("Expected the S3 backup to pass verification, got %+v", response)
+	}
+
+	// An archive left behind by an interrupted backup
+	stray := "pockestrator/offsite/offsite-20200101-000000-000.zip"
+	stub.put(stray, []byte("stray"), time.Now().AddDate(0, 0, -30))
+
+	policy, err := orchestrator.SetBackupPolicy(ctx, svc.ID, &pkg.BackupPolicyRequest{Schedule: "0 3 * * *", RetentionDays: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := orchestrator.ApplyBackupRetention(ctx, policy, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected only the stray archive to be pruned, got %d deleted", deleted)
+	}
+	if keys := stub.keys(); len(keys) != 1 || keys[0] != "pockestrator/"+backup.Path {
+		t.Errorf("Expected the recorded archive to survive retention, got %v", keys)
+	}
+
+	if err := orchestrator.DeleteBackup(ctx, backup.ID); err != nil {
+		t.Fatal(err)
+	}
+	if keys := stub.keys(); len(keys) != 0 {
+		t.Errorf("Expected delete to remove the archive from the bucket, got %v", keys)
+	}
+}
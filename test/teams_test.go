@@ -0,0 +1,279 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+// newTestTeam creates a team with quotas and members
+func newTestTeam(t *testing.T, app *tests.TestApp, name string, maxServices int, maxMemory, maxBackupStorage string, members ...string) *core.Record {
+	t.Helper()
+
+	collection, err := app.FindCollectionByNameOrId("teams")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	team := core.NewRecord(collection)
+	team.Set("name", name)
+	team.Set("members", members)
+	team.Set("max_services", maxServices)
+	team.Set("max_memory", maxMemory)
+	team.Set("max_backup_storage", maxBackupStorage)
+	if err := app.Save(team); err != nil {
+		t.Fatal(err)
+	}
+
+	return team
+}
+
+// createErrorCodes returns the validation error codes of a rejected service creation
+func createErrorCodes(t *testing.T, orchestrator *pkg.Orchestrator, req *pkg.ServiceRequest) []string {
+	t.Helper()
+
+	response, err := orchestrator.CreateService(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" {
+		t.Fatalf("Expected %s to be rejected, got %+v", req.ProjectName, response)
+	}
+
+	codes := make([]string, len(response.Errors))
+	for i, ve := range response.Errors {
+		codes[i] = ve.Code
+	}
+	return codes
+}
+
+func TestTeamQuotas(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, app := env.Orchestrator, env.DB, env.App
+	ctx := context.Background()
+
+	alice := newTestUser(t, app, "alice@example.com", "operator")
+	bob := newTestUser(t, app, "bob@example.com", "operator")
+	team := newTestTeam(t, app, "web", 2, "1G", "", alice.Id)
+
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18180, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id, Team: team.Id, Limits: database.ServiceLimits{MemoryMax: "768M"}}
+	if err := dbManager.CreateService(ctx, shop); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		req      *pkg.ServiceRequest
+		expected string
+	}{
+		{"unknown team", &pkg.ServiceRequest{Team: "missing"}, "INVALID_TEAM"},
+		{"non-member owner", &pkg.ServiceRequest{Owner: bob.Id, Team: team.Id, Limits: database.ServiceLimits{MemoryMax: "128M"}}, "TEAM_MEMBERSHIP"},
+		{"no memory limit", &pkg.ServiceRequest{Owner: alice.Id, Team: team.Id}, "MEMORY_LIMIT_REQUIRED"},
+		{"memory over quota", &pkg.ServiceRequest{Owner: alice.Id, Team: team.Id, Limits: database.ServiceLimits{MemoryMax: "512M"}}, "TEAM_QUOTA_MEMORY"},
+	}
+	for _, tc := range cases {
+		tc.req.ProjectName = "blog"
+		tc.req.PocketBaseVersion = "0.28.4"
+		if codes := createErrorCodes(t, orchestrator, tc.req); len(codes) != 1 || codes[0] != tc.expected {
+			t.Errorf("%s: expected %s, got %v", tc.name, tc.expected, codes)
+		}
+	}
+
+	response, _ := orchestrator.CreateService(ctx, &pkg.ServiceRequest{ProjectName: "blog", PocketBaseVersion: "0.28.4", Owner: alice.Id, Team: team.Id, Limits: database.ServiceLimits{MemoryMax: "512M"}})
+	if !strings.Contains(response.Errors[0].Message, "1.2G of its 1G") {
+		t.Errorf("Expected the message to show the memory the team would use, got %q", response.Errors[0].Message)
+	}
+
+	// Full teams take no more services, and no services can move in
+	blog := &database.ServiceRecord{ProjectName: "blog", Port: 18181, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id, Team: team.Id, Limits: database.ServiceLimits{MemoryMax: "128M"}}
+	wiki := &database.ServiceRecord{ProjectName: "wiki", Port: 18182, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Limits: database.ServiceLimits{MemoryMax: "64M"}}
+	for _, s := range []*database.ServiceRecord{blog, wiki} {
+		if err := dbManager.CreateService(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	codes := createErrorCodes(t, orchestrator, &pkg.ServiceRequest{ProjectName: "docs", PocketBaseVersion: "0.28.4", Owner: alice.Id, Team: team.Id, Limits: database.ServiceLimits{MemoryMax: "64M"}})
+	if len(codes) != 1 || codes[0] != "TEAM_QUOTA_SERVICES" {
+		t.Errorf("Expected a full team to be rejected, got %v", codes)
+	}
+	if err := orchestrator.SetServiceTeam(ctx, wiki.ID, team.Id); !errors.Is(err, pkg.ErrInvalidTeam) {
+		t.Errorf("Expected moving into a full team to be rejected, got %v", err)
+	}
+
+	// A move is checked with the rest of its update, and a rejected update changes nothing
+	response, err := orchestrator.UpdateService(ctx, wiki.ID, &pkg.ServiceUpdateRequest{Port: 18183, Team: &team.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" || response.Errors[0].Code != "TEAM_QUOTA_SERVICES" {
+		t.Errorf("Expected an update moving into a full team to be rejected, got %+v", response)
+	}
+	if current, _ := dbManager.GetService(ctx, wiki.ID); current.Port != 18182 || current.Team != "" {
+		t.Errorf("Expected a rejected update to leave the service alone, got port %d in team %q", current.Port, current.Team)
+	}
+
+	// Raising a limit must still fit the quota
+	response, err = orchestrator.UpdateService(ctx, blog.ID, &pkg.ServiceUpdateRequest{Limits: &database.ServiceLimits{MemoryMax: "512M"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" || response.Errors[0].Code != "TEAM_QUOTA_MEMORY" {
+		t.Errorf("Expected a limit over the quota to be rejected, got %+v", response)
+	}
+
+	if err := orchestrator.SetServiceTeam(ctx, blog.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	response, err = orchestrator.UpdateService(ctx, blog.ID, &pkg.ServiceUpdateRequest{PocketBaseVersion: "latest", Team: &team.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" || response.Errors[0].Code != "INVALID_VERSION_FORMAT" {
+		t.Errorf("Expected an invalid version to be rejected, got %+v", response)
+	}
+	if current, _ := dbManager.GetService(ctx, blog.ID); current.Team != "" {
+		t.Errorf("Expected a rejected update to keep the service out of the team, got %q", current.Team)
+	}
+
+	// A move alone is saved without a deploy
+	response, err = orchestrator.UpdateService(ctx, wiki.ID, &pkg.ServiceUpdateRequest{Team: &team.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" {
+		t.Errorf("Expected wiki to fit once blog left, got %+v", response)
+	}
+	if current, _ := dbManager.GetService(ctx, wiki.ID); current.Team != team.Id || current.Status != "active" {
+		t.Errorf("Expected wiki to move into the team untouched, got team %q with status %s", current.Team, current.Status)
+	}
+
+	// A move saved with a deployed change is kept when the deploy rolls back
+	noTeam := ""
+	response, err = orchestrator.UpdateService(ctx, wiki.ID, &pkg.ServiceUpdateRequest{Port: 18184, Team: &noTeam})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" {
+		t.Fatalf("Expected wiki to leave the team with a new port, got %+v", response)
+	}
+	waitForDeployments(t, dbManager)
+	if current, _ := dbManager.GetService(ctx, wiki.ID); current.Team != "" {
+		t.Errorf("Expected wiki to stay out of the team, got %q", current.Team)
+	}
+}
+
+func TestTeamUsage(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, app := env.Orchestrator, env.DB, env.App
+	ctx := context.Background()
+
+	alice := newTestUser(t, app, "alice@example.com", "operator")
+	team := newTestTeam(t, app, "data", 0, "", "1M", alice.Id)
+
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18185, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id, Team: team.Id, Limits: database.ServiceLimits{MemoryMax: "512M"}}
+	blog := &database.ServiceRecord{ProjectName: "blog", Port: 18186, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id, Team: team.Id}
+	for _, s := range []*database.ServiceRecord{shop, blog} {
+		if err := dbManager.CreateService(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backup := &database.BackupRecord{ServiceID: shop.ID, Filename: "shop.zip", Storage: "local", Path: "shop.zip", Size: 1 << 20, Checksum: strings.Repeat("0", 64), Trigger: "manual"}
+	if err := dbManager.CreateBackup(ctx, backup); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := orchestrator.GetTeamUsage(ctx, team.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Services != 2 || usage.MemoryBytes != 512<<20 || usage.BackupBytes != 1<<20 || usage.MaxBackupBytes != 1<<20 || usage.MaxMemoryBytes != 0 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	// Teams out of backup storage take no more services
+	codes := createErrorCodes(t, orchestrator, &pkg.ServiceRequest{ProjectName: "wiki", PocketBaseVersion: "0.28.4", Owner: alice.Id, Team: team.Id})
+	if len(codes) != 1 || codes[0] != "TEAM_QUOTA_BACKUP_STORAGE" {
+		t.Errorf("Expected a team out of backup storage to be rejected, got %v", codes)
+	}
+}
+
+func TestBackupQuota(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, app := env.Orchestrator, env.DB, env.App
+	ctx := context.Background()
+
+	alice := newTestUser(t, app, "alice@example.com", "operator")
+	team := newTestTeam(t, app, "data", 0, "", "1M", alice.Id)
+
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18187, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id, Team: team.Id}
+	if err := dbManager.CreateService(ctx, shop); err != nil {
+		t.Fatal(err)
+	}
+	closeDB := writeTestDataDir(t, env.BaseDir, "shop")
+	defer closeDB()
+
+	// A backup that leaves no room for another
+	full := &database.BackupRecord{ServiceID: shop.ID, Filename: "full.zip", Storage: "local", Path: "full.zip", Size: 1<<20 - 1, Checksum: strings.Repeat("0", 64), Trigger: "manual"}
+	if err := dbManager.CreateBackup(ctx, full); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := orchestrator.CreateBackup(ctx, shop.ID, "manual"); !errors.Is(err, pkg.ErrBackupQuota) {
+		t.Fatalf("Expected the backup to exceed the quota, got %v", err)
+	}
+	backups, err := dbManager.ListBackups(ctx, shop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("Expected no backup to be recorded, got %d", len(backups))
+	}
+	if staged, _ := os.ReadDir(filepath.Join(env.BackupDir, ".staging")); len(staged) != 0 {
+		t.Errorf("Expected the rejected snapshot to be removed, got %v", staged)
+	}
+
+	// Scheduled backups are held to the same quota
+	if _, err := orchestrator.SetBackupPolicy(ctx, shop.ID, &pkg.BackupPolicyRequest{Schedule: "* * * * *"}); err != nil {
+		t.Fatal(err)
+	}
+	if failed, err := orchestrator.RunScheduledBackups(ctx, time.Now()); err != nil || failed != 1 {
+		t.Errorf("Expected the scheduled backup to fail, got %d (%v)", failed, err)
+	}
+
+	// Deleting backups makes room again
+	if err := dbManager.DeleteBackup(ctx, full.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orchestrator.CreateBackup(ctx, shop.ID, "manual"); err != nil {
+		t.Errorf("Expected the backup to fit once space was freed, got %v", err)
+	}
+
+	// Services bring their backups with them when they move in
+	archive := &database.ServiceRecord{ProjectName: "archive", Port: 18188, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, archive); err != nil {
+		t.Fatal(err)
+	}
+	large := &database.BackupRecord{ServiceID: archive.ID, Filename: "large.zip", Storage: "local", Path: "large.zip", Size: 1 << 20, Checksum: strings.Repeat("0", 64), Trigger: "manual"}
+	if err := dbManager.CreateBackup(ctx, large); err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.SetServiceTeam(ctx, archive.ID, team.Id); !errors.Is(err, pkg.ErrInvalidTeam) || !strings.Contains(err.Error(), "would use") {
+		t.Errorf("Expected the move to exceed the backup quota, got %v", err)
+	}
+	if err := dbManager.DeleteBackup(ctx, large.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.SetServiceTeam(ctx, archive.ID, team.Id); err != nil {
+		t.Errorf("Expected the move to fit without the backup, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+
+	"github.com/tigawanna/pockestrator/internal/auth"
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestAPITokens(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager, app := env.Orchestrator, env.DB, env.App
+	ctx := context.Background()
+
+	alice := newTestUser(t, app, "alice@example.com", "operator")
+	owner := pkg.TokenOwner{Collection: auth.UsersCollection, ID: alice.Id, Email: alice.Email(), Role: auth.RoleOperator}
+
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18170, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active", Owner: alice.Id}
+	blog := &database.ServiceRecord{ProjectName: "blog", Port: 18171, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	for _, s := range []*database.ServiceRecord{shop, blog} {
+		if err := dbManager.CreateService(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	past := time.Now().Add(-time.Hour)
+	for name, req := range map[string]*pkg.TokenRequest{
+		"no name":              {Permissions: []auth.Permission{auth.PermRead}},
+		"no permissions":       {Name: "ci"},
+		"beyond the role":      {Name: "ci", Permissions: []auth.Permission{auth.PermDelete}},
+		"inaccessible service": {Name: "ci", Permissions: []auth.Permission{auth.PermRead}, Services: []string{blog.ID}},
+		"past expiry":          {Name: "ci", Permissions: []auth.Permission{auth.PermRead}, ExpiresAt: &past},
+	} {
+		if _, err := orchestrator.CreateAPIToken(ctx, owner, req); !errors.Is(err, pkg.ErrInvalidToken) {
+			t.Errorf("Expected a token with %s to be rejected, got %v", name, err)
+		}
+	}
+
+	created, err := orchestrator.CreateAPIToken(ctx, owner, &pkg.TokenRequest{
+		Name:        "ci",
+		Permissions: []auth.Permission{auth.PermRead, auth.PermDeploy, auth.PermRead},
+		Services:    []string{shop.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Token, auth.TokenPrefix) || !strings.HasPrefix(created.Token, created.Prefix) || len(created.Permissions) != 2 {
+		t.Errorf("Unexpected token: %+v", created)
+	}
+
+	stored, err := dbManager.GetAPIToken(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Hash == "" || strings.Contains(stored.Hash, created.Token[len(created.Prefix):]) {
+		t.Errorf("Expected only a hash of the token to be stored, got %q", stored.Hash)
+	}
+
+	used, err := orchestrator.AuthenticateAPIToken(ctx, created.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used == nil || used.ID != created.ID || used.LastUsedAt == nil {
+		t.Fatalf("Expected the token to authenticate and record its use, got %+v", used)
+	}
+	if stored, _ := dbManager.GetAPIToken(ctx, created.ID); stored.LastUsedAt == nil {
+		t.Errorf("Expected the last use to be stored")
+	}
+
+	if unknown, err := orchestrator.AuthenticateAPIToken(ctx, created.Token+"0"); err != nil || unknown != nil {
+		t.Errorf("Expected an unknown token not to authenticate, got %+v, %v", unknown, err)
+	}
+
+	// Expired tokens stop working
+	record, err := app.FindRecordById("api_tokens", created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("expires", past)
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	if expired, _ := orchestrator.AuthenticateAPIToken(ctx, created.Token); expired != nil {
+		t.Errorf("Expected an expired token not to authenticate")
+	}
+
+	if tokens, _ := orchestrator.ListAPITokens(ctx, alice.Id); len(tokens) != 1 {
+		t.Errorf("Expected alice to have one token, got %+v", tokens)
+	}
+	if err := orchestrator.RevokeAPIToken(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, _ := orchestrator.ListAPITokens(ctx, ""); len(tokens) != 0 {
+		t.Errorf("Expected revoked tokens to be deleted, got %+v", tokens)
+	}
+}
+
+func TestAPITokenScope(t *testing.T) {
+	admin := newAuthRecord(core.CollectionNameSuperusers, "")
+	scope := &auth.TokenScope{Name: "ci", Permissions: []auth.Permission{auth.PermRead, auth.PermControl}, Services: []string{"shop"}}
+
+	// newEvent authenticates a request with an API token of the scope
+	newEvent := func(t *testing.T) *core.RequestEvent {
+		e := &core.RequestEvent{}
+		e.Request = httptest.NewRequest("GET", "/api/pockestrator/services/shop", nil)
+		e.Request.Header.Set("Authorization", "Bearer "+auth.TokenPrefix+"secret")
+
+		load := auth.LoadAPIToken("/api/pockestrator/", func(e *core.RequestEvent, token string) (*core.Record, *auth.TokenScope, error) {
+			if token != auth.TokenPrefix+"secret" {
+				return nil, nil, nil
+			}
+			return admin, scope, nil
+		})
+		if err := load.Func(e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Auth != admin || auth.TokenScopeOf(e) != scope {
+			t.Fatal("Expected the token to authenticate as its owner")
+		}
+		return e
+	}
+
+	status := func(t *testing.T, handler func(*core.RequestEvent) error) int {
+		err := handler(newEvent(t))
+		var apiErr *router.ApiError
+		if errors.As(err, &apiErr) {
+			return apiErr.Status
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 200
+	}
+
+	grants := func(service string) auth.GrantFunc {
+		return func(e *core.RequestEvent) (string, *auth.Grant, error) { return service, nil, nil }
+	}
+
+	cases := []struct {
+		name     string
+		handler  func(*core.RequestEvent) error
+		expected int
+	}{
+		{"read everything", auth.Require(auth.PermRead).Func, 200},
+		{"deploy beyond the scope", auth.Require(auth.PermDeploy).Func, 403},
+		{"control beyond the services", auth.Require(auth.PermControl).Func, 403},
+		{"control a scoped service", auth.RequireService(auth.PermControl, grants("shop")).Func, 200},
+		{"control another service", auth.RequireService(auth.PermControl, grants("blog")).Func, 403},
+		{"delete a scoped service", auth.RequireService(auth.PermDelete, grants("shop")).Func, 403},
+		{"manage tokens", auth.RejectAPITokens().Func, 403},
+	}
+	for _, tc := range cases {
+		if got := status(t, tc.handler); got != tc.expected {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.expected, got)
+		}
+	}
+
+	// Unknown tokens are rejected, PocketBase auth tokens are left alone
+	e := &core.RequestEvent{}
+	e.Request = httptest.NewRequest("GET", "/api/pockestrator/services", nil)
+	e.Request.Header.Set("Authorization", auth.TokenPrefix+"unknown")
+	load := auth.LoadAPIToken("/api/pockestrator/", func(e *core.RequestEvent, token string) (*core.Record, *auth.TokenScope, error) {
+		return nil, nil, nil
+	})
+	var apiErr *router.ApiError
+	if err := load.Func(e); !errors.As(err, &apiErr) || apiErr.Status != 401 {
+		t.Errorf("Expected an unknown token to be unauthorized, got %v", err)
+	}
+
+	e.Request.Header.Set("Authorization", "eyJhbGciOiJIUzI1NiJ9.e30.sig")
+	if err := load.Func(e); err != nil || e.Auth != nil {
+		t.Errorf("Expected other tokens to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package validation_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+)
+
+func TestUpdateService(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	svc := &database.ServiceRecord{ProjectName: "app", Port: 18140, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	other := &database.ServiceRecord{ProjectName: "other", Port: 18141, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	quoted := &database.ServiceRecord{ProjectName: "quoted", Port: 18144, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	for _, s := range []*database.ServiceRecord{svc, other, quoted} {
+		if err := dbManager.CreateService(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rejected := map[string]struct {
+		req  *pkg.ServiceUpdateRequest
+		code string
+	}{
+		"version":      {&pkg.ServiceUpdateRequest{PocketBaseVersion: "latest"}, "INVALID_VERSION_FORMAT"},
+		"domain":       {&pkg.ServiceUpdateRequest{Domain: "not a domain"}, "INVALID_DOMAIN_FORMAT"},
+		"port range":   {&pkg.ServiceUpdateRequest{Port: 80}, "INVALID_PORT_RANGE"},
+		"port taken":   {&pkg.ServiceUpdateRequest{Port: 18141}, "DUPLICATE_PORT"},
+		"managed flag": {&pkg.ServiceUpdateRequest{ServeFlags: []string{"--http=0.0.0.0:80"}}, "MANAGED_FLAG"},
+		"spaced flag":  {&pkg.ServiceUpdateRequest{ServeFlags: []string{"--dir=/a b"}}, "MANAGED_FLAG"},
+		"line break":   {&pkg.ServiceUpdateRequest{ServeFlags: []string{"--x=a\nb"}}, "INVALID_FLAG"},
+		"env name":     {&pkg.ServiceUpdateRequest{Env: map[string]string{"BAD-NAME": "x"}}, "INVALID_ENV"},
+		"limits":       {&pkg.ServiceUpdateRequest{Limits: &database.ServiceLimits{CPUQuota: "half"}}, "INVALID_LIMITS"},
+	}
+	for name, tc := range rejected {
+		response, err := orchestrator.UpdateService(ctx, svc.ID, tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Status != "error" || len(response.Errors) == 0 || response.Errors[0].Code != tc.code {
+			t.Errorf("%s: expected %s, got %+v", name, tc.code, response)
+		}
+	}
+
+	// Rejected updates leave the record alone
+	unchanged, err := dbManager.GetService(ctx, svc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.Port != 18140 || unchanged.Status != "active" {
+		t.Fatalf("Expected rejected updates not to touch the record, got %+v", unchanged)
+	}
+
+	response, err := orchestrator.UpdateService(ctx, svc.ID, &pkg.ServiceUpdateRequest{Port: 18140, Domain: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" || response.Data.Status != "active" {
+		t.Errorf("Expected an update without changes to be a no-op, got %+v", response)
+	}
+
+	// Services that are being deployed cannot be updated
+	dbManager.UpdateServiceStatus(ctx, other.ID, "deploying")
+	response, err = orchestrator.UpdateService(ctx, other.ID, &pkg.ServiceUpdateRequest{Port: 18143})
+	dbManager.UpdateServiceStatus(ctx, other.ID, "active")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "error" || response.Errors[0].Code != "SERVICE_BUSY" {
+		t.Errorf("Expected an update during a deploy to be rejected, got %+v", response)
+	}
+
+	// Flags with spaces, quotes or specifiers are quoted in the unit, so they are accepted
+	flags := []string{"--x=%h", `--name=a b "c"`}
+	response, err = orchestrator.UpdateService(ctx, quoted.ID, &pkg.ServiceUpdateRequest{ServeFlags: flags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" || !slices.Equal(response.Data.ServeFlags, flags) {
+		t.Errorf("Expected the quoted flags to be accepted, got %+v", response)
+	}
+
+	response, err = orchestrator.UpdateService(ctx, svc.ID, &pkg.ServiceUpdateRequest{Port: 18142, ServeFlags: []string{"--dev"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != "success" || response.Data.Port != 18142 || response.Data.Status != "deploying" {
+		t.Fatalf("Expected the update to start, got %+v", response)
+	}
+
+	// Without a real host the service cannot be restarted, so the record is rolled back
+	waitForDeployments(t, dbManager)
+
+	rolledBack, err := dbManager.GetService(ctx, svc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack.Port != 18140 || len(rolledBack.ServeFlags) != 0 {
+		t.Errorf("Expected the record to be rolled back, got %+v", rolledBack)
+	}
+	if rolledBack.Status != "error" {
+		t.Errorf("Expected a failed rollback to leave the service in error, got %s", rolledBack.Status)
+	}
+
+	reserved, err := dbManager.GetReservedPorts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved[18140] != "app" || reserved[18142] != "" {
+		t.Errorf("Expected only the previous port to stay reserved, got %v", reserved)
+	}
+}
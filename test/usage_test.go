@@ -0,0 +1,72 @@
+package validation_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/internal/service"
+)
+
+func TestDataDirUsage(t *testing.T) {
+	baseDir := t.TempDir()
+	manager := service.NewManager(baseDir, t.TempDir(), "")
+
+	usage, err := manager.DataDirUsage("missing")
+	if err != nil || usage.Total != 0 {
+		t.Errorf("Expected empty usage for a missing pb_data, got %+v (%v)", usage, err)
+	}
+
+	dataDir := filepath.Join(baseDir, "app", "pb_data")
+	files := map[string]int{
+		"data.db":                     4096,
+		"data.db-wal":                 1000,
+		"data.db-shm":                 24,
+		"auxiliary.db":                2048,
+		"auxiliary.db-wal":            100,
+		"storage/coll/rec/avatar.png": 500,
+		"storage/coll/rec/resume.pdf": 300,
+		"backups/pb_backup_2025.zip":  50,
+	}
+	for name, size := range files {
+		path := filepath.Join(dataDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err = manager.DataDirUsage("app")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := service.DataUsage{DataDB: 4096, DataWAL: 1024, AuxiliaryDB: 2048, AuxiliaryWAL: 100, Storage: 800, Other: 50, Total: 8118}
+	if *usage != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *usage)
+	}
+}
+
+func TestGetServiceUsage(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	svc := &database.ServiceRecord{ProjectName: "usage", Port: 18140, PocketBaseVersion: "0.0.1", Domain: "example.com", Status: "inactive"}
+	if err := dbManager.CreateService(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := orchestrator.GetServiceUsage(ctx, svc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.ProjectName != "usage" || usage.Disk == nil || usage.MainPID != 0 || usage.StartedAt != nil {
+		t.Errorf("Expected disk usage only for a service that is not running, got %+v", usage)
+	}
+}
@@ -0,0 +1,341 @@
+package validation_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+
+	"github.com/tigawanna/pockestrator/internal/database"
+	"github.com/tigawanna/pockestrator/pkg"
+	"github.com/tigawanna/pockestrator/pkg/client"
+)
+
+// webhookReceiver is a local HTTP endpoint that records the deliveries it receives and
+// answers with the queued status codes, then 200
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	t.Helper()
+
+	receiver := &webhookReceiver{statuses: statuses}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.received = append(receiver.received, r)
+		receiver.bodies = append(receiver.bodies, body)
+
+		status := http.StatusOK
+		if len(receiver.statuses) > 0 {
+			status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("receiver says no"))
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver
+}
+
+// count returns how many deliveries the receiver got
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+// onlyDelivery returns the single delivery of a webhook
+func onlyDelivery(t *testing.T, orchestrator *pkg.Orchestrator, webhookID string) *database.WebhookDeliveryRecord {
+	t.Helper()
+
+	deliveries, err := orchestrator.ListWebhookDeliveries(context.Background(), webhookID, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected one delivery, got %d", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func TestCreateWebhook(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx := context.Background()
+
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18190, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	if err := dbManager.CreateService(ctx, shop); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []*pkg.WebhookRequest{
+		{URL: "https://hooks.example.com", Events: []pkg.EventType{pkg.EventStatusChanged}},
+		{Name: "chat", URL: "hooks.example.com/x", Events: []pkg.EventType{pkg.EventStatusChanged}},
+		{Name: "chat", URL: "ftp://hooks.example.com", Events: []pkg.EventType{pkg.EventStatusChanged}},
+		{Name: "chat", URL: "https://hooks.example.com"},
+		{Name: "chat", URL: "https://hooks.example.com", Events: []pkg.EventType{"service.exploded"}},
+		{Name: "chat", URL: "https://hooks.example.com", Events: []pkg.EventType{pkg.EventStatusChanged}, Services: []string{"missing"}},
+	}
+	for _, req := range invalid {
+		if _, err := orchestrator.CreateWebhook(ctx, req); !errors.Is(err, pkg.ErrInvalidWebhook) {
+			t.Errorf("Expected %+v to be rejected, got %v", req, err)
+		}
+	}
+
+	// Services can be given by name, and a secret is generated when none is given
+	webhook, err := orchestrator.CreateWebhook(ctx, &pkg.WebhookRequest{Name: "chat", URL: "https://hooks.example.com", Events: []pkg.EventType{pkg.EventStatusChanged}, Services: []string{"shop"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhook.Secret) != 64 || !webhook.Enabled || len(webhook.Services) != 1 || webhook.Services[0] != shop.ID {
+		t.Errorf("Unexpected webhook: %+v", webhook)
+	}
+
+	// The secret is never returned again
+	webhooks, err := orchestrator.ListWebhooks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, _ := json.Marshal(webhooks)
+	if len(webhooks) != 1 || strings.Contains(string(listed), webhook.Secret) {
+		t.Errorf("Expected the listed webhook without its secret, got %s", listed)
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	orchestrator := newTestEnv(t, testOptions{}).Orchestrator
+	ctx := context.Background()
+
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	webhook, err := orchestrator.CreateWebhook(ctx, &pkg.WebhookRequest{Name: "tickets", URL: receiver.URL, Events: []pkg.EventType{pkg.EventStatusChanged}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only subscribed event types are queued
+	event := orchestrator.Events().Publish(pkg.Event{Type: pkg.EventStatusChanged, ServiceID: "abc123", ServiceName: "shop", Status: &pkg.StatusChange{From: "active", To: "error"}})
+	for _, e := range []pkg.Event{event, {Type: pkg.EventBackupCompleted, ServiceID: "abc123"}} {
+		queued, err := orchestrator.EnqueueWebhookDeliveries(ctx, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := map[pkg.EventType]int{pkg.EventStatusChanged: 1}[e.Type]; queued != expected {
+			t.Errorf("Expected %d deliveries for %s, got %d", expected, e.Type, queued)
+		}
+	}
+
+	// A failed attempt is retried after a backoff
+	now := time.Now()
+	if delivered, err := orchestrator.DeliverDueWebhooks(ctx, now); err != nil || delivered != 0 {
+		t.Fatalf("Expected the first attempt to fail, got %d, %v", delivered, err)
+	}
+	delivery := onlyDelivery(t, orchestrator, webhook.ID)
+	if delivery.Status != database.DeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != 500 || !strings.Contains(delivery.Error, "receiver says no") {
+		t.Errorf("Expected a pending delivery recording the failure, got %+v", delivery)
+	}
+	if delivery.NextAttempt == nil || delivery.NextAttempt.Sub(now) < pkg.WebhookRetryDelay(1)-time.Second {
+		t.Errorf("Expected the retry to wait %s, got %v", pkg.WebhookRetryDelay(1), delivery.NextAttempt)
+	}
+
+	orchestrator.DeliverDueWebhooks(ctx, now.Add(pkg.WebhookRetryDelay(1)/2))
+	if receiver.count() != 1 {
+		t.Fatalf("Expected no attempt before the backoff, got %d attempts", receiver.count())
+	}
+
+	if delivered, err := orchestrator.DeliverDueWebhooks(ctx, now.Add(pkg.WebhookRetryDelay(1)+time.Second)); err != nil || delivered != 1 {
+		t.Fatalf("Expected the retry to be delivered, got %d, %v", delivered, err)
+	}
+	delivery = onlyDelivery(t, orchestrator, webhook.ID)
+	if delivery.Status != database.DeliveryDelivered || delivery.Attempts != 2 || delivery.DeliveredAt == nil || delivery.Error != "" {
+		t.Errorf("Expected a delivered delivery, got %+v", delivery)
+	}
+
+	// Receivers can verify the payload with the shared secret
+	req, body := receiver.received[1], receiver.bodies[1]
+	if req.Header.Get(pkg.WebhookSignatureHeader) != pkg.SignWebhookPayload("s3cret", body) {
+		t.Errorf("Expected a valid signature, got %q", req.Header.Get(pkg.WebhookSignatureHeader))
+	}
+	if req.Header.Get(pkg.WebhookEventHeader) != string(pkg.EventStatusChanged) || req.Header.Get(pkg.WebhookDeliveryHeader) != delivery.ID {
+		t.Errorf("Unexpected headers: %v", req.Header)
+	}
+	var payload pkg.Event
+	if err := json.Unmarshal(body, &payload); err != nil || payload.ID != event.ID || payload.Status.To != "error" {
+		t.Errorf("Expected the event as payload, got %s", body)
+	}
+}
+
+func TestWebhookDeliveryFails(t *testing.T) {
+	orchestrator := newTestEnv(t, testOptions{}).Orchestrator
+	ctx := context.Background()
+
+	if pkg.WebhookRetryDelay(1) != 30*time.Second || pkg.WebhookRetryDelay(2) != time.Minute || pkg.WebhookRetryDelay(20) != time.Hour {
+		t.Errorf("Expected exponential backoff capped at an hour")
+	}
+
+	statuses := make([]int, pkg.WebhookMaxAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	receiver := newWebhookReceiver(t, statuses...)
+	webhook, err := orchestrator.CreateWebhook(ctx, &pkg.WebhookRequest{Name: "chat", URL: receiver.URL, Events: []pkg.EventType{pkg.EventHealthChanged}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orchestrator.EnqueueWebhookDeliveries(ctx, &pkg.Event{ID: 7, Type: pkg.EventHealthChanged, ServiceID: "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for attempt := 1; attempt <= pkg.WebhookMaxAttempts; attempt++ {
+		orchestrator.DeliverDueWebhooks(ctx, now)
+		now = now.Add(pkg.WebhookRetryDelay(attempt) + time.Second)
+	}
+
+	delivery := onlyDelivery(t, orchestrator, webhook.ID)
+	if delivery.Status != database.DeliveryFailed || delivery.Attempts != pkg.WebhookMaxAttempts || delivery.NextAttempt != nil || delivery.ResponseStatus != 503 {
+		t.Errorf("Expected the delivery to fail after %d attempts, got %+v", pkg.WebhookMaxAttempts, delivery)
+	}
+
+	orchestrator.DeliverDueWebhooks(ctx, now.Add(24*time.Hour))
+	if receiver.count() != pkg.WebhookMaxAttempts {
+		t.Errorf("Expected no attempts after failing, got %d", receiver.count())
+	}
+	failed, _ := orchestrator.ListWebhookDeliveries(ctx, webhook.ID, database.DeliveryFailed, 0)
+	pending, _ := orchestrator.ListWebhookDeliveries(ctx, webhook.ID, database.DeliveryPending, 0)
+	if len(failed) != 1 || len(pending) != 0 {
+		t.Errorf("Expected the log to filter by status, got %d failed and %d pending", len(failed), len(pending))
+	}
+}
+
+func TestWebhookDeliveryWithoutWebhook(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator := env.Orchestrator
+	ctx := context.Background()
+
+	receiver := newWebhookReceiver(t)
+	gone, err := orchestrator.CreateWebhook(ctx, &pkg.WebhookRequest{Name: "gone", URL: receiver.URL, Events: []pkg.EventType{pkg.EventHealthChanged}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orchestrator.EnqueueWebhookDeliveries(ctx, &pkg.Event{ID: 8, Type: pkg.EventHealthChanged, ServiceID: "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The webhook row disappears without its delivery, so it can no longer be loaded
+	if _, err := env.App.DB().NewQuery("DELETE FROM webhooks WHERE id = {:id}").Bind(dbx.Params{"id": gone.ID}).Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	kept, err := orchestrator.CreateWebhook(ctx, &pkg.WebhookRequest{Name: "kept", URL: receiver.URL, Events: []pkg.EventType{pkg.EventHealthChanged}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orchestrator.EnqueueWebhookDeliveries(ctx, &pkg.Event{ID: 9, Type: pkg.EventHealthChanged, ServiceID: "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Its delivery fails, and the deliveries queued behind it are still sent
+	if delivered, err := orchestrator.DeliverDueWebhooks(ctx, time.Now()); err != nil || delivered != 1 {
+		t.Fatalf("Expected the kept webhook's delivery to be sent, got %d, %v", delivered, err)
+	}
+	if delivery := onlyDelivery(t, orchestrator, gone.ID); delivery.Status != database.DeliveryFailed || delivery.NextAttempt != nil || delivery.Error == "" {
+		t.Errorf("Expected the delivery of the missing webhook to fail, got %+v", delivery)
+	}
+	if delivery := onlyDelivery(t, orchestrator, kept.ID); delivery.Status != database.DeliveryDelivered {
+		t.Errorf("Expected the kept webhook's delivery to be delivered, got %+v", delivery)
+	}
+}
+
+func TestRunWebhooks(t *testing.T) {
+	env := newTestEnv(t, testOptions{})
+	orchestrator, dbManager := env.Orchestrator, env.DB
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiver := newWebhookReceiver(t)
+	shop := &database.ServiceRecord{ProjectName: "shop", Port: 18191, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	blog := &database.ServiceRecord{ProjectName: "blog", Port: 18192, PocketBaseVersion: "0.28.4", Domain: "example.com", Status: "active"}
+	for _, s := range []*database.ServiceRecord{shop, blog} {
+		if err := dbManager.CreateService(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	webhook, err := orchestrator.CreateWebhook(ctx, &pkg.WebhookRequest{Name: "chat", URL: receiver.URL, Events: []pkg.EventType{pkg.EventStatusChanged}, Services: []string{shop.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go orchestrator.RunWebhooks(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	// Events of other services are not sent
+	for _, id := range []string{blog.ID, shop.ID} {
+		if err := dbManager.UpdateServiceStatus(ctx, id, "error"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for receiver.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	delivery := onlyDelivery(t, orchestrator, webhook.ID)
+	if delivery.Status != database.DeliveryDelivered || delivery.ServiceName != "shop" || receiver.count() != 1 {
+		t.Errorf("Expected the shop event to be delivered, got %+v after %d requests", delivery, receiver.count())
+	}
+}
+
+func TestClientWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	server := newAPIStub(t, "secret", map[string]func(w http.ResponseWriter, r *http.Request){
+		"POST /api/pockestrator/webhooks": func(w http.ResponseWriter, r *http.Request) {
+			var req pkg.WebhookRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			writeStubJSON(w, http.StatusOK, map[string]any{"id": "wh1", "name": req.Name, "url": req.URL, "events": req.Events, "enabled": true, "secret": "generated"})
+		},
+		"GET /api/pockestrator/webhooks/wh1/deliveries": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.RawQuery != "limit=5&status=failed" {
+				t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+			}
+			writeStubJSON(w, http.StatusOK, map[string]any{"deliveries": []map[string]any{{"id": "d1", "webhook": "wh1", "status": "failed", "attempts": 8, "payload": map[string]any{"id": 42}}}})
+		},
+	})
+
+	c := client.New(server.URL, "secret")
+
+	webhook, err := c.CreateWebhook(ctx, &pkg.WebhookRequest{Name: "chat", URL: "https://hooks.example.com", Events: []pkg.EventType{pkg.EventStatusChanged}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.ID != "wh1" || webhook.Secret != "generated" || !webhook.Enabled {
+		t.Errorf("Unexpected webhook: %+v", webhook)
+	}
+
+	deliveries, err := c.ListWebhookDeliveries(ctx, "wh1", database.DeliveryFailed, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Attempts != 8 || string(deliveries[0].Payload) != `{"id":42}` {
+		t.Errorf("Unexpected deliveries: %+v", deliveries)
+	}
+}